@@ -0,0 +1,131 @@
+// Package bip322 implements the generic signed message format of BIP322, which proves the
+// ownership of any address (P2WPKH, P2SH-P2WPKH, P2TR, multisig...) by signing a virtual
+// transaction spending an output locked to it, instead of the legacy P2PKH-only format
+// of ECPrivate.SignMessage.
+//
+// The message is committed in the scriptSig of the virtual to_spend transaction, which pays
+// zero to the scriptPubKey of the address. The virtual to_sign transaction spends it and is
+// signed with the normal segwit or taproot digest:
+//   - simple: only the witness stack of to_sign is encoded.
+//   - full: the whole to_sign transaction is encoded.
+//   - proof of funds: full format where to_sign also spends real UTXOs of the address.
+//
+// Signatures are encoded in base64.
+package bip322
+
+import (
+	"encoding/base64"
+	"fmt"
+	"math/big"
+
+	"github.com/mrtnetwork/bitcoin/address"
+	"github.com/mrtnetwork/bitcoin/constant"
+	"github.com/mrtnetwork/bitcoin/digest"
+	"github.com/mrtnetwork/bitcoin/formating"
+	"github.com/mrtnetwork/bitcoin/keypair"
+	"github.com/mrtnetwork/bitcoin/scripts"
+)
+
+// Utxo is an output of the address spent by a proof of funds signature.
+type Utxo struct {
+	// TxHash is the id of the transaction creating the output.
+	TxHash string
+
+	// Vout is the index of the output in the transaction.
+	Vout int
+
+	// Value is the amount of the output in satoshis.
+	Value *big.Int
+}
+
+// Signer holds the address whose ownership is proven and the keys that can spend it.
+type Signer struct {
+	// Address is the address of the signed message.
+	Address address.BitcoinAddress
+
+	// Keys are the private keys of the address. P2PKH, P2WPKH, P2SH-P2WPKH and P2TR addresses
+	// use a single key, multisig addresses one key per required signature.
+	Keys []*keypair.ECPrivate
+
+	// WitnessScript is the multisig script of P2WSH and P2SH-P2WSH addresses.
+	WitnessScript *scripts.Script
+}
+
+var (
+	// the zero txid and the vout of the to_spend input
+	zeroTxId   = formating.BytesToHex(make([]byte, 32))
+	toSpendOut = 0xffffffff
+	// the version of both virtual transactions
+	zeroVersion = []byte{0x00, 0x00, 0x00, 0x00}
+)
+
+// MessageHash returns the BIP340 tagged hash of the message committed by to_spend.
+func MessageHash(message string) []byte {
+	return digest.TaggedHash([]byte(message), "BIP0322-signed-message")
+}
+
+// ToSpend returns the virtual to_spend transaction of the message, paying zero to scriptPubKey.
+func ToSpend(message string, scriptPubKey *scripts.Script) *scripts.BtcTransaction {
+	scriptSig := scripts.NewScript("OP_0", formating.BytesToHex(MessageHash(message)))
+	input := scripts.NewTxInput(zeroTxId, toSpendOut, scriptSig, constant.EMPTY_TX_SEQUENCE)
+	output := scripts.NewTxOutput(big.NewInt(0), scriptPubKey)
+	return scripts.NewBtcTransaction([]*scripts.TxInput{input}, []*scripts.TxOutput{output}, false, constant.DEFAULT_TX_LOCKTIME, zeroVersion)
+}
+
+// ToSign returns the unsigned virtual to_sign transaction spending to_spend and the utxos of a proof of funds.
+func ToSign(toSpend *scripts.BtcTransaction, utxos []Utxo) *scripts.BtcTransaction {
+	inputs := []*scripts.TxInput{scripts.NewTxInput(toSpend.TxId(), 0, constant.EMPTY_TX_SEQUENCE)}
+	for _, utxo := range utxos {
+		inputs = append(inputs, scripts.NewTxInput(utxo.TxHash, utxo.Vout, constant.EMPTY_TX_SEQUENCE))
+	}
+	output := scripts.NewTxOutput(big.NewInt(0), scripts.NewScript("OP_RETURN"))
+	return scripts.NewBtcTransaction(inputs, []*scripts.TxOutput{output}, true, constant.DEFAULT_TX_LOCKTIME, zeroVersion)
+}
+
+// encodeWitness returns the base64 consensus encoding of a witness stack
+func encodeWitness(witness *scripts.TxWitnessInput) string {
+	data := append(formating.EncodeVarint(len(witness.Stack)), witness.ToBytes()...)
+	return base64.StdEncoding.EncodeToString(data)
+}
+
+// decodeWitness parses the consensus encoding of a witness stack, all bytes must be consumed
+func decodeWitness(data []byte) (witness *scripts.TxWitnessInput, err error) {
+	invalid := fmt.Errorf("invalid witness stack")
+	defer func() {
+		if recover() != nil {
+			witness, err = nil, invalid
+		}
+	}()
+	if len(data) == 0 {
+		return nil, invalid
+	}
+	count, cursor := formating.ViToInt(data)
+	stack := []string{}
+	for i := 0; i < count; i++ {
+		if cursor >= len(data) {
+			return nil, invalid
+		}
+		size, sizeCursor := formating.ViToInt(data[cursor:])
+		cursor += sizeCursor
+		if size < 0 || cursor+size > len(data) {
+			return nil, invalid
+		}
+		stack = append(stack, formating.BytesToHex(data[cursor:cursor+size]))
+		cursor += size
+	}
+	if cursor != len(data) {
+		return nil, invalid
+	}
+	return scripts.NewTxWitnessInput(stack...), nil
+}
+
+// decodeTransaction parses a full format signature. The transaction comes from an untrusted
+// party and the parser does not bound-check every field.
+func decodeTransaction(data []byte) (tx *scripts.BtcTransaction, err error) {
+	defer func() {
+		if recover() != nil {
+			tx, err = nil, fmt.Errorf("invalid transaction")
+		}
+	}()
+	return scripts.BtcTransactionFromRaw(formating.BytesToHex(data))
+}
@@ -0,0 +1,159 @@
+package bip322
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"math/big"
+	"sort"
+
+	"github.com/mrtnetwork/bitcoin/constant"
+	"github.com/mrtnetwork/bitcoin/digest"
+	"github.com/mrtnetwork/bitcoin/formating"
+	"github.com/mrtnetwork/bitcoin/scripts"
+)
+
+// SignSimple signs the message and returns the witness stack of to_sign in base64.
+// P2PKH addresses have no witness and must use SignFull or the legacy ECPrivate.SignMessage.
+func (s *Signer) SignSimple(message string) (string, error) {
+	if kindOf(s.Address.ToScriptPubKey().ToBytes()) == p2pkh {
+		return "", fmt.Errorf("simple signatures require a segwit address")
+	}
+	tx, err := s.sign(message, nil)
+	if err != nil {
+		return "", err
+	}
+	return encodeWitness(tx.Witnesses[0]), nil
+}
+
+// SignFull signs the message and returns the whole to_sign transaction in base64.
+func (s *Signer) SignFull(message string) (string, error) {
+	return s.SignProofOfFunds(message, nil)
+}
+
+// SignProofOfFunds signs the message and proves the control of utxos, which must be outputs
+// of the signer address. It returns the whole to_sign transaction in base64.
+func (s *Signer) SignProofOfFunds(message string, utxos []Utxo) (string, error) {
+	tx, err := s.sign(message, utxos)
+	if err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(tx.ToBytes(tx.HasSegwit)), nil
+}
+
+// sign builds to_sign and signs every input
+func (s *Signer) sign(message string, utxos []Utxo) (*scripts.BtcTransaction, error) {
+	if s.Address == nil || len(s.Keys) == 0 {
+		return nil, fmt.Errorf("the signer requires an address and at least one key")
+	}
+	scriptPubKey := s.Address.ToScriptPubKey()
+	tx := ToSign(ToSpend(message, scriptPubKey), utxos)
+	amounts := []*big.Int{big.NewInt(0)}
+	for _, utxo := range utxos {
+		if utxo.Value == nil {
+			return nil, fmt.Errorf("missing value of utxo %s:%d", utxo.TxHash, utxo.Vout)
+		}
+		amounts = append(amounts, utxo.Value)
+	}
+	prevouts := make([]*scripts.Script, len(tx.Inputs))
+	for i := range prevouts {
+		prevouts[i] = scriptPubKey
+	}
+	tx.HasSegwit = kindOf(scriptPubKey.ToBytes()) != p2pkh
+	for i := range tx.Inputs {
+		witness, err := s.signInput(tx, i, prevouts, amounts)
+		if err != nil {
+			return nil, err
+		}
+		tx.Witnesses = append(tx.Witnesses, witness)
+	}
+	return tx, nil
+}
+
+// signInput returns the witness of input index and sets its scriptSig
+func (s *Signer) signInput(tx *scripts.BtcTransaction, index int, prevouts []*scripts.Script, amounts []*big.Int) (*scripts.TxWitnessInput, error) {
+	scriptPubKey := prevouts[index].ToBytes()
+	key := s.Keys[0]
+	pub := key.GetPublic()
+	switch kindOf(scriptPubKey) {
+	case p2pkh:
+		pubHex := pub.ToHex(true)
+		if !bytes.Equal(digest.Hash160(formating.HexToBytes(pubHex)), scriptPubKey[3:23]) {
+			pubHex = pub.ToHex(false)
+			if !bytes.Equal(digest.Hash160(formating.HexToBytes(pubHex)), scriptPubKey[3:23]) {
+				return nil, fmt.Errorf("the key does not belong to the address")
+			}
+		}
+		txDigest := tx.GetTransactionDigest(index, prevouts[index], constant.SIGHASH_ALL)
+		tx.Inputs[index].ScriptSig = scripts.NewScript(key.SingInput(txDigest, constant.SIGHASH_ALL), pubHex)
+		return scripts.NewTxWitnessInput(), nil
+	case p2sh:
+		var redeem *scripts.Script
+		if s.WitnessScript == nil {
+			redeem = pub.ToSegwitAddress().ToScriptPubKey()
+		} else {
+			redeem = scripts.NewScript("OP_0", formating.BytesToHex(digest.SingleHash(s.WitnessScript.ToBytes())))
+		}
+		if !bytes.Equal(digest.Hash160(redeem.ToBytes()), scriptPubKey[2:22]) {
+			return nil, fmt.Errorf("the key or witness script does not belong to the address")
+		}
+		tx.Inputs[index].ScriptSig = scripts.NewScript(redeem.ToHex())
+		return s.signWitnessV0(tx, index, redeem.ToBytes()[2:], amounts[index])
+	case p2wpkh, p2wsh:
+		return s.signWitnessV0(tx, index, scriptPubKey[2:], amounts[index])
+	case p2tr:
+		if pub.ToTaprootAddress().Program().Program != formating.BytesToHex(scriptPubKey[2:]) {
+			return nil, fmt.Errorf("the key does not belong to the address")
+		}
+		txDigest := tx.GetTransactionTaprootDigest(index, prevouts, amounts, 0, scripts.NewScript(), constant.TAPROOT_SIGHASH_ALL)
+		return scripts.NewTxWitnessInput(key.SignTaprootTransaction(txDigest, constant.TAPROOT_SIGHASH_ALL, []interface{}{}, true)), nil
+	}
+	return nil, fmt.Errorf("unsupported address type")
+}
+
+// signWitnessV0 signs a P2WPKH program of 20 bytes or a P2WSH multisig program of 32 bytes
+func (s *Signer) signWitnessV0(tx *scripts.BtcTransaction, index int, program []byte, amount *big.Int) (*scripts.TxWitnessInput, error) {
+	if len(program) == 20 {
+		pub := s.Keys[0].GetPublic()
+		if !bytes.Equal(digest.Hash160(pub.ToCompressedBytes()), program) {
+			return nil, fmt.Errorf("the key does not belong to the address")
+		}
+		txDigest := tx.GetTransactionSegwitDigit(index, pub.ToAddress().ToScriptPubKey(), amount)
+		return scripts.NewTxWitnessInput(s.Keys[0].SingInput(txDigest, constant.SIGHASH_ALL), pub.ToHex()), nil
+	}
+	if s.WitnessScript == nil {
+		return nil, fmt.Errorf("a witness script is required for P2WSH addresses")
+	}
+	witnessScript := s.WitnessScript.ToBytes()
+	if !bytes.Equal(digest.SingleHash(witnessScript), program) {
+		return nil, fmt.Errorf("the witness script does not belong to the address")
+	}
+	required, publicKeys, err := parseMultisig(witnessScript)
+	if err != nil {
+		return nil, err
+	}
+	txDigest := tx.GetTransactionSegwitDigit(index, s.WitnessScript, amount)
+	// CHECKMULTISIG expects the signatures in the order of the keys
+	positions := map[int]string{}
+	for _, key := range s.Keys {
+		for i, publicKey := range publicKeys {
+			if bytes.Equal(publicKey, key.GetPublic().ToCompressedBytes()) {
+				positions[i] = key.SingInput(txDigest, constant.SIGHASH_ALL)
+			}
+		}
+	}
+	if len(positions) < required {
+		return nil, fmt.Errorf("expected %d keys of the witness script, got %d", required, len(positions))
+	}
+	order := []int{}
+	for i := range positions {
+		order = append(order, i)
+	}
+	sort.Ints(order)
+	stack := []string{""}
+	for _, i := range order[:required] {
+		stack = append(stack, positions[i])
+	}
+	stack = append(stack, s.WitnessScript.ToHex())
+	return scripts.NewTxWitnessInput(stack...), nil
+}
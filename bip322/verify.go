@@ -0,0 +1,293 @@
+package bip322
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"math/big"
+	"strings"
+
+	"github.com/mrtnetwork/bitcoin/address"
+	"github.com/mrtnetwork/bitcoin/constant"
+	"github.com/mrtnetwork/bitcoin/digest"
+	"github.com/mrtnetwork/bitcoin/ecc"
+	"github.com/mrtnetwork/bitcoin/formating"
+	"github.com/mrtnetwork/bitcoin/keypair"
+	"github.com/mrtnetwork/bitcoin/scripts"
+)
+
+// outputKind is the type of a scriptPubKey supported by the verifier
+type outputKind int
+
+const (
+	unknown outputKind = iota
+	p2pkh
+	p2sh
+	p2wpkh
+	p2wsh
+	p2tr
+)
+
+// Verify checks a simple, full or legacy (P2PKH only) signature of the message by addr.
+// Full signatures that also spend real outputs must be checked with VerifyProofOfFunds.
+func Verify(message string, addr address.BitcoinAddress, signature string) error {
+	return VerifyProofOfFunds(message, addr, signature, nil)
+}
+
+// VerifyProofOfFunds checks a full signature of the message by addr that also spends utxos,
+// outputs of addr. The caller is responsible for checking that utxos are unspent.
+func VerifyProofOfFunds(message string, addr address.BitcoinAddress, signature string, utxos []Utxo) error {
+	data, err := base64.StdEncoding.DecodeString(signature)
+	if err != nil {
+		return fmt.Errorf("invalid base64 signature")
+	}
+	scriptPubKey := addr.ToScriptPubKey()
+	toSpend := ToSpend(message, scriptPubKey)
+	amounts := []*big.Int{big.NewInt(0)}
+	for _, utxo := range utxos {
+		if utxo.Value == nil {
+			return fmt.Errorf("missing value of utxo %s:%d", utxo.TxHash, utxo.Vout)
+		}
+		amounts = append(amounts, utxo.Value)
+	}
+	kind := kindOf(scriptPubKey.ToBytes())
+	if len(utxos) == 0 {
+		if kind == p2pkh && len(data) == 65 {
+			return verifyLegacy(message, scriptPubKey.ToBytes(), data)
+		}
+		if witness, err := decodeWitness(data); err == nil {
+			tx := ToSign(toSpend, nil)
+			tx.Witnesses = []*scripts.TxWitnessInput{witness}
+			if kind == p2sh {
+				// the scriptSig of nested segwit addresses is not part of simple signatures
+				tx.Inputs[0].ScriptSig = nestedScriptSig(witness.Stack)
+			}
+			return verifyInputs(tx, scriptPubKey, amounts)
+		}
+	}
+	tx, err := decodeTransaction(data)
+	if err != nil {
+		return err
+	}
+	expected := ToSign(toSpend, utxos)
+	if len(tx.Inputs) != len(expected.Inputs) {
+		return fmt.Errorf("expected %d inputs, got %d", len(expected.Inputs), len(tx.Inputs))
+	}
+	for i, input := range tx.Inputs {
+		if !strings.EqualFold(input.TxID, expected.Inputs[i].TxID) || input.TxIndex != expected.Inputs[i].TxIndex {
+			return fmt.Errorf("input %d does not spend the expected output", i)
+		}
+	}
+	if len(tx.Outputs) != 1 || tx.Outputs[0].Amount.Sign() != 0 || !bytes.Equal(tx.Outputs[0].ScriptPubKey.ToBytes(), []byte{0x6a}) {
+		return fmt.Errorf("to_sign must have a single OP_RETURN output of zero")
+	}
+	return verifyInputs(tx, scriptPubKey, amounts)
+}
+
+// verifyInputs checks the signatures of every input of to_sign, all spending scriptPubKey
+func verifyInputs(tx *scripts.BtcTransaction, scriptPubKey *scripts.Script, amounts []*big.Int) error {
+	prevouts := make([]*scripts.Script, len(tx.Inputs))
+	for i := range prevouts {
+		prevouts[i] = scriptPubKey
+	}
+	for i := range tx.Inputs {
+		if err := verifyInput(tx, i, prevouts, amounts); err != nil {
+			return fmt.Errorf("input %d: %v", i, err)
+		}
+	}
+	return nil
+}
+
+func verifyInput(tx *scripts.BtcTransaction, index int, prevouts []*scripts.Script, amounts []*big.Int) error {
+	scriptPubKey := prevouts[index].ToBytes()
+	stack := []string{}
+	if index < len(tx.Witnesses) {
+		stack = tx.Witnesses[index].Stack
+	}
+	scriptSig := tx.Inputs[index].ScriptSig.Script
+	switch kindOf(scriptPubKey) {
+	case p2pkh:
+		if len(stack) != 0 || len(scriptSig) != 2 {
+			return fmt.Errorf("invalid P2PKH scriptSig")
+		}
+		signature, _ := pushedData(scriptSig[0])
+		publicKey, _ := pushedData(scriptSig[1])
+		if !bytes.Equal(digest.Hash160(publicKey), scriptPubKey[3:23]) {
+			return fmt.Errorf("the public key does not belong to the address")
+		}
+		return checkSignature(tx.GetTransactionDigest(index, prevouts[index], constant.SIGHASH_ALL), publicKey, signature)
+	case p2sh:
+		if len(scriptSig) != 1 {
+			return fmt.Errorf("invalid P2SH scriptSig")
+		}
+		redeem, _ := pushedData(scriptSig[0])
+		if !bytes.Equal(digest.Hash160(redeem), scriptPubKey[2:22]) {
+			return fmt.Errorf("the redeem script does not belong to the address")
+		}
+		if kind := kindOf(redeem); kind != p2wpkh && kind != p2wsh {
+			return fmt.Errorf("only nested segwit P2SH addresses are supported")
+		}
+		return verifyWitnessV0(tx, index, redeem[2:], stack, amounts[index])
+	case p2wpkh, p2wsh:
+		if len(scriptSig) != 0 {
+			return fmt.Errorf("segwit inputs must have an empty scriptSig")
+		}
+		return verifyWitnessV0(tx, index, scriptPubKey[2:], stack, amounts[index])
+	case p2tr:
+		if len(scriptSig) != 0 {
+			return fmt.Errorf("segwit inputs must have an empty scriptSig")
+		}
+		if len(stack) != 1 {
+			return fmt.Errorf("only key path spends of P2TR addresses are supported")
+		}
+		signature := formating.HexToBytes(stack[0])
+		sighash := constant.TAPROOT_SIGHASH_ALL
+		if len(signature) == 65 && signature[64] == constant.SIGHASH_ALL {
+			sighash = constant.SIGHASH_ALL
+		} else if len(signature) != 64 {
+			return fmt.Errorf("only SIGHASH_ALL signatures are accepted")
+		}
+		txDigest := tx.GetTransactionTaprootDigest(index, prevouts, amounts, 0, scripts.NewScript(), sighash)
+		if !ecc.VerifySchnorr(txDigest, scriptPubKey[2:], signature[:64]) {
+			return fmt.Errorf("invalid signature")
+		}
+		return nil
+	}
+	return fmt.Errorf("unsupported address type")
+}
+
+// verifyWitnessV0 checks the witness of a P2WPKH program of 20 bytes or a P2WSH multisig program of 32 bytes
+func verifyWitnessV0(tx *scripts.BtcTransaction, index int, program []byte, stack []string, amount *big.Int) error {
+	if len(program) == 20 {
+		if len(stack) != 2 {
+			return fmt.Errorf("invalid P2WPKH witness")
+		}
+		publicKey := formating.HexToBytes(stack[1])
+		if !bytes.Equal(digest.Hash160(publicKey), program) {
+			return fmt.Errorf("the public key does not belong to the address")
+		}
+		scriptCode := scripts.NewScript("OP_DUP", "OP_HASH160", formating.BytesToHex(program), "OP_EQUALVERIFY", "OP_CHECKSIG")
+		return checkSignature(tx.GetTransactionSegwitDigit(index, scriptCode, amount), publicKey, formating.HexToBytes(stack[0]))
+	}
+	if len(stack) < 2 {
+		return fmt.Errorf("invalid P2WSH witness")
+	}
+	witnessScript := formating.HexToBytes(stack[len(stack)-1])
+	if !bytes.Equal(digest.SingleHash(witnessScript), program) {
+		return fmt.Errorf("the witness script does not belong to the address")
+	}
+	required, publicKeys, err := parseMultisig(witnessScript)
+	if err != nil {
+		return err
+	}
+	if len(stack) != required+2 || stack[0] != "" {
+		return fmt.Errorf("expected %d signatures", required)
+	}
+	script, err := scripts.ScriptFromRaw(witnessScript, true)
+	if err != nil || !bytes.Equal(script.ToBytes(), witnessScript) {
+		return fmt.Errorf("invalid witness script")
+	}
+	txDigest := tx.GetTransactionSegwitDigit(index, script, amount)
+	// like CHECKMULTISIG, every signature must match a key following the key of the previous one
+	key := 0
+	for _, signature := range stack[1 : required+1] {
+		for key < len(publicKeys) && checkSignature(txDigest, publicKeys[key], formating.HexToBytes(signature)) != nil {
+			key++
+		}
+		if key == len(publicKeys) {
+			return fmt.Errorf("invalid signature")
+		}
+		key++
+	}
+	return nil
+}
+
+// verifyLegacy checks a signature of ECPrivate.SignMessage against a P2PKH scriptPubKey
+func verifyLegacy(message string, scriptPubKey []byte, signature []byte) error {
+	if signature[0] < 27 || signature[0] > 34 {
+		return fmt.Errorf("invalid legacy signature")
+	}
+	pub := keypair.GetSignaturePublic(message, signature)
+	if pub == nil {
+		return fmt.Errorf("invalid legacy signature")
+	}
+	if !strings.EqualFold(pub.ToHash160(signature[0] >= 31), formating.BytesToHex(scriptPubKey[3:23])) {
+		return fmt.Errorf("invalid signature")
+	}
+	return nil
+}
+
+// checkSignature verifies a DER signature with a SIGHASH_ALL byte
+func checkSignature(txDigest []byte, publicKey []byte, signature []byte) error {
+	if len(signature) == 0 || signature[len(signature)-1] != constant.SIGHASH_ALL {
+		return fmt.Errorf("only SIGHASH_ALL signatures are accepted")
+	}
+	pub, err := keypair.NewECPPublicFromBytes(publicKey)
+	if err != nil {
+		return fmt.Errorf("invalid public key")
+	}
+	if !ecc.VerifyDER(txDigest, pub.ToCompressedBytes(), signature) {
+		return fmt.Errorf("invalid signature")
+	}
+	return nil
+}
+
+// nestedScriptSig returns the scriptSig of a P2SH-P2WPKH or P2SH-P2WSH input with the given witness stack
+func nestedScriptSig(stack []string) *scripts.Script {
+	if len(stack) == 0 {
+		return scripts.NewScript()
+	}
+	last := formating.HexToBytes(stack[len(stack)-1])
+	if len(stack) == 2 && len(last) == 33 {
+		return scripts.NewScript(formating.BytesToHex(append([]byte{0x00, 0x14}, digest.Hash160(last)...)))
+	}
+	return scripts.NewScript(formating.BytesToHex(append([]byte{0x00, 0x20}, digest.SingleHash(last)...)))
+}
+
+// parseMultisig returns the required signatures and the public keys of an OP_m <keys> OP_n OP_CHECKMULTISIG script
+func parseMultisig(script []byte) (int, [][]byte, error) {
+	invalid := fmt.Errorf("only multisig witness scripts are supported")
+	if len(script) < 37 || script[len(script)-1] != 0xae {
+		return 0, nil, invalid
+	}
+	required := int(script[0]) - 0x50
+	total := int(script[len(script)-2]) - 0x50
+	if required < 1 || total < required || total > 16 || len(script) != 3+34*total {
+		return 0, nil, invalid
+	}
+	publicKeys := make([][]byte, total)
+	for i := range publicKeys {
+		offset := 1 + 34*i
+		if script[offset] != 33 {
+			return 0, nil, invalid
+		}
+		publicKeys[i] = script[offset+1 : offset+34]
+	}
+	return required, publicKeys, nil
+}
+
+// pushedData returns the bytes of a data push of a parsed script
+func pushedData(item interface{}) ([]byte, bool) {
+	data, ok := item.(string)
+	if !ok || strings.HasPrefix(data, "OP_") {
+		return nil, false
+	}
+	b, err := formating.HexToBytesCatch(data)
+	return b, err == nil
+}
+
+func kindOf(script []byte) outputKind {
+	switch {
+	case len(script) == 25 && script[0] == 0x76 && script[1] == 0xa9 && script[2] == 0x14 && script[23] == 0x88 && script[24] == 0xac:
+		return p2pkh
+	case len(script) == 23 && script[0] == 0xa9 && script[1] == 0x14 && script[22] == 0x87:
+		return p2sh
+	case len(script) == 22 && script[0] == 0x00 && script[1] == 0x14:
+		return p2wpkh
+	case len(script) == 34 && script[0] == 0x00 && script[1] == 0x20:
+		return p2wsh
+	case len(script) == 34 && script[0] == 0x51 && script[1] == 0x20:
+		return p2tr
+	}
+	return unknown
+}
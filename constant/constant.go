@@ -217,3 +217,10 @@ const (
 	P2WSH_ADDRESS_V0  = "p2wshv0"
 	P2TR_ADDRESS_V1   = "p2trv1"
 )
+
+// Provably unspendable internal key (BIP341 "H" point) used for taproot
+// outputs that must only be spent through the script path
+const TAPROOT_UNSPENDABLE_PUBLIC_KEY = "0250929b74c1a04954b78b4b6035e97a5e078a5a0f28ec96d547bfee9ace803ac0"
+
+// Lock times below this value are interpreted as block heights, above as unix timestamps
+const LOCKTIME_THRESHOLD = 500000000
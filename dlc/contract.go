@@ -0,0 +1,305 @@
+// Discreet Log Contracts (DLC): bitcoin settled contracts on the outcome of an event attested by an oracle.
+//
+// Both parties lock their collateral in a 2-of-2 P2WSH funding output. Before funding, they
+// exchange ECDSA adaptor signatures of every contract execution transaction (CET), each
+// encrypted with the oracle attestation point of the CET's outcome. Once the oracle attests
+// the outcome, its signature decrypts the counterparty's adaptor signature of the matching CET,
+// and either party can close the contract. A refund transaction, valid after a lock time,
+// returns the collateral if the oracle never attests.
+package dlc
+
+import (
+	"fmt"
+	"math/big"
+	"sort"
+	"strings"
+
+	"github.com/mrtnetwork/bitcoin/address"
+	"github.com/mrtnetwork/bitcoin/constant"
+	"github.com/mrtnetwork/bitcoin/formating"
+	"github.com/mrtnetwork/bitcoin/keypair"
+	"github.com/mrtnetwork/bitcoin/scripts"
+)
+
+// DustLimit is the smallest payout output a CET or refund transaction creates; a smaller payout is left to fees.
+var DustLimit = big.NewInt(1000)
+
+// Party is one side of the contract.
+type Party struct {
+	// FundingPublicKey is the public key of the party in the 2-of-2 funding output.
+	FundingPublicKey string
+
+	// PayoutAddress receives the payout of the party.
+	PayoutAddress address.BitcoinAddress
+
+	// Collateral is the amount the party locks in the funding output.
+	Collateral *big.Int
+}
+
+// EnumeratedOutcome is the payout of one outcome of an enumerated event.
+type EnumeratedOutcome struct {
+	// Outcome is the outcome as attested by the oracle.
+	Outcome string
+
+	// OfferPayout is the amount paid to the offer party, the accept party receives the rest.
+	OfferPayout *big.Int
+}
+
+// NumericRange is the payout of every value between Start and End (inclusive) of a numeric event.
+type NumericRange struct {
+	Start int
+	End   int
+
+	// OfferPayout is the amount paid to the offer party, the accept party receives the rest.
+	OfferPayout *big.Int
+}
+
+// Cet is a contract execution transaction, paying for the outcomes it covers.
+type Cet struct {
+	// Outcomes is the attested outcome of an enumerated event, or the binary digit prefix of the
+	// values covered by the CET for a numeric event.
+	Outcomes []string
+
+	// OfferPayout and AcceptPayout are the payouts of each party before fees.
+	OfferPayout  *big.Int
+	AcceptPayout *big.Int
+
+	// AdaptorPoint is the compressed oracle attestation point of Outcomes in hexadecimal.
+	AdaptorPoint string
+}
+
+// Contract represents a DLC between an offer party and an accept party.
+type Contract struct {
+	Offer  Party
+	Accept Party
+
+	// Oracle is the announcement of the oracle attesting the event.
+	Oracle *OracleAnnouncement
+
+	// Cets are the contract execution transactions, covering every outcome.
+	Cets []*Cet
+
+	// FundingScript is the 2-of-2 multisig witness script of the funding output.
+	FundingScript *scripts.Script
+
+	// FundingAddress is the P2WSH address of the funding output.
+	FundingAddress address.BitcoinAddress
+
+	// FundingTxHash and FundingVout identify the funding output, see SetFundingOutpoint.
+	FundingTxHash string
+	FundingVout   int
+
+	// RefundLockTime is the absolute lock time (block height or unix time) of the refund transaction.
+	RefundLockTime int
+
+	// Fee is the fee of every CET and of the refund transaction, each party pays half.
+	Fee *big.Int
+}
+
+// NewEnumeratedContract creates a contract on an event with a fixed set of outcomes, one CET per outcome.
+// The oracle announcement must have a single nonce.
+func NewEnumeratedContract(offer Party, accept Party, oracle *OracleAnnouncement, outcomes []EnumeratedOutcome, refundLockTime int, fee *big.Int) (*Contract, error) {
+	if len(oracle.Nonces) != 1 {
+		return nil, fmt.Errorf("an enumerated event must be announced with a single nonce")
+	}
+	contract, err := newContract(offer, accept, oracle, refundLockTime, fee)
+	if err != nil {
+		return nil, err
+	}
+	seen := map[string]bool{}
+	for _, outcome := range outcomes {
+		if seen[outcome.Outcome] {
+			return nil, fmt.Errorf("duplicate outcome %s", outcome.Outcome)
+		}
+		seen[outcome.Outcome] = true
+		if err := contract.addCet([]string{outcome.Outcome}, outcome.OfferPayout); err != nil {
+			return nil, err
+		}
+	}
+	if len(contract.Cets) == 0 {
+		return nil, fmt.Errorf("at least one outcome is required")
+	}
+	return contract, nil
+}
+
+// NewNumericContract creates a contract on a numeric event attested digit by digit in base 2.
+// The ranges must cover every value from 0 to 2^n - 1 without overlap, where n is the number
+// of nonces of the announcement. Each range is split into the fewest digit prefixes, one CET per prefix.
+func NewNumericContract(offer Party, accept Party, oracle *OracleAnnouncement, ranges []NumericRange, refundLockTime int, fee *big.Int) (*Contract, error) {
+	nbDigits := len(oracle.Nonces)
+	if nbDigits < 1 || nbDigits > 30 {
+		return nil, fmt.Errorf("a numeric event must be announced with 1 to 30 nonces")
+	}
+	contract, err := newContract(offer, accept, oracle, refundLockTime, fee)
+	if err != nil {
+		return nil, err
+	}
+	sorted := make([]NumericRange, len(ranges))
+	copy(sorted, ranges)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Start < sorted[j].Start })
+	next := 0
+	for _, r := range sorted {
+		if r.Start != next || r.End < r.Start {
+			return nil, fmt.Errorf("the ranges must cover every value without overlap, expected a range starting at %d", next)
+		}
+		for _, prefix := range digitPrefixes(r.Start, r.End, nbDigits) {
+			if err := contract.addCet(prefix, r.OfferPayout); err != nil {
+				return nil, err
+			}
+		}
+		next = r.End + 1
+	}
+	if next != 1<<nbDigits {
+		return nil, fmt.Errorf("the ranges must cover every value up to %d", 1<<nbDigits-1)
+	}
+	return contract, nil
+}
+
+// newContract validates the parties and creates the funding script
+func newContract(offer Party, accept Party, oracle *OracleAnnouncement, refundLockTime int, fee *big.Int) (*Contract, error) {
+	if refundLockTime < 1 || refundLockTime > 0xffffffff {
+		return nil, fmt.Errorf("lock time should be between 1 and 4294967295")
+	}
+	if fee == nil || fee.Sign() < 0 {
+		return nil, fmt.Errorf("invalid fee")
+	}
+	keys := make([]string, 2)
+	for i, party := range []*Party{&offer, &accept} {
+		if party.Collateral == nil || party.Collateral.Sign() < 0 || party.PayoutAddress == nil {
+			return nil, fmt.Errorf("invalid collateral or payout address")
+		}
+		pub, err := keypair.NewECPPublicFromHex(party.FundingPublicKey)
+		if err != nil {
+			return nil, err
+		}
+		party.FundingPublicKey = pub.ToHex()
+		keys[i] = party.FundingPublicKey
+	}
+	if keys[0] == keys[1] {
+		return nil, fmt.Errorf("the parties must use different funding keys")
+	}
+	sort.Strings(keys)
+	contract := &Contract{
+		Offer:          offer,
+		Accept:         accept,
+		Oracle:         oracle,
+		FundingScript:  scripts.NewScript("OP_2", keys[0], keys[1], "OP_2", "OP_CHECKMULTISIG"),
+		RefundLockTime: refundLockTime,
+		Fee:            fee,
+	}
+	if new(big.Int).Sub(contract.FundingAmount(), fee).Cmp(DustLimit) < 0 {
+		return nil, fmt.Errorf("the collateral does not cover the fee")
+	}
+	addr, err := address.P2WSHAddresssFromScript(contract.FundingScript)
+	if err != nil {
+		return nil, err
+	}
+	contract.FundingAddress = addr
+	return contract, nil
+}
+
+func (c *Contract) addCet(outcomes []string, offerPayout *big.Int) error {
+	total := c.FundingAmount()
+	if offerPayout == nil || offerPayout.Sign() < 0 || offerPayout.Cmp(total) > 0 {
+		return fmt.Errorf("the payout of outcome %s must be between 0 and the total collateral", strings.Join(outcomes, ""))
+	}
+	point, err := c.Oracle.AdaptorPoint(outcomes)
+	if err != nil {
+		return err
+	}
+	c.Cets = append(c.Cets, &Cet{
+		Outcomes:     outcomes,
+		OfferPayout:  new(big.Int).Set(offerPayout),
+		AcceptPayout: new(big.Int).Sub(total, offerPayout),
+		AdaptorPoint: formating.BytesToHex(point),
+	})
+	return nil
+}
+
+// digitPrefixes splits [start, end] into the fewest aligned blocks of 2^k values, each one
+// identified by the nbDigits - k most significant binary digits its values share
+func digitPrefixes(start int, end int, nbDigits int) [][]string {
+	var prefixes [][]string
+	for start <= end {
+		size := 1
+		for start%(size*2) == 0 && start+size*2-1 <= end && size*2 <= 1<<nbDigits {
+			size *= 2
+		}
+		digits, _ := NumericOutcomes(start, nbDigits)
+		free := 0
+		for s := size; s > 1; s /= 2 {
+			free++
+		}
+		if free == nbDigits {
+			// a single CET pays for every value, commit to the first digit with both CETs
+			prefixes = append(prefixes, []string{"0"}, []string{"1"})
+		} else {
+			prefixes = append(prefixes, digits[:nbDigits-free])
+		}
+		start += size
+	}
+	return prefixes
+}
+
+// FundingAmount returns the value of the funding output, the sum of both collaterals.
+func (c *Contract) FundingAmount() *big.Int {
+	return new(big.Int).Add(c.Offer.Collateral, c.Accept.Collateral)
+}
+
+// SetFundingOutpoint sets the funding output once the funding transaction is built. The funding
+// transaction pays FundingAmount to FundingAddress and can be built with BitcoinTransactionBuilder;
+// its inputs must be SegWit so the transaction id is known before it is signed.
+func (c *Contract) SetFundingOutpoint(txHash string, vout int) {
+	c.FundingTxHash = txHash
+	c.FundingVout = vout
+}
+
+// CetTransaction returns the unsigned contract execution transaction at index.
+func (c *Contract) CetTransaction(index int) (*scripts.BtcTransaction, error) {
+	if index < 0 || index >= len(c.Cets) {
+		return nil, fmt.Errorf("CET index out of range")
+	}
+	cet := c.Cets[index]
+	return c.spendFunding(cet.OfferPayout, cet.AcceptPayout, nil)
+}
+
+// RefundTransaction returns the unsigned refund transaction, valid after RefundLockTime,
+// that returns the collateral of each party.
+func (c *Contract) RefundTransaction() (*scripts.BtcTransaction, error) {
+	return c.spendFunding(c.Offer.Collateral, c.Accept.Collateral, formating.PackUint32LE(uint32(c.RefundLockTime)))
+}
+
+// spendFunding creates a transaction spending the funding output to both parties, each party paying half of the fee
+func (c *Contract) spendFunding(offerPayout *big.Int, acceptPayout *big.Int, lockTime []byte) (*scripts.BtcTransaction, error) {
+	if c.FundingTxHash == "" {
+		return nil, fmt.Errorf("the funding outpoint is not set")
+	}
+	offerFee := new(big.Int).Rsh(c.Fee, 1)
+	acceptFee := new(big.Int).Sub(c.Fee, offerFee)
+	offerOut := new(big.Int).Sub(offerPayout, offerFee)
+	acceptOut := new(big.Int).Sub(acceptPayout, acceptFee)
+	// a party whose payout does not cover its share of the fee leaves it to the other party
+	if offerOut.Cmp(DustLimit) < 0 {
+		offerOut = big.NewInt(0)
+		acceptOut = new(big.Int).Sub(acceptPayout, c.Fee)
+	} else if acceptOut.Cmp(DustLimit) < 0 {
+		acceptOut = big.NewInt(0)
+		offerOut = new(big.Int).Sub(offerPayout, c.Fee)
+	}
+	var outputs []*scripts.TxOutput
+	if offerOut.Cmp(DustLimit) >= 0 {
+		outputs = append(outputs, scripts.NewTxOutput(offerOut, c.Offer.PayoutAddress.ToScriptPubKey()))
+	}
+	if acceptOut.Cmp(DustLimit) >= 0 {
+		outputs = append(outputs, scripts.NewTxOutput(acceptOut, c.Accept.PayoutAddress.ToScriptPubKey()))
+	}
+	if len(outputs) == 0 {
+		return nil, fmt.Errorf("the payouts do not cover the fee")
+	}
+	txIn := scripts.NewTxInput(c.FundingTxHash, c.FundingVout)
+	if lockTime == nil {
+		return scripts.NewBtcTransaction([]*scripts.TxInput{txIn}, outputs, true), nil
+	}
+	txIn.Sequence = constant.ABSOLUTE_TIMELOCK_SEQUENCE
+	return scripts.NewBtcTransaction([]*scripts.TxInput{txIn}, outputs, true, lockTime), nil
+}
@@ -0,0 +1,156 @@
+package dlc
+
+import (
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+
+	"github.com/mrtnetwork/bitcoin/digest"
+	"github.com/mrtnetwork/bitcoin/ecc"
+	"github.com/mrtnetwork/bitcoin/formating"
+)
+
+// OracleAnnouncement is published by an oracle before the event: its x-only public key and
+// the x-only nonce points it commits to use for the attestation. Enumerated events use one nonce,
+// numeric events use one nonce per binary digit of the outcome, most significant digit first.
+type OracleAnnouncement struct {
+	// PublicKey is the 32 bytes x-only public key of the oracle in hexadecimal.
+	PublicKey string
+
+	// Nonces are the 32 bytes x-only nonce points in hexadecimal.
+	Nonces []string
+}
+
+// OracleAttestation is published by the oracle once the outcome is known. Signatures[i] is the
+// BIP340 signature of Outcomes[i] with the nonce Nonces[i] of the announcement.
+type OracleAttestation struct {
+	// Outcomes are the attested outcomes, one per nonce.
+	Outcomes []string
+
+	// Signatures are the 64 bytes BIP340 signatures in hexadecimal.
+	Signatures []string
+}
+
+// OutcomeMessage returns the 32 bytes message an oracle signs for an outcome.
+func OutcomeMessage(outcome string) []byte {
+	return digest.TaggedHash([]byte(outcome), "DLC/oracle/attestation/v0")
+}
+
+// NumericOutcomes returns the binary digits of value, one outcome per digit, as attested by
+// a numeric oracle with nbDigits nonces.
+func NumericOutcomes(value int, nbDigits int) ([]string, error) {
+	if nbDigits < 1 || nbDigits > 30 || value < 0 || value >= 1<<nbDigits {
+		return nil, fmt.Errorf("value %d cannot be represented with %d digits", value, nbDigits)
+	}
+	outcomes := make([]string, nbDigits)
+	for i := 0; i < nbDigits; i++ {
+		outcomes[i] = strconv.Itoa((value >> (nbDigits - 1 - i)) & 1)
+	}
+	return outcomes, nil
+}
+
+// NewOracleAnnouncement creates the announcement of an oracle from its 32 bytes secret key and the
+// 32 bytes secret nonces it will use for the attestation. The nonces must be fresh for every event,
+// reusing one for two events leaks the oracle key.
+func NewOracleAnnouncement(oracleSecret []byte, nonceSecrets [][]byte) (*OracleAnnouncement, error) {
+	if !ecc.IsValidBitcoinPrivateKey(oracleSecret) {
+		return nil, fmt.Errorf("invalid oracle secret key")
+	}
+	if len(nonceSecrets) == 0 {
+		return nil, fmt.Errorf("at least one nonce is required")
+	}
+	x, _ := curve.ScalarBaseMult(oracleSecret)
+	announcement := &OracleAnnouncement{PublicKey: formating.BytesToHex(x.FillBytes(make([]byte, 32)))}
+	for _, nonce := range nonceSecrets {
+		if !ecc.IsValidBitcoinPrivateKey(nonce) {
+			return nil, fmt.Errorf("invalid oracle nonce")
+		}
+		rx, _ := curve.ScalarBaseMult(nonce)
+		announcement.Nonces = append(announcement.Nonces, formating.BytesToHex(rx.FillBytes(make([]byte, 32))))
+	}
+	return announcement, nil
+}
+
+// Attest signs the outcomes with the oracle secret key and the nonces of the announcement.
+func Attest(oracleSecret []byte, nonceSecrets [][]byte, outcomes []string) (*OracleAttestation, error) {
+	if len(outcomes) != len(nonceSecrets) {
+		return nil, fmt.Errorf("expected %d outcomes, got %d", len(nonceSecrets), len(outcomes))
+	}
+	if !ecc.IsValidBitcoinPrivateKey(oracleSecret) {
+		return nil, fmt.Errorf("invalid oracle secret key")
+	}
+	attestation := &OracleAttestation{Outcomes: outcomes}
+	for i, nonce := range nonceSecrets {
+		if !ecc.IsValidBitcoinPrivateKey(nonce) {
+			return nil, fmt.Errorf("invalid oracle nonce")
+		}
+		signature, err := ecc.SchnorrSignWithNonce(OutcomeMessage(outcomes[i]), oracleSecret, nonce)
+		if err != nil {
+			return nil, err
+		}
+		attestation.Signatures = append(attestation.Signatures, formating.BytesToHex(signature))
+	}
+	return attestation, nil
+}
+
+// AttestationPoint returns the 33 bytes compressed point s * G of the signature the oracle will publish
+// if it attests outcome with the nonce at index: R + e * P. It can be computed before the event.
+func (a *OracleAnnouncement) AttestationPoint(index int, outcome string) ([]byte, error) {
+	if index < 0 || index >= len(a.Nonces) {
+		return nil, fmt.Errorf("nonce index out of range")
+	}
+	return ecc.SchnorrSignaturePoint(OutcomeMessage(outcome), formating.HexToBytes(a.PublicKey), formating.HexToBytes(a.Nonces[index]))
+}
+
+// AdaptorPoint returns the sum of the attestation points of outcomes, attested with the first
+// len(outcomes) nonces. It locks the adaptor signatures of the CET paying for these outcomes.
+func (a *OracleAnnouncement) AdaptorPoint(outcomes []string) ([]byte, error) {
+	if len(outcomes) == 0 || len(outcomes) > len(a.Nonces) {
+		return nil, fmt.Errorf("invalid number of outcomes")
+	}
+	x, y := new(big.Int), new(big.Int)
+	for i, outcome := range outcomes {
+		point, err := a.AttestationPoint(i, outcome)
+		if err != nil {
+			return nil, err
+		}
+		sx, sy := ecc.UnmarshalCompressed(curve, point)
+		x, y = curve.Add(x, y, sx, sy)
+	}
+	if x.Sign() == 0 && y.Sign() == 0 {
+		return nil, fmt.Errorf("the adaptor point cannot be infinity")
+	}
+	return ecc.MarshalCompressed(curve, x, y), nil
+}
+
+// VerifyAttestation checks that attestation holds valid signatures of the oracle for every nonce of the announcement.
+func (a *OracleAnnouncement) VerifyAttestation(attestation *OracleAttestation) error {
+	if len(attestation.Signatures) != len(a.Nonces) || len(attestation.Outcomes) != len(a.Nonces) {
+		return fmt.Errorf("expected %d signatures and outcomes", len(a.Nonces))
+	}
+	publicKey := formating.HexToBytes(a.PublicKey)
+	for i, signature := range attestation.Signatures {
+		sig := formating.HexToBytes(signature)
+		if len(sig) != 64 || !strings.EqualFold(formating.BytesToHex(sig[:32]), a.Nonces[i]) {
+			return fmt.Errorf("signature %d does not use the announced nonce", i)
+		}
+		if !ecc.VerifySchnorr(OutcomeMessage(attestation.Outcomes[i]), publicKey, sig) {
+			return fmt.Errorf("invalid oracle signature for outcome %s", attestation.Outcomes[i])
+		}
+	}
+	return nil
+}
+
+// adaptorSecret returns the sum of the s values of the first count signatures, the discrete
+// logarithm of the adaptor point of the attested outcomes
+func (attestation *OracleAttestation) adaptorSecret(count int) []byte {
+	n := curve.Params().N
+	secret := new(big.Int)
+	for _, signature := range attestation.Signatures[:count] {
+		secret.Add(secret, new(big.Int).SetBytes(formating.HexToBytes(signature)[32:]))
+	}
+	return secret.Mod(secret, n).FillBytes(make([]byte, 32))
+}
+
+var curve = ecc.P256k1()
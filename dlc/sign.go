@@ -0,0 +1,209 @@
+package dlc
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/mrtnetwork/bitcoin/constant"
+	"github.com/mrtnetwork/bitcoin/ecc"
+	"github.com/mrtnetwork/bitcoin/formating"
+	"github.com/mrtnetwork/bitcoin/keypair"
+	"github.com/mrtnetwork/bitcoin/scripts"
+)
+
+// SignCets creates the adaptor signatures of every CET with the funding key of one party,
+// in the order of Cets. They are sent to the counterparty before the funding transaction is signed.
+func (c *Contract) SignCets(key *keypair.ECPrivate) ([]string, error) {
+	if _, err := c.counterpartyKey(key.GetPublic().ToHex()); err != nil {
+		return nil, err
+	}
+	signatures := make([]string, len(c.Cets))
+	for i, cet := range c.Cets {
+		digest, err := c.cetDigest(i)
+		if err != nil {
+			return nil, err
+		}
+		signature, err := ecc.EcdsaAdaptorEncryptSign(digest, key.ToBytes(), formating.HexToBytes(cet.AdaptorPoint))
+		if err != nil {
+			return nil, err
+		}
+		signatures[i] = formating.BytesToHex(signature)
+	}
+	return signatures, nil
+}
+
+// VerifyCetSignatures verifies the adaptor signatures of every CET received from the party with
+// the given funding public key. Never sign the funding transaction before this succeeds.
+func (c *Contract) VerifyCetSignatures(publicKey string, signatures []string) error {
+	pub, err := c.partyKey(publicKey)
+	if err != nil {
+		return err
+	}
+	if len(signatures) != len(c.Cets) {
+		return fmt.Errorf("expected %d CET signatures, got %d", len(c.Cets), len(signatures))
+	}
+	for i, cet := range c.Cets {
+		digest, err := c.cetDigest(i)
+		if err != nil {
+			return err
+		}
+		if !ecc.VerifyEcdsaAdaptor(digest, pub.ToCompressedBytes(), formating.HexToBytes(cet.AdaptorPoint), formating.HexToBytes(signatures[i])) {
+			return fmt.Errorf("invalid adaptor signature of CET %d", i)
+		}
+	}
+	return nil
+}
+
+// SignRefund signs the refund transaction with the funding key of one party.
+func (c *Contract) SignRefund(key *keypair.ECPrivate) (string, error) {
+	if _, err := c.counterpartyKey(key.GetPublic().ToHex()); err != nil {
+		return "", err
+	}
+	digest, err := c.refundDigest()
+	if err != nil {
+		return "", err
+	}
+	return key.SingInput(digest, constant.SIGHASH_ALL), nil
+}
+
+// VerifyRefundSignature verifies the refund signature received from the party with the given funding public key.
+func (c *Contract) VerifyRefundSignature(publicKey string, signature string) error {
+	pub, err := c.partyKey(publicKey)
+	if err != nil {
+		return err
+	}
+	digest, err := c.refundDigest()
+	if err != nil {
+		return err
+	}
+	if !ecc.VerifyDER(digest, pub.ToCompressedBytes(), formating.HexToBytes(signature)) {
+		return fmt.Errorf("invalid refund signature")
+	}
+	return nil
+}
+
+// FindCet returns the index of the CET paying for the attested outcome.
+func (c *Contract) FindCet(attestation *OracleAttestation) (int, error) {
+	for i, cet := range c.Cets {
+		if len(cet.Outcomes) > len(attestation.Outcomes) {
+			continue
+		}
+		match := true
+		for j, outcome := range cet.Outcomes {
+			if attestation.Outcomes[j] != outcome {
+				match = false
+				break
+			}
+		}
+		if match {
+			return i, nil
+		}
+	}
+	return -1, fmt.Errorf("no CET pays for outcome %s", strings.Join(attestation.Outcomes, ""))
+}
+
+// Close verifies the oracle attestation and returns the fully signed CET of the attested outcome.
+// The oracle signatures decrypt the counterparty's adaptor signature of the CET, the other
+// signature is created with key.
+//
+// Parameters:
+// - attestation: The attestation of the oracle.
+// - key: The funding private key of the closing party.
+// - counterpartySignatures: The adaptor signatures of every CET received from the counterparty.
+func (c *Contract) Close(attestation *OracleAttestation, key *keypair.ECPrivate, counterpartySignatures []string) (*scripts.BtcTransaction, error) {
+	if err := c.Oracle.VerifyAttestation(attestation); err != nil {
+		return nil, err
+	}
+	counterparty, err := c.counterpartyKey(key.GetPublic().ToHex())
+	if err != nil {
+		return nil, err
+	}
+	index, err := c.FindCet(attestation)
+	if err != nil {
+		return nil, err
+	}
+	if len(counterpartySignatures) != len(c.Cets) {
+		return nil, fmt.Errorf("expected %d CET signatures, got %d", len(c.Cets), len(counterpartySignatures))
+	}
+	tx, err := c.CetTransaction(index)
+	if err != nil {
+		return nil, err
+	}
+	digest := tx.GetTransactionSegwitDigit(0, c.FundingScript, c.FundingAmount())
+	secret := attestation.adaptorSecret(len(c.Cets[index].Outcomes))
+	counterpartySignature, err := ecc.DecryptEcdsaAdaptor(formating.HexToBytes(counterpartySignatures[index]), secret, constant.SIGHASH_ALL)
+	if err != nil {
+		return nil, err
+	}
+	if !ecc.VerifyDER(digest, counterparty.ToCompressedBytes(), formating.HexToBytes(counterpartySignature)) {
+		return nil, fmt.Errorf("invalid adaptor signature of CET %d", index)
+	}
+	tx.Witnesses = append(tx.Witnesses, c.fundingWitness(key, digest, counterparty, counterpartySignature))
+	return tx, nil
+}
+
+// Refund returns the fully signed refund transaction. It can only be broadcast after RefundLockTime.
+//
+// Parameters:
+// - key: The funding private key of the refunding party.
+// - counterpartySignature: The refund signature received from the counterparty.
+func (c *Contract) Refund(key *keypair.ECPrivate, counterpartySignature string) (*scripts.BtcTransaction, error) {
+	counterparty, err := c.counterpartyKey(key.GetPublic().ToHex())
+	if err != nil {
+		return nil, err
+	}
+	if err := c.VerifyRefundSignature(counterparty.ToHex(), counterpartySignature); err != nil {
+		return nil, err
+	}
+	tx, err := c.RefundTransaction()
+	if err != nil {
+		return nil, err
+	}
+	digest := tx.GetTransactionSegwitDigit(0, c.FundingScript, c.FundingAmount())
+	tx.Witnesses = append(tx.Witnesses, c.fundingWitness(key, digest, counterparty, counterpartySignature))
+	return tx, nil
+}
+
+// fundingWitness signs digest with key and orders both signatures like the keys of the funding script
+func (c *Contract) fundingWitness(key *keypair.ECPrivate, digest []byte, counterparty *keypair.ECPublic, counterpartySignature string) *scripts.TxWitnessInput {
+	signature := key.SingInput(digest, constant.SIGHASH_ALL)
+	if key.GetPublic().ToHex() < counterparty.ToHex() {
+		return scripts.NewTxWitnessInput("", signature, counterpartySignature, c.FundingScript.ToHex())
+	}
+	return scripts.NewTxWitnessInput("", counterpartySignature, signature, c.FundingScript.ToHex())
+}
+
+func (c *Contract) cetDigest(index int) ([]byte, error) {
+	tx, err := c.CetTransaction(index)
+	if err != nil {
+		return nil, err
+	}
+	return tx.GetTransactionSegwitDigit(0, c.FundingScript, c.FundingAmount()), nil
+}
+
+func (c *Contract) refundDigest() ([]byte, error) {
+	tx, err := c.RefundTransaction()
+	if err != nil {
+		return nil, err
+	}
+	return tx.GetTransactionSegwitDigit(0, c.FundingScript, c.FundingAmount()), nil
+}
+
+// partyKey returns the funding public key of the party with the given public key
+func (c *Contract) partyKey(publicKey string) (*keypair.ECPublic, error) {
+	if !strings.EqualFold(publicKey, c.Offer.FundingPublicKey) && !strings.EqualFold(publicKey, c.Accept.FundingPublicKey) {
+		return nil, fmt.Errorf("the public key is not a funding key of the contract")
+	}
+	return keypair.NewECPPublicFromHex(publicKey)
+}
+
+// counterpartyKey returns the funding public key of the other party
+func (c *Contract) counterpartyKey(publicKey string) (*keypair.ECPublic, error) {
+	switch {
+	case strings.EqualFold(publicKey, c.Offer.FundingPublicKey):
+		return keypair.NewECPPublicFromHex(c.Accept.FundingPublicKey)
+	case strings.EqualFold(publicKey, c.Accept.FundingPublicKey):
+		return keypair.NewECPPublicFromHex(c.Offer.FundingPublicKey)
+	}
+	return nil, fmt.Errorf("the private key does not belong to a party of the contract")
+}
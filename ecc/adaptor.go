@@ -0,0 +1,208 @@
+package ecc
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/mrtnetwork/bitcoin/digest"
+	"github.com/mrtnetwork/bitcoin/formating"
+	"math/big"
+)
+
+// SchnorrAdaptorPreSign creates a 65 bytes adaptor pre-signature (R || s') of the message for the adaptor point T.
+// R is the compressed nonce point of the final signature, including the adaptor point.
+// The pre-signature is not a valid BIP340 signature; whoever learns the discrete logarithm t of T
+// can turn it into one with AdaptSchnorr, and publishing that signature reveals t to the signer
+// through ExtractSchnorrAdaptorSecret. This is the building block of point time locked contracts.
+//
+// Parameters:
+// - message: The 32 bytes message.
+// - secret: The 32 bytes secret key of the signer.
+// - adaptorPoint: The 33 bytes compressed adaptor point T.
+// - aux: 32 bytes of fresh auxiliary randomness.
+func SchnorrAdaptorPreSign(message []byte, secret []byte, adaptorPoint []byte, aux []byte) ([]byte, error) {
+	curve := P256k1()
+	n := curve.Params().N
+	if len(message) != 32 {
+		return nil, fmt.Errorf("the message must be a 32-byte array")
+	}
+	if len(aux) != 32 {
+		return nil, fmt.Errorf("aux_rand must be 32 bytes")
+	}
+	d := new(big.Int).SetBytes(secret)
+	if len(secret) != 32 || d.Sign() == 0 || d.Cmp(n) >= 0 {
+		return nil, fmt.Errorf("the secret key must be an integer in the range 1..n-1")
+	}
+	tx, ty := UnmarshalCompressed(curve, adaptorPoint)
+	if tx == nil {
+		return nil, fmt.Errorf("invalid adaptor point")
+	}
+	pX, pY := curve.ScalarBaseMult(secret)
+	if pY.Bit(0) == 1 {
+		d.Sub(n, d)
+	}
+	t := formating.XorBytes(d.FillBytes(make([]byte, 32)), digest.TaggedHash(aux, "BIP0340/aux"))
+	combined := append(append(append(t, adaptorPoint...), pX.FillBytes(make([]byte, 32))...), message...)
+	k := new(big.Int).Mod(new(big.Int).SetBytes(digest.TaggedHash(combined, "SchnorrAdaptor/nonce")), n)
+	if k.Sign() == 0 {
+		return nil, fmt.Errorf("failure, this happens only with negligible probability")
+	}
+	kX, kY := curve.ScalarBaseMult(k.FillBytes(make([]byte, 32)))
+	rX, rY := curve.Add(kX, kY, tx, ty)
+	if rX.Sign() == 0 && rY.Sign() == 0 {
+		return nil, fmt.Errorf("failure, this happens only with negligible probability")
+	}
+	// the final nonce R' + T must have an even y, otherwise the adapted signature uses -R' - T
+	if rY.Bit(0) == 1 {
+		k.Sub(n, k)
+	}
+	e := schnorrChallenge(rX, pX, message)
+	s := new(big.Int).Mul(e, d)
+	s.Add(s, k).Mod(s, n)
+	preSignature := append(MarshalCompressed(curve, rX, rY), s.FillBytes(make([]byte, 32))...)
+	if !VerifySchnorrAdaptor(message, pX.FillBytes(make([]byte, 32)), adaptorPoint, preSignature) {
+		return nil, fmt.Errorf("the created pre-signature does not pass verification")
+	}
+	return preSignature, nil
+}
+
+// VerifySchnorrAdaptor verifies a 65 bytes adaptor pre-signature for the 32 bytes x-only public key
+// and the 33 bytes adaptor point. A valid pre-signature guarantees that adapting it with the
+// discrete logarithm of the adaptor point produces a valid BIP340 signature.
+func VerifySchnorrAdaptor(message []byte, publicKey []byte, adaptorPoint []byte, preSignature []byte) bool {
+	curve := P256k1()
+	if len(message) != 32 || len(publicKey) != 32 || len(preSignature) != 65 {
+		return false
+	}
+	px, py, err := liftX(new(big.Int).SetBytes(publicKey))
+	if err != nil {
+		return false
+	}
+	tx, ty := UnmarshalCompressed(curve, adaptorPoint)
+	if tx == nil {
+		return false
+	}
+	rx, ry := UnmarshalCompressed(curve, preSignature[:33])
+	if rx == nil {
+		return false
+	}
+	s := new(big.Int).SetBytes(preSignature[33:])
+	if s.Cmp(curve.Params().N) >= 0 {
+		return false
+	}
+	// R' = R - T, negated when R has an odd y
+	kx, ky := curve.Add(rx, ry, tx, new(big.Int).Sub(curve.Params().P, ty))
+	if ry.Bit(0) == 1 {
+		ky = new(big.Int).Sub(curve.Params().P, ky)
+	}
+	e := schnorrChallenge(rx, px, message)
+	ex, ey := curve.ScalarMult(px, py, e.FillBytes(make([]byte, 32)))
+	expectedX, expectedY := curve.Add(kx, ky, ex, ey)
+	sx, sy := curve.ScalarBaseMult(s.FillBytes(make([]byte, 32)))
+	return sx.Cmp(expectedX) == 0 && sy.Cmp(expectedY) == 0
+}
+
+// AdaptSchnorr completes a pre-signature with the 32 bytes adaptor secret t and returns the 64 bytes BIP340 signature.
+func AdaptSchnorr(preSignature []byte, adaptorSecret []byte) ([]byte, error) {
+	n := P256k1().Params().N
+	if len(preSignature) != 65 {
+		return nil, fmt.Errorf("the pre-signature must be a 65-byte array")
+	}
+	t := new(big.Int).SetBytes(adaptorSecret)
+	if len(adaptorSecret) != 32 || t.Sign() == 0 || t.Cmp(n) >= 0 {
+		return nil, fmt.Errorf("the adaptor secret must be an integer in the range 1..n-1")
+	}
+	s := new(big.Int).SetBytes(preSignature[33:])
+	if preSignature[0] == 0x03 {
+		s.Sub(s, t)
+	} else {
+		s.Add(s, t)
+	}
+	s.Mod(s, n)
+	return append(formating.CopyBytes(preSignature[1:33]), s.FillBytes(make([]byte, 32))...), nil
+}
+
+// ExtractSchnorrAdaptorSecret recovers the 32 bytes adaptor secret t from a pre-signature and the
+// BIP340 signature adapted from it. It fails when the signature does not belong to the pre-signature.
+func ExtractSchnorrAdaptorSecret(preSignature []byte, signature []byte, adaptorPoint []byte) ([]byte, error) {
+	curve := P256k1()
+	n := curve.Params().N
+	if len(preSignature) != 65 || len(signature) != 64 {
+		return nil, fmt.Errorf("invalid pre-signature or signature length")
+	}
+	if !bytes.Equal(preSignature[1:33], signature[:32]) {
+		return nil, fmt.Errorf("the signature does not belong to the pre-signature")
+	}
+	t := new(big.Int).Sub(new(big.Int).SetBytes(signature[32:]), new(big.Int).SetBytes(preSignature[33:]))
+	if preSignature[0] == 0x03 {
+		t.Neg(t)
+	}
+	t.Mod(t, n)
+	tBytes := t.FillBytes(make([]byte, 32))
+	x, y := curve.ScalarBaseMult(tBytes)
+	if !bytes.Equal(MarshalCompressed(curve, x, y), adaptorPoint) {
+		return nil, fmt.Errorf("the extracted secret does not match the adaptor point")
+	}
+	return tBytes, nil
+}
+
+// SchnorrSignWithNonce signs the 32 bytes message with the secret key and the given 32 bytes nonce
+// secret instead of a derived one, as an oracle attesting with a nonce announced in advance. A
+// nonce must never sign two messages, the secret key would be revealed.
+func SchnorrSignWithNonce(message []byte, secret []byte, nonce []byte) ([]byte, error) {
+	curve := P256k1()
+	n := curve.Params().N
+	if len(message) != 32 {
+		return nil, fmt.Errorf("the message must be a 32-byte array")
+	}
+	d := new(big.Int).SetBytes(secret)
+	if len(secret) != 32 || d.Sign() == 0 || d.Cmp(n) >= 0 {
+		return nil, fmt.Errorf("the secret key must be an integer in the range 1..n-1")
+	}
+	k := new(big.Int).SetBytes(nonce)
+	if len(nonce) != 32 || k.Sign() == 0 || k.Cmp(n) >= 0 {
+		return nil, fmt.Errorf("the nonce must be an integer in the range 1..n-1")
+	}
+	pX, pY := curve.ScalarBaseMult(secret)
+	if pY.Bit(0) == 1 {
+		d.Sub(n, d)
+	}
+	rX, rY := curve.ScalarBaseMult(nonce)
+	if rY.Bit(0) == 1 {
+		k.Sub(n, k)
+	}
+	e := schnorrChallenge(rX, pX, message)
+	s := new(big.Int).Mul(e, d)
+	s.Add(s, k).Mod(s, n)
+	return append(rX.FillBytes(make([]byte, 32)), s.FillBytes(make([]byte, 32))...), nil
+}
+
+// SchnorrSignaturePoint returns the 33 bytes compressed point s * G of the BIP340 signature of the
+// message by the 32 bytes x-only public key with the 32 bytes x-only nonce: R + e * P. It is known
+// before the signature, an adaptor point revealed by the signature.
+func SchnorrSignaturePoint(message []byte, publicKey []byte, nonce []byte) ([]byte, error) {
+	curve := P256k1()
+	if len(publicKey) != 32 {
+		return nil, fmt.Errorf("invalid x-only public key")
+	}
+	if len(nonce) != 32 {
+		return nil, fmt.Errorf("invalid x-only nonce")
+	}
+	px, py, err := liftX(new(big.Int).SetBytes(publicKey))
+	if err != nil {
+		return nil, fmt.Errorf("invalid x-only public key")
+	}
+	rx, ry, err := liftX(new(big.Int).SetBytes(nonce))
+	if err != nil {
+		return nil, fmt.Errorf("invalid x-only nonce")
+	}
+	e := schnorrChallenge(rx, px, message)
+	ex, ey := curve.ScalarMult(px, py, e.FillBytes(make([]byte, 32)))
+	sx, sy := curve.Add(rx, ry, ex, ey)
+	return MarshalCompressed(curve, sx, sy), nil
+}
+
+// schnorrChallenge returns the BIP340 challenge of the nonce x, public key x and message
+func schnorrChallenge(rx *big.Int, px *big.Int, message []byte) *big.Int {
+	combined := append(append(rx.FillBytes(make([]byte, 32)), px.FillBytes(make([]byte, 32))...), message...)
+	return new(big.Int).Mod(new(big.Int).SetBytes(digest.TaggedHash(combined, "BIP0340/challenge")), P256k1().Params().N)
+}
@@ -0,0 +1,281 @@
+package ecc
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/mrtnetwork/bitcoin/digest"
+	"github.com/mrtnetwork/bitcoin/formating"
+	"math/big"
+)
+
+// ECDSA_ADAPTOR_SIGNATURE_LENGTH is the length of an ECDSA adaptor (encrypted) signature:
+// R (33) || R_a (33) || s_hat (32) || DLEQ proof e (32) || DLEQ proof s (32).
+const ECDSA_ADAPTOR_SIGNATURE_LENGTH = 162
+
+// EcdsaAdaptorEncryptSign creates an ECDSA adaptor signature (one-time verifiably encrypted
+// signature) of the message for the adaptor point Y. Like SingInput it grinds the nonce for a
+// low R so the decrypted DER signature is at most 71 bytes.
+//
+// The adaptor signature can be checked with VerifyEcdsaAdaptor, turned into a valid ECDSA
+// signature by whoever knows the discrete logarithm y of Y with DecryptEcdsaAdaptor, and once
+// that signature is published the signer learns y with RecoverEcdsaAdaptorSecret.
+//
+// Parameters:
+// - message: The 32 bytes message (transaction digest).
+// - secret: The 32 bytes secret key of the signer.
+// - adaptorPoint: The 33 bytes compressed adaptor point Y.
+func EcdsaAdaptorEncryptSign(message []byte, secret []byte, adaptorPoint []byte) ([]byte, error) {
+	curve := P256k1()
+	n := curve.Params().N
+	if len(message) != 32 {
+		return nil, fmt.Errorf("the message must be a 32-byte array")
+	}
+	x := new(big.Int).SetBytes(secret)
+	if len(secret) != 32 || x.Sign() == 0 || x.Cmp(n) >= 0 {
+		return nil, fmt.Errorf("the secret key must be an integer in the range 1..n-1")
+	}
+	yx, yy := UnmarshalCompressed(curve, adaptorPoint)
+	if yx == nil {
+		return nil, fmt.Errorf("invalid adaptor point")
+	}
+	for attempt := 0; attempt < 256; attempt++ {
+		combined := append(append(append(formating.CopyBytes(secret), adaptorPoint...), message...), byte(attempt))
+		k := new(big.Int).Mod(new(big.Int).SetBytes(digest.TaggedHash(combined, "ECDSAAdaptor/nonce")), n)
+		if k.Sign() == 0 {
+			continue
+		}
+		kBytes := k.FillBytes(make([]byte, 32))
+		rx, ry := curve.ScalarMult(yx, yy, kBytes)
+		r := new(big.Int).Mod(rx, n)
+		// low R, the same rule SingInput applies to its signatures
+		if r.Sign() == 0 || r.BitLen() > 255 {
+			continue
+		}
+		rax, ray := curve.ScalarBaseMult(kBytes)
+		kInv := new(big.Int).ModInverse(k, n)
+		sHat := new(big.Int).Mul(r, x)
+		sHat.Add(sHat, calculateE(n, message)).Mul(sHat, kInv).Mod(sHat, n)
+		if sHat.Sign() == 0 {
+			continue
+		}
+		bigR := MarshalCompressed(curve, rx, ry)
+		bigRa := MarshalCompressed(curve, rax, ray)
+		proof, err := dleqProve(k, adaptorPoint, bigRa, bigR)
+		if err != nil {
+			return nil, err
+		}
+		signature := append(append(append(bigR, bigRa...), sHat.FillBytes(make([]byte, 32))...), proof...)
+		pX, pY := curve.ScalarBaseMult(secret)
+		if !VerifyEcdsaAdaptor(message, MarshalCompressed(curve, pX, pY), adaptorPoint, signature) {
+			return nil, fmt.Errorf("the created adaptor signature does not pass verification")
+		}
+		return signature, nil
+	}
+	return nil, fmt.Errorf("failure, this happens only with negligible probability")
+}
+
+// VerifyEcdsaAdaptor verifies an adaptor signature for the 33 bytes compressed public key and adaptor point.
+// A valid adaptor signature guarantees that decrypting it with the discrete logarithm of the
+// adaptor point produces a valid ECDSA signature of the message.
+func VerifyEcdsaAdaptor(message []byte, publicKey []byte, adaptorPoint []byte, adaptorSignature []byte) bool {
+	curve := P256k1()
+	n := curve.Params().N
+	if len(message) != 32 || len(adaptorSignature) != ECDSA_ADAPTOR_SIGNATURE_LENGTH {
+		return false
+	}
+	px, py := UnmarshalCompressed(curve, publicKey)
+	if px == nil {
+		return false
+	}
+	rx, _ := UnmarshalCompressed(curve, adaptorSignature[:33])
+	rax, ray := UnmarshalCompressed(curve, adaptorSignature[33:66])
+	if rx == nil || rax == nil {
+		return false
+	}
+	if !dleqVerify(adaptorPoint, adaptorSignature[33:66], adaptorSignature[:33], adaptorSignature[98:]) {
+		return false
+	}
+	sHat := new(big.Int).SetBytes(adaptorSignature[66:98])
+	r := new(big.Int).Mod(rx, n)
+	if sHat.Sign() == 0 || sHat.Cmp(n) >= 0 || r.Sign() == 0 {
+		return false
+	}
+	// s_hat * R_a == m * G + r * X
+	lx, ly := curve.ScalarMult(rax, ray, sHat.FillBytes(make([]byte, 32)))
+	mx, my := curve.ScalarBaseMult(new(big.Int).Mod(calculateE(n, message), n).FillBytes(make([]byte, 32)))
+	xx, xy := curve.ScalarMult(px, py, r.FillBytes(make([]byte, 32)))
+	ex, ey := curve.Add(mx, my, xx, xy)
+	return lx.Cmp(ex) == 0 && ly.Cmp(ey) == 0
+}
+
+// DecryptEcdsaAdaptor decrypts an adaptor signature with the 32 bytes adaptor secret y and returns the
+// low S DER signature followed by the sighash byte as a hexadecimal string, the same format as SingInput.
+func DecryptEcdsaAdaptor(adaptorSignature []byte, adaptorSecret []byte, sigHash int) (string, error) {
+	n := P256k1().Params().N
+	if len(adaptorSignature) != ECDSA_ADAPTOR_SIGNATURE_LENGTH {
+		return "", fmt.Errorf("invalid adaptor signature length")
+	}
+	y := new(big.Int).SetBytes(adaptorSecret)
+	if len(adaptorSecret) != 32 || y.Sign() == 0 || y.Cmp(n) >= 0 {
+		return "", fmt.Errorf("the adaptor secret must be an integer in the range 1..n-1")
+	}
+	rx, _ := UnmarshalCompressed(P256k1(), adaptorSignature[:33])
+	if rx == nil {
+		return "", fmt.Errorf("invalid adaptor signature")
+	}
+	r := new(big.Int).Mod(rx, n)
+	s := new(big.Int).ModInverse(y, n)
+	s.Mul(s, new(big.Int).SetBytes(adaptorSignature[66:98])).Mod(s, n)
+	if s.Cmp(new(big.Int).Rsh(n, 1)) > 0 {
+		s.Sub(n, s)
+	}
+	der := append(ListBigIntToDER([]*big.Int{r, s}), byte(sigHash))
+	return formating.BytesToHex(der), nil
+}
+
+// RecoverEcdsaAdaptorSecret recovers the 32 bytes adaptor secret y from an adaptor signature and the
+// signature decrypted from it, as found in the witness (DER followed by the sighash byte).
+func RecoverEcdsaAdaptorSecret(adaptorSignature []byte, signature []byte, adaptorPoint []byte) ([]byte, error) {
+	curve := P256k1()
+	n := curve.Params().N
+	if len(adaptorSignature) != ECDSA_ADAPTOR_SIGNATURE_LENGTH {
+		return nil, fmt.Errorf("invalid adaptor signature length")
+	}
+	r, s, err := parseDERSignature(signature)
+	if err != nil {
+		return nil, err
+	}
+	rx, _ := UnmarshalCompressed(curve, adaptorSignature[:33])
+	if rx == nil || new(big.Int).Mod(rx, n).Cmp(r) != 0 {
+		return nil, fmt.Errorf("the signature does not belong to the adaptor signature")
+	}
+	y := new(big.Int).ModInverse(s, n)
+	y.Mul(y, new(big.Int).SetBytes(adaptorSignature[66:98])).Mod(y, n)
+	for _, candidate := range []*big.Int{y, new(big.Int).Sub(n, y)} {
+		yBytes := candidate.FillBytes(make([]byte, 32))
+		x, yy := curve.ScalarBaseMult(yBytes)
+		if bytes.Equal(MarshalCompressed(curve, x, yy), adaptorPoint) {
+			return yBytes, nil
+		}
+	}
+	return nil, fmt.Errorf("the recovered secret does not match the adaptor point")
+}
+
+// VerifyDER verifies an ECDSA signature of the 32 bytes message for the 33 bytes compressed public key.
+// The signature is DER encoded, an optional trailing sighash byte (as in a witness) is ignored.
+func VerifyDER(message []byte, publicKey []byte, signature []byte) bool {
+	curve := P256k1()
+	n := curve.Params().N
+	if len(message) != 32 {
+		return false
+	}
+	px, py := UnmarshalCompressed(curve, publicKey)
+	if px == nil {
+		return false
+	}
+	r, s, err := parseDERSignature(signature)
+	if err != nil {
+		return false
+	}
+	sInv := new(big.Int).ModInverse(s, n)
+	u1 := new(big.Int).Mul(calculateE(n, message), sInv)
+	u1.Mod(u1, n)
+	u2 := new(big.Int).Mul(r, sInv)
+	u2.Mod(u2, n)
+	x1, y1 := curve.ScalarBaseMult(u1.FillBytes(make([]byte, 32)))
+	x2, y2 := curve.ScalarMult(px, py, u2.FillBytes(make([]byte, 32)))
+	x, y := curve.Add(x1, y1, x2, y2)
+	if x.Sign() == 0 && y.Sign() == 0 {
+		return false
+	}
+	return new(big.Int).Mod(x, n).Cmp(r) == 0
+}
+
+// parseDERSignature decodes the r and s values of a DER signature with an optional trailing sighash byte
+func parseDERSignature(signature []byte) (*big.Int, *big.Int, error) {
+	invalid := fmt.Errorf("invalid DER signature")
+	if len(signature) < 8 || signature[0] != 0x30 {
+		return nil, nil, invalid
+	}
+	length := int(signature[1])
+	if length+2 != len(signature) && length+3 != len(signature) {
+		return nil, nil, invalid
+	}
+	body := signature[2 : 2+length]
+	values := make([]*big.Int, 2)
+	for i := range values {
+		if len(body) < 2 || body[0] != 0x02 || int(body[1]) > len(body)-2 || body[1] == 0 {
+			return nil, nil, invalid
+		}
+		values[i] = new(big.Int).SetBytes(body[2 : 2+body[1]])
+		body = body[2+body[1]:]
+	}
+	n := P256k1().Params().N
+	if len(body) != 0 {
+		return nil, nil, invalid
+	}
+	for _, v := range values {
+		if v.Sign() == 0 || v.Cmp(n) >= 0 {
+			return nil, nil, invalid
+		}
+	}
+	return values[0], values[1], nil
+}
+
+// dleqProve proves that R_a = k * G and R = k * Y share the same discrete logarithm k.
+// The proof is e || s.
+func dleqProve(k *big.Int, adaptorPoint []byte, bigRa []byte, bigR []byte) ([]byte, error) {
+	curve := P256k1()
+	n := curve.Params().N
+	yx, yy := UnmarshalCompressed(curve, adaptorPoint)
+	nonceData := append(append(append(k.FillBytes(make([]byte, 32)), adaptorPoint...), bigRa...), bigR...)
+	a := new(big.Int).Mod(new(big.Int).SetBytes(digest.TaggedHash(nonceData, "DLEQ/nonce")), n)
+	if a.Sign() == 0 {
+		return nil, fmt.Errorf("failure, this happens only with negligible probability")
+	}
+	aBytes := a.FillBytes(make([]byte, 32))
+	a1x, a1y := curve.ScalarBaseMult(aBytes)
+	a2x, a2y := curve.ScalarMult(yx, yy, aBytes)
+	e := dleqChallenge(adaptorPoint, bigRa, bigR, MarshalCompressed(curve, a1x, a1y), MarshalCompressed(curve, a2x, a2y))
+	s := new(big.Int).Mul(e, k)
+	s.Add(s, a).Mod(s, n)
+	return append(e.FillBytes(make([]byte, 32)), s.FillBytes(make([]byte, 32))...), nil
+}
+
+// dleqVerify checks a proof created by dleqProve
+func dleqVerify(adaptorPoint []byte, bigRa []byte, bigR []byte, proof []byte) bool {
+	curve := P256k1()
+	n := curve.Params().N
+	p := curve.Params().P
+	if len(proof) != 64 {
+		return false
+	}
+	yx, yy := UnmarshalCompressed(curve, adaptorPoint)
+	rax, ray := UnmarshalCompressed(curve, bigRa)
+	rx, ry := UnmarshalCompressed(curve, bigR)
+	if yx == nil || rax == nil || rx == nil {
+		return false
+	}
+	e := new(big.Int).SetBytes(proof[:32])
+	s := new(big.Int).SetBytes(proof[32:])
+	if e.Cmp(n) >= 0 || s.Cmp(n) >= 0 {
+		return false
+	}
+	eBytes := e.FillBytes(make([]byte, 32))
+	// A1 = s * G - e * R_a, A2 = s * Y - e * R
+	sgx, sgy := curve.ScalarBaseMult(proof[32:])
+	erax, eray := curve.ScalarMult(rax, ray, eBytes)
+	a1x, a1y := curve.Add(sgx, sgy, erax, new(big.Int).Sub(p, eray))
+	syx, syy := curve.ScalarMult(yx, yy, proof[32:])
+	erx, ery := curve.ScalarMult(rx, ry, eBytes)
+	a2x, a2y := curve.Add(syx, syy, erx, new(big.Int).Sub(p, ery))
+	if (a1x.Sign() == 0 && a1y.Sign() == 0) || (a2x.Sign() == 0 && a2y.Sign() == 0) {
+		return false
+	}
+	expected := dleqChallenge(adaptorPoint, bigRa, bigR, MarshalCompressed(curve, a1x, a1y), MarshalCompressed(curve, a2x, a2y))
+	return expected.Cmp(e) == 0
+}
+
+func dleqChallenge(points ...[]byte) *big.Int {
+	return new(big.Int).Mod(new(big.Int).SetBytes(digest.TaggedHash(bytes.Join(points, nil), "DLEQ")), P256k1().Params().N)
+}
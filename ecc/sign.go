@@ -215,6 +215,9 @@ func SchnorrSign(message []byte, secret []byte, aux []byte) []byte {
 func liftX(x *big.Int) (*big.Int, *big.Int, error) {
 	curve := P256k1()
 	prime := curve.Params().P
+	if x.Cmp(prime) >= 0 {
+		return big.NewInt(0), big.NewInt(0), errors.New("x is not a field element")
+	}
 	temp := new(big.Int)
 	temp.Exp(x, big.NewInt(3), prime)
 	ySq := new(big.Int).Add(temp, big.NewInt(7))
@@ -10,6 +10,14 @@ import (
 // Tweaks the public key with the specified tweak. Required to create the
 // taproot public key from the internal key.
 func TweakTaprootPoint(pub []byte, twek []byte) []byte {
+	combined, _ := TweakTaprootPointWithParity(pub, twek)
+	return combined
+}
+
+// TweakTaprootPointWithParity tweaks the public key like TweakTaprootPoint and also
+// reports whether the tweaked point had an odd y coordinate before it was negated.
+// The parity is required for the control block of a taproot script path spend.
+func TweakTaprootPointWithParity(pub []byte, twek []byte) ([]byte, bool) {
 	curve := P256k1()
 	x := decodeBigInt(pub[:32])
 	y := decodeBigInt(pub[32:])
@@ -19,13 +27,14 @@ func TweakTaprootPoint(pub []byte, twek []byte) []byte {
 	qx, qy := curve.ScalarMult(curve.Params().Gx, curve.Params().Gy, twek)
 	x, y = curve.Add(x, y, qx, qy)
 
-	if y.Bit(0) == 1 { // Check if y is odd
+	isOdd := y.Bit(0) == 1
+	if isOdd { // Check if y is odd
 		y = y.Sub(curve.Params().P, y)
 	}
 	r := formating.PadByteSliceTo32(encodeBigInt(x))
 	s := formating.PadByteSliceTo32(encodeBigInt(y))
 	combined := append(r, s...)
-	return combined
+	return combined, isOdd
 }
 
 // Tweaks the private key before signing with it. Check if public key's y
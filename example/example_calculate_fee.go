@@ -2,6 +2,7 @@
 package example
 
 import (
+	"context"
 	"github.com/mrtnetwork/bitcoin/address"
 	"github.com/mrtnetwork/bitcoin/provider"
 
@@ -25,9 +26,8 @@ func TestExampleCalculateFee() {
 		as the transaction cost is not genuine. Using it may likely result
 		in errors when attempting to send the transaction.
 
-		Please note that Mempool displays the transaction cost in bytes,
-		whereas BlockCypher displays the transaction cost in kilobytes.
-		The GetEstimate method accurately calculates the cost based on the selected API.
+		Every API returns the fee rates in satoshis per 1000 virtual bytes,
+		the GetEstimate method calculates the cost from the virtual size of the transaction.
 	*/
 	api := provider.SelectApi(provider.BlockCyperApi, &network)
 	// i generate random mnemonic for test
@@ -134,7 +134,7 @@ func TestExampleCalculateFee() {
 	// looping address to read Utxos
 	for _, spender := range spenders {
 		// read ech address utxo from mempol
-		spenderUtxos, err := api.GetAccountUtxo(spender)
+		spenderUtxos, err := api.GetAccountUtxo(context.Background(), spender)
 
 		// oh this address does not have any satoshi for spending
 		if !spenderUtxos.CanSpending() {
@@ -330,7 +330,7 @@ func TestExampleCalculateFee() {
 	fmt.Println("transaction size: ", transactionSize)
 	// Ok we now have the transaction size
 	// Well, we use API to receive network fees
-	networkFee, err := api.GetNetworkFee()
+	networkFee, err := api.GetNetworkFee(context.Background())
 	if err != nil {
 		fmt.Println("cannot read network fee: ", err)
 		return
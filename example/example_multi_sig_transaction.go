@@ -2,6 +2,7 @@
 package example
 
 import (
+	"context"
 	"github.com/mrtnetwork/bitcoin/address"
 	"github.com/mrtnetwork/bitcoin/provider"
 
@@ -148,7 +149,7 @@ func ExampleMultiSigTransactionSpending() {
 	// looping address to read Utxos
 	for _, spender := range spenders {
 		// read ech address utxo from mempol
-		spenderUtxos, err := api.GetAccountUtxo(spender)
+		spenderUtxos, err := api.GetAccountUtxo(context.Background(), spender)
 		// oh something bad happen when reading Utxos
 		if err != nil {
 			fmt.Println("something bad happen when reading Utxos: ", err)
@@ -323,7 +324,7 @@ func ExampleMultiSigTransactionSpending() {
 	fmt.Println("transaction size: ", transactionSize)
 
 	// now we send transaction to network
-	trId, err := api.SendRawTransaction(digest)
+	trId, err := api.SendRawTransaction(context.Background(), digest)
 
 	if err != nil {
 		fmt.Println("something bad happen when sending transaction: ", err)
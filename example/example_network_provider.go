@@ -1,7 +1,12 @@
 package example
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"net/http"
+	"time"
+
 	"github.com/mrtnetwork/bitcoin/address"
 	"github.com/mrtnetwork/bitcoin/provider"
 )
@@ -10,39 +15,34 @@ func ExampleNetworkProvider() {
 	// select network testnet or mainnet
 	network := address.TestnetNetwork
 
-	// create api (BlockCyperApi or MempoolApi)
-	// Currently, only a few critical methods have been implemented to retrieve unspent transactions,
-	// obtain network fees, receive transactions, and send transactions to the network.
-	api := provider.SelectApi(provider.MempoolApi, &network)
+	// create api (provider.NewMempoolProvider or provider.NewBlockCypherProvider)
+	// every backend implements provider.ChainProvider and returns the same types.
+	// you can inject your own http.Client, or use provider.SelectApi for the default one.
+	var api provider.ChainProvider = provider.NewMempoolProvider(&network, &http.Client{Timeout: 30 * time.Second})
+	ctx := context.Background()
 
 	// ========================================================================================//
 
 	// Read Transaction id(hash)
-	tr, e := api.GetTransaction("d4bad8e07d30ca4389ec8a203318aa523cc3e36c9730d0a6852a3801d086c5fe")
-	if e != nil {
+	tr, e := api.GetTransaction(ctx, "d4bad8e07d30ca4389ec8a203318aa523cc3e36c9730d0a6852a3801d086c5fe")
+	if errors.Is(e, provider.ErrNotFound) {
+		fmt.Println("unknown transaction")
+		return
+	} else if e != nil {
 		fmt.Println("error: ", e)
 		return
 	}
-	if converted, ok := tr.(*provider.BlocCyperTransaction); ok {
-		fmt.Println("is blockcypher transaction struct")
-		fmt.Println(converted.Hash)
-		fmt.Println(converted.Inputs)
-		fmt.Println(converted.Outputs)
-		fmt.Println(converted.Confirmations)
-	} else if converted, ok := tr.(*provider.MempoolTransaction); ok {
-		fmt.Println("Memool transaction struct")
-		fmt.Println(converted.TxID)
-		fmt.Println(converted.Vout)
-		fmt.Println(converted.Vin)
-		fmt.Println(converted.Status.Confirmed)
-	}
+	fmt.Println(tr.TxId)
+	fmt.Println(tr.Inputs)
+	fmt.Println(tr.Outputs)
+	fmt.Println(tr.Status.Confirmed, tr.Status.BlockHeight)
 
 	// ========================================================================================//
 
 	addr, _ := address.P2WPKHAddresssFromAddress("tb1q92nmnvhj04sqd4x7wjaewlt5jn8n3ngmplcymy")
 
 	// Read accounts UTXOS
-	utxos, e := api.GetAccountUtxo(provider.UtxoOwnerDetails{
+	utxos, e := api.GetAccountUtxo(ctx, provider.UtxoOwnerDetails{
 		PublicKey: "",
 		Address:   addr,
 	})
@@ -62,11 +62,11 @@ func ExampleNetworkProvider() {
 	// ========================================================================================//
 
 	// Network fee
-	fee, e := api.GetNetworkFee()
+	fee, e := api.GetNetworkFee(ctx)
 	if e != nil {
 		fmt.Println(e)
 	} else {
-		// PER KB
+		// PER 1000 VIRTUAL BYTES
 		fmt.Println("MEDIUM: ", fee.Medium)
 		fmt.Println("LOW: ", fee.Low)
 		fmt.Println("LOW: ", fee.High)
@@ -78,35 +78,29 @@ func ExampleNetworkProvider() {
 	// ========================================================================================//
 
 	//  Send transaction
-	_, _ = api.SendRawTransaction("TRANSACTION DIGEST")
+	_, e = api.SendRawTransaction(ctx, "TRANSACTION DIGEST")
+	if errors.Is(e, provider.ErrRejected) {
+		fmt.Println("invalid transaction: ", e)
+	} else if errors.Is(e, provider.ErrRateLimited) {
+		fmt.Println("try again later")
+	}
 
 	// ========================================================================================//
 
-	// Read account transactions
-	transaction, _ := api.GetAccountTransactions(addr.Show(network), func(url string) string {
-		/*
-			You have the option to modify the address before making the request,
-			such as adding parameters like a limit or page number. For more information,
-			please consult the Mempool API or BlockCypher documentation.
-			You have the option to modify the address before making the request,
-			such as adding parameters like a limit or page number. For more information, please consult the Mempool API or BlockCypher documentation.
-
-		*/
-		return url
-	})
-	if converted, ok := transaction.(provider.MemoolTransactionList); ok {
-		fmt.Println("is mempool transactions struct")
-		fmt.Println("transactions: ", len(converted))
-		for i := 0; i < len(converted); i++ {
-			fmt.Println("transactions: ", converted[i].TxID)
-			fmt.Println("transactions: ", converted[i].Status)
+	// Read account transactions, page by page
+	cursor := ""
+	for {
+		page, e := api.GetAccountTransactions(ctx, addr, cursor)
+		if e != nil {
+			fmt.Println(e)
+			break
 		}
-	} else if converted, ok := transaction.(provider.BlockCypherTransactionList); ok {
-		fmt.Println("is blockCypher transaction struct")
-		for i := 0; i < len(converted); i++ {
-			fmt.Println("transactions: ", converted[i].Hash)
-			fmt.Println("transactions: ", converted[i].Confirmations)
+		for _, transaction := range page.Transactions {
+			fmt.Println("transaction: ", transaction.TxId, transaction.Status.Confirmed)
 		}
+		if page.Next == "" {
+			break
+		}
+		cursor = page.Next
 	}
-
 }
@@ -1,6 +1,7 @@
 package example
 
 import (
+	"context"
 	"fmt"
 	"math/big"
 	"testing"
@@ -121,7 +122,7 @@ func TestExampleSpendingFrom8InputTo10Output(t *testing.T) {
 	// looping address to read Utxos
 	for _, spender := range spenders {
 		// read each address utxo from mempol
-		spenderUtxos, err := api.GetAccountUtxo(spender)
+		spenderUtxos, err := api.GetAccountUtxo(context.Background(), spender)
 
 		// oh this address does not have any satoshi for spending
 		if !spenderUtxos.CanSpending() {
@@ -314,7 +315,7 @@ func TestExampleSpendingFrom8InputTo10Output(t *testing.T) {
 	}
 
 	// now we send transaction to network
-	trId, err := api.SendRawTransaction(digest)
+	trId, err := api.SendRawTransaction(context.Background(), digest)
 
 	if err != nil {
 		fmt.Println("something bad happen when sending transaction: ", err)
@@ -65,17 +65,19 @@ func ViToInt(byteint []byte) (int, int) {
 		return ni, 1
 	}
 
+	var value int
 	switch ni {
 	case 253:
 		size = 2
+		value = int(binary.LittleEndian.Uint16(byteint[1 : 1+size]))
 	case 254:
 		size = 4
+		value = int(binary.LittleEndian.Uint32(byteint[1 : 1+size]))
 	default:
 		size = 8
+		value = int(binary.LittleEndian.Uint64(byteint[1 : 1+size]))
 	}
 
-	value := int(binary.LittleEndian.Uint64(byteint[1 : 1+size]))
-
 	return value, size + 1
 }
 
@@ -0,0 +1,192 @@
+package frost
+
+import (
+	"fmt"
+	"math/big"
+)
+
+// DkgRound1Secret is the secret state a participant keeps between the rounds of the
+// distributed key generation. It must never be sent to the other participants.
+type DkgRound1Secret struct {
+	identifier   int
+	coefficients []*big.Int
+	commitment   [][]byte
+	threshold    int
+	maxSigners   int
+}
+
+// DkgRound1Package is broadcast to every other participant in the first round.
+type DkgRound1Package struct {
+	// Identifier of the sender.
+	Identifier int
+	// Commitment are the 33 bytes compressed commitments to the sender's polynomial coefficients.
+	Commitment [][]byte
+	// ProofOfKnowledge is the 65 bytes proof that the sender knows its secret (R || mu).
+	ProofOfKnowledge []byte
+}
+
+// DkgRound2Package is sent privately (over an encrypted and authenticated channel) to one participant.
+type DkgRound2Package struct {
+	// From is the identifier of the sender.
+	From int
+	// To is the identifier of the receiver.
+	To int
+	// SigningShare is the 32 bytes share of the sender's secret for the receiver.
+	SigningShare []byte
+}
+
+// DkgPart1 starts the distributed key generation (Pedersen DKG with proofs of knowledge)
+// for the participant with the given identifier. The returned package is broadcast to all participants.
+func DkgPart1(identifier int, threshold int, maxSigners int) (*DkgRound1Secret, *DkgRound1Package, error) {
+	if err := validateParameters(threshold, maxSigners); err != nil {
+		return nil, nil, err
+	}
+	if identifier < 1 || identifier > maxSigners {
+		return nil, nil, fmt.Errorf("identifier must be between 1 and %d", maxSigners)
+	}
+	secret, err := randomScalar()
+	if err != nil {
+		return nil, nil, err
+	}
+	coefficients, err := randomPolynomial(secret, threshold)
+	if err != nil {
+		return nil, nil, err
+	}
+	commitment := commitPolynomial(coefficients)
+	k, err := randomScalar()
+	if err != nil {
+		return nil, nil, err
+	}
+	rx, ry := baseMul(k)
+	r := encodePoint(rx, ry)
+	c := dkgChallenge(identifier, commitment[0], r)
+	mu := new(big.Int).Mul(coefficients[0], c)
+	mu.Add(mu, k).Mod(mu, curveOrder)
+	return &DkgRound1Secret{
+		identifier:   identifier,
+		coefficients: coefficients,
+		commitment:   commitment,
+		threshold:    threshold,
+		maxSigners:   maxSigners,
+	}, &DkgRound1Package{
+		Identifier:       identifier,
+		Commitment:       commitment,
+		ProofOfKnowledge: append(r, scalarBytes(mu)...),
+	}, nil
+}
+
+// DkgPart2 verifies the first round packages of the other participants and returns the
+// shares to send privately to each of them.
+func DkgPart2(secret *DkgRound1Secret, round1 []*DkgRound1Package) ([]*DkgRound2Package, error) {
+	if err := secret.verifyRound1(round1); err != nil {
+		return nil, err
+	}
+	packages := make([]*DkgRound2Package, 0, len(round1))
+	for _, pkg := range round1 {
+		packages = append(packages, &DkgRound2Package{
+			From:         secret.identifier,
+			To:           pkg.Identifier,
+			SigningShare: scalarBytes(evaluatePolynomial(secret.coefficients, pkg.Identifier)),
+		})
+	}
+	return packages, nil
+}
+
+// DkgPart3 verifies the shares received in the second round and returns the participant's
+// KeyPackage and the PublicKeyPackage, which is the same for every participant.
+func DkgPart3(secret *DkgRound1Secret, round1 []*DkgRound1Package, round2 []*DkgRound2Package) (*KeyPackage, *PublicKeyPackage, error) {
+	if err := secret.verifyRound1(round1); err != nil {
+		return nil, nil, err
+	}
+	if len(round2) != len(round1) {
+		return nil, nil, fmt.Errorf("expected %d round 2 packages, got %d", len(round1), len(round2))
+	}
+	commitments := map[int][][]byte{}
+	for _, pkg := range round1 {
+		commitments[pkg.Identifier] = pkg.Commitment
+	}
+	signingShare := evaluatePolynomial(secret.coefficients, secret.identifier)
+	for _, pkg := range round2 {
+		if pkg.To != secret.identifier {
+			return nil, nil, fmt.Errorf("round 2 package from participant %d is not addressed to this participant", pkg.From)
+		}
+		commitment, ok := commitments[pkg.From]
+		if !ok {
+			return nil, nil, fmt.Errorf("missing round 1 package of participant %d", pkg.From)
+		}
+		delete(commitments, pkg.From)
+		share := &SecretShare{Identifier: secret.identifier, Value: pkg.SigningShare, Commitment: commitment}
+		if err := share.Verify(); err != nil {
+			return nil, nil, fmt.Errorf("invalid share from participant %d: %v", pkg.From, err)
+		}
+		signingShare.Add(signingShare, new(big.Int).SetBytes(pkg.SigningShare)).Mod(signingShare, curveOrder)
+	}
+	all := [][][]byte{secret.commitment}
+	for _, pkg := range round1 {
+		all = append(all, pkg.Commitment)
+	}
+	pub, err := publicKeyPackageFromCommitments(all, secret.threshold, secret.maxSigners)
+	if err != nil {
+		return nil, nil, err
+	}
+	vx, vy := baseMul(signingShare)
+	return &KeyPackage{
+		Identifier:     secret.identifier,
+		SigningShare:   scalarBytes(signingShare),
+		VerifyingShare: encodePoint(vx, vy),
+		GroupPublicKey: pub.GroupPublicKey,
+		Threshold:      secret.threshold,
+	}, pub, nil
+}
+
+// verifyRound1 checks that round1 holds exactly one valid package from every other participant
+func (secret *DkgRound1Secret) verifyRound1(round1 []*DkgRound1Package) error {
+	if len(round1) != secret.maxSigners-1 {
+		return fmt.Errorf("expected %d round 1 packages, got %d", secret.maxSigners-1, len(round1))
+	}
+	seen := map[int]bool{secret.identifier: true}
+	for _, pkg := range round1 {
+		if pkg.Identifier < 1 || pkg.Identifier > secret.maxSigners || seen[pkg.Identifier] {
+			return fmt.Errorf("invalid or duplicate participant identifier %d", pkg.Identifier)
+		}
+		seen[pkg.Identifier] = true
+		if len(pkg.Commitment) != secret.threshold {
+			return fmt.Errorf("commitment of participant %d has the wrong length", pkg.Identifier)
+		}
+		if err := verifyProofOfKnowledge(pkg); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func verifyProofOfKnowledge(pkg *DkgRound1Package) error {
+	invalid := fmt.Errorf("invalid proof of knowledge from participant %d", pkg.Identifier)
+	if len(pkg.ProofOfKnowledge) != 65 {
+		return invalid
+	}
+	r, err := decodePoint(pkg.ProofOfKnowledge[:33])
+	if err != nil {
+		return invalid
+	}
+	mu := new(big.Int).SetBytes(pkg.ProofOfKnowledge[33:])
+	if mu.Cmp(curveOrder) >= 0 {
+		return invalid
+	}
+	phi, err := decodePoint(pkg.Commitment[0])
+	if err != nil {
+		return invalid
+	}
+	c := dkgChallenge(pkg.Identifier, pkg.Commitment[0], pkg.ProofOfKnowledge[:33])
+	cx, cy := curve.ScalarMult(phi[0], phi[1], scalarBytes(c))
+	ex, ey := curve.Add(r[0], r[1], cx, cy)
+	mx, my := baseMul(mu)
+	if !pointEqual(mx, my, ex, ey) {
+		return invalid
+	}
+	return nil
+}
+
+func dkgChallenge(identifier int, verifyingKey []byte, r []byte) *big.Int {
+	return hashToScalar("FROST/dkg", scalarBytes(big.NewInt(int64(identifier))), verifyingKey, r)
+}
@@ -0,0 +1,360 @@
+// Implementation of FROST threshold Schnorr signatures (RFC 9591) adapted to secp256k1 and
+// BIP340 x-only keys. The aggregated signature is an ordinary BIP340 signature, so a group of
+// t-of-n participants can spend a Taproot key path output like a single signer.
+package frost
+
+import (
+	"bytes"
+	"fmt"
+	"math/big"
+	"sort"
+
+	"github.com/mrtnetwork/bitcoin/digest"
+	"github.com/mrtnetwork/bitcoin/ecc"
+	"github.com/mrtnetwork/bitcoin/keypair"
+)
+
+// SecretShare is the share of the group secret a trusted dealer sends to one participant,
+// together with the Feldman commitment to the dealer's polynomial that proves the share is consistent.
+type SecretShare struct {
+	// Identifier of the participant, between 1 and the number of participants.
+	Identifier int
+	// Value is the 32 bytes secret share.
+	Value []byte
+	// Commitment are the 33 bytes compressed commitments to the polynomial coefficients.
+	Commitment [][]byte
+}
+
+// KeyPackage contains everything a participant needs to sign.
+type KeyPackage struct {
+	// Identifier of the participant.
+	Identifier int
+	// SigningShare is the 32 bytes secret signing share of the participant.
+	SigningShare []byte
+	// VerifyingShare is the 33 bytes public key of SigningShare.
+	VerifyingShare []byte
+	// GroupPublicKey is the 33 bytes group public key.
+	GroupPublicKey []byte
+	// Threshold is the minimum number of participants required to sign.
+	Threshold int
+}
+
+// PublicKeyPackage contains the public data used to verify signature shares and signatures.
+type PublicKeyPackage struct {
+	// VerifyingShares are the 33 bytes public keys of the signing share of each participant.
+	VerifyingShares map[int][]byte
+	// GroupPublicKey is the 33 bytes group public key.
+	GroupPublicKey []byte
+	// Threshold is the minimum number of participants required to sign.
+	Threshold int
+}
+
+// TrustedDealerKeygen splits secret into maxSigners shares of which any threshold can sign.
+// A random secret is generated when secret is nil. The dealer learns the group secret and
+// must be trusted to delete it, use the DKG functions to avoid that.
+func TrustedDealerKeygen(secret []byte, threshold int, maxSigners int) ([]*SecretShare, *PublicKeyPackage, error) {
+	if err := validateParameters(threshold, maxSigners); err != nil {
+		return nil, nil, err
+	}
+	var s *big.Int
+	if secret == nil {
+		var err error
+		if s, err = randomScalar(); err != nil {
+			return nil, nil, err
+		}
+	} else {
+		s = new(big.Int).SetBytes(secret)
+		if len(secret) != 32 || s.Sign() == 0 || s.Cmp(curveOrder) >= 0 {
+			return nil, nil, fmt.Errorf("invalid secret")
+		}
+	}
+	coefficients, err := randomPolynomial(s, threshold)
+	if err != nil {
+		return nil, nil, err
+	}
+	commitment := commitPolynomial(coefficients)
+	shares := make([]*SecretShare, maxSigners)
+	for i := 1; i <= maxSigners; i++ {
+		shares[i-1] = &SecretShare{
+			Identifier: i,
+			Value:      scalarBytes(evaluatePolynomial(coefficients, i)),
+			Commitment: commitment,
+		}
+	}
+	pub, err := publicKeyPackageFromCommitments([][][]byte{commitment}, threshold, maxSigners)
+	if err != nil {
+		return nil, nil, err
+	}
+	return shares, pub, nil
+}
+
+// Verify checks the share against the dealer's commitment.
+func (share *SecretShare) Verify() error {
+	value := new(big.Int).SetBytes(share.Value)
+	if len(share.Value) != 32 || value.Sign() == 0 || value.Cmp(curveOrder) >= 0 {
+		return fmt.Errorf("invalid secret share")
+	}
+	expected, err := evaluateCommitment(share.Commitment, share.Identifier)
+	if err != nil {
+		return err
+	}
+	x, y := baseMul(value)
+	if !pointEqual(x, y, expected[0], expected[1]) {
+		return fmt.Errorf("secret share of participant %d does not match the commitment", share.Identifier)
+	}
+	return nil
+}
+
+// NewKeyPackage verifies a share received from a trusted dealer and creates the participant's KeyPackage.
+func NewKeyPackage(share *SecretShare) (*KeyPackage, error) {
+	if err := share.Verify(); err != nil {
+		return nil, err
+	}
+	x, y := baseMul(new(big.Int).SetBytes(share.Value))
+	group, err := decodePoint(share.Commitment[0])
+	if err != nil {
+		return nil, err
+	}
+	return &KeyPackage{
+		Identifier:     share.Identifier,
+		SigningShare:   share.Value,
+		VerifyingShare: encodePoint(x, y),
+		GroupPublicKey: encodePoint(group[0], group[1]),
+		Threshold:      len(share.Commitment),
+	}, nil
+}
+
+// PublicKey returns the group public key. Use ToTaprootAddress for the address of the group and
+// ToHex as the owner public key of its UTXOs in the transaction builder; the builder's signer
+// callback then runs the signing rounds with the key path digest as message and the tweak of TaprootTweak(nil).
+func (pub *PublicKeyPackage) PublicKey() (*keypair.ECPublic, error) {
+	return keypair.NewECPPublicFromBytes(pub.GroupPublicKey)
+}
+
+// TaprootTweak returns the BIP341 tweak of the group key for the given script tree merkle
+// root (nil for a key path only output). Pass it to NewSigningPackage to sign for the output key.
+func (pub *PublicKeyPackage) TaprootTweak(merkleRoot []byte) []byte {
+	return digest.TaggedHash(append(xOnly(pub.GroupPublicKey), merkleRoot...), "TapTweak")
+}
+
+// XOnlyPublicKey returns the 32 bytes x-only key that verifies signatures created with tweak
+// (nil for an untweaked signature).
+func (pub *PublicKeyPackage) XOnlyPublicKey(tweak []byte) ([]byte, error) {
+	key, err := tweakGroupKey(pub.GroupPublicKey, tweak)
+	if err != nil {
+		return nil, err
+	}
+	return scalarBytes(key.x), nil
+}
+
+// groupKey is the group public key adjusted for BIP340: the final key has an even y and
+// the secret key the signers use is g2 * (g1 * x + t).
+type groupKey struct {
+	x, y *big.Int
+	g1   *big.Int
+	g2   *big.Int
+	t    *big.Int
+}
+
+func tweakGroupKey(groupPublicKey []byte, tweak []byte) (*groupKey, error) {
+	p, err := decodePoint(groupPublicKey)
+	if err != nil {
+		return nil, err
+	}
+	one := big.NewInt(1)
+	minusOne := new(big.Int).Sub(curveOrder, one)
+	key := &groupKey{x: p[0], y: p[1], g1: one, g2: one, t: big.NewInt(0)}
+	if key.y.Bit(0) == 1 {
+		key.g1 = minusOne
+		key.y = new(big.Int).Sub(curve.Params().P, key.y)
+	}
+	if tweak == nil {
+		return key, nil
+	}
+	key.t = new(big.Int).SetBytes(tweak)
+	if len(tweak) != 32 || key.t.Cmp(curveOrder) >= 0 {
+		return nil, fmt.Errorf("the tweak must be less than n")
+	}
+	tx, ty := baseMul(key.t)
+	key.x, key.y = curve.Add(key.x, key.y, tx, ty)
+	if key.x.Sign() == 0 && key.y.Sign() == 0 {
+		return nil, fmt.Errorf("the result of tweaking cannot be infinity")
+	}
+	if key.y.Bit(0) == 1 {
+		key.g2 = minusOne
+		key.y = new(big.Int).Sub(curve.Params().P, key.y)
+	}
+	return key, nil
+}
+
+func validateParameters(threshold int, maxSigners int) error {
+	if threshold < 2 {
+		return fmt.Errorf("threshold should be at least 2")
+	}
+	if maxSigners < threshold {
+		return fmt.Errorf("the number of participants should be at least the threshold")
+	}
+	return nil
+}
+
+// randomPolynomial returns threshold coefficients with constant term s
+func randomPolynomial(s *big.Int, threshold int) ([]*big.Int, error) {
+	coefficients := []*big.Int{s}
+	for i := 1; i < threshold; i++ {
+		c, err := randomScalar()
+		if err != nil {
+			return nil, err
+		}
+		coefficients = append(coefficients, c)
+	}
+	return coefficients, nil
+}
+
+func evaluatePolynomial(coefficients []*big.Int, identifier int) *big.Int {
+	x := big.NewInt(int64(identifier))
+	result := big.NewInt(0)
+	for i := len(coefficients) - 1; i >= 0; i-- {
+		result.Mul(result, x)
+		result.Add(result, coefficients[i]).Mod(result, curveOrder)
+	}
+	return result
+}
+
+func commitPolynomial(coefficients []*big.Int) [][]byte {
+	commitment := make([][]byte, len(coefficients))
+	for i, c := range coefficients {
+		commitment[i] = encodePoint(baseMul(c))
+	}
+	return commitment
+}
+
+// evaluateCommitment returns the public key of the share of identifier
+func evaluateCommitment(commitment [][]byte, identifier int) ([2]*big.Int, error) {
+	x := big.NewInt(int64(identifier))
+	power := big.NewInt(1)
+	rx, ry := new(big.Int), new(big.Int)
+	for _, c := range commitment {
+		p, err := decodePoint(c)
+		if err != nil {
+			return [2]*big.Int{}, err
+		}
+		px, py := curve.ScalarMult(p[0], p[1], scalarBytes(power))
+		rx, ry = curve.Add(rx, ry, px, py)
+		power = new(big.Int).Mul(power, x)
+		power.Mod(power, curveOrder)
+	}
+	return [2]*big.Int{rx, ry}, nil
+}
+
+// publicKeyPackageFromCommitments sums the commitments of all dealers (one for a trusted dealer)
+func publicKeyPackageFromCommitments(commitments [][][]byte, threshold int, maxSigners int) (*PublicKeyPackage, error) {
+	shares := make(map[int][]byte, maxSigners)
+	for i := 1; i <= maxSigners; i++ {
+		sx, sy := new(big.Int), new(big.Int)
+		for _, commitment := range commitments {
+			p, err := evaluateCommitment(commitment, i)
+			if err != nil {
+				return nil, err
+			}
+			sx, sy = curve.Add(sx, sy, p[0], p[1])
+		}
+		shares[i] = encodePoint(sx, sy)
+	}
+	gx, gy := new(big.Int), new(big.Int)
+	for _, commitment := range commitments {
+		p, err := decodePoint(commitment[0])
+		if err != nil {
+			return nil, err
+		}
+		gx, gy = curve.Add(gx, gy, p[0], p[1])
+	}
+	if gx.Sign() == 0 && gy.Sign() == 0 {
+		return nil, fmt.Errorf("the group public key cannot be infinity")
+	}
+	return &PublicKeyPackage{VerifyingShares: shares, GroupPublicKey: encodePoint(gx, gy), Threshold: threshold}, nil
+}
+
+// lagrangeCoefficient returns the Lagrange coefficient of identifier for the signer set
+func lagrangeCoefficient(identifier int, identifiers []int) (*big.Int, error) {
+	num, den := big.NewInt(1), big.NewInt(1)
+	xi := big.NewInt(int64(identifier))
+	found := false
+	for _, j := range identifiers {
+		if j == identifier {
+			found = true
+			continue
+		}
+		xj := big.NewInt(int64(j))
+		num.Mul(num, xj).Mod(num, curveOrder)
+		diff := new(big.Int).Sub(xj, xi)
+		den.Mul(den, diff).Mod(den, curveOrder)
+	}
+	if !found {
+		return nil, fmt.Errorf("participant %d is not part of the signer set", identifier)
+	}
+	inv := new(big.Int).ModInverse(den, curveOrder)
+	if inv == nil {
+		return nil, fmt.Errorf("duplicate participant identifier")
+	}
+	return num.Mul(num, inv).Mod(num, curveOrder), nil
+}
+
+var curve = ecc.P256k1()
+var curveOrder = curve.Params().N
+
+func randomScalar() (*big.Int, error) {
+	for {
+		b, err := digest.GenerateRandom(32)
+		if err != nil {
+			return nil, err
+		}
+		k := new(big.Int).SetBytes(b)
+		if k.Sign() != 0 && k.Cmp(curveOrder) < 0 {
+			return k, nil
+		}
+	}
+}
+
+// hashToScalar hashes data with a FROST specific tag into a scalar
+func hashToScalar(tag string, data ...[]byte) *big.Int {
+	h := digest.TaggedHash(bytes.Join(data, nil), tag)
+	return new(big.Int).Mod(new(big.Int).SetBytes(h), curveOrder)
+}
+
+func baseMul(k *big.Int) (*big.Int, *big.Int) {
+	return curve.ScalarBaseMult(scalarBytes(k))
+}
+
+func pointEqual(x1, y1, x2, y2 *big.Int) bool {
+	return x1.Cmp(x2) == 0 && y1.Cmp(y2) == 0
+}
+
+func decodePoint(b []byte) ([2]*big.Int, error) {
+	x, y := ecc.UnmarshalCompressed(curve, b)
+	if x == nil {
+		return [2]*big.Int{}, fmt.Errorf("invalid point")
+	}
+	return [2]*big.Int{x, y}, nil
+}
+
+func encodePoint(x, y *big.Int) []byte {
+	return ecc.MarshalCompressed(curve, x, y)
+}
+
+func xOnly(compressed []byte) []byte {
+	return append([]byte{}, compressed[1:]...)
+}
+
+// scalarBytes encodes k as 32 bytes big endian
+func scalarBytes(k *big.Int) []byte {
+	return k.FillBytes(make([]byte, 32))
+}
+
+func sortedIdentifiers(ids map[int]bool) []int {
+	result := make([]int, 0, len(ids))
+	for id := range ids {
+		result = append(result, id)
+	}
+	sort.Ints(result)
+	return result
+}
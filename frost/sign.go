@@ -0,0 +1,273 @@
+package frost
+
+import (
+	"bytes"
+	"fmt"
+	"math/big"
+
+	"github.com/mrtnetwork/bitcoin/digest"
+	"github.com/mrtnetwork/bitcoin/ecc"
+)
+
+// SigningNonces are the secret nonces of one participant for one signing session.
+// They must stay on the participant's machine and are erased by Sign.
+type SigningNonces struct {
+	hiding     *big.Int
+	binding    *big.Int
+	Commitment *SigningCommitment
+}
+
+// SigningCommitment is the public commitment to the nonces of a participant, sent to the coordinator in the first round.
+type SigningCommitment struct {
+	// Identifier of the participant.
+	Identifier int
+	// Hiding is the 33 bytes commitment to the hiding nonce.
+	Hiding []byte
+	// Binding is the 33 bytes commitment to the binding nonce.
+	Binding []byte
+}
+
+// SigningPackage is created by the coordinator from the commitments of the selected
+// participants and sent to each of them in the second round.
+type SigningPackage struct {
+	// Commitments of the participating signers, at least the threshold.
+	Commitments []*SigningCommitment
+	// Message is the message to be signed (the 32 bytes sighash for a transaction).
+	Message []byte
+	// Tweak is the optional 32 bytes x-only tweak, see PublicKeyPackage.TaprootTweak.
+	Tweak []byte
+}
+
+// NewSigningPackage creates the signing package of a session.
+func NewSigningPackage(commitments []*SigningCommitment, msg []byte, tweak []byte) *SigningPackage {
+	return &SigningPackage{Commitments: commitments, Message: msg, Tweak: tweak}
+}
+
+// Commit runs the first signing round: it generates fresh nonces for the participant and
+// returns them with their commitment. The nonces are bound to the signing share so a weak
+// random generator does not leak the share.
+func Commit(key *KeyPackage) (*SigningNonces, error) {
+	hiding, err := generateNonce(key.SigningShare)
+	if err != nil {
+		return nil, err
+	}
+	binding, err := generateNonce(key.SigningShare)
+	if err != nil {
+		return nil, err
+	}
+	hx, hy := baseMul(hiding)
+	bx, by := baseMul(binding)
+	return &SigningNonces{
+		hiding:  hiding,
+		binding: binding,
+		Commitment: &SigningCommitment{
+			Identifier: key.Identifier,
+			Hiding:     encodePoint(hx, hy),
+			Binding:    encodePoint(bx, by),
+		},
+	}, nil
+}
+
+func generateNonce(secret []byte) (*big.Int, error) {
+	for {
+		rand, err := digest.GenerateRandom(32)
+		if err != nil {
+			return nil, err
+		}
+		k := hashToScalar("FROST/nonce", rand, secret)
+		if k.Sign() != 0 {
+			return k, nil
+		}
+	}
+}
+
+// sessionValues are the values derived from a SigningPackage
+type sessionValues struct {
+	key            *groupKey
+	identifiers    []int
+	bindingFactors map[int]*big.Int
+	commitments    map[int][2][2]*big.Int
+	rx, ry         *big.Int
+	c              *big.Int
+}
+
+func (pkg *SigningPackage) values(groupPublicKey []byte, threshold int) (*sessionValues, error) {
+	if len(pkg.Commitments) < threshold {
+		return nil, fmt.Errorf("at least %d signers are required", threshold)
+	}
+	key, err := tweakGroupKey(groupPublicKey, pkg.Tweak)
+	if err != nil {
+		return nil, err
+	}
+	ids := map[int]bool{}
+	commitments := map[int][2][2]*big.Int{}
+	for _, commitment := range pkg.Commitments {
+		if commitment.Identifier < 1 || ids[commitment.Identifier] {
+			return nil, fmt.Errorf("invalid or duplicate participant identifier %d", commitment.Identifier)
+		}
+		ids[commitment.Identifier] = true
+		hiding, err := decodePoint(commitment.Hiding)
+		if err != nil {
+			return nil, fmt.Errorf("invalid commitment of participant %d", commitment.Identifier)
+		}
+		binding, err := decodePoint(commitment.Binding)
+		if err != nil {
+			return nil, fmt.Errorf("invalid commitment of participant %d", commitment.Identifier)
+		}
+		commitments[commitment.Identifier] = [2][2]*big.Int{hiding, binding}
+	}
+	identifiers := sortedIdentifiers(ids)
+	var encoded []byte
+	for _, id := range identifiers {
+		c := commitments[id]
+		encoded = append(encoded, scalarBytes(big.NewInt(int64(id)))...)
+		encoded = append(encoded, encodePoint(c[0][0], c[0][1])...)
+		encoded = append(encoded, encodePoint(c[1][0], c[1][1])...)
+	}
+	prefix := bytes.Join([][]byte{
+		scalarBytes(key.x),
+		digest.TaggedHash(pkg.Message, "FROST/msg"),
+		digest.TaggedHash(encoded, "FROST/com"),
+	}, nil)
+	values := &sessionValues{
+		key:            key,
+		identifiers:    identifiers,
+		bindingFactors: map[int]*big.Int{},
+		commitments:    commitments,
+		rx:             new(big.Int),
+		ry:             new(big.Int),
+	}
+	for _, id := range identifiers {
+		rho := hashToScalar("FROST/rho", prefix, scalarBytes(big.NewInt(int64(id))))
+		values.bindingFactors[id] = rho
+		px, py := values.commitmentShare(id)
+		values.rx, values.ry = curve.Add(values.rx, values.ry, px, py)
+	}
+	if values.rx.Sign() == 0 && values.ry.Sign() == 0 {
+		return nil, fmt.Errorf("the group commitment cannot be infinity")
+	}
+	challenge := digest.TaggedHash(bytes.Join([][]byte{scalarBytes(values.rx), scalarBytes(key.x), pkg.Message}, nil), "BIP0340/challenge")
+	values.c = new(big.Int).Mod(new(big.Int).SetBytes(challenge), curveOrder)
+	return values, nil
+}
+
+// commitmentShare returns D + rho * E of participant id
+func (values *sessionValues) commitmentShare(id int) (*big.Int, *big.Int) {
+	c := values.commitments[id]
+	ex, ey := curve.ScalarMult(c[1][0], c[1][1], scalarBytes(values.bindingFactors[id]))
+	return curve.Add(c[0][0], c[0][1], ex, ey)
+}
+
+// shareCoefficient returns c * lambda * g2 * g1, the factor applied to the signing share of id
+func (values *sessionValues) shareCoefficient(id int) (*big.Int, error) {
+	lambda, err := lagrangeCoefficient(id, values.identifiers)
+	if err != nil {
+		return nil, err
+	}
+	k := new(big.Int).Mul(values.c, lambda)
+	k.Mul(k, values.key.g2).Mul(k, values.key.g1)
+	return k.Mod(k, curveOrder), nil
+}
+
+// Sign runs the second signing round and returns the participant's 32 bytes signature share.
+// The nonces are erased so they can never be used for a second signature.
+func Sign(pkg *SigningPackage, nonces *SigningNonces, key *KeyPackage) ([]byte, error) {
+	if nonces.hiding == nil || nonces.binding == nil {
+		return nil, fmt.Errorf("the signing nonces have already been used")
+	}
+	hiding, binding := nonces.hiding, nonces.binding
+	nonces.hiding, nonces.binding = nil, nil
+	var own *SigningCommitment
+	for _, commitment := range pkg.Commitments {
+		if commitment.Identifier == key.Identifier {
+			own = commitment
+		}
+	}
+	if own == nil || !bytes.Equal(own.Hiding, nonces.Commitment.Hiding) || !bytes.Equal(own.Binding, nonces.Commitment.Binding) {
+		return nil, fmt.Errorf("the signing package does not contain the commitment of participant %d", key.Identifier)
+	}
+	values, err := pkg.values(key.GroupPublicKey, key.Threshold)
+	if err != nil {
+		return nil, err
+	}
+	k := new(big.Int).Mul(binding, values.bindingFactors[key.Identifier])
+	k.Add(k, hiding).Mod(k, curveOrder)
+	if values.ry.Bit(0) == 1 {
+		k.Sub(curveOrder, k)
+	}
+	coefficient, err := values.shareCoefficient(key.Identifier)
+	if err != nil {
+		return nil, err
+	}
+	z := new(big.Int).Mul(coefficient, new(big.Int).SetBytes(key.SigningShare))
+	z.Add(z, k).Mod(z, curveOrder)
+	return scalarBytes(z), nil
+}
+
+// VerifySignatureShare verifies the signature share of a participant. The coordinator
+// uses it to identify a participant that sent an invalid share.
+func VerifySignatureShare(pkg *SigningPackage, identifier int, share []byte, pub *PublicKeyPackage) error {
+	values, err := pkg.values(pub.GroupPublicKey, pub.Threshold)
+	if err != nil {
+		return err
+	}
+	return values.verifyShare(identifier, share, pub)
+}
+
+func (values *sessionValues) verifyShare(identifier int, share []byte, pub *PublicKeyPackage) error {
+	invalid := fmt.Errorf("invalid signature share from participant %d", identifier)
+	if _, ok := values.commitments[identifier]; !ok {
+		return fmt.Errorf("participant %d is not part of the signer set", identifier)
+	}
+	z := new(big.Int).SetBytes(share)
+	if len(share) != 32 || z.Cmp(curveOrder) >= 0 {
+		return invalid
+	}
+	y, err := decodePoint(pub.VerifyingShares[identifier])
+	if err != nil {
+		return fmt.Errorf("missing verifying share of participant %d", identifier)
+	}
+	rx, ry := values.commitmentShare(identifier)
+	if values.ry.Bit(0) == 1 {
+		ry = new(big.Int).Sub(curve.Params().P, ry)
+	}
+	coefficient, err := values.shareCoefficient(identifier)
+	if err != nil {
+		return err
+	}
+	yx, yy := curve.ScalarMult(y[0], y[1], scalarBytes(coefficient))
+	ex, ey := curve.Add(rx, ry, yx, yy)
+	zx, zy := baseMul(z)
+	if !pointEqual(zx, zy, ex, ey) {
+		return invalid
+	}
+	return nil
+}
+
+// Aggregate verifies the signature shares of all participants of the signing package and
+// aggregates them into a 64 bytes BIP340 signature valid for PublicKeyPackage.XOnlyPublicKey(pkg.Tweak).
+func Aggregate(pkg *SigningPackage, shares map[int][]byte, pub *PublicKeyPackage) ([]byte, error) {
+	values, err := pkg.values(pub.GroupPublicKey, pub.Threshold)
+	if err != nil {
+		return nil, err
+	}
+	z := new(big.Int)
+	for _, id := range values.identifiers {
+		share, ok := shares[id]
+		if !ok {
+			return nil, fmt.Errorf("missing signature share of participant %d", id)
+		}
+		if err := values.verifyShare(id, share, pub); err != nil {
+			return nil, err
+		}
+		z.Add(z, new(big.Int).SetBytes(share))
+	}
+	ct := new(big.Int).Mul(values.c, values.key.g2)
+	ct.Mul(ct, values.key.t)
+	z.Add(z, ct).Mod(z, curveOrder)
+	signature := append(scalarBytes(values.rx), scalarBytes(z)...)
+	if !ecc.VerifySchnorr(pkg.Message, scalarBytes(values.key.x), signature) {
+		return nil, fmt.Errorf("the aggregated signature does not pass verification")
+	}
+	return signature, nil
+}
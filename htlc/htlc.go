@@ -0,0 +1,236 @@
+// Hash Time-Locked Contracts (HTLC) for atomic swaps and submarine swaps.
+package htlc
+
+import (
+	"fmt"
+
+	"github.com/mrtnetwork/bitcoin/address"
+	"github.com/mrtnetwork/bitcoin/constant"
+	"github.com/mrtnetwork/bitcoin/digest"
+	"github.com/mrtnetwork/bitcoin/formating"
+	"github.com/mrtnetwork/bitcoin/keypair"
+	"github.com/mrtnetwork/bitcoin/scripts"
+)
+
+// HashType is the hash function that locks the payment to a preimage.
+type HashType int
+
+const (
+	// SHA256 locks the payment to the single SHA256 of the preimage (Lightning payment hash)
+	SHA256 HashType = iota
+	// HASH160 locks the payment to RIPEMD160(SHA256(preimage))
+	HASH160
+)
+
+// PreimageLength is the only preimage size accepted by the contract scripts. Enforcing it
+// with OP_SIZE prevents griefing in cross-chain swaps where the chains accept different sizes.
+const PreimageLength = 32
+
+/*
+Contract represents an HTLC output.
+
+The receiver can claim the funds at any time by revealing the preimage of PaymentHash,
+the sender can take the funds back once LockTime has passed.
+
+P2WSH witness script:
+
+	OP_IF
+		OP_SIZE 32 OP_EQUALVERIFY <hash op> <payment hash> OP_EQUALVERIFY <receiver>
+	OP_ELSE
+		<locktime> OP_CHECKLOCKTIMEVERIFY OP_DROP <sender>
+	OP_ENDIF
+	OP_CHECKSIG
+
+P2TR uses an unspendable internal key and one leaf per path with the same conditions.
+*/
+type Contract struct {
+	// HashType is the hash function of PaymentHash.
+	HashType HashType
+
+	// PaymentHash is the hash of the preimage in hexadecimal.
+	PaymentHash string
+
+	// ReceiverPublicKey is the public key that claims the funds with the preimage.
+	ReceiverPublicKey string
+
+	// SenderPublicKey is the public key that refunds the funds after LockTime.
+	SenderPublicKey string
+
+	// LockTime is the absolute lock time (block height or unix time) of the refund path.
+	LockTime int
+
+	// Address represents the P2WSH or P2TR address of the contract.
+	Address address.BitcoinAddress
+
+	// WitnessScript is the redeem script of a P2WSH contract, nil for P2TR.
+	WitnessScript *scripts.Script
+
+	// ClaimLeaf and RefundLeaf are the tapleafs of a P2TR contract, nil for P2WSH.
+	ClaimLeaf  *scripts.Script
+	RefundLeaf *scripts.Script
+
+	// InternalPublicKey is the unspendable taproot internal key of a P2TR contract.
+	InternalPublicKey string
+}
+
+// PaymentHash returns the hash of preimage for the given hash type in hexadecimal.
+func PaymentHash(hashType HashType, preimage []byte) string {
+	if hashType == HASH160 {
+		return formating.BytesToHex(digest.Hash160(preimage))
+	}
+	return formating.BytesToHex(digest.SingleHash(preimage))
+}
+
+// NewP2WSHContract creates an HTLC locked in a P2WSH output.
+//
+// Parameters:
+// - hashType: The hash function of paymentHash (SHA256 or HASH160).
+// - paymentHash: The hash of the preimage in hexadecimal.
+// - receiverPublicKey: The public key that can claim the funds with the preimage.
+// - senderPublicKey: The public key that can refund the funds after lockTime.
+// - lockTime: The absolute lock time of the refund path.
+func NewP2WSHContract(hashType HashType, paymentHash string, receiverPublicKey string, senderPublicKey string, lockTime int) (*Contract, error) {
+	contract, receiver, sender, err := newContract(hashType, paymentHash, receiverPublicKey, senderPublicKey, lockTime)
+	if err != nil {
+		return nil, err
+	}
+	contract.WitnessScript = scripts.NewScript(
+		"OP_IF",
+		"OP_SIZE", PreimageLength, "OP_EQUALVERIFY", contract.hashOpCode(), contract.PaymentHash, "OP_EQUALVERIFY", receiver.ToHex(),
+		"OP_ELSE",
+		contract.LockTime, "OP_CHECKLOCKTIMEVERIFY", "OP_DROP", sender.ToHex(),
+		"OP_ENDIF",
+		"OP_CHECKSIG",
+	)
+	addr, err := address.P2WSHAddresssFromScript(contract.WitnessScript)
+	if err != nil {
+		return nil, err
+	}
+	contract.Address = addr
+	return contract, nil
+}
+
+// NewP2TRContract creates an HTLC locked in a P2TR output with a claim leaf and a refund leaf.
+// The internal key is unspendable, so the output can only be spent through one of the leafs.
+//
+// Parameters:
+// - hashType: The hash function of paymentHash (SHA256 or HASH160).
+// - paymentHash: The hash of the preimage in hexadecimal.
+// - receiverPublicKey: The public key that can claim the funds with the preimage.
+// - senderPublicKey: The public key that can refund the funds after lockTime.
+// - lockTime: The absolute lock time of the refund path.
+func NewP2TRContract(hashType HashType, paymentHash string, receiverPublicKey string, senderPublicKey string, lockTime int) (*Contract, error) {
+	contract, receiver, sender, err := newContract(hashType, paymentHash, receiverPublicKey, senderPublicKey, lockTime)
+	if err != nil {
+		return nil, err
+	}
+	contract.ClaimLeaf = scripts.NewScript(
+		"OP_SIZE", PreimageLength, "OP_EQUALVERIFY", contract.hashOpCode(), contract.PaymentHash, "OP_EQUALVERIFY",
+		receiver.ToXOnlyHex(), "OP_CHECKSIG",
+	)
+	contract.RefundLeaf = scripts.NewScript(
+		contract.LockTime, "OP_CHECKLOCKTIMEVERIFY", "OP_DROP", sender.ToXOnlyHex(), "OP_CHECKSIG",
+	)
+	internal, err := keypair.NewECPPublicFromHex(constant.TAPROOT_UNSPENDABLE_PUBLIC_KEY)
+	if err != nil {
+		return nil, err
+	}
+	contract.InternalPublicKey = internal.ToHex()
+	contract.Address = internal.ToTaprootAddress(contract.ClaimLeaf, contract.RefundLeaf)
+	return contract, nil
+}
+
+// newContract validates the contract parameters
+func newContract(hashType HashType, paymentHash string, receiverPublicKey string, senderPublicKey string, lockTime int) (*Contract, *keypair.ECPublic, *keypair.ECPublic, error) {
+	hashLength := 32
+	if hashType == HASH160 {
+		hashLength = 20
+	} else if hashType != SHA256 {
+		return nil, nil, nil, fmt.Errorf("invalid hash type")
+	}
+	if len(formating.HexToBytes(paymentHash)) != hashLength {
+		return nil, nil, nil, fmt.Errorf("payment hash should be %d bytes", hashLength)
+	}
+	if lockTime < 1 || lockTime > 0xffffffff {
+		return nil, nil, nil, fmt.Errorf("lock time should be between 1 and 4294967295")
+	}
+	receiver, err := keypair.NewECPPublicFromHex(receiverPublicKey)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	sender, err := keypair.NewECPPublicFromHex(senderPublicKey)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	return &Contract{
+		HashType:          hashType,
+		PaymentHash:       formating.BytesToHex(formating.HexToBytes(paymentHash)),
+		ReceiverPublicKey: receiver.ToHex(),
+		SenderPublicKey:   sender.ToHex(),
+		LockTime:          lockTime,
+	}, receiver, sender, nil
+}
+
+// hashOpCode returns the opcode that hashes the preimage
+func (c *Contract) hashOpCode() string {
+	if c.HashType == HASH160 {
+		return "OP_HASH160"
+	}
+	return "OP_SHA256"
+}
+
+// IsTaproot reports whether the contract is a P2TR output
+func (c *Contract) IsTaproot() bool {
+	return c.Address.GetType() == address.P2TR
+}
+
+// ControlBlock returns the control block of the claim leaf (claim true) or the refund leaf of a P2TR contract.
+func (c *Contract) ControlBlock(claim bool) (*scripts.ControlBlock, error) {
+	if !c.IsTaproot() {
+		return nil, fmt.Errorf("control block is only available for taproot contracts")
+	}
+	internal, err := keypair.NewECPPublicFromHex(c.InternalPublicKey)
+	if err != nil {
+		return nil, err
+	}
+	isOdd, err := internal.ToTapRootParity([]interface{}{c.ClaimLeaf, c.RefundLeaf})
+	if err != nil {
+		return nil, err
+	}
+	sibling := c.ClaimLeaf.ToTapleafTaggedHash()
+	if claim {
+		sibling = c.RefundLeaf.ToTapleafTaggedHash()
+	}
+	return scripts.NewControlBlockWithParity(internal.ToXOnlyHex(), sibling, isOdd), nil
+}
+
+// VerifyPreimage checks that preimage (hexadecimal) unlocks the contract.
+func (c *Contract) VerifyPreimage(preimage string) bool {
+	preimageBytes := formating.HexToBytes(preimage)
+	if len(preimageBytes) != PreimageLength {
+		return false
+	}
+	return PaymentHash(c.HashType, preimageBytes) == c.PaymentHash
+}
+
+// ExtractPreimage searches the witnesses of a claim transaction for the preimage of the contract
+// and returns it in hexadecimal. An error is returned when the transaction does not reveal it.
+func (c *Contract) ExtractPreimage(tx *scripts.BtcTransaction) (string, error) {
+	for _, witness := range tx.Witnesses {
+		for _, item := range witness.Stack {
+			if c.VerifyPreimage(item) {
+				return formating.BytesToHex(formating.HexToBytes(item)), nil
+			}
+		}
+	}
+	return "", fmt.Errorf("transaction does not reveal the preimage")
+}
+
+// ExtractPreimageFromRaw parses a raw transaction in hexadecimal and extracts the preimage like ExtractPreimage.
+func (c *Contract) ExtractPreimageFromRaw(rawTx string) (string, error) {
+	tx, err := scripts.BtcTransactionFromRaw(rawTx)
+	if err != nil {
+		return "", err
+	}
+	return c.ExtractPreimage(tx)
+}
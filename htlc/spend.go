@@ -0,0 +1,117 @@
+package htlc
+
+import (
+	"fmt"
+	"math/big"
+	"strings"
+
+	"github.com/mrtnetwork/bitcoin/address"
+	"github.com/mrtnetwork/bitcoin/constant"
+	"github.com/mrtnetwork/bitcoin/formating"
+	"github.com/mrtnetwork/bitcoin/keypair"
+	"github.com/mrtnetwork/bitcoin/scripts"
+)
+
+// ContractUtxo is the output that funded the contract.
+type ContractUtxo struct {
+	// TxHash is the identifier of the funding transaction.
+	TxHash string
+
+	// Vout is the index of the contract output within the funding transaction.
+	Vout int
+
+	// Value is the amount locked in the contract.
+	Value *big.Int
+}
+
+// BuildClaimTransaction creates and signs a transaction that spends the contract output to destination
+// by revealing the preimage.
+//
+// Parameters:
+// - utxo: The contract output.
+// - destination: The address that receives the claimed amount minus fee.
+// - fee: The transaction fee.
+// - preimage: The preimage of the payment hash in hexadecimal.
+// - receiver: The private key of the contract receiver.
+func (c *Contract) BuildClaimTransaction(utxo ContractUtxo, destination address.BitcoinAddress, fee *big.Int, preimage string, receiver *keypair.ECPrivate) (*scripts.BtcTransaction, error) {
+	if !c.VerifyPreimage(preimage) {
+		return nil, fmt.Errorf("preimage does not match the payment hash")
+	}
+	if !strings.EqualFold(receiver.GetPublic().ToHex(), c.ReceiverPublicKey) {
+		return nil, fmt.Errorf("private key does not belong to the contract receiver")
+	}
+	tx, err := c.buildSpendTransaction(utxo, destination, fee, false)
+	if err != nil {
+		return nil, err
+	}
+	if c.IsTaproot() {
+		sig := c.signTaproot(tx, utxo, c.ClaimLeaf, receiver)
+		controlBlock, err := c.ControlBlock(true)
+		if err != nil {
+			return nil, err
+		}
+		tx.Witnesses = append(tx.Witnesses, scripts.NewTxWitnessInput(sig, preimage, c.ClaimLeaf.ToHex(), controlBlock.ToHex()))
+		return tx, nil
+	}
+	digest := tx.GetTransactionSegwitDigit(0, c.WitnessScript, utxo.Value)
+	sig := receiver.SingInput(digest, constant.SIGHASH_ALL)
+	// "01" selects the OP_IF branch
+	tx.Witnesses = append(tx.Witnesses, scripts.NewTxWitnessInput(sig, preimage, "01", c.WitnessScript.ToHex()))
+	return tx, nil
+}
+
+// BuildRefundTransaction creates and signs a transaction that returns the contract output to destination
+// once the lock time has passed. The transaction is only valid after LockTime.
+//
+// Parameters:
+// - utxo: The contract output.
+// - destination: The address that receives the refunded amount minus fee.
+// - fee: The transaction fee.
+// - sender: The private key of the contract sender.
+func (c *Contract) BuildRefundTransaction(utxo ContractUtxo, destination address.BitcoinAddress, fee *big.Int, sender *keypair.ECPrivate) (*scripts.BtcTransaction, error) {
+	if !strings.EqualFold(sender.GetPublic().ToHex(), c.SenderPublicKey) {
+		return nil, fmt.Errorf("private key does not belong to the contract sender")
+	}
+	tx, err := c.buildSpendTransaction(utxo, destination, fee, true)
+	if err != nil {
+		return nil, err
+	}
+	if c.IsTaproot() {
+		sig := c.signTaproot(tx, utxo, c.RefundLeaf, sender)
+		controlBlock, err := c.ControlBlock(false)
+		if err != nil {
+			return nil, err
+		}
+		tx.Witnesses = append(tx.Witnesses, scripts.NewTxWitnessInput(sig, c.RefundLeaf.ToHex(), controlBlock.ToHex()))
+		return tx, nil
+	}
+	digest := tx.GetTransactionSegwitDigit(0, c.WitnessScript, utxo.Value)
+	sig := sender.SingInput(digest, constant.SIGHASH_ALL)
+	// an empty item selects the OP_ELSE branch
+	tx.Witnesses = append(tx.Witnesses, scripts.NewTxWitnessInput(sig, "", c.WitnessScript.ToHex()))
+	return tx, nil
+}
+
+// buildSpendTransaction creates the unsigned transaction spending the contract output. Refunds
+// set the transaction lock time and a non final sequence required by OP_CHECKLOCKTIMEVERIFY.
+func (c *Contract) buildSpendTransaction(utxo ContractUtxo, destination address.BitcoinAddress, fee *big.Int, refund bool) (*scripts.BtcTransaction, error) {
+	amount := new(big.Int).Sub(utxo.Value, fee)
+	if amount.Sign() <= 0 {
+		return nil, fmt.Errorf("fee exceeds the contract amount")
+	}
+	txIn := scripts.NewTxInput(utxo.TxHash, utxo.Vout)
+	txOut := scripts.NewTxOutput(amount, destination.ToScriptPubKey())
+	if !refund {
+		return scripts.NewBtcTransaction([]*scripts.TxInput{txIn}, []*scripts.TxOutput{txOut}, true), nil
+	}
+	txIn.Sequence = constant.ABSOLUTE_TIMELOCK_SEQUENCE
+	lockTime := formating.PackUint32LE(uint32(c.LockTime))
+	return scripts.NewBtcTransaction([]*scripts.TxInput{txIn}, []*scripts.TxOutput{txOut}, true, lockTime), nil
+}
+
+// signTaproot signs the script path digest of leaf with the untweaked key
+func (c *Contract) signTaproot(tx *scripts.BtcTransaction, utxo ContractUtxo, leaf *scripts.Script, key *keypair.ECPrivate) string {
+	digest := tx.GetTransactionTaprootDigest(0, []*scripts.Script{c.Address.ToScriptPubKey()},
+		[]*big.Int{utxo.Value}, 1, leaf, constant.TAPROOT_SIGHASH_ALL)
+	return key.SignTaprootTransaction(digest, constant.TAPROOT_SIGHASH_ALL, []interface{}{}, false)
+}
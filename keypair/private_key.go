@@ -161,32 +161,39 @@ func MagicMessage(message string) []byte {
 
 // signs the message's digest and returns the signature
 func (ecPriv *ECPrivate) SignMessage(message string, compressed bool) string {
+	header := 27
+	if compressed {
+		header = 31
+	}
+	return ecPriv.signMessage(message, header, compressed)
+}
+
+// SignSegwitMessage signs the message for the P2WPKH or P2SH-P2WPKH address of the key and
+// returns the signature in hexadecimal. Following BIP137, the header byte of the signature
+// is 39-42 for P2WPKH and 35-38 for P2SH-P2WPKH addresses.
+func (ecPriv *ECPrivate) SignSegwitMessage(message string, addressType address.AddressType) (string, error) {
+	switch addressType {
+	case address.P2WPKH:
+		return ecPriv.signMessage(message, 39, true), nil
+	case address.P2WPKHInP2SH:
+		return ecPriv.signMessage(message, 35, true), nil
+	}
+	return "", fmt.Errorf("segwit messages can only be signed for P2WPKH and P2SH-P2WPKH addresses")
+}
+
+// signMessage signs the message's digest and adds the recovery id to the header byte
+func (ecPriv *ECPrivate) signMessage(message string, header int, compressed bool) string {
 	m := digest.SingleHash(MagicMessage(message))
 
 	signature := ecc.SingMessage(m, ecPriv.ToBytes())
-	prefix := 27
-
-	// Determine recid based on the prefix
-	if compressed {
-		prefix += 4
-	}
-	addr := ecPriv.GetPublic().ToAddress(compressed)
-	for i := prefix; i < prefix+4; i++ {
-		// Attempt to create a new byte slice containing the signature
-		sig := make([]byte, 0)
-		char := string(rune(i))
-		charBytes := []byte(char)
-
-		sig = append(sig, charBytes...)
-		sig = append(sig, signature...)
-		// Handle any potential errors (e.g., utf8 encoding errors)
+	publicKey := ecPriv.GetPublic().ToHex(compressed)
+	for recid := 0; recid < 4; recid++ {
+		sig := append([]byte{byte(header + recid)}, signature...)
 		if pub := GetSignaturePublic(message, sig); pub != nil {
-			if strings.EqualFold(pub.ToAddress(compressed).Program().Hash160, addr.Program().Hash160) {
+			if strings.EqualFold(pub.ToHex(compressed), publicKey) {
 				return formating.BytesToHex(sig)
 			}
-			continue
 		}
-
 	}
 	panic("cannot validate message")
 }
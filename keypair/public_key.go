@@ -2,6 +2,7 @@
 package keypair
 
 import (
+	"encoding/base64"
 	"fmt"
 	"strings"
 
@@ -217,6 +218,19 @@ func (ecPublic *ECPublic) ToTapRotHex(script []interface{}) (string, error) {
 
 }
 
+// ToTapRootParity reports whether the Taproot output key derived from the ECPublic key
+// and an optional script has an odd y coordinate. The result must be set in the control
+// block when spending through the script path.
+func (ecPublic *ECPublic) ToTapRootParity(script []interface{}) (bool, error) {
+	publicBytes := ecPublic.ToUnCompressedBytes(false)
+	tweak, e := ecPublic.CalculateTweek(script)
+	if e != nil {
+		return false, e
+	}
+	_, isOdd := ecc.TweakTaprootPointWithParity(publicBytes, tweak)
+	return isOdd, nil
+}
+
 // tapleafTaggedHash computes and returns the tagged hash of a script for Taproot,
 // using the specified script. It prepends a version byte and then tags the hash with "TapLeaf".
 func tapleafTaggedHash(script *scripts.Script) []byte {
@@ -306,18 +320,16 @@ func (ecPublic *ECPublic) Verify(message string, signature string) bool {
 // GetSignaturePublic extracts and returns the public key associated with a signature
 // for the given message. If the extraction is successful, it returns an ECPublic key;
 // otherwise, it returns nil.
+// The header byte of the signature is one of the BIP137 ranges: 27-30 (P2PKH uncompressed),
+// 31-34 (P2PKH compressed), 35-38 (P2SH-P2WPKH) or 39-42 (P2WPKH).
 func GetSignaturePublic(message string, signature []byte) *ECPublic {
 	m := digest.SingleHash(MagicMessage(message))
-	prefix := int(signature[0])
-
-	var recid int
+	if len(signature) != 65 || signature[0] < 27 || signature[0] > 42 {
+		return nil
+	}
 
 	// Determine recid based on the prefix
-	if prefix >= 31 {
-		recid = prefix - 31
-	} else {
-		recid = prefix - 27
-	}
+	recid := int(signature[0]-27) % 4
 
 	rec := ecc.RecoverPublicKey(recid, formating.CopyBytes(signature[1:]), m)
 
@@ -327,3 +339,58 @@ func GetSignaturePublic(message string, signature []byte) *ECPublic {
 	}
 	return nil
 }
+
+// MessageVerifyOption relaxes the checks of VerifyMessage for wallets whose signatures
+// do not use the BIP137 header of the address type.
+type MessageVerifyOption int
+
+const (
+	// ElectrumLeniency accepts the compressed P2PKH headers (31-34) for P2WPKH and P2SH-P2WPKH
+	// addresses, as Electrum signs messages of segwit addresses.
+	ElectrumLeniency MessageVerifyOption = iota
+
+	// TrezorLeniency accepts the P2WPKH and P2SH-P2WPKH headers (35-42) for both segwit address
+	// types, as some hardware wallets do not distinguish them.
+	TrezorLeniency
+)
+
+// VerifyMessage checks that signature is a signature of message by the owner of addr. The signature
+// is 65 bytes in hexadecimal (as returned by SignMessage) or base64 (as used by wallets). The public key
+// is recovered from the signature and the address of the type selected by the header byte must be addr.
+// P2PKH, P2WPKH and P2SH-P2WPKH addresses are supported.
+func VerifyMessage(addr address.BitcoinAddress, message string, signature string, options ...MessageVerifyOption) bool {
+	sig, err := formating.HexToBytesCatch(signature)
+	if err != nil || len(sig) != 65 {
+		sig, err = base64.StdEncoding.DecodeString(signature)
+		if err != nil {
+			return false
+		}
+	}
+	pub := GetSignaturePublic(message, sig)
+	if pub == nil {
+		return false
+	}
+	electrum, trezor := false, false
+	for _, option := range options {
+		switch option {
+		case ElectrumLeniency:
+			electrum = true
+		case TrezorLeniency:
+			trezor = true
+		}
+	}
+	scriptPubKey := addr.ToScriptPubKey().ToHex()
+	matches := func(candidate address.BitcoinAddress) bool {
+		return strings.EqualFold(candidate.ToScriptPubKey().ToHex(), scriptPubKey)
+	}
+	switch header := sig[0]; {
+	case header < 31:
+		return matches(pub.ToAddress(false))
+	case header < 35:
+		return matches(pub.ToAddress(true)) || (electrum && (matches(pub.ToSegwitAddress()) || matches(pub.ToP2WPKHInP2SH())))
+	case header < 39:
+		return matches(pub.ToP2WPKHInP2SH()) || (trezor && matches(pub.ToSegwitAddress()))
+	default:
+		return matches(pub.ToSegwitAddress()) || (trezor && matches(pub.ToP2WPKHInP2SH()))
+	}
+}
@@ -0,0 +1,256 @@
+// Implementation of MuSig2 (BIP327) multi-signatures for Schnorr (BIP340) keys.
+//
+// Every step works on serialized values so each signer can run on a different machine:
+// signers exchange public keys, public nonces and partial signatures, never secrets.
+package musig2
+
+import (
+	"bytes"
+	"fmt"
+	"math/big"
+	"sort"
+
+	"github.com/mrtnetwork/bitcoin/digest"
+	"github.com/mrtnetwork/bitcoin/ecc"
+)
+
+// InvalidContributionError is returned when the contribution (public key, public nonce,
+// aggregate nonce or partial signature) of a signer is invalid. It identifies the
+// misbehaving signer so the protocol can be aborted and the signer blamed.
+type InvalidContributionError struct {
+	// Signer is the index of the signer, -1 when the contribution is not attributable
+	// to a single signer (aggregate nonce).
+	Signer int
+	// Contrib is the invalid contribution: "pubkey", "pubnonce", "aggnonce" or "psig".
+	Contrib string
+}
+
+func (e *InvalidContributionError) Error() string {
+	if e.Signer < 0 {
+		return fmt.Sprintf("invalid %s", e.Contrib)
+	}
+	return fmt.Sprintf("signer %d provided an invalid %s", e.Signer, e.Contrib)
+}
+
+// KeyAggContext is the result of the key aggregation, optionally tweaked.
+type KeyAggContext struct {
+	q    *point
+	gacc *big.Int
+	tacc *big.Int
+}
+
+// KeySort sorts 33 bytes compressed public keys in lexicographical order.
+func KeySort(pubkeys [][]byte) [][]byte {
+	sorted := make([][]byte, len(pubkeys))
+	copy(sorted, pubkeys)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return bytes.Compare(sorted[i], sorted[j]) < 0
+	})
+	return sorted
+}
+
+// KeyAgg aggregates 33 bytes compressed public keys into a single public key.
+// The order of pubkeys matters, use KeySort for an order independent aggregate key.
+func KeyAgg(pubkeys [][]byte) (*KeyAggContext, error) {
+	if len(pubkeys) == 0 {
+		return nil, fmt.Errorf("at least one public key is required")
+	}
+	pk2 := getSecondKey(pubkeys)
+	var q *point
+	for i, pk := range pubkeys {
+		p, err := cpoint(pk)
+		if err != nil {
+			return nil, &InvalidContributionError{Signer: i, Contrib: "pubkey"}
+		}
+		a := keyAggCoeffInternal(pubkeys, pk, pk2)
+		q = q.add(p.mul(a))
+	}
+	if q == nil {
+		return nil, fmt.Errorf("the aggregate public key cannot be infinity")
+	}
+	return &KeyAggContext{q: q, gacc: big.NewInt(1), tacc: big.NewInt(0)}, nil
+}
+
+// hashKeys returns the tagged hash of the list of public keys
+func hashKeys(pubkeys [][]byte) []byte {
+	return digest.TaggedHash(bytes.Join(pubkeys, nil), "KeyAgg list")
+}
+
+// getSecondKey returns the first public key that differs from the first one, or 33 zero bytes
+func getSecondKey(pubkeys [][]byte) []byte {
+	for _, pk := range pubkeys[1:] {
+		if !bytes.Equal(pk, pubkeys[0]) {
+			return pk
+		}
+	}
+	return make([]byte, 33)
+}
+
+// keyAggCoeff returns the key aggregation coefficient of pk
+func keyAggCoeff(pubkeys [][]byte, pk []byte) *big.Int {
+	return keyAggCoeffInternal(pubkeys, pk, getSecondKey(pubkeys))
+}
+
+func keyAggCoeffInternal(pubkeys [][]byte, pk []byte, pk2 []byte) *big.Int {
+	if bytes.Equal(pk, pk2) {
+		return big.NewInt(1)
+	}
+	l := hashKeys(pubkeys)
+	h := digest.TaggedHash(append(l, pk...), "KeyAgg coefficient")
+	return new(big.Int).Mod(new(big.Int).SetBytes(h), curveOrder)
+}
+
+// ApplyTweak returns a new context with the tweak added to the aggregate key.
+// An x-only tweak is applied to the even y version of the key, as required by taproot.
+func (ctx *KeyAggContext) ApplyTweak(tweak []byte, isXOnly bool) (*KeyAggContext, error) {
+	if len(tweak) != 32 {
+		return nil, fmt.Errorf("the tweak must be a 32-byte array")
+	}
+	g := big.NewInt(1)
+	if isXOnly && !ctx.q.hasEvenY() {
+		g = new(big.Int).Sub(curveOrder, big.NewInt(1))
+	}
+	t := new(big.Int).SetBytes(tweak)
+	if t.Cmp(curveOrder) >= 0 {
+		return nil, fmt.Errorf("the tweak must be less than n")
+	}
+	q := ctx.q.mul(g).add(baseMul(t))
+	if q == nil {
+		return nil, fmt.Errorf("the result of tweaking cannot be infinity")
+	}
+	gacc := new(big.Int).Mul(g, ctx.gacc)
+	gacc.Mod(gacc, curveOrder)
+	tacc := new(big.Int).Mul(g, ctx.tacc)
+	tacc.Add(tacc, t).Mod(tacc, curveOrder)
+	return &KeyAggContext{q: q, gacc: gacc, tacc: tacc}, nil
+}
+
+// TaprootTweak returns the BIP341 tweak of the aggregate key for the given script tree
+// merkle root (nil for a key path only output). Apply it as an x-only tweak.
+func (ctx *KeyAggContext) TaprootTweak(merkleRoot []byte) []byte {
+	return digest.TaggedHash(append(ctx.XOnlyPublicKey(), merkleRoot...), "TapTweak")
+}
+
+// PublicKey returns the aggregate public key in 33 bytes compressed form.
+func (ctx *KeyAggContext) PublicKey() []byte {
+	return ctx.q.cBytes()
+}
+
+// XOnlyPublicKey returns the 32 bytes x-only aggregate public key, the key that
+// verifies the final BIP340 signature (and the taproot output key once tweaked).
+func (ctx *KeyAggContext) XOnlyPublicKey() []byte {
+	return ctx.q.xBytes()
+}
+
+// applyTweaks aggregates the keys and applies the tweaks in order
+func applyTweaks(pubkeys [][]byte, tweaks [][]byte, isXOnly []bool) (*KeyAggContext, error) {
+	if len(tweaks) != len(isXOnly) {
+		return nil, fmt.Errorf("the tweaks and isXOnly arrays must have the same length")
+	}
+	ctx, err := KeyAgg(pubkeys)
+	if err != nil {
+		return nil, err
+	}
+	for i := range tweaks {
+		ctx, err = ctx.ApplyTweak(tweaks[i], isXOnly[i])
+		if err != nil {
+			return nil, err
+		}
+	}
+	return ctx, nil
+}
+
+// point is an affine secp256k1 point, nil is the point at infinity
+type point struct {
+	x, y *big.Int
+}
+
+var curve = ecc.P256k1()
+var curveOrder = curve.Params().N
+
+func newPoint(x, y *big.Int) *point {
+	if x.Sign() == 0 && y.Sign() == 0 {
+		return nil
+	}
+	return &point{x: x, y: y}
+}
+
+// cpoint decodes a 33 bytes compressed point
+func cpoint(b []byte) (*point, error) {
+	x, y := ecc.UnmarshalCompressed(curve, b)
+	if x == nil {
+		return nil, fmt.Errorf("invalid point")
+	}
+	return &point{x: x, y: y}, nil
+}
+
+// cpointExt decodes a 33 bytes compressed point where 33 zero bytes encode infinity
+func cpointExt(b []byte) (*point, error) {
+	if bytes.Equal(b, make([]byte, 33)) {
+		return nil, nil
+	}
+	return cpoint(b)
+}
+
+func baseMul(k *big.Int) *point {
+	if k.Sign() == 0 {
+		return nil
+	}
+	return newPoint(curve.ScalarBaseMult(scalarBytes(k)))
+}
+
+func (p *point) mul(k *big.Int) *point {
+	if p == nil || k.Sign() == 0 {
+		return nil
+	}
+	return newPoint(curve.ScalarMult(p.x, p.y, scalarBytes(k)))
+}
+
+func (p *point) add(q *point) *point {
+	if p == nil {
+		return q
+	}
+	if q == nil {
+		return p
+	}
+	return newPoint(curve.Add(p.x, p.y, q.x, q.y))
+}
+
+func (p *point) negate() *point {
+	if p == nil {
+		return nil
+	}
+	return &point{x: p.x, y: new(big.Int).Sub(curve.Params().P, p.y)}
+}
+
+func (p *point) equal(q *point) bool {
+	if p == nil || q == nil {
+		return p == q
+	}
+	return p.x.Cmp(q.x) == 0 && p.y.Cmp(q.y) == 0
+}
+
+func (p *point) hasEvenY() bool {
+	return p.y.Bit(0) == 0
+}
+
+func (p *point) xBytes() []byte {
+	return scalarBytes(p.x)
+}
+
+func (p *point) cBytes() []byte {
+	return ecc.MarshalCompressed(curve, p.x, p.y)
+}
+
+// cBytesExt encodes a point in compressed form, infinity as 33 zero bytes
+func (p *point) cBytesExt() []byte {
+	if p == nil {
+		return make([]byte, 33)
+	}
+	return p.cBytes()
+}
+
+// scalarBytes encodes k as 32 bytes big endian
+func scalarBytes(k *big.Int) []byte {
+	return k.FillBytes(make([]byte, 32))
+}
@@ -0,0 +1,99 @@
+package musig2
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math/big"
+
+	"github.com/mrtnetwork/bitcoin/digest"
+	"github.com/mrtnetwork/bitcoin/formating"
+)
+
+// NonceGen generates a fresh secret nonce and the matching public nonce for one signing session.
+// The 97 bytes secret nonce must stay on the signer's machine and must never be used twice,
+// the 66 bytes public nonce is sent to the other signers.
+//
+// Parameters:
+// - sk: The 32 bytes secret key of the signer, optional (nil) but recommended.
+// - pk: The 33 bytes compressed public key of the signer.
+// - aggpk: The 32 bytes x-only aggregate public key, optional (nil).
+// - msg: The message to be signed, optional (nil). An empty non nil slice is an empty message.
+// - extraIn: Any extra input, optional (nil).
+func NonceGen(sk, pk, aggpk, msg, extraIn []byte) ([]byte, []byte, error) {
+	rand, err := digest.GenerateRandom(32)
+	if err != nil {
+		return nil, nil, err
+	}
+	return NonceGenWithRand(rand, sk, pk, aggpk, msg, extraIn)
+}
+
+// NonceGenWithRand is NonceGen with caller provided 32 bytes randomness. It is only
+// safe when rand is uniformly random and never reused; it exists for test vectors.
+func NonceGenWithRand(rand, sk, pk, aggpk, msg, extraIn []byte) ([]byte, []byte, error) {
+	if len(rand) != 32 {
+		return nil, nil, fmt.Errorf("rand must be a 32-byte array")
+	}
+	if sk != nil && len(sk) != 32 {
+		return nil, nil, fmt.Errorf("the secret key must be a 32-byte array")
+	}
+	if len(pk) != 33 {
+		return nil, nil, fmt.Errorf("the public key must be a 33-byte array")
+	}
+	if aggpk != nil && len(aggpk) != 32 {
+		return nil, nil, fmt.Errorf("the aggregate public key must be a 32-byte array")
+	}
+	if sk != nil {
+		rand = formating.XorBytes(sk, digest.TaggedHash(rand, "MuSig/aux"))
+	}
+	var msgPrefixed []byte
+	if msg == nil {
+		msgPrefixed = []byte{0x00}
+	} else {
+		msgPrefixed = append([]byte{0x01}, binary.BigEndian.AppendUint64(nil, uint64(len(msg)))...)
+		msgPrefixed = append(msgPrefixed, msg...)
+	}
+	k1 := nonceHash(rand, pk, aggpk, 0, msgPrefixed, extraIn)
+	k2 := nonceHash(rand, pk, aggpk, 1, msgPrefixed, extraIn)
+	if k1.Sign() == 0 || k2.Sign() == 0 {
+		return nil, nil, fmt.Errorf("failure, this happens only with negligible probability")
+	}
+	secnonce := append(append(scalarBytes(k1), scalarBytes(k2)...), pk...)
+	pubnonce := append(baseMul(k1).cBytes(), baseMul(k2).cBytes()...)
+	return secnonce, pubnonce, nil
+}
+
+func nonceHash(rand, pk, aggpk []byte, i byte, msgPrefixed, extraIn []byte) *big.Int {
+	var buf []byte
+	buf = append(buf, rand...)
+	buf = append(buf, byte(len(pk)))
+	buf = append(buf, pk...)
+	buf = append(buf, byte(len(aggpk)))
+	buf = append(buf, aggpk...)
+	buf = append(buf, msgPrefixed...)
+	buf = binary.BigEndian.AppendUint32(buf, uint32(len(extraIn)))
+	buf = append(buf, extraIn...)
+	buf = append(buf, i)
+	h := digest.TaggedHash(buf, "MuSig/nonce")
+	return new(big.Int).Mod(new(big.Int).SetBytes(h), curveOrder)
+}
+
+// NonceAgg aggregates the 66 bytes public nonces of all signers into the aggregate nonce.
+// Any party (usually a coordinator) can run it; the result is sent to every signer.
+func NonceAgg(pubnonces [][]byte) ([]byte, error) {
+	aggnonce := make([]byte, 0, 66)
+	for j := 0; j < 2; j++ {
+		var r *point
+		for i, pubnonce := range pubnonces {
+			if len(pubnonce) != 66 {
+				return nil, &InvalidContributionError{Signer: i, Contrib: "pubnonce"}
+			}
+			p, err := cpoint(pubnonce[j*33 : (j+1)*33])
+			if err != nil {
+				return nil, &InvalidContributionError{Signer: i, Contrib: "pubnonce"}
+			}
+			r = r.add(p)
+		}
+		aggnonce = append(aggnonce, r.cBytesExt()...)
+	}
+	return aggnonce, nil
+}
@@ -0,0 +1,252 @@
+package musig2
+
+import (
+	"bytes"
+	"fmt"
+	"math/big"
+
+	"github.com/mrtnetwork/bitcoin/digest"
+)
+
+// SessionContext holds the public data of one signing session. Every signer and the
+// aggregator build the same context from the values exchanged during the session.
+type SessionContext struct {
+	// AggNonce is the 66 bytes aggregate nonce returned by NonceAgg.
+	AggNonce []byte
+	// PublicKeys are the 33 bytes public keys of all signers, in the order used by KeyAgg.
+	PublicKeys [][]byte
+	// Tweaks are 32 bytes tweaks applied to the aggregate key in order.
+	Tweaks [][]byte
+	// IsXOnly tells for each tweak whether it is an x-only (taproot) tweak.
+	IsXOnly []bool
+	// Message is the message to be signed.
+	Message []byte
+}
+
+// NewSessionContext creates the context of a signing session.
+func NewSessionContext(aggnonce []byte, pubkeys [][]byte, tweaks [][]byte, isXOnly []bool, msg []byte) *SessionContext {
+	return &SessionContext{
+		AggNonce:   aggnonce,
+		PublicKeys: pubkeys,
+		Tweaks:     tweaks,
+		IsXOnly:    isXOnly,
+		Message:    msg,
+	}
+}
+
+// sessionValues are the values derived from a SessionContext
+type sessionValues struct {
+	q    *point
+	gacc *big.Int
+	tacc *big.Int
+	b    *big.Int
+	r    *point
+	e    *big.Int
+}
+
+func (session *SessionContext) values() (*sessionValues, error) {
+	keyAgg, err := applyTweaks(session.PublicKeys, session.Tweaks, session.IsXOnly)
+	if err != nil {
+		return nil, err
+	}
+	if len(session.AggNonce) != 66 {
+		return nil, &InvalidContributionError{Signer: -1, Contrib: "aggnonce"}
+	}
+	bHash := digest.TaggedHash(bytes.Join([][]byte{session.AggNonce, keyAgg.q.xBytes(), session.Message}, nil), "MuSig/noncecoef")
+	b := new(big.Int).Mod(new(big.Int).SetBytes(bHash), curveOrder)
+	r1, err := cpointExt(session.AggNonce[:33])
+	if err != nil {
+		return nil, &InvalidContributionError{Signer: -1, Contrib: "aggnonce"}
+	}
+	r2, err := cpointExt(session.AggNonce[33:])
+	if err != nil {
+		return nil, &InvalidContributionError{Signer: -1, Contrib: "aggnonce"}
+	}
+	r := r1.add(r2.mul(b))
+	if r == nil {
+		// the signing still succeeds with an honest majority of nonces, see BIP327
+		r = baseMul(big.NewInt(1))
+	}
+	eHash := digest.TaggedHash(bytes.Join([][]byte{r.xBytes(), keyAgg.q.xBytes(), session.Message}, nil), "BIP0340/challenge")
+	e := new(big.Int).Mod(new(big.Int).SetBytes(eHash), curveOrder)
+	return &sessionValues{q: keyAgg.q, gacc: keyAgg.gacc, tacc: keyAgg.tacc, b: b, r: r, e: e}, nil
+}
+
+// sessionKeyAggCoeff returns the key aggregation coefficient of the signer with public key p
+func (session *SessionContext) sessionKeyAggCoeff(p *point) (*big.Int, error) {
+	pk := p.cBytes()
+	for _, key := range session.PublicKeys {
+		if bytes.Equal(key, pk) {
+			return keyAggCoeff(session.PublicKeys, pk), nil
+		}
+	}
+	return nil, fmt.Errorf("the signer's pubkey must be included in the list of pubkeys")
+}
+
+// Sign creates the 32 bytes partial signature of a signer.
+//
+// The first 64 bytes of secnonce are zeroed once read so that an accidental second call with
+// the same secret nonce fails instead of leaking the secret key.
+//
+// Parameters:
+// - secnonce: The 97 bytes secret nonce returned by NonceGen for this session.
+// - sk: The 32 bytes secret key of the signer.
+// - session: The session context.
+func Sign(secnonce []byte, sk []byte, session *SessionContext) ([]byte, error) {
+	values, err := session.values()
+	if err != nil {
+		return nil, err
+	}
+	if len(secnonce) != 97 {
+		return nil, fmt.Errorf("the secret nonce must be a 97-byte array")
+	}
+	k1Prime := new(big.Int).SetBytes(secnonce[:32])
+	k2Prime := new(big.Int).SetBytes(secnonce[32:64])
+	copy(secnonce[:64], make([]byte, 64))
+	if k1Prime.Sign() == 0 || k1Prime.Cmp(curveOrder) >= 0 {
+		return nil, fmt.Errorf("first secnonce value is out of range")
+	}
+	if k2Prime.Sign() == 0 || k2Prime.Cmp(curveOrder) >= 0 {
+		return nil, fmt.Errorf("second secnonce value is out of range")
+	}
+	k1, k2 := k1Prime, k2Prime
+	if !values.r.hasEvenY() {
+		k1 = new(big.Int).Sub(curveOrder, k1Prime)
+		k2 = new(big.Int).Sub(curveOrder, k2Prime)
+	}
+	if len(sk) != 32 {
+		return nil, fmt.Errorf("the secret key must be a 32-byte array")
+	}
+	dPrime := new(big.Int).SetBytes(sk)
+	if dPrime.Sign() == 0 || dPrime.Cmp(curveOrder) >= 0 {
+		return nil, fmt.Errorf("secret key value is out of range")
+	}
+	p := baseMul(dPrime)
+	if !bytes.Equal(p.cBytes(), secnonce[64:]) {
+		return nil, fmt.Errorf("public key does not match nonce_gen argument")
+	}
+	a, err := session.sessionKeyAggCoeff(p)
+	if err != nil {
+		return nil, err
+	}
+	g := big.NewInt(1)
+	if !values.q.hasEvenY() {
+		g = new(big.Int).Sub(curveOrder, big.NewInt(1))
+	}
+	d := new(big.Int).Mul(g, values.gacc)
+	d.Mul(d, dPrime).Mod(d, curveOrder)
+
+	s := new(big.Int).Mul(values.b, k2)
+	s.Add(s, k1)
+	ead := new(big.Int).Mul(values.e, a)
+	ead.Mul(ead, d)
+	s.Add(s, ead).Mod(s, curveOrder)
+
+	psig := scalarBytes(s)
+	pubnonce := append(baseMul(k1Prime).cBytes(), baseMul(k2Prime).cBytes()...)
+	ok, err := session.VerifyPartialSignature(psig, pubnonce, p.cBytes())
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, fmt.Errorf("the created partial signature does not pass verification")
+	}
+	return psig, nil
+}
+
+// PartialSigVerify verifies the partial signature of signer i. It aggregates the public
+// nonces itself, use SessionContext.VerifyPartialSignature when the aggregate nonce is known.
+//
+// Parameters:
+// - psig: The 32 bytes partial signature.
+// - pubnonces: The 66 bytes public nonces of all signers.
+// - pubkeys: The 33 bytes public keys of all signers.
+// - tweaks, isXOnly: The tweaks applied to the aggregate key.
+// - msg: The signed message.
+// - i: The index of the signer in pubnonces and pubkeys.
+func PartialSigVerify(psig []byte, pubnonces [][]byte, pubkeys [][]byte, tweaks [][]byte, isXOnly []bool, msg []byte, i int) (bool, error) {
+	if len(pubnonces) != len(pubkeys) {
+		return false, fmt.Errorf("the pubnonces and pubkeys arrays must have the same length")
+	}
+	if i < 0 || i >= len(pubkeys) {
+		return false, fmt.Errorf("signer index out of range")
+	}
+	aggnonce, err := NonceAgg(pubnonces)
+	if err != nil {
+		return false, err
+	}
+	session := NewSessionContext(aggnonce, pubkeys, tweaks, isXOnly, msg)
+	return session.VerifyPartialSignature(psig, pubnonces[i], pubkeys[i])
+}
+
+// VerifyPartialSignature verifies the partial signature of the signer with the given public nonce and public key.
+func (session *SessionContext) VerifyPartialSignature(psig []byte, pubnonce []byte, pk []byte) (bool, error) {
+	values, err := session.values()
+	if err != nil {
+		return false, err
+	}
+	if len(psig) != 32 {
+		return false, nil
+	}
+	s := new(big.Int).SetBytes(psig)
+	if s.Cmp(curveOrder) >= 0 {
+		return false, nil
+	}
+	if len(pubnonce) != 66 {
+		return false, fmt.Errorf("the public nonce must be a 66-byte array")
+	}
+	rs1, err := cpoint(pubnonce[:33])
+	if err != nil {
+		return false, err
+	}
+	rs2, err := cpoint(pubnonce[33:])
+	if err != nil {
+		return false, err
+	}
+	re := rs1.add(rs2.mul(values.b))
+	if !values.r.hasEvenY() {
+		re = re.negate()
+	}
+	p, err := cpoint(pk)
+	if err != nil {
+		return false, err
+	}
+	a, err := session.sessionKeyAggCoeff(p)
+	if err != nil {
+		return false, err
+	}
+	g := big.NewInt(1)
+	if !values.q.hasEvenY() {
+		g = new(big.Int).Sub(curveOrder, big.NewInt(1))
+	}
+	gPrime := new(big.Int).Mul(g, values.gacc)
+	gPrime.Mod(gPrime, curveOrder)
+	eag := new(big.Int).Mul(values.e, a)
+	eag.Mul(eag, gPrime).Mod(eag, curveOrder)
+	return baseMul(s).equal(re.add(p.mul(eag))), nil
+}
+
+// PartialSigAgg aggregates the partial signatures of all signers into the final
+// 64 bytes BIP340 signature, valid for the (tweaked) x-only aggregate public key.
+func PartialSigAgg(psigs [][]byte, session *SessionContext) ([]byte, error) {
+	values, err := session.values()
+	if err != nil {
+		return nil, err
+	}
+	s := big.NewInt(0)
+	for i, psig := range psigs {
+		si := new(big.Int).SetBytes(psig)
+		if len(psig) != 32 || si.Cmp(curveOrder) >= 0 {
+			return nil, &InvalidContributionError{Signer: i, Contrib: "psig"}
+		}
+		s.Add(s, si)
+	}
+	g := big.NewInt(1)
+	if !values.q.hasEvenY() {
+		g = new(big.Int).Sub(curveOrder, big.NewInt(1))
+	}
+	egt := new(big.Int).Mul(values.e, g)
+	egt.Mul(egt, values.tacc)
+	s.Add(s, egt).Mod(s, curveOrder)
+	return append(values.r.xBytes(), scalarBytes(s)...), nil
+}
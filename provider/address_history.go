@@ -0,0 +1,131 @@
+package provider
+
+import (
+	"context"
+	"math/big"
+	"strings"
+
+	"github.com/mrtnetwork/bitcoin/address"
+)
+
+// AddressHistoryItem is a transaction of the history of an address with its effect on the address.
+type AddressHistoryItem struct {
+	ChainTransaction
+
+	// Confirmations is the number of blocks including and following the one of the transaction,
+	// 0 while the transaction is in the mempool.
+	Confirmations int
+
+	// Received is the value of the outputs paying the address, Sent the value of the inputs
+	// spending its outputs and Net the difference, negative when the address spent coins.
+	Received *big.Int
+	Sent     *big.Int
+	Net      *big.Int
+}
+
+// Pending reports whether the transaction is still unconfirmed.
+func (item *AddressHistoryItem) Pending() bool {
+	return !item.Status.Confirmed
+}
+
+// NewAddressHistoryItem returns the history item of a transaction for addr, tip is the height of
+// the chain tip used to count the confirmations.
+func NewAddressHistoryItem(transaction ChainTransaction, addr address.BitcoinAddress, network address.NetworkInfo, tip int) AddressHistoryItem {
+	item := AddressHistoryItem{ChainTransaction: transaction, Received: big.NewInt(0), Sent: big.NewInt(0)}
+	// the backends return the address, the script or both
+	shown := addr.Show(network)
+	script := addr.ToScriptPubKey().ToHex()
+	owns := func(addressOf string, scriptOf string) bool {
+		return (addressOf != "" && addressOf == shown) || (scriptOf != "" && strings.EqualFold(scriptOf, script))
+	}
+	for _, input := range transaction.Inputs {
+		if input.Value != nil && owns(input.Address, input.ScriptPubKey) {
+			item.Sent.Add(item.Sent, input.Value)
+		}
+	}
+	for _, output := range transaction.Outputs {
+		if output.Value != nil && owns(output.Address, output.ScriptPubKey) {
+			item.Received.Add(item.Received, output.Value)
+		}
+	}
+	item.Net = new(big.Int).Sub(item.Received, item.Sent)
+	if transaction.Status.Confirmed {
+		// a block mined after the tip was read
+		if tip < transaction.Status.BlockHeight {
+			tip = transaction.Status.BlockHeight
+		}
+		item.Confirmations = tip - transaction.Status.BlockHeight + 1
+	}
+	return item
+}
+
+// AddressHistory iterates over the history of an address page by page, most recent first, with the
+// unconfirmed transactions first. The pages of the backend are followed transparently and a
+// transaction moving between two pages while iterating is returned once.
+type AddressHistory struct {
+	provider ChainProvider
+	addr     address.BitcoinAddress
+	network  address.NetworkInfo
+
+	cursor string
+	tip    int
+	done   bool
+	seen   map[string]bool
+}
+
+// NewAddressHistory returns the history of addr fetched from provider.
+func NewAddressHistory(provider ChainProvider, addr address.BitcoinAddress, network address.NetworkInfo) *AddressHistory {
+	return &AddressHistory{provider: provider, addr: addr, network: network, tip: -1, seen: map[string]bool{}}
+}
+
+// Done reports whether the last page was returned.
+func (history *AddressHistory) Done() bool {
+	return history.done
+}
+
+// Next returns the items of the next page, nil once Done.
+func (history *AddressHistory) Next(ctx context.Context) ([]AddressHistoryItem, error) {
+	if history.done {
+		return nil, nil
+	}
+	if history.tip < 0 {
+		tip, err := history.provider.GetBlockHeight(ctx)
+		if err != nil {
+			return nil, err
+		}
+		history.tip = tip
+	}
+	page, err := history.provider.GetAccountTransactions(ctx, history.addr, history.cursor)
+	if err != nil {
+		return nil, err
+	}
+	items := []AddressHistoryItem{}
+	for _, transaction := range page.Transactions {
+		if history.seen[transaction.TxId] {
+			continue
+		}
+		history.seen[transaction.TxId] = true
+		items = append(items, NewAddressHistoryItem(transaction, history.addr, history.network, history.tip))
+	}
+	history.cursor = page.Next
+	history.done = page.Next == ""
+	return items, nil
+}
+
+// All returns the items of the remaining pages.
+func (history *AddressHistory) All(ctx context.Context) ([]AddressHistoryItem, error) {
+	items := []AddressHistoryItem{}
+	for !history.done {
+		page, err := history.Next(ctx)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, page...)
+	}
+	return items, nil
+}
+
+// GetAddressHistory returns the whole history of addr, most recent first.
+func GetAddressHistory(ctx context.Context, provider ChainProvider, addr address.BitcoinAddress, network address.NetworkInfo) ([]AddressHistoryItem, error) {
+	return NewAddressHistory(provider, addr, network).All(ctx)
+}
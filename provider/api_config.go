@@ -1,9 +1,7 @@
-// access BlockCypher and Mempool APIs for fetching UTXos, transaction data, network fees, and sending transactions in the Bitcoin network
+// access BlockCypher, Mempool and Esplora APIs, Bitcoin Core nodes and Electrum servers for fetching UTXos, transaction data, network fees, and sending transactions in the Bitcoin network, the mempool.space WebSocket API and the ZMQ notifications of Bitcoin Core for real-time notifications
 package provider
 
 import (
-	"strings"
-
 	"github.com/mrtnetwork/bitcoin/address"
 )
 
@@ -12,18 +10,9 @@ type APIType int
 const (
 	MempoolApi APIType = iota
 	BlockCyperApi
+	BlockstreamApi
 )
 
-type aPIConfig struct {
-	URL             string
-	FeeRate         string
-	Transaction     string
-	Transactions    string
-	SendTransaction string
-	ApiType         APIType
-	Network         address.Network
-}
-
 const (
 	blockCypherBaseURL = "https://api.blockcypher.com/v1/btc/test3"
 	mempoolBaseURL     = "https://mempool.space/testnet/api"
@@ -35,96 +24,26 @@ const (
 	blockstreamMainBaseURL = "https://blockstream.info/api"
 )
 
-func createMempolApi(network address.NetworkInfo) *aPIConfig {
-	baseUrl := mempoolMainBaseURL
-	if !network.IsMainNet() {
-		baseUrl = mempoolBaseURL
-	}
-
-	return &aPIConfig{
-		URL:             baseUrl + "/address/###/utxo",
-		FeeRate:         baseUrl + "/v1/fees/recommended",
-		Transaction:     baseUrl + "/tx/###",
-		SendTransaction: baseUrl + "/tx",
-		ApiType:         MempoolApi,
-		Transactions:    baseUrl + "/address/###/txs",
-		Network:         network.Network(),
-	}
-}
-func createBlockCyperApi(network address.NetworkInfo) *aPIConfig {
-	baseUrl := blockCypherMianBaseURL
-	if !network.IsMainNet() {
-		baseUrl = blockCypherBaseURL
-	}
-
-	return &aPIConfig{
-		URL:             baseUrl + "/addrs/###/?unspentOnly=true&includeScript=true&limit=2000",
-		FeeRate:         baseUrl,
-		Transaction:     baseUrl + "/txs/###",
-		SendTransaction: baseUrl + "/txs/push",
-		Transactions:    baseUrl + "/addrs/###/full?limit=200",
-		ApiType:         BlockCyperApi,
-		Network:         network.Network(),
-	}
-}
-
-// SelectApi chooses and returns the appropriate API configuration based on the given APIType
-// and network information.
+// SelectApi returns the ChainProvider of the given APIType and network, sending its requests
+// with http.DefaultClient. Use NewMempoolProvider, NewBlockCypherProvider or NewEsploraProvider to
+// inject a client.
 //
 // Parameters:
 // - apitype: The APIType representing the desired API.
 // - network: The address.NetworkInfo providing network-specific details.
-func SelectApi(apitype APIType, network address.NetworkInfo) *aPIConfig {
+func SelectApi(apitype APIType, network address.NetworkInfo) ChainProvider {
 	switch apitype {
 	case MempoolApi:
 		{
-			return createMempolApi(network)
-		}
-	default:
-		{
-			return createBlockCyperApi(network)
+			return NewMempoolProvider(network, nil)
 		}
-	}
-}
-
-// Return UTXO url contains address
-func (api *aPIConfig) GetUtxoUrl(address string) string {
-	baseUrl := api.URL
-	return strings.Replace(baseUrl, "###", address, -1)
-}
-
-// Return Network Fee api url contains address
-func (api *aPIConfig) GetFeeApiUrl() string {
-	return api.FeeRate
-}
-
-// get current network of api
-func (api *aPIConfig) GetNetwork() address.NetworkInfo {
-	switch api.Network {
-	case address.Mainnet:
+	case BlockstreamApi:
 		{
-			return &address.MainnetNetwork
+			return NewEsploraProvider(network, nil)
 		}
 	default:
 		{
-			return &address.TestnetNetwork
+			return NewBlockCypherProvider(network, nil)
 		}
 	}
 }
-
-// get send transaction url
-func (api *aPIConfig) GetSendTransactionUrl() string {
-	return api.SendTransaction
-}
-
-// get transaction url contains hash
-func (api *aPIConfig) GetTransactionUrl(transactionId string) string {
-	baseUrl := api.Transaction
-	return strings.Replace(baseUrl, "###", transactionId, -1)
-}
-
-// get account transaction url contains address
-func (api *aPIConfig) GetTransactionsUrl(address string) string {
-	baseUrl := api.Transactions
-	return strings.Replace(baseUrl, "###", address, -1)
-}
@@ -0,0 +1,115 @@
+package provider
+
+import (
+	"encoding/binary"
+	"fmt"
+	"time"
+
+	"github.com/mrtnetwork/bitcoin/digest"
+	"github.com/mrtnetwork/bitcoin/formating"
+	"github.com/mrtnetwork/bitcoin/scripts"
+)
+
+// BlockHeader is the 80 bytes header of a block.
+type BlockHeader struct {
+	// Hash of the block as displayed by explorers.
+	Hash string
+
+	// Height of the block, 0 when parsed from raw bytes.
+	Height int
+
+	Version    int32
+	PrevBlock  string
+	MerkleRoot string
+	Time       time.Time
+	Bits       uint32
+	Nonce      uint32
+}
+
+// Block is a block with its transactions.
+type Block struct {
+	Header BlockHeader
+
+	// Transactions of the block, the coinbase first.
+	Transactions []*scripts.BtcTransaction
+
+	// TxIds are the ids of Transactions, computed from their raw bytes.
+	TxIds []string
+}
+
+// MerkleProof is the merkle proof of the inclusion of a transaction in a block.
+type MerkleProof struct {
+	BlockHeight int `json:"block_height"`
+
+	// Merkle holds the hashes of the branch from the transaction to the merkle root.
+	Merkle []string `json:"merkle"`
+
+	// Pos is the index of the transaction in the block.
+	Pos int `json:"pos"`
+}
+
+// ParseBlockHeader parses the 80 bytes header of a block.
+func ParseBlockHeader(header []byte) (*BlockHeader, error) {
+	if len(header) < 80 {
+		return nil, fmt.Errorf("invalid block header length")
+	}
+	header = header[:80]
+	return &BlockHeader{
+		Hash:       formating.BytesToHex(formating.ReverseBytes(digest.DoubleHash(header))),
+		Version:    int32(binary.LittleEndian.Uint32(header[0:4])),
+		PrevBlock:  formating.BytesToHex(formating.ReverseBytes(formating.CopyBytes(header[4:36]))),
+		MerkleRoot: formating.BytesToHex(formating.ReverseBytes(formating.CopyBytes(header[36:68]))),
+		Time:       time.Unix(int64(binary.LittleEndian.Uint32(header[68:72])), 0),
+		Bits:       binary.LittleEndian.Uint32(header[72:76]),
+		Nonce:      binary.LittleEndian.Uint32(header[76:80]),
+	}, nil
+}
+
+// ParseBlock parses a serialized block.
+func ParseBlock(raw []byte) (block *Block, err error) {
+	// the transactions come from the network and the parser does not bound-check every field
+	defer func() {
+		if recover() != nil {
+			block, err = nil, fmt.Errorf("invalid block")
+		}
+	}()
+	header, err := ParseBlockHeader(raw)
+	if err != nil {
+		return nil, err
+	}
+	block = &Block{Header: *header}
+	count, cursor := formating.ViToInt(raw[80:])
+	cursor += 80
+	for i := 0; i < count; i++ {
+		tx, size, err := scripts.BtcTransactionFromBytes(raw[cursor:])
+		if err != nil {
+			return nil, err
+		}
+		block.Transactions = append(block.Transactions, tx)
+		block.TxIds = append(block.TxIds, txIdFromRaw(raw[cursor:cursor+size], tx))
+		cursor += size
+	}
+	if cursor != len(raw) {
+		return nil, fmt.Errorf("invalid block length")
+	}
+	return block, nil
+}
+
+// stripWitness returns the serialization of a parsed transaction without its witnesses, from its
+// raw bytes and without relying on the serialization of its scripts (coinbase scripts are arbitrary bytes)
+func stripWitness(raw []byte, tx *scripts.BtcTransaction) []byte {
+	if !tx.HasSegwit {
+		return raw
+	}
+	witnessSize := 0
+	for _, witness := range tx.Witnesses {
+		witnessSize += len(formating.EncodeVarint(len(witness.Stack))) + len(witness.ToBytes())
+	}
+	stripped := append(formating.CopyBytes(raw[0:4]), raw[6:len(raw)-4-witnessSize]...)
+	return append(stripped, raw[len(raw)-4:]...)
+}
+
+// txIdFromRaw returns the id of a parsed transaction from its raw bytes
+func txIdFromRaw(raw []byte, tx *scripts.BtcTransaction) string {
+	return formating.BytesToHex(formating.ReverseBytes(digest.DoubleHash(stripWitness(raw, tx))))
+}
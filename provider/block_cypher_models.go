@@ -30,19 +30,25 @@ type blockCypherUtxo struct {
 	UnconfirmedNTx     int     `json:"unconfirmed_n_tx"`
 	FinalNTx           int     `json:"final_n_tx"`
 	TxRefs             []TxRef `json:"txrefs"`
+	UnconfirmedTxRefs  []TxRef `json:"unconfirmed_txrefs"`
 	TxURL              string  `json:"tx_url"`
 }
 
 func (info *blockCypherUtxo) ToUtxoWithOwner(owner UtxoOwnerDetails) UtxoWithOwnerList {
-	utxos := make([]UtxoWithOwner, len(info.TxRefs))
-	for i := 0; i < len(info.TxRefs); i++ {
+	refs := append(info.TxRefs, info.UnconfirmedTxRefs...)
+	utxos := make([]UtxoWithOwner, len(refs))
+	for i := 0; i < len(refs); i++ {
+		height := refs[i].BlockHeight
+		if height < 0 {
+			height = 0
+		}
 		utxos[i] = UtxoWithOwner{
 			Utxo: BitcoinUtxo{
-				TxHash:      info.TxRefs[i].TxHash,
-				Value:       &info.TxRefs[i].Value,
-				Vout:        info.TxRefs[i].TxOutputN,
+				TxHash:      refs[i].TxHash,
+				Value:       &refs[i].Value,
+				Vout:        refs[i].TxOutputN,
 				ScriptType:  owner.Address.GetType(),
-				BlockHeight: 1,
+				BlockHeight: height,
 			},
 			OwnerDetails: owner,
 		}
@@ -57,6 +63,7 @@ type BlocCypherTransactionInput struct {
 	OutputValue int      `json:"output_value"`
 	Sequence    int      `json:"sequence"`
 	Addresses   []string `json:"addresses"`
+	Script      string   `json:"script"`
 	ScriptType  string   `json:"script_type"`
 	Age         int      `json:"age"`
 	Witness     []string `json:"witness"`
@@ -74,6 +81,7 @@ type BlocCyperTransactionOutput struct {
 type BlocCyperTransaction struct {
 	BlockHeight   int                          `json:"block_height"`
 	BlockIndex    int                          `json:"block_index"`
+	BlockHash     string                       `json:"block_hash"`
 	Hash          string                       `json:"hash"`
 	Addresses     []string                     `json:"addresses"`
 	Total         int                          `json:"total"`
@@ -83,7 +91,9 @@ type BlocCyperTransaction struct {
 	Preference    string                       `json:"preference"`
 	RelayedBy     string                       `json:"relayed_by"`
 	Received      time.Time                    `json:"received"`
+	Confirmed     time.Time                    `json:"confirmed"`
 	Ver           int                          `json:"ver"`
+	LockTime      int                          `json:"lock_time"`
 	DoubleSpend   bool                         `json:"double_spend"`
 	VinSz         int                          `json:"vin_sz"`
 	VoutSz        int                          `json:"vout_sz"`
@@ -104,6 +114,7 @@ type BlockCypherAddressInfo struct {
 	UnconfirmedNumTx   int                        `json:"unconfirmed_n_tx"`
 	FinalNumTx         int                        `json:"final_n_tx"`
 	TXs                BlockCypherTransactionList `json:"txs"`
+	HasMore            bool                       `json:"hasMore"`
 }
 
 type BlockCypherTransactionList []BlocCyperTransaction
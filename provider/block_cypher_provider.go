@@ -0,0 +1,323 @@
+package provider
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/mrtnetwork/bitcoin/address"
+)
+
+// blockCypherPageSize is the number of transactions requested per page of the BlockCypher address API
+const blockCypherPageSize = 50
+
+// blockCypherMempoolCursor starts the cursors of the pages of unconfirmed transactions
+const blockCypherMempoolCursor = "mempool:"
+
+// BlockCypherProvider is the ChainProvider of the BlockCypher REST API.
+type BlockCypherProvider struct {
+	// BaseURL of the API, for example https://api.blockcypher.com/v1/btc/main.
+	BaseURL string
+
+	// Token is the optional API token, added to every request to raise the rate limits.
+	Token string
+
+	// Network of the addresses.
+	Network address.NetworkInfo
+
+	rest restClient
+}
+
+// NewBlockCypherProvider returns the provider of the public BlockCypher API of the network.
+// A nil client uses http.DefaultClient.
+func NewBlockCypherProvider(network address.NetworkInfo, client *http.Client) *BlockCypherProvider {
+	baseUrl := blockCypherMianBaseURL
+	if !network.IsMainNet() {
+		baseUrl = blockCypherBaseURL
+	}
+	return &BlockCypherProvider{BaseURL: baseUrl, Network: network, rest: newRestClient(client)}
+}
+
+// url returns the url of path with the query parameters and the token
+func (api *BlockCypherProvider) url(path string, query ...string) string {
+	if api.Token != "" {
+		query = append(query, "token="+api.Token)
+	}
+	if len(query) == 0 {
+		return api.BaseURL + path
+	}
+	return api.BaseURL + path + "?" + strings.Join(query, "&")
+}
+
+// GetAccountUtxo returns the confirmed and unconfirmed unspent transaction outputs of the owner's address.
+func (api *BlockCypherProvider) GetAccountUtxo(ctx context.Context, owner UtxoOwnerDetails) (UtxoWithOwnerList, error) {
+	var addressInfo blockCypherUtxo
+	url := api.url("/addrs/"+owner.Address.Show(api.Network), "unspentOnly=true", "includeScript=true", "limit=2000")
+	if err := api.rest.get(ctx, url, &addressInfo); err != nil {
+		return nil, err
+	}
+	return addressInfo.ToUtxoWithOwner(owner), nil
+}
+
+// GetTransaction returns the transaction with the given id.
+func (api *BlockCypherProvider) GetTransaction(ctx context.Context, transactionId string) (*ChainTransaction, error) {
+	var transaction BlocCyperTransaction
+	if err := api.rest.get(ctx, api.url("/txs/"+transactionId), &transaction); err != nil {
+		return nil, err
+	}
+	return transaction.ToChainTransaction(), nil
+}
+
+// GetAccountTransactions returns a page of 50 transactions of an address. The full address
+// endpoint only pages by block height, so the cursor is the height of the last block of the
+// previous page with the ids of its transactions already returned, the next page restarts at this
+// block and skips them. The transactions of a block or of the mempool not fitting in a page are
+// listed from the transaction references of the address and fetched one by one.
+func (api *BlockCypherProvider) GetAccountTransactions(ctx context.Context, addr address.BitcoinAddress, cursor string) (*TransactionPage, error) {
+	if ids, ok := strings.CutPrefix(cursor, blockCypherMempoolCursor); ok {
+		return api.mempoolTransactions(ctx, addr, blockCypherSeen(ids))
+	}
+	query := []string{"limit=" + strconv.Itoa(blockCypherPageSize)}
+	height, seen := 0, map[string]bool{}
+	if cursor != "" {
+		heightPart, ids, _ := strings.Cut(cursor, ":")
+		var err error
+		if height, err = strconv.Atoi(heightPart); err != nil {
+			return nil, fmt.Errorf("invalid cursor %s", cursor)
+		}
+		seen = blockCypherSeen(ids)
+		query = append(query, "before="+strconv.Itoa(height+1))
+	}
+	var addressInfo BlockCypherAddressInfo
+	if err := api.rest.get(ctx, api.url("/addrs/"+addr.Show(api.Network)+"/full", query...), &addressInfo); err != nil {
+		return nil, err
+	}
+	page := &TransactionPage{}
+	for _, transaction := range addressInfo.TXs {
+		// the unconfirmed transactions are only listed before the first block
+		if seen[transaction.Hash] || (cursor != "" && transaction.BlockHeight < 0) {
+			continue
+		}
+		page.Transactions = append(page.Transactions, *transaction.ToChainTransaction())
+	}
+	if !addressInfo.HasMore || len(addressInfo.TXs) == 0 {
+		return page, nil
+	}
+	last := addressInfo.TXs[len(addressInfo.TXs)-1].BlockHeight
+	if last < 0 {
+		// the page is full of unconfirmed transactions
+		page.Next = blockCypherMempoolCursor + blockCypherIds(page.Transactions, -1, nil)
+		return page, nil
+	}
+	if len(page.Transactions) == 0 {
+		// every transaction of the page is in the block of the cursor, already returned
+		return api.blockTransactions(ctx, addr, height, seen)
+	}
+	if last != height {
+		seen = nil
+	}
+	page.Next = strconv.Itoa(last) + ":" + blockCypherIds(page.Transactions, last, seen)
+	return page, nil
+}
+
+// blockTransactions returns the next transactions of the block at height not returned yet
+func (api *BlockCypherProvider) blockTransactions(ctx context.Context, addr address.BitcoinAddress, height int, seen map[string]bool) (*TransactionPage, error) {
+	var addressInfo blockCypherUtxo
+	url := api.url("/addrs/"+addr.Show(api.Network), "limit=2000", "before="+strconv.Itoa(height+1), "after="+strconv.Itoa(height-1))
+	if err := api.rest.get(ctx, url, &addressInfo); err != nil {
+		return nil, err
+	}
+	// the block is done, the next page starts below it
+	return api.referencedTransactions(ctx, addressInfo.TxRefs, seen, strconv.Itoa(height)+":", strconv.Itoa(height-1)+":")
+}
+
+// mempoolTransactions returns the next unconfirmed transactions not returned yet, then continues
+// with the confirmed ones from the highest block of the address
+func (api *BlockCypherProvider) mempoolTransactions(ctx context.Context, addr address.BitcoinAddress, seen map[string]bool) (*TransactionPage, error) {
+	var addressInfo blockCypherUtxo
+	if err := api.rest.get(ctx, api.url("/addrs/"+addr.Show(api.Network), "limit=2000"), &addressInfo); err != nil {
+		return nil, err
+	}
+	next := ""
+	for _, ref := range addressInfo.TxRefs {
+		if ref.BlockHeight > 0 {
+			next = strconv.Itoa(ref.BlockHeight) + ":"
+			break
+		}
+	}
+	return api.referencedTransactions(ctx, addressInfo.UnconfirmedTxRefs, seen, blockCypherMempoolCursor, next)
+}
+
+// referencedTransactions fetches a page of the transactions of refs not seen. The next cursor is
+// prefix with the ids returned while transactions remain, otherwise done.
+func (api *BlockCypherProvider) referencedTransactions(ctx context.Context, refs []TxRef, seen map[string]bool, prefix string, done string) (*TransactionPage, error) {
+	ids := []string{}
+	for _, ref := range refs {
+		if !seen[ref.TxHash] {
+			seen[ref.TxHash] = true
+			ids = append(ids, ref.TxHash)
+		}
+	}
+	page := &TransactionPage{}
+	for i := 0; i < len(ids) && i < blockCypherPageSize; i++ {
+		transaction, err := api.GetTransaction(ctx, ids[i])
+		if err != nil {
+			return nil, err
+		}
+		page.Transactions = append(page.Transactions, *transaction)
+	}
+	if len(ids) <= blockCypherPageSize {
+		page.Next = done
+		return page, nil
+	}
+	for _, id := range ids[blockCypherPageSize:] {
+		delete(seen, id)
+	}
+	returned := make([]string, 0, len(seen))
+	for id := range seen {
+		returned = append(returned, id)
+	}
+	sort.Strings(returned)
+	page.Next = prefix + strings.Join(returned, ",")
+	return page, nil
+}
+
+// blockCypherIds joins the ids of seen and of the transactions at height, -1 for the unconfirmed
+// ones
+func blockCypherIds(transactions []ChainTransaction, height int, seen map[string]bool) string {
+	ids := []string{}
+	for id := range seen {
+		ids = append(ids, id)
+	}
+	for _, transaction := range transactions {
+		if (height < 0 && !transaction.Status.Confirmed) || (transaction.Status.Confirmed && transaction.Status.BlockHeight == height) {
+			ids = append(ids, transaction.TxId)
+		}
+	}
+	sort.Strings(ids)
+	return strings.Join(ids, ",")
+}
+
+// blockCypherSeen returns the set of the ids of a cursor
+func blockCypherSeen(ids string) map[string]bool {
+	seen := map[string]bool{}
+	for _, id := range strings.Split(ids, ",") {
+		if id != "" {
+			seen[id] = true
+		}
+	}
+	return seen
+}
+
+// GetNetworkFee returns the fee rates of the chain endpoint.
+func (api *BlockCypherProvider) GetNetworkFee(ctx context.Context) (*BitcoinFeeRate, error) {
+	var fee map[string]interface{}
+	if err := api.rest.get(ctx, api.url(""), &fee); err != nil {
+		return nil, err
+	}
+	for _, key := range []string{"high_fee_per_kb", "medium_fee_per_kb", "low_fee_per_kb"} {
+		if _, ok := fee[key].(float64); !ok {
+			return nil, fmt.Errorf("missing %s in the response", key)
+		}
+	}
+	return NewBitcoinFeeRateFromBlockCyper(fee), nil
+}
+
+// GetFeeEstimates returns the fee rates of the chain endpoint by confirmation target: the high
+// fee for 1 to 2 blocks, the medium fee for 3 to 6 blocks and the low fee for 7 blocks or more.
+func (api *BlockCypherProvider) GetFeeEstimates(ctx context.Context) (FeeEstimates, error) {
+	fee, err := api.GetNetworkFee(ctx)
+	if err != nil {
+		return nil, err
+	}
+	// the rates are in satoshis per 1000 bytes
+	return FeeEstimates{
+		1: FeeRateFromSatPerKvB(fee.High.Int64()),
+		3: FeeRateFromSatPerKvB(fee.Medium.Int64()),
+		7: FeeRateFromSatPerKvB(fee.Low.Int64()),
+	}, nil
+}
+
+// SendRawTransaction broadcasts a serialized transaction and returns its id.
+func (api *BlockCypherProvider) SendRawTransaction(ctx context.Context, rawTransaction string) (string, error) {
+	payload, err := json.Marshal(map[string]string{"tx": rawTransaction})
+	if err != nil {
+		return "", fmt.Errorf("error marshaling JSON: %v", err)
+	}
+	body, err := api.rest.do(ctx, http.MethodPost, api.url("/txs/push"), "application/json", payload)
+	if err != nil {
+		return "", err
+	}
+	var result struct {
+		Tx BlocCyperTransaction `json:"tx"`
+	}
+	if err := json.Unmarshal(body, &result); err != nil {
+		return "", fmt.Errorf("error decoding JSON: %v", err)
+	}
+	return result.Tx.Hash, nil
+}
+
+// GetBlockHeight returns the height of the chain tip.
+func (api *BlockCypherProvider) GetBlockHeight(ctx context.Context) (int, error) {
+	var chain struct {
+		Height int `json:"height"`
+	}
+	if err := api.rest.get(ctx, api.url(""), &chain); err != nil {
+		return 0, err
+	}
+	return chain.Height, nil
+}
+
+// ToChainTransaction converts the transaction to the type shared by every backend.
+func (transaction *BlocCyperTransaction) ToChainTransaction() *ChainTransaction {
+	result := &ChainTransaction{
+		TxId:     transaction.Hash,
+		Version:  transaction.Ver,
+		Locktime: transaction.LockTime,
+		Size:     transaction.Size,
+		VSize:    transaction.VSize,
+		Weight:   transaction.VSize * 4,
+		Fee:      big.NewInt(int64(transaction.Fees)),
+	}
+	// unconfirmed transactions have a block height of -1
+	if transaction.BlockHeight > 0 {
+		result.Status = TxStatus{
+			Confirmed:   true,
+			BlockHeight: transaction.BlockHeight,
+			BlockHash:   transaction.BlockHash,
+			BlockTime:   transaction.Confirmed,
+		}
+	}
+	for _, input := range transaction.Inputs {
+		result.Inputs = append(result.Inputs, ChainTxInput{
+			TxId:       input.PrevHash,
+			Vout:       input.OutputIndex,
+			Address:    firstAddress(input.Addresses),
+			Value:      big.NewInt(int64(input.OutputValue)),
+			ScriptSig:  input.Script,
+			Witness:    input.Witness,
+			Sequence:   uint32(input.Sequence),
+			IsCoinbase: input.PrevHash == "",
+		})
+	}
+	for _, output := range transaction.Outputs {
+		result.Outputs = append(result.Outputs, ChainTxOutput{
+			Address:      firstAddress(output.Addresses),
+			ScriptPubKey: output.Script,
+			Value:        big.NewInt(int64(output.Value)),
+		})
+	}
+	return result
+}
+
+func firstAddress(addresses []string) string {
+	if len(addresses) == 0 {
+		return ""
+	}
+	return addresses[0]
+}
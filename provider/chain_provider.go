@@ -0,0 +1,180 @@
+package provider
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"time"
+
+	"github.com/mrtnetwork/bitcoin/address"
+)
+
+// ChainProvider is implemented by every blockchain backend (Mempool, BlockCypher...). All results are
+// typed and every call takes a context, so requests can be cancelled or bounded with a deadline.
+type ChainProvider interface {
+	// GetAccountUtxo returns the unspent transaction outputs of the owner's address.
+	GetAccountUtxo(ctx context.Context, owner UtxoOwnerDetails) (UtxoWithOwnerList, error)
+
+	// GetTransaction returns the transaction with the given id, its inputs, outputs and status.
+	GetTransaction(ctx context.Context, transactionId string) (*ChainTransaction, error)
+
+	// GetAccountTransactions returns a page of the transactions of an address, most recent first.
+	// The first page is requested with an empty cursor, the following ones with the Next cursor
+	// of the previous page.
+	GetAccountTransactions(ctx context.Context, addr address.BitcoinAddress, cursor string) (*TransactionPage, error)
+
+	// GetNetworkFee returns the current high, medium and low fee rates.
+	GetNetworkFee(ctx context.Context) (*BitcoinFeeRate, error)
+
+	// SendRawTransaction broadcasts a serialized transaction in hexadecimal and returns its id.
+	SendRawTransaction(ctx context.Context, rawTransaction string) (string, error)
+
+	// GetBlockHeight returns the height of the chain tip.
+	GetBlockHeight(ctx context.Context) (int, error)
+}
+
+// TxStatus is the confirmation status of a transaction.
+type TxStatus struct {
+	// Confirmed reports whether the transaction is included in a block.
+	Confirmed bool
+
+	// BlockHeight is the height of the block including the transaction, 0 when unconfirmed.
+	BlockHeight int
+
+	// BlockHash is the hash of the block including the transaction, empty when unconfirmed.
+	BlockHash string
+
+	// BlockTime is the timestamp of the block including the transaction, zero when unconfirmed.
+	BlockTime time.Time
+}
+
+// ChainTxInput is an input of a ChainTransaction with the output it spends.
+type ChainTxInput struct {
+	// TxId and Vout identify the spent output.
+	TxId string
+	Vout int
+
+	// Address of the spent output, empty when the backend cannot decode it.
+	Address string
+
+	// Value of the spent output in satoshis.
+	Value *big.Int
+
+	// ScriptPubKey of the spent output in hexadecimal, empty when the backend does not return it.
+	ScriptPubKey string
+
+	// ScriptSig of the input in hexadecimal.
+	ScriptSig string
+
+	// Witness stack of the input in hexadecimal.
+	Witness []string
+
+	// Sequence of the input.
+	Sequence uint32
+
+	// IsCoinbase reports whether the input is the input of a coinbase transaction.
+	IsCoinbase bool
+}
+
+// ChainTxOutput is an output of a ChainTransaction.
+type ChainTxOutput struct {
+	// Address of the output, empty when the script has no address (OP_RETURN...).
+	Address string
+
+	// ScriptPubKey of the output in hexadecimal.
+	ScriptPubKey string
+
+	// Value of the output in satoshis.
+	Value *big.Int
+}
+
+// ChainTransaction is a transaction as returned by a ChainProvider.
+type ChainTransaction struct {
+	TxId     string
+	Version  int
+	Locktime int
+
+	// Size is the serialized size in bytes, VSize the virtual size and Weight the weight units.
+	Size   int
+	VSize  int
+	Weight int
+
+	// Fee paid by the transaction in satoshis.
+	Fee *big.Int
+
+	Inputs  []ChainTxInput
+	Outputs []ChainTxOutput
+	Status  TxStatus
+}
+
+// TransactionPage is a page of the transactions of an address.
+type TransactionPage struct {
+	// Transactions of the page, most recent first.
+	Transactions []ChainTransaction
+
+	// Next is the cursor of the next page, empty on the last page.
+	Next string
+}
+
+var (
+	// ErrRateLimited is returned when the backend rejects a request because of rate limiting.
+	ErrRateLimited = errors.New("rate limited")
+
+	// ErrNotFound is returned when the transaction, address or block is unknown to the backend.
+	ErrNotFound = errors.New("not found")
+
+	// ErrRejected is returned when the backend refuses to broadcast a transaction.
+	ErrRejected = errors.New("transaction rejected")
+
+	// ErrUnavailable is returned when the backend fails with a server error.
+	ErrUnavailable = errors.New("backend unavailable")
+
+	// ErrNotSupported is returned when the backend does not implement the request.
+	ErrNotSupported = errors.New("not supported by the backend")
+)
+
+// APIError is the error of a request answered with an unsuccessful status. Use errors.Is with
+// ErrRateLimited, ErrNotFound, ErrRejected or ErrUnavailable to check its kind.
+type APIError struct {
+	// StatusCode is the HTTP status of the response.
+	StatusCode int
+
+	// Message is the body of the response.
+	Message string
+
+	// RetryAfter is the delay requested by a rate limited response, zero when not specified.
+	RetryAfter time.Duration
+
+	// Err is the kind of the error, nil for other statuses.
+	Err error
+}
+
+func (e *APIError) Error() string {
+	if e.Err == nil {
+		return fmt.Sprintf("request failed with status %d: %s", e.StatusCode, e.Message)
+	}
+	return fmt.Sprintf("%v (status %d): %s", e.Err, e.StatusCode, e.Message)
+}
+
+func (e *APIError) Unwrap() error {
+	return e.Err
+}
+
+var (
+	_ ChainProvider = (*MempoolProvider)(nil)
+	_ ChainProvider = (*BlockCypherProvider)(nil)
+	_ ChainProvider = (*RPCProvider)(nil)
+	_ ChainProvider = (*ElectrumProvider)(nil)
+	_ ChainProvider = (*EsploraProvider)(nil)
+	_ ChainProvider = (*CompositeProvider)(nil)
+
+	_ FeeSource = (*MempoolProvider)(nil)
+	_ FeeSource = (*BlockCypherProvider)(nil)
+	_ FeeSource = (*RPCProvider)(nil)
+	_ FeeSource = (*ElectrumProvider)(nil)
+	_ FeeSource = (*EsploraProvider)(nil)
+	_ FeeSource = (*CompositeProvider)(nil)
+	_ FeeSource = (*FeeEstimator)(nil)
+	_ FeeSource = (*BlockPolicyEstimator)(nil)
+)
@@ -0,0 +1,145 @@
+package provider
+
+import (
+	"math/big"
+	"time"
+)
+
+// DustAttackThreshold is the value in satoshis up to which an output paying an address that
+// already received funds is suspected to be a dust attack: spending it with the other coins of
+// the wallet would link them.
+const DustAttackThreshold = 1000
+
+// CoinMetadata holds the coin control state of a UTXO. The zero value is a coin spendable without
+// restriction.
+type CoinMetadata struct {
+	// Frozen coins are never spent unless CoinControl.IncludeFrozen is set.
+	Frozen bool `json:"frozen,omitempty"`
+
+	// ReservedUntil keeps the coin for a pending payment until the given time, the coin is not
+	// spent before unless CoinControl.IncludeReserved is set.
+	ReservedUntil time.Time `json:"reserved_until,omitempty"`
+
+	// Labels of the coin, for example "kyc" or "payout".
+	Labels []string `json:"labels,omitempty"`
+
+	// Origin of the coin, for example the exchange or the customer who sent it.
+	Origin string `json:"origin,omitempty"`
+
+	// Quarantined is set on the suspected dust attack outputs, they are not spent unless
+	// CoinControl.IncludeQuarantined is set.
+	Quarantined bool `json:"quarantined,omitempty"`
+}
+
+// IsReserved returns whether the coin is reserved at the given time.
+func (metadata *CoinMetadata) IsReserved(now time.Time) bool {
+	return now.Before(metadata.ReservedUntil)
+}
+
+// HasLabel returns whether the coin has the label.
+func (metadata *CoinMetadata) HasLabel(label string) bool {
+	for _, element := range metadata.Labels {
+		if element == label {
+			return true
+		}
+	}
+	return false
+}
+
+// CoinControl selects the UTXOs spent by the transaction builder. The zero value excludes the
+// frozen, reserved and quarantined coins.
+type CoinControl struct {
+	// IncludeFrozen, IncludeReserved and IncludeQuarantined allow spending the coins kept by
+	// their metadata.
+	IncludeFrozen      bool
+	IncludeReserved    bool
+	IncludeQuarantined bool
+
+	// Labels, when not empty, only selects the coins with one of the labels. ExcludeLabels never
+	// selects the coins with one of the labels.
+	Labels        []string
+	ExcludeLabels []string
+
+	// Origins, when not empty, only selects the coins of one of the origins. ExcludeOrigins never
+	// selects the coins of one of the origins.
+	Origins        []string
+	ExcludeOrigins []string
+
+	// Now is the time compared to the reservations, the current time when zero.
+	Now time.Time
+}
+
+// Allows returns whether the UTXO is selected.
+func (control *CoinControl) Allows(utxo UtxoWithOwner) bool {
+	metadata := &utxo.Metadata
+	if metadata.Frozen && !control.IncludeFrozen {
+		return false
+	}
+	if metadata.Quarantined && !control.IncludeQuarantined {
+		return false
+	}
+	now := control.Now
+	if now.IsZero() {
+		now = time.Now()
+	}
+	if metadata.IsReserved(now) && !control.IncludeReserved {
+		return false
+	}
+	if len(control.Labels) != 0 && !hasAny(metadata.Labels, control.Labels) {
+		return false
+	}
+	if hasAny(metadata.Labels, control.ExcludeLabels) {
+		return false
+	}
+	if len(control.Origins) != 0 && !hasAny([]string{metadata.Origin}, control.Origins) {
+		return false
+	}
+	return !hasAny([]string{metadata.Origin}, control.ExcludeOrigins)
+}
+
+// Select returns the UTXOs allowed by the coin control.
+func (utxos UtxoWithOwnerList) Select(control CoinControl) UtxoWithOwnerList {
+	selected := UtxoWithOwnerList{}
+	for _, utxo := range utxos {
+		if control.Allows(utxo) {
+			selected = append(selected, utxo)
+		}
+	}
+	return selected
+}
+
+// QuarantineDust quarantines the suspected dust attack outputs of the list: the outputs up to
+// threshold satoshis paying an address that has other outputs in the list or whose script
+// (ScriptPubKey in hexadecimal) reused reports as already used, for example from its history.
+// reused may be nil. It returns the number of outputs quarantined.
+func (utxos UtxoWithOwnerList) QuarantineDust(threshold *big.Int, reused func(scriptPubKey string) bool) int {
+	count := map[string]int{}
+	for _, utxo := range utxos {
+		count[utxo.OwnerDetails.Address.ToScriptPubKey().ToHex()]++
+	}
+	quarantined := 0
+	for i := range utxos {
+		utxo := &utxos[i]
+		if utxo.Metadata.Quarantined || utxo.Utxo.Value.Cmp(threshold) > 0 {
+			continue
+		}
+		script := utxo.OwnerDetails.Address.ToScriptPubKey().ToHex()
+		if count[script] > 1 || (reused != nil && reused(script)) {
+			utxo.Metadata.Quarantined = true
+			quarantined++
+		}
+	}
+	return quarantined
+}
+
+// hasAny returns whether values holds one of the elements
+func hasAny(values []string, elements []string) bool {
+	for _, value := range values {
+		for _, element := range elements {
+			if value == element {
+				return true
+			}
+		}
+	}
+	return false
+}
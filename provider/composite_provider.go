@@ -0,0 +1,464 @@
+package provider
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mrtnetwork/bitcoin/address"
+)
+
+// ErrNoQuorum is returned when the backends queried for a quorum read do not agree.
+var ErrNoQuorum = errors.New("backends disagree")
+
+// BackendStatus is the health of a backend of a CompositeProvider.
+type BackendStatus struct {
+	Provider ChainProvider
+
+	// Healthy is false while the backend is skipped after repeated failures or a rate limit.
+	Healthy bool
+
+	// Failures is the number of consecutive failures of the backend.
+	Failures int
+
+	// LastError is the last failure of the backend.
+	LastError error
+}
+
+// backend is a ChainProvider with its health
+type backend struct {
+	provider       ChainProvider
+	failures       int
+	lastError      error
+	unhealthyUntil time.Time
+}
+
+// CompositeProvider is a ChainProvider spreading the requests over several backends. A request
+// failing with a rate limit, a server or a network error is sent to the next backend, and when
+// every backend failed, retried after an exponential backoff. A backend failing repeatedly, or
+// rate limited with a Retry-After delay, is moved after the healthy ones until it recovers.
+type CompositeProvider struct {
+	// Quorum is the number of backends that must return the same UTXO set to GetAccountUtxo and
+	// GetBalance. 0 and 1 use the first backend answering.
+	Quorum int
+
+	// MaxRetries is the number of retries after every backend failed.
+	MaxRetries int
+
+	// BaseDelay is the delay before the first retry, doubled on each retry up to MaxDelay.
+	BaseDelay time.Duration
+	MaxDelay  time.Duration
+
+	// FailureThreshold is the number of consecutive failures after which a backend is unhealthy
+	// for Cooldown.
+	FailureThreshold int
+	Cooldown         time.Duration
+
+	mu       sync.Mutex
+	backends []*backend
+}
+
+// NewCompositeProvider returns the provider of the backends, tried in the given order.
+func NewCompositeProvider(backends ...ChainProvider) *CompositeProvider {
+	composite := &CompositeProvider{
+		MaxRetries:       3,
+		BaseDelay:        500 * time.Millisecond,
+		MaxDelay:         30 * time.Second,
+		FailureThreshold: 3,
+		Cooldown:         time.Minute,
+	}
+	for _, provider := range backends {
+		composite.backends = append(composite.backends, &backend{provider: provider})
+	}
+	return composite
+}
+
+// Status returns the health of the backends in the configured order.
+func (api *CompositeProvider) Status() []BackendStatus {
+	api.mu.Lock()
+	defer api.mu.Unlock()
+	now := time.Now()
+	status := make([]BackendStatus, len(api.backends))
+	for i, b := range api.backends {
+		status[i] = BackendStatus{Provider: b.provider, Healthy: !now.Before(b.unhealthyUntil), Failures: b.failures, LastError: b.lastError}
+	}
+	return status
+}
+
+// ordered returns the healthy backends in the configured order followed by the unhealthy ones,
+// the closest to recover first
+func (api *CompositeProvider) ordered() []*backend {
+	api.mu.Lock()
+	defer api.mu.Unlock()
+	now := time.Now()
+	healthy, unhealthy := []*backend{}, []*backend{}
+	for _, b := range api.backends {
+		if now.Before(b.unhealthyUntil) {
+			unhealthy = append(unhealthy, b)
+		} else {
+			healthy = append(healthy, b)
+		}
+	}
+	sort.SliceStable(unhealthy, func(i, j int) bool { return unhealthy[i].unhealthyUntil.Before(unhealthy[j].unhealthyUntil) })
+	return append(healthy, unhealthy...)
+}
+
+// report updates the health of a backend with the result of a request
+func (api *CompositeProvider) report(b *backend, err error) {
+	api.mu.Lock()
+	defer api.mu.Unlock()
+	if err == nil || !isBackendFailure(err) {
+		b.failures, b.lastError, b.unhealthyUntil = 0, nil, time.Time{}
+		return
+	}
+	b.failures++
+	b.lastError = err
+	if b.failures >= api.FailureThreshold {
+		b.unhealthyUntil = time.Now().Add(api.Cooldown)
+	}
+	var apiError *APIError
+	if errors.As(err, &apiError) && apiError.RetryAfter > 0 {
+		if until := time.Now().Add(apiError.RetryAfter); until.After(b.unhealthyUntil) {
+			b.unhealthyUntil = until
+		}
+	}
+}
+
+// isBackendFailure reports whether the error is a failure of the backend (rate limit, server or
+// network error) rather than an answer (not found, rejected, not supported)
+func isBackendFailure(err error) bool {
+	switch {
+	case errors.Is(err, ErrRateLimited), errors.Is(err, ErrUnavailable):
+		return true
+	case errors.Is(err, ErrNotFound), errors.Is(err, ErrRejected), errors.Is(err, ErrNotSupported),
+		errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
+		return false
+	}
+	var apiError *APIError
+	return !errors.As(err, &apiError)
+}
+
+// backoff waits before the retry following attempt, at least the Retry-After delay of err
+func (api *CompositeProvider) backoff(ctx context.Context, attempt int, err error) error {
+	delay := api.BaseDelay << attempt
+	var apiError *APIError
+	if errors.As(err, &apiError) && apiError.RetryAfter > delay {
+		delay = apiError.RetryAfter
+	}
+	if delay > api.MaxDelay || delay < 0 {
+		delay = api.MaxDelay
+	}
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// failover sends the request to the backends until one answers. An answer of a backend (not
+// found, rejected...) is returned when no other backend succeeds, the backend failures are
+// retried after a backoff.
+func (api *CompositeProvider) failover(ctx context.Context, request func(index int, provider ChainProvider) error) error {
+	if len(api.backends) == 0 {
+		return fmt.Errorf("no backend")
+	}
+	var failure error
+	for attempt := 0; ; attempt++ {
+		var answer error
+		for _, b := range api.ordered() {
+			err := request(api.index(b), b.provider)
+			api.report(b, err)
+			if err == nil {
+				return nil
+			}
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			if isBackendFailure(err) {
+				failure = err
+			} else if answer == nil {
+				answer = err
+			}
+		}
+		if answer != nil {
+			return answer
+		}
+		if attempt == api.MaxRetries {
+			return failure
+		}
+		if err := api.backoff(ctx, attempt, failure); err != nil {
+			return err
+		}
+	}
+}
+
+// retry sends the request to a single backend, retrying its failures after a backoff
+func (api *CompositeProvider) retry(ctx context.Context, b *backend, request func(provider ChainProvider) error) error {
+	for attempt := 0; ; attempt++ {
+		err := request(b.provider)
+		if err != nil && ctx.Err() != nil {
+			// the request was cancelled, it says nothing of the health of the backend
+			return ctx.Err()
+		}
+		api.report(b, err)
+		if err == nil || !isBackendFailure(err) || attempt == api.MaxRetries {
+			return err
+		}
+		if err := api.backoff(ctx, attempt, err); err != nil {
+			return err
+		}
+	}
+}
+
+func (api *CompositeProvider) index(b *backend) int {
+	for i := range api.backends {
+		if api.backends[i] == b {
+			return i
+		}
+	}
+	return -1
+}
+
+// GetAccountUtxo returns the unspent transaction outputs of the owner's address. With a Quorum,
+// the outputs are returned once Quorum backends answered the same outputs, and ErrNoQuorum when
+// no set of outputs can reach the quorum.
+func (api *CompositeProvider) GetAccountUtxo(ctx context.Context, owner UtxoOwnerDetails) (UtxoWithOwnerList, error) {
+	if api.Quorum <= 1 {
+		var utxos UtxoWithOwnerList
+		err := api.failover(ctx, func(index int, provider ChainProvider) (err error) {
+			utxos, err = provider.GetAccountUtxo(ctx, owner)
+			return err
+		})
+		return utxos, err
+	}
+	if api.Quorum > len(api.backends) {
+		return nil, fmt.Errorf("quorum of %d with %d backends", api.Quorum, len(api.backends))
+	}
+
+	// every backend is queried concurrently, the answers are grouped by set as they arrive and the
+	// backends still answering are cancelled once a set reaches the quorum
+	type answer struct {
+		utxos UtxoWithOwnerList
+		err   error
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	ordered := api.ordered()
+	answers := make(chan answer, len(ordered))
+	for _, b := range ordered {
+		go func(b *backend) {
+			var a answer
+			a.err = api.retry(ctx, b, func(provider ChainProvider) (err error) {
+				a.utxos, err = provider.GetAccountUtxo(ctx, owner)
+				return err
+			})
+			answers <- a
+		}(b)
+	}
+
+	counts := map[string]int{}
+	agreed, answered := 0, 0
+	var err error
+	for pending := len(ordered); pending > 0; pending-- {
+		a := <-answers
+		if a.err != nil {
+			err = a.err
+		} else {
+			key := utxoSetKey(a.utxos)
+			counts[key]++
+			answered++
+			if counts[key] == api.Quorum {
+				return a.utxos, nil
+			}
+			if counts[key] > agreed {
+				agreed = counts[key]
+			}
+		}
+		// no set reaches the quorum with the answers still pending
+		if agreed+pending-1 < api.Quorum {
+			break
+		}
+	}
+	if answered >= api.Quorum || err == nil {
+		return nil, fmt.Errorf("%w on the unspent outputs", ErrNoQuorum)
+	}
+	return nil, fmt.Errorf("%d of %d backends answered: %w", agreed, api.Quorum, err)
+}
+
+// utxoSetKey identifies a set of outputs regardless of their order and of the heights, which
+// differ between backends for the unconfirmed outputs
+func utxoSetKey(utxos UtxoWithOwnerList) string {
+	keys := make([]string, len(utxos))
+	for i, utxo := range utxos {
+		keys[i] = utxo.Utxo.TxHash + ":" + strconv.Itoa(utxo.Utxo.Vout) + ":" + utxo.Utxo.Value.String()
+	}
+	sort.Strings(keys)
+	return strings.Join(keys, ",")
+}
+
+// GetBalance returns the sum of the unspent outputs of the owner's address, read with the quorum
+// of GetAccountUtxo.
+func (api *CompositeProvider) GetBalance(ctx context.Context, owner UtxoOwnerDetails) (*big.Int, error) {
+	utxos, err := api.GetAccountUtxo(ctx, owner)
+	if err != nil {
+		return nil, err
+	}
+	balance := big.NewInt(0)
+	for _, utxo := range utxos {
+		balance.Add(balance, utxo.Utxo.Value)
+	}
+	return balance, nil
+}
+
+// GetTransaction returns the transaction with the given id.
+func (api *CompositeProvider) GetTransaction(ctx context.Context, transactionId string) (*ChainTransaction, error) {
+	var transaction *ChainTransaction
+	err := api.failover(ctx, func(index int, provider ChainProvider) (err error) {
+		transaction, err = provider.GetTransaction(ctx, transactionId)
+		return err
+	})
+	return transaction, err
+}
+
+// GetAccountTransactions returns a page of the transactions of an address. The cursors are
+// specific to each backend: the first page is read with failover and the following ones from
+// the backend of the first page.
+func (api *CompositeProvider) GetAccountTransactions(ctx context.Context, addr address.BitcoinAddress, cursor string) (*TransactionPage, error) {
+	var page *TransactionPage
+	if cursor == "" {
+		var pageBackend int
+		err := api.failover(ctx, func(index int, provider ChainProvider) (err error) {
+			page, err = provider.GetAccountTransactions(ctx, addr, "")
+			pageBackend = index
+			return err
+		})
+		if err != nil {
+			return nil, err
+		}
+		if page.Next != "" {
+			page.Next = strconv.Itoa(pageBackend) + ":" + page.Next
+		}
+		return page, nil
+	}
+	index, backendCursor, ok := strings.Cut(cursor, ":")
+	i, err := strconv.Atoi(index)
+	if !ok || err != nil || i < 0 || i >= len(api.backends) {
+		return nil, fmt.Errorf("invalid cursor %s", cursor)
+	}
+	err = api.retry(ctx, api.backends[i], func(provider ChainProvider) (err error) {
+		page, err = provider.GetAccountTransactions(ctx, addr, backendCursor)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	if page.Next != "" {
+		page.Next = index + ":" + page.Next
+	}
+	return page, nil
+}
+
+// GetNetworkFee returns the current high, medium and low fee rates.
+func (api *CompositeProvider) GetNetworkFee(ctx context.Context) (*BitcoinFeeRate, error) {
+	var fee *BitcoinFeeRate
+	err := api.failover(ctx, func(index int, provider ChainProvider) (err error) {
+		fee, err = provider.GetNetworkFee(ctx)
+		return err
+	})
+	return fee, err
+}
+
+// GetFeeEstimates returns the fee rates by confirmation target of the first backend answering,
+// use a FeeEstimator to combine the estimates of the backends.
+func (api *CompositeProvider) GetFeeEstimates(ctx context.Context) (FeeEstimates, error) {
+	var estimates FeeEstimates
+	err := api.failover(ctx, func(index int, provider ChainProvider) (err error) {
+		source, ok := provider.(FeeSource)
+		if !ok {
+			return ErrNotSupported
+		}
+		estimates, err = source.GetFeeEstimates(ctx)
+		return err
+	})
+	return estimates, err
+}
+
+// GetBlockHeight returns the height of the chain tip.
+func (api *CompositeProvider) GetBlockHeight(ctx context.Context) (int, error) {
+	var height int
+	err := api.failover(ctx, func(index int, provider ChainProvider) (err error) {
+		height, err = provider.GetBlockHeight(ctx)
+		return err
+	})
+	return height, err
+}
+
+// isAlreadyKnown reports whether a broadcast failed because the backend already knows the
+// transaction
+func isAlreadyKnown(err error) bool {
+	message := strings.ToLower(err.Error())
+	for _, known := range []string{"already in mempool", "txn-already-in-mempool", "txn-already-known", "already in block chain", "already exists"} {
+		if strings.Contains(message, known) {
+			return true
+		}
+	}
+	return false
+}
+
+// SendRawTransaction broadcasts a serialized transaction to every backend concurrently and returns
+// its id when one of them accepts it or already knows it. The failures of a backend are retried,
+// ErrRejected is returned when every backend rejects the transaction.
+func (api *CompositeProvider) SendRawTransaction(ctx context.Context, rawTransaction string) (string, error) {
+	if len(api.backends) == 0 {
+		return "", fmt.Errorf("no backend")
+	}
+	ids := make([]string, len(api.backends))
+	errs := make([]error, len(api.backends))
+	var wg sync.WaitGroup
+	for i, b := range api.backends {
+		wg.Add(1)
+		go func(i int, b *backend) {
+			defer wg.Done()
+			errs[i] = api.retry(ctx, b, func(provider ChainProvider) (err error) {
+				ids[i], err = provider.SendRawTransaction(ctx, rawTransaction)
+				return err
+			})
+		}(i, b)
+	}
+	wg.Wait()
+
+	known := false
+	var rejected, failure error
+	for i := range errs {
+		switch {
+		case errs[i] == nil:
+			return ids[i], nil
+		case isAlreadyKnown(errs[i]):
+			known = true
+		case errors.Is(errs[i], ErrRejected):
+			rejected = errs[i]
+		default:
+			failure = errs[i]
+		}
+	}
+	if known {
+		transaction, err := parseTransaction(rawTransaction)
+		if err != nil {
+			return "", err
+		}
+		return transaction.TxId(), nil
+	}
+	if rejected != nil {
+		return "", rejected
+	}
+	return "", failure
+}
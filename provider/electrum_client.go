@@ -0,0 +1,257 @@
+package provider
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"net"
+	"sync"
+
+	"github.com/mrtnetwork/bitcoin/address"
+)
+
+// electrumProtocolVersion is the version of the Electrum protocol negotiated with the server
+const electrumProtocolVersion = "1.4"
+
+// electrumChannelSize is the buffer of the subscription channels. When a subscriber falls behind,
+// the oldest notification is dropped, the last one always reflects the current state.
+const electrumChannelSize = 16
+
+// ElectrumError is an error returned by an Electrum server.
+type ElectrumError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *ElectrumError) Error() string {
+	return fmt.Sprintf("electrum error %d: %s", e.Code, e.Message)
+}
+
+type electrumMessage struct {
+	Id     *int            `json:"id"`
+	Method string          `json:"method"`
+	Params json.RawMessage `json:"params"`
+	Result json.RawMessage `json:"result"`
+	Error  *ElectrumError  `json:"error"`
+}
+
+// ElectrumHeader is a block header notified by the server.
+type ElectrumHeader struct {
+	Height int
+	Header *BlockHeader
+}
+
+// ElectrumProvider is the ChainProvider of an Electrum server (ElectrumX, Fulcrum, electrs...).
+// The requests are pipelined over a single TCP or TLS connection and can be sent concurrently.
+type ElectrumProvider struct {
+	// Network of the addresses.
+	Network address.NetworkInfo
+
+	conn    net.Conn
+	writeMu sync.Mutex
+
+	mu       sync.Mutex
+	nextId   int
+	pending  map[int]chan *electrumMessage
+	headers  []chan ElectrumHeader
+	statuses map[string][]chan string
+	done     chan struct{}
+	err      error
+}
+
+// DialElectrum connects to the Electrum server at address (host:port) and negotiates the protocol
+// version. A nil tlsConfig connects over plain TCP.
+func DialElectrum(ctx context.Context, address string, network address.NetworkInfo, tlsConfig *tls.Config) (*ElectrumProvider, error) {
+	var conn net.Conn
+	var err error
+	if tlsConfig != nil {
+		conn, err = (&tls.Dialer{Config: tlsConfig}).DialContext(ctx, "tcp", address)
+	} else {
+		conn, err = (&net.Dialer{}).DialContext(ctx, "tcp", address)
+	}
+	if err != nil {
+		return nil, err
+	}
+	api := NewElectrumProvider(conn, network)
+	if err := api.Call(ctx, "server.version", nil, "bitcoin-go", electrumProtocolVersion); err != nil {
+		api.Close()
+		return nil, err
+	}
+	return api, nil
+}
+
+// NewElectrumProvider returns the provider of an established connection to an Electrum server.
+func NewElectrumProvider(conn net.Conn, network address.NetworkInfo) *ElectrumProvider {
+	api := &ElectrumProvider{
+		Network:  network,
+		conn:     conn,
+		pending:  map[int]chan *electrumMessage{},
+		statuses: map[string][]chan string{},
+		done:     make(chan struct{}),
+	}
+	go api.readLoop()
+	return api
+}
+
+// Close closes the connection and the subscription channels.
+func (api *ElectrumProvider) Close() error {
+	return api.conn.Close()
+}
+
+// Done is closed when the connection is closed.
+func (api *ElectrumProvider) Done() <-chan struct{} {
+	return api.done
+}
+
+// Call sends a request to the server and decodes its result into result, which can be nil.
+// Concurrent calls are pipelined on the connection.
+func (api *ElectrumProvider) Call(ctx context.Context, method string, result interface{}, params ...interface{}) error {
+	if params == nil {
+		params = []interface{}{}
+	}
+	response := make(chan *electrumMessage, 1)
+	api.mu.Lock()
+	if api.err != nil {
+		api.mu.Unlock()
+		return api.err
+	}
+	id := api.nextId
+	api.nextId++
+	api.pending[id] = response
+	api.mu.Unlock()
+
+	request, err := json.Marshal(map[string]interface{}{"jsonrpc": "2.0", "id": id, "method": method, "params": params})
+	if err != nil {
+		api.forget(id)
+		return fmt.Errorf("error marshaling JSON: %v", err)
+	}
+	api.writeMu.Lock()
+	_, err = api.conn.Write(append(request, '\n'))
+	api.writeMu.Unlock()
+	if err != nil {
+		api.forget(id)
+		return err
+	}
+
+	select {
+	case message := <-response:
+		if message.Error != nil {
+			return message.Error
+		}
+		if result == nil {
+			return nil
+		}
+		if err := json.Unmarshal(message.Result, result); err != nil {
+			return fmt.Errorf("error decoding JSON: %v", err)
+		}
+		return nil
+	case <-api.done:
+		return api.err
+	case <-ctx.Done():
+		api.forget(id)
+		return ctx.Err()
+	}
+}
+
+// forget removes a pending request, its response will be ignored
+func (api *ElectrumProvider) forget(id int) {
+	api.mu.Lock()
+	delete(api.pending, id)
+	api.mu.Unlock()
+}
+
+// readLoop dispatches the responses to the pending requests and the notifications to the
+// subscribers until the connection is closed
+func (api *ElectrumProvider) readLoop() {
+	reader := bufio.NewReader(api.conn)
+	var err error
+	for {
+		var line []byte
+		line, err = reader.ReadBytes('\n')
+		if err != nil {
+			break
+		}
+		var message electrumMessage
+		if json.Unmarshal(line, &message) != nil {
+			continue
+		}
+		if message.Id != nil {
+			api.mu.Lock()
+			response, ok := api.pending[*message.Id]
+			delete(api.pending, *message.Id)
+			api.mu.Unlock()
+			if ok {
+				response <- &message
+			}
+			continue
+		}
+		api.notify(&message)
+	}
+
+	api.mu.Lock()
+	api.err = fmt.Errorf("electrum connection closed: %v", err)
+	for _, subscriber := range api.headers {
+		close(subscriber)
+	}
+	for _, subscribers := range api.statuses {
+		for _, subscriber := range subscribers {
+			close(subscriber)
+		}
+	}
+	api.headers, api.statuses = nil, map[string][]chan string{}
+	api.mu.Unlock()
+	close(api.done)
+}
+
+// notify delivers a notification to the subscribers
+func (api *ElectrumProvider) notify(message *electrumMessage) {
+	switch message.Method {
+	case "blockchain.headers.subscribe":
+		var params []electrumHeader
+		if json.Unmarshal(message.Params, &params) != nil || len(params) == 0 {
+			return
+		}
+		header, err := params[0].toElectrumHeader()
+		if err != nil {
+			return
+		}
+		api.mu.Lock()
+		for _, subscriber := range api.headers {
+			select {
+			case subscriber <- *header:
+			default:
+				// drop the oldest header, the subscriber is behind
+				select {
+				case <-subscriber:
+				default:
+				}
+				subscriber <- *header
+			}
+		}
+		api.mu.Unlock()
+	case "blockchain.scripthash.subscribe":
+		var params []*string
+		if json.Unmarshal(message.Params, &params) != nil || len(params) != 2 || params[0] == nil {
+			return
+		}
+		status := ""
+		if params[1] != nil {
+			status = *params[1]
+		}
+		api.mu.Lock()
+		for _, subscriber := range api.statuses[*params[0]] {
+			select {
+			case subscriber <- status:
+			default:
+				select {
+				case <-subscriber:
+				default:
+				}
+				subscriber <- status
+			}
+		}
+		api.mu.Unlock()
+	}
+}
@@ -0,0 +1,495 @@
+package provider
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/mrtnetwork/bitcoin/address"
+	"github.com/mrtnetwork/bitcoin/digest"
+	"github.com/mrtnetwork/bitcoin/formating"
+	"github.com/mrtnetwork/bitcoin/scripts"
+)
+
+// electrumPageSize is the number of transactions of a page of GetAccountTransactions
+const electrumPageSize = 25
+
+// ElectrumScriptHash returns the script hash identifying the address in the Electrum protocol,
+// the reversed sha256 of its scriptPubKey.
+func ElectrumScriptHash(addr address.BitcoinAddress) string {
+	return formating.BytesToHex(formating.ReverseBytes(digest.SingleHash(addr.ToScriptPubKey().ToBytes())))
+}
+
+// ElectrumHistoryItem is a transaction of the history of a script hash.
+type ElectrumHistoryItem struct {
+	TxHash string `json:"tx_hash"`
+
+	// Height of the block including the transaction, 0 in the mempool and -1 in the mempool
+	// with unconfirmed inputs.
+	Height int `json:"height"`
+
+	// Fee of the transactions of the mempool in satoshis, nil for the confirmed ones.
+	Fee *big.Int `json:"fee"`
+}
+
+// ElectrumUnspent is an unspent output of a script hash.
+type ElectrumUnspent struct {
+	TxHash string `json:"tx_hash"`
+	TxPos  int    `json:"tx_pos"`
+
+	// Height of the block including the output, 0 in the mempool.
+	Height int `json:"height"`
+
+	// Value of the output in satoshis.
+	Value *big.Int `json:"value"`
+}
+
+// ElectrumBalance is the balance of a script hash in satoshis.
+type ElectrumBalance struct {
+	Confirmed   *big.Int `json:"confirmed"`
+	Unconfirmed *big.Int `json:"unconfirmed"`
+}
+
+type electrumHeader struct {
+	Hex    string `json:"hex"`
+	Height int    `json:"height"`
+}
+
+func (header *electrumHeader) toElectrumHeader() (*ElectrumHeader, error) {
+	data, err := formating.HexToBytesCatch(header.Hex)
+	if err != nil {
+		return nil, fmt.Errorf("invalid block header: %v", err)
+	}
+	parsed, err := ParseBlockHeader(data)
+	if err != nil {
+		return nil, err
+	}
+	parsed.Height = header.Height
+	return &ElectrumHeader{Height: header.Height, Header: parsed}, nil
+}
+
+// withKind returns err as the given kind when it is an error of the server
+func withKind(err error, kind error) error {
+	var electrumError *ElectrumError
+	if errors.As(err, &electrumError) {
+		return fmt.Errorf("%w: %v", kind, err)
+	}
+	return err
+}
+
+// parallel runs the tasks concurrently, their requests are pipelined on the connection, and
+// returns the first error
+func parallel(tasks ...func() error) error {
+	errs := make([]error, len(tasks))
+	var wg sync.WaitGroup
+	for i, task := range tasks {
+		wg.Add(1)
+		go func(i int, task func() error) {
+			defer wg.Done()
+			errs[i] = task()
+		}(i, task)
+	}
+	wg.Wait()
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GetHistory returns the confirmed and unconfirmed transactions of a script hash.
+func (api *ElectrumProvider) GetHistory(ctx context.Context, scriptHash string) ([]ElectrumHistoryItem, error) {
+	var history []ElectrumHistoryItem
+	if err := api.Call(ctx, "blockchain.scripthash.get_history", &history, scriptHash); err != nil {
+		return nil, err
+	}
+	return history, nil
+}
+
+// ListUnspent returns the unspent outputs of a script hash.
+func (api *ElectrumProvider) ListUnspent(ctx context.Context, scriptHash string) ([]ElectrumUnspent, error) {
+	var unspents []ElectrumUnspent
+	if err := api.Call(ctx, "blockchain.scripthash.listunspent", &unspents, scriptHash); err != nil {
+		return nil, err
+	}
+	return unspents, nil
+}
+
+// GetBalance returns the balance of a script hash.
+func (api *ElectrumProvider) GetBalance(ctx context.Context, scriptHash string) (*ElectrumBalance, error) {
+	var balance ElectrumBalance
+	if err := api.Call(ctx, "blockchain.scripthash.get_balance", &balance, scriptHash); err != nil {
+		return nil, err
+	}
+	return &balance, nil
+}
+
+// SubscribeScriptHash subscribes to the changes of the history of a script hash. It returns the
+// current status, empty without history, and the channel of the following statuses, closed with
+// the connection.
+func (api *ElectrumProvider) SubscribeScriptHash(ctx context.Context, scriptHash string) (string, <-chan string, error) {
+	subscriber := make(chan string, electrumChannelSize)
+	api.mu.Lock()
+	if api.err != nil {
+		api.mu.Unlock()
+		return "", nil, api.err
+	}
+	api.statuses[scriptHash] = append(api.statuses[scriptHash], subscriber)
+	api.mu.Unlock()
+
+	var status *string
+	if err := api.Call(ctx, "blockchain.scripthash.subscribe", &status, scriptHash); err != nil {
+		api.mu.Lock()
+		subscribers := api.statuses[scriptHash]
+		for i := range subscribers {
+			if subscribers[i] == subscriber {
+				api.statuses[scriptHash] = append(subscribers[:i], subscribers[i+1:]...)
+				close(subscriber)
+				break
+			}
+		}
+		api.mu.Unlock()
+		return "", nil, err
+	}
+	if status == nil {
+		return "", subscriber, nil
+	}
+	return *status, subscriber, nil
+}
+
+// SubscribeHeaders subscribes to the new blocks. It returns the current tip and the channel of
+// the following headers, closed with the connection.
+func (api *ElectrumProvider) SubscribeHeaders(ctx context.Context) (*ElectrumHeader, <-chan ElectrumHeader, error) {
+	subscriber := make(chan ElectrumHeader, electrumChannelSize)
+	api.mu.Lock()
+	if api.err != nil {
+		api.mu.Unlock()
+		return nil, nil, api.err
+	}
+	api.headers = append(api.headers, subscriber)
+	api.mu.Unlock()
+
+	var tip electrumHeader
+	err := api.Call(ctx, "blockchain.headers.subscribe", &tip)
+	var header *ElectrumHeader
+	if err == nil {
+		header, err = tip.toElectrumHeader()
+	}
+	if err != nil {
+		api.mu.Lock()
+		for i := range api.headers {
+			if api.headers[i] == subscriber {
+				api.headers = append(api.headers[:i], api.headers[i+1:]...)
+				close(subscriber)
+				break
+			}
+		}
+		api.mu.Unlock()
+		return nil, nil, err
+	}
+	return header, subscriber, nil
+}
+
+// getRawTransaction returns a transaction and its serialization
+func (api *ElectrumProvider) getRawTransaction(ctx context.Context, transactionId string) (*scripts.BtcTransaction, []byte, error) {
+	var raw string
+	if err := api.Call(ctx, "blockchain.transaction.get", &raw, transactionId); err != nil {
+		return nil, nil, withKind(err, ErrNotFound)
+	}
+	data, err := formating.HexToBytesCatch(raw)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid transaction: %v", err)
+	}
+	transaction, err := parseTransaction(raw)
+	if err != nil {
+		return nil, nil, err
+	}
+	return transaction, data, nil
+}
+
+// GetRawTransaction returns the transaction with the given id.
+func (api *ElectrumProvider) GetRawTransaction(ctx context.Context, transactionId string) (*scripts.BtcTransaction, error) {
+	transaction, _, err := api.getRawTransaction(ctx, transactionId)
+	return transaction, err
+}
+
+// EstimateFee returns the fee rate for a confirmation within blocks.
+func (api *ElectrumProvider) EstimateFee(ctx context.Context, blocks int) (FeeRate, error) {
+	var fee json.Number
+	if err := api.Call(ctx, "blockchain.estimatefee", &fee, blocks); err != nil {
+		return 0, err
+	}
+	// the server returns -1 without enough data
+	if fee == "" || strings.HasPrefix(string(fee), "-") {
+		return 0, fmt.Errorf("fee estimation unavailable for %d blocks", blocks)
+	}
+	// in bitcoins per 1000 virtual bytes
+	return btcPerKvBToFeeRate(fee)
+}
+
+// GetMerkle returns the merkle proof of a transaction confirmed at height.
+func (api *ElectrumProvider) GetMerkle(ctx context.Context, transactionId string, height int) (*MerkleProof, error) {
+	var merkle MerkleProof
+	if err := api.Call(ctx, "blockchain.transaction.get_merkle", &merkle, transactionId, height); err != nil {
+		return nil, withKind(err, ErrNotFound)
+	}
+	return &merkle, nil
+}
+
+// GetBlockHeader returns the header of the block at height.
+func (api *ElectrumProvider) GetBlockHeader(ctx context.Context, height int) (*BlockHeader, error) {
+	header := electrumHeader{Height: height}
+	if err := api.Call(ctx, "blockchain.block.header", &header.Hex, height); err != nil {
+		return nil, withKind(err, ErrNotFound)
+	}
+	result, err := header.toElectrumHeader()
+	if err != nil {
+		return nil, err
+	}
+	return result.Header, nil
+}
+
+// GetAccountUtxo returns the confirmed and unconfirmed unspent transaction outputs of the owner's address.
+func (api *ElectrumProvider) GetAccountUtxo(ctx context.Context, owner UtxoOwnerDetails) (UtxoWithOwnerList, error) {
+	unspents, err := api.ListUnspent(ctx, ElectrumScriptHash(owner.Address))
+	if err != nil {
+		return nil, err
+	}
+	utxos := make(UtxoWithOwnerList, len(unspents))
+	for i, unspent := range unspents {
+		utxos[i] = UtxoWithOwner{
+			Utxo: BitcoinUtxo{
+				TxHash:      unspent.TxHash,
+				Value:       unspent.Value,
+				Vout:        unspent.TxPos,
+				ScriptType:  owner.Address.GetType(),
+				BlockHeight: unspent.Height,
+			},
+			OwnerDetails: owner,
+		}
+	}
+	return utxos, nil
+}
+
+// GetTransaction returns the transaction with the given id. The protocol only serves raw
+// transactions: the spent outputs are fetched to value the inputs, the height is found in the
+// history of the first output and the addresses are left empty.
+func (api *ElectrumProvider) GetTransaction(ctx context.Context, transactionId string) (*ChainTransaction, error) {
+	transaction, raw, err := api.getRawTransaction(ctx, transactionId)
+	if err != nil {
+		return nil, err
+	}
+	result := &ChainTransaction{
+		TxId:     txIdFromRaw(raw, transaction),
+		Version:  int(int32(binary.LittleEndian.Uint32(transaction.Version))),
+		Locktime: int(binary.LittleEndian.Uint32(transaction.Locktime)),
+		Size:     len(raw),
+		Weight:   len(stripWitness(raw, transaction))*3 + len(raw),
+	}
+	result.VSize = (result.Weight + 3) / 4
+
+	// the spent transactions and the history are requested concurrently
+	spent := map[string]*scripts.BtcTransaction{}
+	var mu sync.Mutex
+	tasks := []func() error{}
+	for _, input := range transaction.Inputs {
+		id := input.TxID
+		if _, ok := spent[id]; ok || isCoinbaseInput(input) {
+			continue
+		}
+		spent[id] = nil
+		tasks = append(tasks, func() error {
+			previous, err := api.GetRawTransaction(ctx, id)
+			mu.Lock()
+			spent[id] = previous
+			mu.Unlock()
+			return err
+		})
+	}
+	height := 0
+	for _, output := range transaction.Outputs {
+		script := output.ScriptPubKey.ToBytes()
+		// OP_RETURN outputs are not indexed
+		if len(script) > 0 && script[0] == 0x6a {
+			continue
+		}
+		scriptHash := formating.BytesToHex(formating.ReverseBytes(digest.SingleHash(script)))
+		tasks = append(tasks, func() error {
+			history, err := api.GetHistory(ctx, scriptHash)
+			for _, item := range history {
+				if item.TxHash == result.TxId {
+					height = item.Height
+				}
+			}
+			return err
+		})
+		break
+	}
+	if err := parallel(tasks...); err != nil {
+		return nil, err
+	}
+	if height > 0 {
+		header, err := api.GetBlockHeader(ctx, height)
+		if err != nil {
+			return nil, err
+		}
+		result.Status = TxStatus{Confirmed: true, BlockHeight: height, BlockHash: header.Hash, BlockTime: header.Time}
+	}
+
+	fee := big.NewInt(0)
+	coinbase := false
+	for i, input := range transaction.Inputs {
+		chainInput := ChainTxInput{
+			TxId:       input.TxID,
+			Vout:       input.TxIndex,
+			ScriptSig:  input.ScriptSig.ToHex(),
+			Sequence:   binary.LittleEndian.Uint32(input.Sequence),
+			IsCoinbase: isCoinbaseInput(input),
+			Value:      big.NewInt(0),
+		}
+		if transaction.HasSegwit && i < len(transaction.Witnesses) {
+			chainInput.Witness = transaction.Witnesses[i].Stack
+		}
+		if chainInput.IsCoinbase {
+			coinbase = true
+		} else if previous := spent[input.TxID]; previous != nil && input.TxIndex < len(previous.Outputs) {
+			chainInput.Value = previous.Outputs[input.TxIndex].Amount
+			chainInput.ScriptPubKey = previous.Outputs[input.TxIndex].ScriptPubKey.ToHex()
+			fee.Add(fee, chainInput.Value)
+		}
+		result.Inputs = append(result.Inputs, chainInput)
+	}
+	for _, output := range transaction.Outputs {
+		result.Outputs = append(result.Outputs, ChainTxOutput{ScriptPubKey: output.ScriptPubKey.ToHex(), Value: output.Amount})
+		fee.Sub(fee, output.Amount)
+	}
+	if coinbase {
+		fee.SetInt64(0)
+	}
+	result.Fee = fee
+	return result, nil
+}
+
+// isCoinbaseInput reports whether the input is the input of a coinbase transaction
+func isCoinbaseInput(input *scripts.TxInput) bool {
+	return input.TxIndex == 0xffffffff && strings.Trim(input.TxID, "0") == ""
+}
+
+// GetAccountTransactions returns a page of 25 transactions of an address. The server returns the
+// whole history, the cursor is the offset of the page in it.
+func (api *ElectrumProvider) GetAccountTransactions(ctx context.Context, addr address.BitcoinAddress, cursor string) (*TransactionPage, error) {
+	offset := 0
+	if cursor != "" {
+		var err error
+		if offset, err = strconv.Atoi(cursor); err != nil || offset < 0 {
+			return nil, fmt.Errorf("invalid cursor %s", cursor)
+		}
+	}
+	history, err := api.GetHistory(ctx, ElectrumScriptHash(addr))
+	if err != nil {
+		return nil, err
+	}
+	// most recent first, the transactions of the mempool have a height of 0 or -1
+	sort.SliceStable(history, func(i, j int) bool {
+		if history[i].Height <= 0 || history[j].Height <= 0 {
+			return history[i].Height <= 0 && history[j].Height > 0
+		}
+		return history[i].Height > history[j].Height
+	})
+	page := &TransactionPage{}
+	if offset >= len(history) {
+		return page, nil
+	}
+	end := offset + electrumPageSize
+	if end < len(history) {
+		page.Next = strconv.Itoa(end)
+	} else {
+		end = len(history)
+	}
+	page.Transactions = make([]ChainTransaction, end-offset)
+	tasks := make([]func() error, end-offset)
+	for i := range tasks {
+		i := i
+		tasks[i] = func() error {
+			transaction, err := api.GetTransaction(ctx, history[offset+i].TxHash)
+			if err == nil {
+				page.Transactions[i] = *transaction
+			}
+			return err
+		}
+	}
+	if err := parallel(tasks...); err != nil {
+		return nil, err
+	}
+	return page, nil
+}
+
+// GetNetworkFee returns the fee rates estimated for a confirmation within 2, 6 and 144 blocks.
+func (api *ElectrumProvider) GetNetworkFee(ctx context.Context) (*BitcoinFeeRate, error) {
+	rates := make([]*big.Int, 3)
+	tasks := make([]func() error, len(rates))
+	for i, blocks := range []int{2, 6, 144} {
+		i, blocks := i, blocks
+		tasks[i] = func() error {
+			rate, err := api.EstimateFee(ctx, blocks)
+			rates[i] = big.NewInt(rate.SatPerKvB())
+			return err
+		}
+	}
+	if err := parallel(tasks...); err != nil {
+		return nil, err
+	}
+	return &BitcoinFeeRate{High: rates[0], Medium: rates[1], Low: rates[2]}, nil
+}
+
+// GetFeeEstimates returns the fee rates by confirmation target in blocks, the targets without
+// enough data are left out.
+func (api *ElectrumProvider) GetFeeEstimates(ctx context.Context) (FeeEstimates, error) {
+	rates := make([]FeeRate, len(feeTargets))
+	errs := make([]error, len(feeTargets))
+	tasks := make([]func() error, len(feeTargets))
+	for i, blocks := range feeTargets {
+		i, blocks := i, blocks
+		tasks[i] = func() error {
+			rates[i], errs[i] = api.EstimateFee(ctx, blocks)
+			return nil
+		}
+	}
+	parallel(tasks...)
+	estimates := FeeEstimates{}
+	for i, blocks := range feeTargets {
+		if errs[i] == nil {
+			estimates[blocks] = rates[i]
+		}
+	}
+	if len(estimates) == 0 {
+		return nil, errs[0]
+	}
+	return estimates, nil
+}
+
+// SendRawTransaction broadcasts a serialized transaction and returns its id.
+func (api *ElectrumProvider) SendRawTransaction(ctx context.Context, rawTransaction string) (string, error) {
+	var transactionId string
+	if err := api.Call(ctx, "blockchain.transaction.broadcast", &transactionId, rawTransaction); err != nil {
+		return "", withKind(err, ErrRejected)
+	}
+	return transactionId, nil
+}
+
+// GetBlockHeight returns the height of the chain tip.
+func (api *ElectrumProvider) GetBlockHeight(ctx context.Context) (int, error) {
+	var tip electrumHeader
+	if err := api.Call(ctx, "blockchain.headers.subscribe", &tip); err != nil {
+		return 0, err
+	}
+	return tip.Height, nil
+}
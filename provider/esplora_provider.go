@@ -0,0 +1,218 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/mrtnetwork/bitcoin/address"
+	"github.com/mrtnetwork/bitcoin/formating"
+	"github.com/mrtnetwork/bitcoin/scripts"
+)
+
+// esploraPageSize is the number of confirmed transactions of a page of the Esplora address API
+const esploraPageSize = 25
+
+// EsploraProvider is the ChainProvider of the Esplora REST API of Blockstream. BaseURL can point
+// to a self-hosted instance, including regtest ones.
+type EsploraProvider struct {
+	// BaseURL of the API, for example https://blockstream.info/api.
+	BaseURL string
+
+	// Network of the addresses.
+	Network address.NetworkInfo
+
+	rest restClient
+}
+
+// NewEsploraProvider returns the provider of the public Blockstream API of the network.
+// A nil client uses http.DefaultClient.
+func NewEsploraProvider(network address.NetworkInfo, client *http.Client) *EsploraProvider {
+	baseUrl := blockstreamMainBaseURL
+	if !network.IsMainNet() {
+		baseUrl = blockstreamBaseURL
+	}
+	return &EsploraProvider{BaseURL: baseUrl, Network: network, rest: newRestClient(client)}
+}
+
+// esploraAccountTransactions returns a page of the transactions of an address from an Esplora
+// compatible API. The first page holds the unconfirmed transactions and the 25 most recent
+// confirmed ones, the following pages the next 25 confirmed ones. The cursor is the id of the
+// last confirmed transaction seen.
+func esploraAccountTransactions(ctx context.Context, rest restClient, url string, cursor string) (*TransactionPage, error) {
+	if cursor != "" {
+		url += "/chain/" + cursor
+	}
+	var transactions MemoolTransactionList
+	if err := rest.get(ctx, url, &transactions); err != nil {
+		return nil, err
+	}
+	page := &TransactionPage{}
+	confirmed := 0
+	for _, transaction := range transactions {
+		page.Transactions = append(page.Transactions, *transaction.ToChainTransaction())
+		if transaction.Status.Confirmed {
+			confirmed++
+		}
+	}
+	if confirmed == esploraPageSize {
+		page.Next = transactions[len(transactions)-1].TxID
+	}
+	return page, nil
+}
+
+// GetAccountUtxo returns the unspent transaction outputs of the owner's address.
+func (api *EsploraProvider) GetAccountUtxo(ctx context.Context, owner UtxoOwnerDetails) (UtxoWithOwnerList, error) {
+	var utxos MempolUtxoList
+	if err := api.rest.get(ctx, api.BaseURL+"/address/"+owner.Address.Show(api.Network)+"/utxo", &utxos); err != nil {
+		return nil, err
+	}
+	return utxos.ToUtxoWithOwner(owner), nil
+}
+
+// GetTransaction returns the transaction with the given id.
+func (api *EsploraProvider) GetTransaction(ctx context.Context, transactionId string) (*ChainTransaction, error) {
+	var transaction MempoolTransaction
+	if err := api.rest.get(ctx, api.BaseURL+"/tx/"+transactionId, &transaction); err != nil {
+		return nil, err
+	}
+	return transaction.ToChainTransaction(), nil
+}
+
+// GetRawTransaction returns the transaction with the given id.
+func (api *EsploraProvider) GetRawTransaction(ctx context.Context, transactionId string) (*scripts.BtcTransaction, error) {
+	body, err := api.rest.do(ctx, http.MethodGet, api.BaseURL+"/tx/"+transactionId+"/hex", "", nil)
+	if err != nil {
+		return nil, err
+	}
+	return parseTransaction(strings.TrimSpace(string(body)))
+}
+
+// GetTransactionStatus returns the confirmation status of a transaction.
+func (api *EsploraProvider) GetTransactionStatus(ctx context.Context, transactionId string) (*TxStatus, error) {
+	var status MempoolStatus
+	if err := api.rest.get(ctx, api.BaseURL+"/tx/"+transactionId+"/status", &status); err != nil {
+		return nil, err
+	}
+	result := status.toTxStatus()
+	return &result, nil
+}
+
+// GetMerkleProof returns the merkle proof of a confirmed transaction.
+func (api *EsploraProvider) GetMerkleProof(ctx context.Context, transactionId string) (*MerkleProof, error) {
+	var proof MerkleProof
+	if err := api.rest.get(ctx, api.BaseURL+"/tx/"+transactionId+"/merkle-proof", &proof); err != nil {
+		return nil, err
+	}
+	return &proof, nil
+}
+
+// GetAccountTransactions returns a page of the transactions of an address. The first page holds
+// the unconfirmed transactions and the 25 most recent confirmed ones, the following pages the
+// next 25 confirmed ones. The cursor is the id of the last confirmed transaction seen.
+func (api *EsploraProvider) GetAccountTransactions(ctx context.Context, addr address.BitcoinAddress, cursor string) (*TransactionPage, error) {
+	return esploraAccountTransactions(ctx, api.rest, api.BaseURL+"/address/"+addr.Show(api.Network)+"/txs", cursor)
+}
+
+// GetBlockHash returns the hash of the block of the main chain at height.
+func (api *EsploraProvider) GetBlockHash(ctx context.Context, height int) (string, error) {
+	body, err := api.rest.do(ctx, http.MethodGet, api.BaseURL+"/block-height/"+strconv.Itoa(height), "", nil)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(body)), nil
+}
+
+// GetBlockHeader returns the header of the block with the given hash.
+func (api *EsploraProvider) GetBlockHeader(ctx context.Context, hash string) (*BlockHeader, error) {
+	body, err := api.rest.do(ctx, http.MethodGet, api.BaseURL+"/block/"+hash+"/header", "", nil)
+	if err != nil {
+		return nil, err
+	}
+	data, err := formating.HexToBytesCatch(strings.TrimSpace(string(body)))
+	if err != nil {
+		return nil, fmt.Errorf("invalid block header: %v", err)
+	}
+	header, err := ParseBlockHeader(data)
+	if err != nil {
+		return nil, err
+	}
+	var block struct {
+		Height int `json:"height"`
+	}
+	if err := api.rest.get(ctx, api.BaseURL+"/block/"+hash, &block); err != nil {
+		return nil, err
+	}
+	header.Height = block.Height
+	return header, nil
+}
+
+// GetFeeEstimates returns the fee rates by confirmation target in blocks.
+func (api *EsploraProvider) GetFeeEstimates(ctx context.Context) (FeeEstimates, error) {
+	var estimates map[string]float64
+	if err := api.rest.get(ctx, api.BaseURL+"/fee-estimates", &estimates); err != nil {
+		return nil, err
+	}
+	rates := FeeEstimates{}
+	for target, rate := range estimates {
+		blocks, err := strconv.Atoi(target)
+		if err != nil {
+			return nil, fmt.Errorf("invalid confirmation target %s", target)
+		}
+		// the API returns satoshis per virtual byte
+		rates[blocks] = FeeRateFromSatPerVByte(rate)
+	}
+	return rates, nil
+}
+
+// estimateFee returns the estimate of the largest target not above target
+func estimateFee(estimates FeeEstimates, target int) (FeeRate, error) {
+	if targets := estimates.Targets(); len(targets) == 0 || target < targets[0] {
+		return 0, fmt.Errorf("fee estimation unavailable for %d blocks", target)
+	}
+	rate, _ := estimates.Target(target)
+	return rate, nil
+}
+
+// EstimateFee returns the fee rate for a confirmation within target blocks, the API estimates a
+// fixed set of targets and the closest one below target is used.
+func (api *EsploraProvider) EstimateFee(ctx context.Context, target int) (FeeRate, error) {
+	estimates, err := api.GetFeeEstimates(ctx)
+	if err != nil {
+		return 0, err
+	}
+	return estimateFee(estimates, target)
+}
+
+// GetNetworkFee returns the fee rates estimated for a confirmation within 2, 6 and 144 blocks.
+func (api *EsploraProvider) GetNetworkFee(ctx context.Context) (*BitcoinFeeRate, error) {
+	estimates, err := api.GetFeeEstimates(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return newBitcoinFeeRate(estimates)
+}
+
+// SendRawTransaction broadcasts a serialized transaction and returns its id.
+func (api *EsploraProvider) SendRawTransaction(ctx context.Context, rawTransaction string) (string, error) {
+	body, err := api.rest.do(ctx, http.MethodPost, api.BaseURL+"/tx", "text/plain", []byte(rawTransaction))
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(body)), nil
+}
+
+// GetBlockHeight returns the height of the chain tip.
+func (api *EsploraProvider) GetBlockHeight(ctx context.Context) (int, error) {
+	body, err := api.rest.do(ctx, http.MethodGet, api.BaseURL+"/blocks/tip/height", "", nil)
+	if err != nil {
+		return 0, err
+	}
+	height, err := strconv.Atoi(strings.TrimSpace(string(body)))
+	if err != nil {
+		return 0, fmt.Errorf("invalid block height: %v", err)
+	}
+	return height, nil
+}
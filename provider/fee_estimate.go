@@ -0,0 +1,214 @@
+package provider
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"sort"
+	"strconv"
+	"sync"
+)
+
+// FeeRate is a fee rate in satoshis per virtual byte. It counts satoshis per 1000 virtual bytes
+// (sat/kvB), the unit of Bitcoin Core, to keep the fractions of the estimates.
+type FeeRate int64
+
+const (
+	// MinRelayFeeRate is the default minimum fee rate relayed by Bitcoin Core nodes, 1 sat/vB.
+	MinRelayFeeRate FeeRate = 1000
+
+	// MaxFeeRate is the default highest fee rate accepted by sendrawtransaction, 0.1 BTC/kvB.
+	MaxFeeRate FeeRate = 10000000
+)
+
+// FeeRateFromSatPerVByte returns the fee rate of rate satoshis per virtual byte.
+func FeeRateFromSatPerVByte(rate float64) FeeRate {
+	return FeeRate(math.Round(rate * 1000))
+}
+
+// FeeRateFromSatPerKvB returns the fee rate of rate satoshis per 1000 virtual bytes.
+func FeeRateFromSatPerKvB(rate int64) FeeRate {
+	return FeeRate(rate)
+}
+
+// SatPerVByte returns the rate in satoshis per virtual byte.
+func (rate FeeRate) SatPerVByte() float64 {
+	return float64(rate) / 1000
+}
+
+// SatPerKvB returns the rate in satoshis per 1000 virtual bytes.
+func (rate FeeRate) SatPerKvB() int64 {
+	return int64(rate)
+}
+
+// Fee returns the fee in satoshis of a transaction of vsize virtual bytes, rounded up.
+func (rate FeeRate) Fee(vsize int) *big.Int {
+	fee := new(big.Int).Mul(big.NewInt(int64(vsize)), big.NewInt(int64(rate)))
+	fee.Add(fee, big.NewInt(999))
+	return fee.Div(fee, big.NewInt(1000))
+}
+
+func (rate FeeRate) String() string {
+	return strconv.FormatFloat(rate.SatPerVByte(), 'f', -1, 64) + " sat/vB"
+}
+
+// FeeEstimates are fee rates by confirmation target in blocks.
+type FeeEstimates map[int]FeeRate
+
+// Targets returns the confirmation targets in increasing order.
+func (estimates FeeEstimates) Targets() []int {
+	targets := make([]int, 0, len(estimates))
+	for target := range estimates {
+		targets = append(targets, target)
+	}
+	sort.Ints(targets)
+	return targets
+}
+
+// Target returns the fee rate for a confirmation within target blocks: the estimate of the
+// largest target not above it, or the one of the smallest target when target is below every
+// estimate. It returns false without estimates.
+func (estimates FeeEstimates) Target(target int) (FeeRate, bool) {
+	targets := estimates.Targets()
+	if len(targets) == 0 {
+		return 0, false
+	}
+	rate := estimates[targets[0]]
+	for _, blocks := range targets {
+		if blocks > target {
+			break
+		}
+		rate = estimates[blocks]
+	}
+	return rate, true
+}
+
+// FeeSource is implemented by the backends estimating fee rates by confirmation target.
+type FeeSource interface {
+	// GetFeeEstimates returns the fee rates by confirmation target in blocks.
+	GetFeeEstimates(ctx context.Context) (FeeEstimates, error)
+}
+
+// FeeMode selects how the estimates of several sources are combined.
+type FeeMode int
+
+const (
+	// FeeEconomical uses the lower median of the estimates, a single source reporting a spike is
+	// ignored.
+	FeeEconomical FeeMode = iota
+
+	// FeeConservative uses the highest estimate.
+	FeeConservative
+)
+
+// FeeEstimator combines the estimates of several sources into a single recommendation. The
+// sources are queried concurrently and the ones failing are skipped.
+type FeeEstimator struct {
+	Sources []FeeSource
+	Mode    FeeMode
+
+	// MinRelayFee is the lowest rate returned, a transaction paying less is not relayed.
+	MinRelayFee FeeRate
+
+	// MaxFee is the highest rate returned, it bounds the estimates during fee spikes.
+	MaxFee FeeRate
+}
+
+// NewFeeEstimator returns an economical estimator of the sources bounded by MinRelayFeeRate and
+// MaxFeeRate.
+func NewFeeEstimator(sources ...FeeSource) *FeeEstimator {
+	return &FeeEstimator{Sources: sources, Mode: FeeEconomical, MinRelayFee: MinRelayFeeRate, MaxFee: MaxFeeRate}
+}
+
+// GetFeeEstimates returns the combined estimates for every target estimated by a source. A
+// longer target never gets a higher rate than a shorter one.
+func (estimator *FeeEstimator) GetFeeEstimates(ctx context.Context) (FeeEstimates, error) {
+	if len(estimator.Sources) == 0 {
+		return nil, fmt.Errorf("no fee source")
+	}
+	results := make([]FeeEstimates, len(estimator.Sources))
+	errs := make([]error, len(estimator.Sources))
+	var wg sync.WaitGroup
+	for i, source := range estimator.Sources {
+		wg.Add(1)
+		go func(i int, source FeeSource) {
+			defer wg.Done()
+			results[i], errs[i] = source.GetFeeEstimates(ctx)
+		}(i, source)
+	}
+	wg.Wait()
+
+	answered := []FeeEstimates{}
+	targets := map[int]bool{}
+	for i, estimates := range results {
+		if errs[i] != nil || len(estimates) == 0 {
+			continue
+		}
+		answered = append(answered, estimates)
+		for target := range estimates {
+			targets[target] = true
+		}
+	}
+	if len(answered) == 0 {
+		if err := errors.Join(errs...); err != nil {
+			return nil, fmt.Errorf("fee estimation unavailable: %v", err)
+		}
+		return nil, fmt.Errorf("fee estimation unavailable")
+	}
+
+	combined := FeeEstimates{}
+	for target := range targets {
+		rates := make([]FeeRate, len(answered))
+		for i, estimates := range answered {
+			rates[i], _ = estimates.Target(target)
+		}
+		combined[target] = estimator.bound(estimator.combine(rates))
+	}
+	previous := FeeRate(math.MaxInt64)
+	for _, target := range combined.Targets() {
+		if combined[target] > previous {
+			combined[target] = previous
+		}
+		previous = combined[target]
+	}
+	return combined, nil
+}
+
+// EstimateFee returns the combined fee rate for a confirmation within target blocks.
+func (estimator *FeeEstimator) EstimateFee(ctx context.Context, target int) (FeeRate, error) {
+	if target <= 0 {
+		return 0, fmt.Errorf("invalid confirmation target %d", target)
+	}
+	estimates, err := estimator.GetFeeEstimates(ctx)
+	if err != nil {
+		return 0, err
+	}
+	rate, _ := estimates.Target(target)
+	return rate, nil
+}
+
+// combine returns the lower median or the highest rate according to the mode
+func (estimator *FeeEstimator) combine(rates []FeeRate) FeeRate {
+	sort.Slice(rates, func(i, j int) bool { return rates[i] < rates[j] })
+	if estimator.Mode == FeeConservative {
+		return rates[len(rates)-1]
+	}
+	return rates[(len(rates)-1)/2]
+}
+
+// bound clamps rate between MinRelayFee and MaxFee, a zero MaxFee does not bound the rates
+func (estimator *FeeEstimator) bound(rate FeeRate) FeeRate {
+	if estimator.MaxFee > 0 && rate > estimator.MaxFee {
+		rate = estimator.MaxFee
+	}
+	if rate < estimator.MinRelayFee {
+		rate = estimator.MinRelayFee
+	}
+	return rate
+}
+
+// feeTargets are the confirmation targets requested from the backends estimating one target at
+// a time
+var feeTargets = []int{2, 3, 6, 12, 24, 144, 1008}
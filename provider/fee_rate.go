@@ -10,17 +10,30 @@ import (
 // The big.Int pointers allow for precise representation of fee rates, where nil values
 // indicate that the fee rate level is not available or unspecified.
 type BitcoinFeeRate struct {
-	High   *big.Int // High fee rate in satoshis per byte
-	Medium *big.Int // Medium fee rate in satoshis per byte
-	Low    *big.Int // Low fee rate in satoshis per byte
+	High   *big.Int // High fee rate in satoshis per 1000 virtual bytes
+	Medium *big.Int // Medium fee rate in satoshis per 1000 virtual bytes
+	Low    *big.Int // Low fee rate in satoshis per 1000 virtual bytes
+}
+
+// newBitcoinFeeRate returns the fee rates estimated for a confirmation within 2, 6 and 144 blocks
+func newBitcoinFeeRate(estimates FeeEstimates) (*BitcoinFeeRate, error) {
+	rates := make([]*big.Int, 3)
+	for i, target := range []int{2, 6, 144} {
+		rate, err := estimateFee(estimates, target)
+		if err != nil {
+			return nil, err
+		}
+		rates[i] = big.NewInt(rate.SatPerKvB())
+	}
+	return &BitcoinFeeRate{High: rates[0], Medium: rates[1], Low: rates[2]}, nil
 }
 
 // parseMempoolFees takes a data interface and converts it to a big.Int representing
-// mempool fees in satoshis per kilobyte (sat/KB). The function performs the conversion
-// based on the type of the input data, which can be either a float64 (floating-point
-// fee rate) or an int (integer fee rate in satoshis per byte).
+// mempool fees in satoshis per 1000 virtual bytes (sat/kvB). The function performs the
+// conversion based on the type of the input data, which can be either a float64 (floating-point
+// fee rate) or an int (integer fee rate in satoshis per virtual byte).
 func parseMempoolFees(data interface{}) *big.Int {
-	const kb = 1024
+	const kb = 1000
 
 	switch v := data.(type) {
 	case float64:
@@ -59,17 +72,17 @@ func (b BitcoinFeeRate) String() string {
 }
 
 // GetEstimate calculates the estimated fee in satoshis for a given transaction size
-// and fee rate (in satoshis per kilobyte) using the formula:
+// and fee rate (in satoshis per 1000 virtual bytes) using the formula:
 //
-//	EstimatedFee = (TransactionSize * FeeRate) / 1024
+//	EstimatedFee = (TransactionVirtualSize * FeeRate) / 1000
 //
 // Parameters:
-// - trSize: An integer representing the transaction size in bytes.
-// - feeRate: A pointer to a big.Int representing the fee rate in satoshis per kilobyte.
+// - trSize: An integer representing the virtual size of the transaction in bytes.
+// - feeRate: A pointer to a big.Int representing the fee rate in satoshis per 1000 virtual bytes.
 //
 // Returns:
 // - *big.Int: A pointer to a big.Int containing the estimated fee in satoshis.
 func (b BitcoinFeeRate) GetEstimate(trSize int, feeRate *big.Int) *big.Int {
 	trSizeBigInt := new(big.Int).SetInt64(int64(trSize))
-	return new(big.Int).Div(new(big.Int).Mul(trSizeBigInt, feeRate), big.NewInt(1024))
+	return new(big.Int).Div(new(big.Int).Mul(trSizeBigInt, feeRate), big.NewInt(1000))
 }
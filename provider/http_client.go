@@ -0,0 +1,78 @@
+package provider
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// restClient sends the requests of the REST backends with an injectable http.Client
+type restClient struct {
+	client *http.Client
+}
+
+func newRestClient(client *http.Client) restClient {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return restClient{client: client}
+}
+
+// get sends a GET request and decodes the JSON response into result
+func (c restClient) get(ctx context.Context, url string, result interface{}) error {
+	body, err := c.do(ctx, http.MethodGet, url, "", nil)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(body, result); err != nil {
+		return fmt.Errorf("error decoding JSON: %v", err)
+	}
+	return nil
+}
+
+// do sends a request and returns the body of a successful response. Unsuccessful statuses
+// are returned as *APIError: 429 is rate limiting, 404 not found, 5xx unavailable and
+// 400 to a POST request a rejected transaction.
+func (c restClient) do(ctx context.Context, method string, url string, contentType string, payload []byte) ([]byte, error) {
+	request, err := http.NewRequestWithContext(ctx, method, url, bytes.NewReader(payload))
+	if err != nil {
+		return nil, err
+	}
+	if contentType != "" {
+		request.Header.Set("Content-Type", contentType)
+	}
+	response, err := c.client.Do(request)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+
+	body, err := io.ReadAll(response.Body)
+	if err != nil {
+		return nil, err
+	}
+	if response.StatusCode >= 200 && response.StatusCode < 300 {
+		return body, nil
+	}
+	apiError := &APIError{StatusCode: response.StatusCode, Message: strings.TrimSpace(string(body))}
+	switch {
+	case response.StatusCode == http.StatusTooManyRequests:
+		apiError.Err = ErrRateLimited
+		if seconds, err := strconv.Atoi(response.Header.Get("Retry-After")); err == nil {
+			apiError.RetryAfter = time.Duration(seconds) * time.Second
+		}
+	case response.StatusCode == http.StatusNotFound:
+		apiError.Err = ErrNotFound
+	case response.StatusCode >= 500:
+		apiError.Err = ErrUnavailable
+	case response.StatusCode == http.StatusBadRequest && method == http.MethodPost:
+		apiError.Err = ErrRejected
+	}
+	return nil, apiError
+}
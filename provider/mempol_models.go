@@ -24,7 +24,7 @@ func (memplUtxos MempolUtxoList) ToUtxoWithOwner(owner UtxoOwnerDetails) UtxoWit
 				Value:       &memplUtxos[i].Value,
 				Vout:        memplUtxos[i].Vout,
 				ScriptType:  owner.Address.GetType(),
-				BlockHeight: 1,
+				BlockHeight: memplUtxos[i].Status.BlockHeight,
 			},
 			OwnerDetails: owner,
 		}
@@ -0,0 +1,161 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mrtnetwork/bitcoin/address"
+)
+
+// MempoolProvider is the ChainProvider of the mempool.space REST API.
+type MempoolProvider struct {
+	// BaseURL of the API, for example https://mempool.space/api. It can point to a self-hosted instance.
+	BaseURL string
+
+	// Network of the addresses.
+	Network address.NetworkInfo
+
+	rest restClient
+}
+
+// NewMempoolProvider returns the provider of the public mempool.space API of the network.
+// A nil client uses http.DefaultClient.
+func NewMempoolProvider(network address.NetworkInfo, client *http.Client) *MempoolProvider {
+	baseUrl := mempoolMainBaseURL
+	if !network.IsMainNet() {
+		baseUrl = mempoolBaseURL
+	}
+	return &MempoolProvider{BaseURL: baseUrl, Network: network, rest: newRestClient(client)}
+}
+
+// GetAccountUtxo returns the unspent transaction outputs of the owner's address.
+func (api *MempoolProvider) GetAccountUtxo(ctx context.Context, owner UtxoOwnerDetails) (UtxoWithOwnerList, error) {
+	var utxos MempolUtxoList
+	if err := api.rest.get(ctx, api.BaseURL+"/address/"+owner.Address.Show(api.Network)+"/utxo", &utxos); err != nil {
+		return nil, err
+	}
+	return utxos.ToUtxoWithOwner(owner), nil
+}
+
+// GetTransaction returns the transaction with the given id.
+func (api *MempoolProvider) GetTransaction(ctx context.Context, transactionId string) (*ChainTransaction, error) {
+	var transaction MempoolTransaction
+	if err := api.rest.get(ctx, api.BaseURL+"/tx/"+transactionId, &transaction); err != nil {
+		return nil, err
+	}
+	return transaction.ToChainTransaction(), nil
+}
+
+// GetAccountTransactions returns a page of the transactions of an address. The first page holds
+// the unconfirmed transactions and the 25 most recent confirmed ones, the following pages the
+// next 25 confirmed ones. The cursor is the id of the last confirmed transaction seen.
+func (api *MempoolProvider) GetAccountTransactions(ctx context.Context, addr address.BitcoinAddress, cursor string) (*TransactionPage, error) {
+	return esploraAccountTransactions(ctx, api.rest, api.BaseURL+"/address/"+addr.Show(api.Network)+"/txs", cursor)
+}
+
+// GetNetworkFee returns the recommended fee rates.
+func (api *MempoolProvider) GetNetworkFee(ctx context.Context) (*BitcoinFeeRate, error) {
+	var fee map[string]interface{}
+	if err := api.rest.get(ctx, api.BaseURL+"/v1/fees/recommended", &fee); err != nil {
+		return nil, err
+	}
+	return NewBitcoinFeeRateFromMempool(fee), nil
+}
+
+// GetFeeEstimates returns the recommended fee rates by confirmation target: the fastest fee for
+// the next block, the half hour fee for 3 blocks, the hour fee for 6 blocks, the economy fee for
+// 144 blocks and the minimum fee for 1008 blocks.
+func (api *MempoolProvider) GetFeeEstimates(ctx context.Context) (FeeEstimates, error) {
+	var fee struct {
+		Fastest  float64 `json:"fastestFee"`
+		HalfHour float64 `json:"halfHourFee"`
+		Hour     float64 `json:"hourFee"`
+		Economy  float64 `json:"economyFee"`
+		Minimum  float64 `json:"minimumFee"`
+	}
+	if err := api.rest.get(ctx, api.BaseURL+"/v1/fees/recommended", &fee); err != nil {
+		return nil, err
+	}
+	estimates := FeeEstimates{}
+	for target, rate := range map[int]float64{1: fee.Fastest, 3: fee.HalfHour, 6: fee.Hour, 144: fee.Economy, 1008: fee.Minimum} {
+		// the economy fee is missing on older instances
+		if rate > 0 {
+			estimates[target] = FeeRateFromSatPerVByte(rate)
+		}
+	}
+	if len(estimates) == 0 {
+		return nil, fmt.Errorf("missing fee rates in the response")
+	}
+	return estimates, nil
+}
+
+// SendRawTransaction broadcasts a serialized transaction and returns its id.
+func (api *MempoolProvider) SendRawTransaction(ctx context.Context, rawTransaction string) (string, error) {
+	body, err := api.rest.do(ctx, http.MethodPost, api.BaseURL+"/tx", "text/plain", []byte(rawTransaction))
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(body)), nil
+}
+
+// GetBlockHeight returns the height of the chain tip.
+func (api *MempoolProvider) GetBlockHeight(ctx context.Context) (int, error) {
+	body, err := api.rest.do(ctx, http.MethodGet, api.BaseURL+"/blocks/tip/height", "", nil)
+	if err != nil {
+		return 0, err
+	}
+	height, err := strconv.Atoi(strings.TrimSpace(string(body)))
+	if err != nil {
+		return 0, fmt.Errorf("invalid block height: %v", err)
+	}
+	return height, nil
+}
+
+// toTxStatus converts the status to the type shared by every backend
+func (status MempoolStatus) toTxStatus() TxStatus {
+	result := TxStatus{Confirmed: status.Confirmed, BlockHeight: status.BlockHeight, BlockHash: status.BlockHash}
+	if status.Confirmed {
+		result.BlockTime = time.Unix(status.BlockTime, 0)
+	}
+	return result
+}
+
+// ToChainTransaction converts the transaction to the type shared by every backend.
+func (transaction *MempoolTransaction) ToChainTransaction() *ChainTransaction {
+	result := &ChainTransaction{
+		TxId:     transaction.TxID,
+		Version:  transaction.Version,
+		Locktime: transaction.Locktime,
+		Size:     transaction.Size,
+		VSize:    (transaction.Weight + 3) / 4,
+		Weight:   transaction.Weight,
+		Fee:      big.NewInt(int64(transaction.Fee)),
+		Status:   transaction.Status.toTxStatus(),
+	}
+	for _, vin := range transaction.Vin {
+		result.Inputs = append(result.Inputs, ChainTxInput{
+			TxId:         vin.TxID,
+			Vout:         vin.Vout,
+			Address:      vin.PrevOut.ScriptPubKeyAddress,
+			Value:        big.NewInt(int64(vin.PrevOut.Value)),
+			ScriptPubKey: vin.PrevOut.ScriptPubKey,
+			ScriptSig:    vin.ScriptSig,
+			Witness:      vin.Witness,
+			Sequence:     uint32(vin.Sequence),
+			IsCoinbase:   vin.IsCoinbase,
+		})
+	}
+	for _, vout := range transaction.Vout {
+		result.Outputs = append(result.Outputs, ChainTxOutput{
+			Address:      vout.ScriptPubKeyAddress,
+			ScriptPubKey: vout.ScriptPubKey,
+			Value:        big.NewInt(int64(vout.Value)),
+		})
+	}
+	return result
+}
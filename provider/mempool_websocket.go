@@ -0,0 +1,514 @@
+package provider
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mrtnetwork/bitcoin/address"
+)
+
+// ErrClosed is returned by the subscriptions of a closed MempoolWebSocket.
+var ErrClosed = errors.New("connection closed")
+
+// mempoolChannelSize is the buffer of the event channels. When a subscriber falls behind, the
+// oldest event is dropped.
+const mempoolChannelSize = 16
+
+// MempoolAddressEvent is a transaction of a tracked address entering the mempool, confirmed in a
+// block (Transaction.Status.Confirmed) or removed from the mempool when replaced or evicted.
+type MempoolAddressEvent struct {
+	Address     string
+	Transaction ChainTransaction
+	Removed     bool
+}
+
+// MempoolTxPosition is the position of an unconfirmed transaction in the projected blocks.
+type MempoolTxPosition struct {
+	// Block is the index of the projected block, 0 for the next one.
+	Block int     `json:"block"`
+	VSize float64 `json:"vsize"`
+}
+
+// MempoolTransactionEvent is a change of a tracked transaction: its confirmation, its
+// replacement by ReplacedBy or a new Position in the projected blocks.
+type MempoolTransactionEvent struct {
+	TxId       string
+	Confirmed  bool
+	ReplacedBy string
+	Position   *MempoolTxPosition
+}
+
+// MempoolBlockEvent is a new block of the chain.
+type MempoolBlockEvent struct {
+	Hash              string `json:"id"`
+	Height            int    `json:"height"`
+	PreviousBlockHash string `json:"previousblockhash"`
+	Timestamp         int64  `json:"timestamp"`
+	TxCount           int    `json:"tx_count"`
+	Size              int    `json:"size"`
+	Weight            int    `json:"weight"`
+}
+
+// MempoolBlockProjection is a block projected from the mempool, the first one is the next block
+// to be mined. Fee rates are in satoshis per virtual byte.
+type MempoolBlockProjection struct {
+	BlockSize  int       `json:"blockSize"`
+	BlockVSize float64   `json:"blockVSize"`
+	NTx        int       `json:"nTx"`
+	TotalFees  int64     `json:"totalFees"`
+	MedianFee  float64   `json:"medianFee"`
+	FeeRange   []float64 `json:"feeRange"`
+}
+
+// MempoolWebSocket is a client of the WebSocket API of mempool.space delivering typed events on
+// channels. The connection is re-established when lost and the subscriptions are renewed.
+//
+// The server tracks a single transaction per connection, tracking another one replaces it.
+type MempoolWebSocket struct {
+	// URL of the API, for example wss://mempool.space/api/v1/ws.
+	URL string
+
+	// Network of the addresses.
+	Network address.NetworkInfo
+
+	// TLSConfig of wss connections, nil uses the default configuration.
+	TLSConfig *tls.Config
+
+	// ReconnectDelay is the delay before the first reconnection, doubled up to MaxReconnectDelay
+	// after each failed attempt.
+	ReconnectDelay    time.Duration
+	MaxReconnectDelay time.Duration
+
+	// PingInterval is the interval of the pings keeping the connection alive, a connection
+	// silent for two intervals is considered lost.
+	PingInterval time.Duration
+
+	mu           sync.Mutex
+	conn         *wsConn
+	addresses    map[string][]chan MempoolAddressEvent
+	addressOrder []string
+	trackedTx    string
+	transactions []chan MempoolTransactionEvent
+	blocks       []chan MempoolBlockEvent
+	projections  []chan []MempoolBlockProjection
+	cancel       context.CancelFunc
+	closed       bool
+	done         chan struct{}
+}
+
+// NewMempoolWebSocket returns the client of the mempool.space API of the network, call Connect
+// to open the connection.
+func NewMempoolWebSocket(network address.NetworkInfo) *MempoolWebSocket {
+	url := "wss://mempool.space/api/v1/ws"
+	if !network.IsMainNet() {
+		url = "wss://mempool.space/testnet/api/v1/ws"
+	}
+	return &MempoolWebSocket{
+		URL:               url,
+		Network:           network,
+		ReconnectDelay:    time.Second,
+		MaxReconnectDelay: time.Minute,
+		PingInterval:      30 * time.Second,
+		addresses:         map[string][]chan MempoolAddressEvent{},
+		done:              make(chan struct{}),
+	}
+}
+
+// Connect opens the connection, it is re-established in the background until Close.
+func (ws *MempoolWebSocket) Connect(ctx context.Context) error {
+	conn, err := ws.dial(ctx)
+	if err != nil {
+		return err
+	}
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+	if ws.closed || ws.cancel != nil {
+		conn.close()
+		return errors.New("websocket already connected or closed")
+	}
+	if err := ws.resubscribe(ctx, conn); err != nil {
+		conn.close()
+		return err
+	}
+	background, cancel := context.WithCancel(context.Background())
+	ws.conn, ws.cancel = conn, cancel
+	go ws.run(background, conn)
+	return nil
+}
+
+// Close closes the connection and the event channels.
+func (ws *MempoolWebSocket) Close() error {
+	ws.mu.Lock()
+	if ws.closed {
+		ws.mu.Unlock()
+		return nil
+	}
+	ws.closed = true
+	conn, cancel := ws.conn, ws.cancel
+	ws.mu.Unlock()
+	if cancel == nil {
+		// never connected
+		ws.shutdown()
+		return nil
+	}
+	cancel()
+	if conn != nil {
+		conn.close()
+	}
+	<-ws.done
+	return nil
+}
+
+// Done is closed once the client is closed and the event channels with it.
+func (ws *MempoolWebSocket) Done() <-chan struct{} {
+	return ws.done
+}
+
+// TrackAddress delivers the transactions of addr entering the mempool, confirmed or removed.
+func (ws *MempoolWebSocket) TrackAddress(ctx context.Context, addr address.BitcoinAddress) (<-chan MempoolAddressEvent, error) {
+	shown := addr.Show(ws.Network)
+	subscriber := make(chan MempoolAddressEvent, mempoolChannelSize)
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+	if ws.closed {
+		return nil, ErrClosed
+	}
+	if _, ok := ws.addresses[shown]; !ok {
+		ws.addressOrder = append(ws.addressOrder, shown)
+	}
+	ws.addresses[shown] = append(ws.addresses[shown], subscriber)
+	return subscriber, ws.send(ctx, ws.addressMessage())
+}
+
+// TrackTransaction delivers the confirmation, the replacement and the position changes of the
+// transaction.
+func (ws *MempoolWebSocket) TrackTransaction(ctx context.Context, transactionId string) (<-chan MempoolTransactionEvent, error) {
+	subscriber := make(chan MempoolTransactionEvent, mempoolChannelSize)
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+	if ws.closed {
+		return nil, ErrClosed
+	}
+	if ws.trackedTx != transactionId {
+		// the subscribers of the previous transaction are not notified anymore
+		for _, previous := range ws.transactions {
+			close(previous)
+		}
+		ws.transactions = nil
+	}
+	ws.trackedTx = transactionId
+	ws.transactions = append(ws.transactions, subscriber)
+	return subscriber, ws.send(ctx, map[string]string{"track-tx": transactionId})
+}
+
+// SubscribeBlocks delivers the new blocks.
+func (ws *MempoolWebSocket) SubscribeBlocks(ctx context.Context) (<-chan MempoolBlockEvent, error) {
+	subscriber := make(chan MempoolBlockEvent, mempoolChannelSize)
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+	if ws.closed {
+		return nil, ErrClosed
+	}
+	ws.blocks = append(ws.blocks, subscriber)
+	return subscriber, ws.send(ctx, ws.wantMessage())
+}
+
+// SubscribeMempoolBlocks delivers the projected blocks each time the mempool changes, they give the
+// fee rates needed to be included in the next blocks.
+func (ws *MempoolWebSocket) SubscribeMempoolBlocks(ctx context.Context) (<-chan []MempoolBlockProjection, error) {
+	subscriber := make(chan []MempoolBlockProjection, mempoolChannelSize)
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+	if ws.closed {
+		return nil, ErrClosed
+	}
+	ws.projections = append(ws.projections, subscriber)
+	return subscriber, ws.send(ctx, ws.wantMessage())
+}
+
+// dial opens a connection
+func (ws *MempoolWebSocket) dial(ctx context.Context) (*wsConn, error) {
+	conn, err := dialWebSocket(ctx, ws.URL, ws.TLSConfig)
+	if err != nil {
+		return nil, err
+	}
+	if ws.PingInterval > 0 {
+		conn.readTimeout = 2 * ws.PingInterval
+	}
+	return conn, nil
+}
+
+// send writes a subscription message when connected, the subscriptions are renewed on reconnection
+func (ws *MempoolWebSocket) send(ctx context.Context, message interface{}) error {
+	if ws.conn == nil {
+		return nil
+	}
+	data, err := json.Marshal(message)
+	if err != nil {
+		return err
+	}
+	if err := ws.conn.writeText(ctx, data); err != nil && ctx.Err() != nil {
+		return ctx.Err()
+	}
+	// a write failure is a lost connection, the subscription is sent again on reconnection
+	return nil
+}
+
+// wantMessage returns the message requesting the block and projection events
+func (ws *MempoolWebSocket) wantMessage() interface{} {
+	data := []string{}
+	if len(ws.blocks) > 0 {
+		data = append(data, "blocks")
+	}
+	if len(ws.projections) > 0 {
+		data = append(data, "mempool-blocks")
+	}
+	return map[string]interface{}{"action": "want", "data": data}
+}
+
+// addressMessage returns the message tracking the addresses
+func (ws *MempoolWebSocket) addressMessage() interface{} {
+	if len(ws.addressOrder) == 1 {
+		return map[string]string{"track-address": ws.addressOrder[0]}
+	}
+	return map[string][]string{"track-addresses": ws.addressOrder}
+}
+
+// resubscribe sends the subscriptions on a new connection, the caller holds the lock
+func (ws *MempoolWebSocket) resubscribe(ctx context.Context, conn *wsConn) error {
+	messages := []interface{}{}
+	if len(ws.blocks) > 0 || len(ws.projections) > 0 {
+		messages = append(messages, ws.wantMessage())
+	}
+	if len(ws.addressOrder) > 0 {
+		messages = append(messages, ws.addressMessage())
+	}
+	if ws.trackedTx != "" {
+		messages = append(messages, map[string]string{"track-tx": ws.trackedTx})
+	}
+	for _, message := range messages {
+		data, err := json.Marshal(message)
+		if err != nil {
+			return err
+		}
+		if err := conn.writeText(ctx, data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// run reads the events of the connection and reconnects when it is lost
+func (ws *MempoolWebSocket) run(ctx context.Context, conn *wsConn) {
+	defer ws.shutdown()
+	for {
+		ws.read(ctx, conn)
+		ws.mu.Lock()
+		ws.conn = nil
+		ws.mu.Unlock()
+		conn.conn.Close()
+
+		delay := ws.ReconnectDelay
+		if delay <= 0 {
+			delay = time.Millisecond
+		}
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(delay):
+			}
+			var err error
+			if conn, err = ws.dial(ctx); err == nil {
+				ws.mu.Lock()
+				if err = ws.resubscribe(ctx, conn); err == nil {
+					ws.conn = conn
+				}
+				ws.mu.Unlock()
+				if err == nil {
+					break
+				}
+				conn.conn.Close()
+			}
+			if delay *= 2; delay > ws.MaxReconnectDelay {
+				delay = ws.MaxReconnectDelay
+			}
+		}
+		if ctx.Err() != nil {
+			conn.close()
+			return
+		}
+	}
+}
+
+// read dispatches the events of a connection until it is lost, pinging the server meanwhile
+func (ws *MempoolWebSocket) read(ctx context.Context, conn *wsConn) {
+	stop := make(chan struct{})
+	defer close(stop)
+	if ws.PingInterval > 0 {
+		go ws.ping(ctx, conn, stop)
+	}
+	for {
+		message, err := conn.readMessage()
+		if err != nil {
+			return
+		}
+		ws.dispatch(message)
+	}
+}
+
+// ping pings the server until stop is closed
+func (ws *MempoolWebSocket) ping(ctx context.Context, conn *wsConn, stop chan struct{}) {
+	ticker := time.NewTicker(ws.PingInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			conn.writeFrame(wsPing, nil)
+		}
+	}
+}
+
+// mempoolAddressTransactions are the transactions of an address in a multi-address message
+type mempoolAddressTransactions struct {
+	Mempool   []MempoolTransaction `json:"mempool"`
+	Confirmed []MempoolTransaction `json:"confirmed"`
+	Removed   []MempoolTransaction `json:"removed"`
+}
+
+// dispatch delivers the events of a message to the subscribers
+func (ws *MempoolWebSocket) dispatch(message []byte) {
+	var fields map[string]json.RawMessage
+	if json.Unmarshal(message, &fields) != nil {
+		return
+	}
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+
+	if raw, ok := fields["block"]; ok {
+		var block MempoolBlockEvent
+		if json.Unmarshal(raw, &block) == nil {
+			for _, subscriber := range ws.blocks {
+				deliver(subscriber, block)
+			}
+		}
+	}
+	if raw, ok := fields["mempool-blocks"]; ok {
+		var projections []MempoolBlockProjection
+		if json.Unmarshal(raw, &projections) == nil {
+			for _, subscriber := range ws.projections {
+				deliver(subscriber, projections)
+			}
+		}
+	}
+
+	// the transactions of a single tracked address
+	if len(ws.addressOrder) == 1 {
+		for key, removed := range map[string]bool{"address-transactions": false, "block-transactions": false, "address-removed-transactions": true} {
+			var transactions []MempoolTransaction
+			if raw, ok := fields[key]; ok && json.Unmarshal(raw, &transactions) == nil {
+				ws.deliverAddress(ws.addressOrder[0], transactions, removed)
+			}
+		}
+	}
+	if raw, ok := fields["multi-address-transactions"]; ok {
+		var addresses map[string]mempoolAddressTransactions
+		if json.Unmarshal(raw, &addresses) == nil {
+			for addr, transactions := range addresses {
+				ws.deliverAddress(addr, transactions.Mempool, false)
+				ws.deliverAddress(addr, transactions.Confirmed, false)
+				ws.deliverAddress(addr, transactions.Removed, true)
+			}
+		}
+	}
+
+	if ws.trackedTx == "" {
+		return
+	}
+	event := MempoolTransactionEvent{TxId: ws.trackedTx}
+	changed := false
+	if raw, ok := fields["txConfirmed"]; ok {
+		var id string
+		if json.Unmarshal(raw, &id) != nil || id == "" || strings.EqualFold(id, ws.trackedTx) {
+			event.Confirmed, changed = true, true
+		}
+	}
+	if raw, ok := fields["txReplaced"]; ok {
+		var replaced struct {
+			TxId string `json:"txid"`
+		}
+		if json.Unmarshal(raw, &replaced) == nil {
+			event.ReplacedBy, changed = replaced.TxId, true
+		}
+	}
+	if raw, ok := fields["txPosition"]; ok {
+		var position struct {
+			TxId     string            `json:"txid"`
+			Position MempoolTxPosition `json:"position"`
+		}
+		if json.Unmarshal(raw, &position) == nil && strings.EqualFold(position.TxId, ws.trackedTx) {
+			event.Position, changed = &position.Position, true
+		}
+	}
+	if changed {
+		for _, subscriber := range ws.transactions {
+			deliver(subscriber, event)
+		}
+	}
+}
+
+// deliverAddress delivers the transactions of an address, the caller holds the lock
+func (ws *MempoolWebSocket) deliverAddress(addr string, transactions []MempoolTransaction, removed bool) {
+	for _, transaction := range transactions {
+		event := MempoolAddressEvent{Address: addr, Transaction: *transaction.ToChainTransaction(), Removed: removed}
+		for _, subscriber := range ws.addresses[addr] {
+			deliver(subscriber, event)
+		}
+	}
+}
+
+// shutdown closes the event channels
+func (ws *MempoolWebSocket) shutdown() {
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+	for _, subscribers := range ws.addresses {
+		for _, subscriber := range subscribers {
+			close(subscriber)
+		}
+	}
+	for _, subscriber := range ws.transactions {
+		close(subscriber)
+	}
+	for _, subscriber := range ws.blocks {
+		close(subscriber)
+	}
+	for _, subscriber := range ws.projections {
+		close(subscriber)
+	}
+	ws.addresses, ws.transactions, ws.blocks, ws.projections = map[string][]chan MempoolAddressEvent{}, nil, nil, nil
+	close(ws.done)
+}
+
+// deliver sends an event without blocking, dropping the oldest one when the subscriber is behind
+func deliver[T any](subscriber chan T, event T) {
+	for {
+		select {
+		case subscriber <- event:
+			return
+		default:
+		}
+		select {
+		case <-subscriber:
+		default:
+		}
+	}
+}
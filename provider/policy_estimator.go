@@ -0,0 +1,354 @@
+package provider
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"math/big"
+	"sync"
+
+	"github.com/mrtnetwork/bitcoin/scripts"
+)
+
+const (
+	// policyBucketSpacing is the ratio between the fee rates of two consecutive buckets
+	policyBucketSpacing = 1.1
+
+	// policySufficientTxs is the number of transactions per block a group of buckets needs on
+	// average to be estimated, as the SUFFICIENT_FEETXS of Bitcoin Core
+	policySufficientTxs = 0.1
+
+	// DefaultFeeConfidence is the probability of confirmation of the estimates of GetFeeEstimates.
+	DefaultFeeConfidence = 0.85
+)
+
+// policyHorizon holds the moving averages of the confirmations for the targets up to
+// Scale*len(Confirmed) blocks, a period counting Scale blocks
+type policyHorizon struct {
+	Scale int     `json:"scale"`
+	Decay float64 `json:"decay"`
+
+	// Confirmed[period][bucket] counts the transactions confirmed within (period+1)*Scale blocks
+	Confirmed [][]float64 `json:"confirmed"`
+
+	// Failed[period][bucket] counts the transactions removed from the mempool unconfirmed after
+	// (period+1)*Scale blocks
+	Failed [][]float64 `json:"failed"`
+
+	// Total[bucket] counts the confirmed transactions and FeeSum[bucket] sums their fee rates
+	Total  []float64 `json:"total"`
+	FeeSum []float64 `json:"fee_sum"`
+}
+
+func newPolicyHorizon(scale int, periods int, decay float64, buckets int) *policyHorizon {
+	horizon := &policyHorizon{Scale: scale, Decay: decay, Total: make([]float64, buckets), FeeSum: make([]float64, buckets)}
+	for i := 0; i < periods; i++ {
+		horizon.Confirmed = append(horizon.Confirmed, make([]float64, buckets))
+		horizon.Failed = append(horizon.Failed, make([]float64, buckets))
+	}
+	return horizon
+}
+
+// maxTarget is the longest target estimated by the horizon
+func (horizon *policyHorizon) maxTarget() int {
+	return horizon.Scale * len(horizon.Confirmed)
+}
+
+// decay ages the averages by one block
+func (horizon *policyHorizon) decay() {
+	for period := range horizon.Confirmed {
+		for bucket := range horizon.Confirmed[period] {
+			horizon.Confirmed[period][bucket] *= horizon.Decay
+			horizon.Failed[period][bucket] *= horizon.Decay
+		}
+	}
+	for bucket := range horizon.Total {
+		horizon.Total[bucket] *= horizon.Decay
+		horizon.FeeSum[bucket] *= horizon.Decay
+	}
+}
+
+// confirmed records a transaction of the bucket confirmed after blocks
+func (horizon *policyHorizon) confirmed(bucket int, rate FeeRate, blocks int) {
+	for period := (blocks+horizon.Scale-1)/horizon.Scale - 1; period < len(horizon.Confirmed); period++ {
+		horizon.Confirmed[period][bucket]++
+	}
+	horizon.Total[bucket]++
+	horizon.FeeSum[bucket] += float64(rate)
+}
+
+// failed records a transaction of the bucket removed from the mempool after blocks
+func (horizon *policyHorizon) failed(bucket int, blocks int) {
+	for period := 0; period < len(horizon.Confirmed) && (period+1)*horizon.Scale <= blocks; period++ {
+		horizon.Failed[period][bucket]++
+	}
+}
+
+// valid reports whether the averages have the expected shape after a restoration
+func (horizon *policyHorizon) valid(buckets int) bool {
+	if horizon.Scale <= 0 || len(horizon.Confirmed) == 0 || len(horizon.Failed) != len(horizon.Confirmed) ||
+		len(horizon.Total) != buckets || len(horizon.FeeSum) != buckets {
+		return false
+	}
+	for period := range horizon.Confirmed {
+		if len(horizon.Confirmed[period]) != buckets || len(horizon.Failed[period]) != buckets {
+			return false
+		}
+	}
+	return true
+}
+
+// policyEntry is a transaction of the mempool waiting for its confirmation
+type policyEntry struct {
+	Height int     `json:"height"`
+	Rate   FeeRate `json:"rate"`
+}
+
+// BlockPolicyEstimator estimates fee rates without a third-party API, in the spirit of the
+// estimatesmartfee of Bitcoin Core: it is fed the transactions entering the mempool and the
+// connected blocks, tracks how many blocks the transactions of each fee rate bucket wait for
+// their confirmation and finds the lowest fee rate confirming within a target at a confidence.
+// The transactions confirmed without being seen in the mempool are ignored. It can be persisted
+// with json.Marshal and restored with json.Unmarshal, and is safe for concurrent use.
+type BlockPolicyEstimator struct {
+	// Confidence is the probability of confirmation of the estimates of GetFeeEstimates.
+	Confidence float64
+
+	mu      sync.Mutex
+	buckets []FeeRate
+	height  int
+	short   *policyHorizon
+	long    *policyHorizon
+	mempool map[string]policyEntry
+}
+
+// NewBlockPolicyEstimator returns an estimator without data. Its buckets range from
+// MinRelayFeeRate to MaxFeeRate, 10% apart.
+func NewBlockPolicyEstimator() *BlockPolicyEstimator {
+	estimator := &BlockPolicyEstimator{Confidence: DefaultFeeConfidence, mempool: map[string]policyEntry{}}
+	for rate := float64(MinRelayFeeRate); rate < float64(MaxFeeRate)*policyBucketSpacing; rate *= policyBucketSpacing {
+		estimator.buckets = append(estimator.buckets, FeeRate(rate))
+	}
+	// the decays of the medium and long horizons of Bitcoin Core, half-lives of 144 and 1008 blocks
+	estimator.short = newPolicyHorizon(1, 48, 0.9952, len(estimator.buckets))
+	estimator.long = newPolicyHorizon(24, 42, 0.99931, len(estimator.buckets))
+	return estimator
+}
+
+// bucket returns the index of the bucket of rate
+func (estimator *BlockPolicyEstimator) bucket(rate FeeRate) int {
+	for i := len(estimator.buckets) - 1; i > 0; i-- {
+		if rate >= estimator.buckets[i] {
+			return i
+		}
+	}
+	return 0
+}
+
+// Height returns the height of the last block processed.
+func (estimator *BlockPolicyEstimator) Height() int {
+	estimator.mu.Lock()
+	defer estimator.mu.Unlock()
+	return estimator.height
+}
+
+// AddTransaction tracks a transaction entering the mempool when the chain tip is at height, fee
+// is the fee it pays in satoshis.
+func (estimator *BlockPolicyEstimator) AddTransaction(tx *scripts.BtcTransaction, fee *big.Int, height int) {
+	vsize := tx.GetVSize()
+	if vsize == 0 || fee == nil || fee.Sign() < 0 {
+		return
+	}
+	rate := new(big.Int).Mul(fee, big.NewInt(1000))
+	estimator.AddEntry(tx.TxId(), FeeRate(rate.Div(rate, big.NewInt(int64(vsize))).Int64()), height)
+}
+
+// AddEntry tracks a transaction of the given fee rate entering the mempool when the chain tip is
+// at height, for example from the mempool entries of a node.
+func (estimator *BlockPolicyEstimator) AddEntry(txId string, rate FeeRate, height int) {
+	estimator.mu.Lock()
+	defer estimator.mu.Unlock()
+	if _, ok := estimator.mempool[txId]; ok {
+		return
+	}
+	estimator.mempool[txId] = policyEntry{Height: height, Rate: rate}
+}
+
+// RemoveTransaction stops tracking a transaction leaving the mempool without being confirmed,
+// replaced or evicted. It counts as a failure for the targets it already waited for.
+func (estimator *BlockPolicyEstimator) RemoveTransaction(txId string) {
+	estimator.mu.Lock()
+	defer estimator.mu.Unlock()
+	entry, ok := estimator.mempool[txId]
+	if !ok {
+		return
+	}
+	delete(estimator.mempool, txId)
+	estimator.failed(entry)
+}
+
+func (estimator *BlockPolicyEstimator) failed(entry policyEntry) {
+	if blocks := estimator.height - entry.Height; blocks > 0 {
+		bucket := estimator.bucket(entry.Rate)
+		estimator.short.failed(bucket, blocks)
+		estimator.long.failed(bucket, blocks)
+	}
+}
+
+// ProcessBlock records the confirmation of the tracked transactions of the block connected at
+// height. Blocks must be processed in order, a block not above the last one processed is ignored
+// and ProcessBlock returns false.
+func (estimator *BlockPolicyEstimator) ProcessBlock(height int, block *Block) bool {
+	estimator.mu.Lock()
+	defer estimator.mu.Unlock()
+	if height <= estimator.height {
+		return false
+	}
+	estimator.height = height
+	estimator.short.decay()
+	estimator.long.decay()
+	for _, txId := range block.TxIds {
+		entry, ok := estimator.mempool[txId]
+		if !ok {
+			continue
+		}
+		delete(estimator.mempool, txId)
+		// entered the mempool at the height of the block, nothing to learn from
+		blocks := height - entry.Height
+		if blocks <= 0 {
+			continue
+		}
+		bucket := estimator.bucket(entry.Rate)
+		estimator.short.confirmed(bucket, entry.Rate, blocks)
+		estimator.long.confirmed(bucket, entry.Rate, blocks)
+	}
+	// the transactions waiting longer than every target are forgotten
+	for txId, entry := range estimator.mempool {
+		if height-entry.Height > estimator.long.maxTarget() {
+			delete(estimator.mempool, txId)
+			estimator.failed(entry)
+		}
+	}
+	return true
+}
+
+// EstimateFee returns the lowest fee rate confirming within target blocks with the given
+// probability, between 0 and 1. The buckets are scanned from the highest fee rate and grouped
+// until they hold enough transactions, a group below the probability is merged with the next
+// buckets. The estimate is the average fee rate of the lowest group reaching the probability.
+func (estimator *BlockPolicyEstimator) EstimateFee(target int, confidence float64) (FeeRate, error) {
+	estimator.mu.Lock()
+	defer estimator.mu.Unlock()
+	if target <= 0 || target > estimator.long.maxTarget() {
+		return 0, fmt.Errorf("invalid confirmation target %d", target)
+	}
+	if confidence <= 0 || confidence > 1 {
+		return 0, fmt.Errorf("invalid confidence %v", confidence)
+	}
+	horizon := estimator.short
+	if target > horizon.maxTarget() {
+		horizon = estimator.long
+	}
+	period := (target+horizon.Scale-1)/horizon.Scale - 1
+
+	// the transactions of the mempool waiting for longer than target are failures
+	waiting := make([]float64, len(estimator.buckets))
+	for _, entry := range estimator.mempool {
+		if estimator.height-entry.Height >= target {
+			waiting[estimator.bucket(entry.Rate)]++
+		}
+	}
+
+	sufficient := policySufficientTxs / (1 - horizon.Decay)
+	var confirmed, total, count, fees float64
+	best := FeeRate(0)
+	for bucket := len(estimator.buckets) - 1; bucket >= 0; bucket-- {
+		confirmed += horizon.Confirmed[period][bucket]
+		total += horizon.Total[bucket] + horizon.Failed[period][bucket] + waiting[bucket]
+		count += horizon.Total[bucket]
+		fees += horizon.FeeSum[bucket]
+		if total < sufficient {
+			continue
+		}
+		// a bucket group with enough data missing the confidence ends the search, a cheaper
+		// group must not average it away
+		if confirmed/total < confidence {
+			break
+		}
+		if count > 0 {
+			best = FeeRate(math.Round(fees / count))
+		}
+		confirmed, total, count, fees = 0, 0, 0, 0
+	}
+	if best == 0 {
+		return 0, fmt.Errorf("fee estimation unavailable for %d blocks", target)
+	}
+	return best, nil
+}
+
+// GetFeeEstimates returns the estimates at Confidence of the targets with enough data.
+func (estimator *BlockPolicyEstimator) GetFeeEstimates(ctx context.Context) (FeeEstimates, error) {
+	estimates := FeeEstimates{}
+	var failure error
+	for _, target := range append([]int{1}, feeTargets...) {
+		rate, err := estimator.EstimateFee(target, estimator.Confidence)
+		if err != nil {
+			failure = err
+			continue
+		}
+		estimates[target] = rate
+	}
+	if len(estimates) == 0 {
+		return nil, failure
+	}
+	return estimates, nil
+}
+
+// policyState is the persisted state of a BlockPolicyEstimator
+type policyState struct {
+	Buckets []FeeRate              `json:"buckets"`
+	Height  int                    `json:"height"`
+	Short   *policyHorizon         `json:"short"`
+	Long    *policyHorizon         `json:"long"`
+	Mempool map[string]policyEntry `json:"mempool"`
+}
+
+// MarshalJSON encodes the state of the estimator, including the tracked transactions.
+func (estimator *BlockPolicyEstimator) MarshalJSON() ([]byte, error) {
+	estimator.mu.Lock()
+	defer estimator.mu.Unlock()
+	return json.Marshal(policyState{
+		Buckets: estimator.buckets,
+		Height:  estimator.height,
+		Short:   estimator.short,
+		Long:    estimator.long,
+		Mempool: estimator.mempool,
+	})
+}
+
+// UnmarshalJSON restores a state encoded by MarshalJSON.
+func (estimator *BlockPolicyEstimator) UnmarshalJSON(data []byte) error {
+	var state policyState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return err
+	}
+	if len(state.Buckets) == 0 || state.Short == nil || state.Long == nil ||
+		!state.Short.valid(len(state.Buckets)) || !state.Long.valid(len(state.Buckets)) {
+		return fmt.Errorf("invalid fee estimator state")
+	}
+	if state.Mempool == nil {
+		state.Mempool = map[string]policyEntry{}
+	}
+	estimator.mu.Lock()
+	defer estimator.mu.Unlock()
+	if estimator.Confidence == 0 {
+		estimator.Confidence = DefaultFeeConfidence
+	}
+	estimator.buckets = state.Buckets
+	estimator.height = state.Height
+	estimator.short = state.Short
+	estimator.long = state.Long
+	estimator.mempool = state.Mempool
+	return nil
+}
@@ -0,0 +1,235 @@
+package providertest
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/mrtnetwork/bitcoin/provider"
+)
+
+// blockCypherMaxLimit is the largest page of the full address endpoint
+const blockCypherMaxLimit = 50
+
+// BlockCypherHandler returns the handler of the BlockCypher API of the chain. Mount it with
+// http.StripPrefix to serve it below a path.
+func (c *Chain) BlockCypherHandler() http.Handler {
+	return http.HandlerFunc(c.serveBlockCypher)
+}
+
+func (c *Chain) serveBlockCypher(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	if r.Method == http.MethodPost {
+		if strings.Join(parts, "/") != "txs/push" {
+			http.NotFound(w, r)
+			return
+		}
+		var request struct {
+			Tx string `json:"tx"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			blockCypherError(w, http.StatusBadRequest, "Couldn't deserialize request: "+err.Error())
+			return
+		}
+		id, err := c.Broadcast(request.Tx)
+		var reject *RejectError
+		if errors.As(err, &reject) {
+			blockCypherError(w, http.StatusBadRequest, "Error sending transaction: "+reject.Reason)
+			return
+		}
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(map[string]interface{}{"tx": c.blockCypherTransaction(c.transactions[id])})
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	query := r.URL.Query()
+	switch {
+	case len(parts) == 1 && parts[0] == "":
+		tip := c.blocks[len(c.blocks)-1]
+		writeJSON(w, map[string]interface{}{
+			"height": tip.height, "hash": tip.hash, "time": tip.time,
+			"high_fee_per_kb": c.fees.Fastest * 1000, "medium_fee_per_kb": c.fees.HalfHour * 1000, "low_fee_per_kb": c.fees.Minimum * 1000,
+		})
+	case len(parts) == 2 && parts[0] == "addrs":
+		before, after := math.MaxInt32, -1
+		for name, value := range map[string]*int{"before": &before, "after": &after} {
+			if query.Get(name) == "" {
+				continue
+			}
+			height, err := strconv.Atoi(query.Get(name))
+			if err != nil {
+				blockCypherError(w, http.StatusBadRequest, "Invalid "+name+" parameter")
+				return
+			}
+			*value = height
+		}
+		c.serveBlockCypherAddress(w, parts[1], query.Get("unspentOnly") == "true", query.Get("includeScript") == "true", before, after)
+	case len(parts) == 3 && parts[0] == "addrs" && parts[2] == "full":
+		limit, err := strconv.Atoi(query.Get("limit"))
+		if err != nil || limit <= 0 {
+			limit = 10
+		}
+		if limit > blockCypherMaxLimit {
+			limit = blockCypherMaxLimit
+		}
+		history := c.history(parts[1])
+		if before := query.Get("before"); before != "" {
+			height, err := strconv.Atoi(before)
+			if err != nil {
+				blockCypherError(w, http.StatusBadRequest, "Invalid before parameter")
+				return
+			}
+			filtered := []*transaction{}
+			for _, tx := range history {
+				if tx.block != nil && tx.block.height < height {
+					filtered = append(filtered, tx)
+				}
+			}
+			history = filtered
+		}
+		info := provider.BlockCypherAddressInfo{Address: parts[1], HasMore: len(history) > limit, TXs: provider.BlockCypherTransactionList{}}
+		for i := 0; i < len(history) && i < limit; i++ {
+			info.TXs = append(info.TXs, c.blockCypherTransaction(history[i]))
+		}
+		writeJSON(w, info)
+	case len(parts) == 2 && parts[0] == "txs":
+		tx, ok := c.transactions[parts[1]]
+		if !ok {
+			blockCypherError(w, http.StatusNotFound, "Transaction "+parts[1]+" not found.")
+			return
+		}
+		writeJSON(w, c.blockCypherTransaction(tx))
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// serveBlockCypherAddress answers the outputs paying to addr, the unconfirmed ones in
+// unconfirmed_txrefs, and the inputs spending them unless unspentOnly. The confirmed references
+// are the ones of the blocks strictly between after and before, the unconfirmed ones are only
+// listed without before.
+func (c *Chain) serveBlockCypherAddress(w http.ResponseWriter, addr string, unspentOnly bool, includeScript bool, before int, after int) {
+	result := map[string]interface{}{"address": addr}
+	confirmed, unconfirmed := []provider.TxRef{}, []provider.TxRef{}
+	var balance, final int64
+	for _, tx := range c.history(addr) {
+		if height := c.height(tx); (tx.block != nil && (height >= before || height <= after)) || (tx.block == nil && before != math.MaxInt32) {
+			continue
+		}
+		if !unspentOnly && !tx.coinbase {
+			for i, in := range tx.spent {
+				if in.address != addr {
+					continue
+				}
+				ref := provider.TxRef{TxHash: tx.id, BlockHeight: c.height(tx), TxInputN: i, TxOutputN: -1, Confirmations: c.confirmations(tx)}
+				ref.Value.SetInt64(in.value)
+				if tx.block == nil {
+					unconfirmed = append(unconfirmed, ref)
+				} else {
+					ref.Confirmed = tx.block.time
+					confirmed = append(confirmed, ref)
+				}
+			}
+		}
+		for vout, out := range tx.outputs {
+			if out.address != addr {
+				continue
+			}
+			spender, spent := c.spentBy[Outpoint{TxId: tx.id, Vout: vout}]
+			if spent && unspentOnly {
+				continue
+			}
+			ref := provider.TxRef{TxHash: tx.id, BlockHeight: c.height(tx), TxInputN: -1, TxOutputN: vout, Spent: spent, Confirmations: c.confirmations(tx)}
+			ref.Value.SetInt64(out.value)
+			if includeScript {
+				ref.Script = out.script
+			}
+			if !spent {
+				final += out.value
+			}
+			if tx.block == nil {
+				unconfirmed = append(unconfirmed, ref)
+				continue
+			}
+			ref.Confirmed = tx.block.time
+			// the balance counts the confirmed outputs not spent by a confirmed transaction
+			if !spent || c.transactions[spender].block == nil {
+				balance += out.value
+			}
+			confirmed = append(confirmed, ref)
+		}
+	}
+	result["txrefs"], result["unconfirmed_txrefs"] = confirmed, unconfirmed
+	result["balance"], result["unconfirmed_balance"], result["final_balance"] = balance, final-balance, final
+	writeJSON(w, result)
+}
+
+func (c *Chain) blockCypherTransaction(tx *transaction) provider.BlocCyperTransaction {
+	result := provider.BlocCyperTransaction{
+		BlockHeight:   c.height(tx),
+		Hash:          tx.id,
+		Total:         int(sum(tx.outputs).Int64()),
+		Fees:          int(tx.fee),
+		Size:          tx.size,
+		VSize:         (tx.weight + 3) / 4,
+		Ver:           int(binary.LittleEndian.Uint32(tx.tx.Version)),
+		LockTime:      int(binary.LittleEndian.Uint32(tx.tx.Locktime)),
+		VinSz:         len(tx.tx.Inputs),
+		VoutSz:        len(tx.outputs),
+		Confirmations: c.confirmations(tx),
+		Addresses:     []string{},
+	}
+	if tx.block != nil {
+		result.BlockHash, result.BlockIndex, result.Confirmed = tx.block.hash, tx.position(), tx.block.time
+	}
+	addresses := map[string]bool{}
+	addAddress := func(addr string) []string {
+		if addr == "" {
+			return nil
+		}
+		if !addresses[addr] {
+			addresses[addr] = true
+			result.Addresses = append(result.Addresses, addr)
+		}
+		return []string{addr}
+	}
+	for i, input := range tx.tx.Inputs {
+		sequence := binary.LittleEndian.Uint32(input.Sequence)
+		in := provider.BlocCypherTransactionInput{
+			Sequence: int(sequence),
+			Script:   input.ScriptSig.ToHex(),
+			Witness:  witness(tx, i),
+		}
+		if sequence < 0xfffffffe {
+			result.OptInRBF = true
+		}
+		if tx.coinbase {
+			in.OutputIndex = -1
+			in.ScriptType = "empty"
+		} else {
+			in.PrevHash, in.OutputIndex = input.TxID, input.TxIndex
+			in.OutputValue = int(tx.spent[i].value)
+			in.Addresses = addAddress(tx.spent[i].address)
+		}
+		result.Inputs = append(result.Inputs, in)
+	}
+	for _, out := range tx.outputs {
+		result.Outputs = append(result.Outputs, provider.BlocCyperTransactionOutput{Value: int(out.value), Script: out.script, Addresses: addAddress(out.address)})
+	}
+	return result
+}
+
+func blockCypherError(w http.ResponseWriter, status int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{"error": message})
+}
@@ -0,0 +1,428 @@
+// Package providertest implements an in-memory blockchain served over the Mempool (Esplora) and
+// BlockCypher REST APIs, for testing the providers and the code using them without network access.
+//
+// A Chain holds a UTXO set and a mempool. Tests fund addresses, broadcast transactions through any
+// provider and mine blocks to confirm them. Broadcasts are checked for missing, double spent and
+// overspent inputs, signatures and scripts are not verified.
+package providertest
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math/big"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mrtnetwork/bitcoin/address"
+	"github.com/mrtnetwork/bitcoin/digest"
+	"github.com/mrtnetwork/bitcoin/formating"
+	"github.com/mrtnetwork/bitcoin/scripts"
+)
+
+// genesisTime is the timestamp of the first block, the following ones are 10 minutes apart
+const genesisTime = 1700000000
+
+// Fees are the fee rates in satoshis per virtual byte answered by the fee endpoints.
+type Fees struct {
+	Fastest  int
+	HalfHour int
+	Hour     int
+	Economy  int
+	Minimum  int
+}
+
+// DefaultFees are the fee rates of a new Chain.
+var DefaultFees = Fees{Fastest: 20, HalfHour: 10, Hour: 5, Economy: 2, Minimum: 1}
+
+// Outpoint identifies a transaction output.
+type Outpoint struct {
+	TxId string
+	Vout int
+}
+
+// RejectError is returned for a transaction refused by Broadcast. Code and Reason are those of
+// Bitcoin Core.
+type RejectError struct {
+	Code   int
+	Reason string
+}
+
+func (e *RejectError) Error() string {
+	return e.Reason
+}
+
+type output struct {
+	value   int64
+	script  string
+	address string
+}
+
+type transaction struct {
+	id       string
+	tx       *scripts.BtcTransaction
+	raw      string
+	size     int
+	weight   int
+	fee      int64
+	coinbase bool
+
+	// spent holds the outputs spent by the inputs, nil for a coinbase transaction
+	spent   []*output
+	outputs []*output
+
+	// block is nil while the transaction is in the mempool
+	block *block
+}
+
+type block struct {
+	hash         string
+	height       int
+	header       []byte
+	time         time.Time
+	transactions []*transaction
+}
+
+// Chain is an in-memory blockchain with a mempool. It is safe for concurrent use.
+type Chain struct {
+	network address.NetworkInfo
+
+	mu           sync.Mutex
+	fees         Fees
+	blocks       []*block
+	transactions map[string]*transaction
+	spentBy      map[Outpoint]string
+	mempool      []*transaction
+	funded       int
+}
+
+// NewChain returns a chain holding an empty genesis block, the addresses of its transactions are
+// encoded for network.
+func NewChain(network address.NetworkInfo) *Chain {
+	chain := &Chain{
+		network:      network,
+		fees:         DefaultFees,
+		transactions: map[string]*transaction{},
+		spentBy:      map[Outpoint]string{},
+	}
+	chain.mine()
+	return chain
+}
+
+// SetFees replaces the fee rates answered by the fee endpoints.
+func (c *Chain) SetFees(fees Fees) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.fees = fees
+}
+
+// Height returns the height of the chain tip.
+func (c *Chain) Height() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.blocks) - 1
+}
+
+// Mempool returns the ids of the unconfirmed transactions in the order they were accepted.
+func (c *Chain) Mempool() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	ids := make([]string, len(c.mempool))
+	for i, tx := range c.mempool {
+		ids[i] = tx.id
+	}
+	return ids
+}
+
+// Fund adds to the mempool a coinbase transaction paying amount to addr and returns its output.
+// Call Mine to confirm it.
+func (c *Chain) Fund(addr address.BitcoinAddress, amount *big.Int) Outpoint {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.funded++
+	// the script signature makes the id of every funding transaction unique
+	counter := make([]byte, 8)
+	binary.BigEndian.PutUint64(counter, uint64(c.funded))
+	input := scripts.NewTxInput(strings.Repeat("00", 32), 0xffffffff, scripts.NewScript(formating.BytesToHex(counter)))
+	tx := scripts.NewBtcTransaction([]*scripts.TxInput{input}, []*scripts.TxOutput{scripts.NewTxOutput(amount, addr.ToScriptPubKey())}, false)
+	entry := c.newTransaction(tx, tx.Serialize())
+	entry.coinbase = true
+	c.accept(entry)
+	return Outpoint{TxId: entry.id, Vout: 0}
+}
+
+// Broadcast adds a serialized transaction to the mempool and returns its id. Its inputs must spend
+// existing outputs not spent by another transaction and cover its outputs.
+func (c *Chain) Broadcast(raw string) (string, error) {
+	tx, err := parseTransaction(raw)
+	if err != nil {
+		return "", &RejectError{Code: -22, Reason: "TX decode failed"}
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry := c.newTransaction(tx, strings.ToLower(raw))
+	if known, ok := c.transactions[entry.id]; ok {
+		if known.block != nil {
+			return "", &RejectError{Code: -27, Reason: "Transaction already in block chain"}
+		}
+		return "", &RejectError{Code: -27, Reason: "txn-already-in-mempool"}
+	}
+	if len(tx.Inputs) == 0 {
+		return "", &RejectError{Code: -26, Reason: "bad-txns-vin-empty"}
+	}
+	if len(tx.Outputs) == 0 {
+		return "", &RejectError{Code: -26, Reason: "bad-txns-vout-empty"}
+	}
+	seen := map[Outpoint]bool{}
+	var inputs, outputs int64
+	for _, input := range tx.Inputs {
+		outpoint := Outpoint{TxId: input.TxID, Vout: input.TxIndex}
+		if seen[outpoint] {
+			return "", &RejectError{Code: -26, Reason: "bad-txns-inputs-duplicate"}
+		}
+		seen[outpoint] = true
+		previous, ok := c.transactions[outpoint.TxId]
+		if !ok || outpoint.Vout < 0 || outpoint.Vout >= len(previous.outputs) {
+			return "", &RejectError{Code: -25, Reason: "bad-txns-inputs-missingorspent"}
+		}
+		if spender, ok := c.spentBy[outpoint]; ok {
+			if c.transactions[spender].block == nil {
+				return "", &RejectError{Code: -26, Reason: "txn-mempool-conflict"}
+			}
+			return "", &RejectError{Code: -25, Reason: "bad-txns-inputs-missingorspent"}
+		}
+		entry.spent = append(entry.spent, previous.outputs[outpoint.Vout])
+		inputs += previous.outputs[outpoint.Vout].value
+	}
+	for _, out := range entry.outputs {
+		if out.value < 0 {
+			return "", &RejectError{Code: -26, Reason: "bad-txns-vout-negative"}
+		}
+		outputs += out.value
+	}
+	if outputs > inputs {
+		return "", &RejectError{Code: -26, Reason: "bad-txns-in-belowout"}
+	}
+	entry.fee = inputs - outputs
+	c.accept(entry)
+	return entry.id, nil
+}
+
+// Mine appends blocks to the chain and returns their hashes, the first one confirms every
+// transaction of the mempool.
+func (c *Chain) Mine(blocks int) []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	hashes := make([]string, blocks)
+	for i := range hashes {
+		hashes[i] = c.mine().hash
+	}
+	return hashes
+}
+
+// parseTransaction parses a serialized transaction, the parser panics on some malformed input
+func parseTransaction(raw string) (tx *scripts.BtcTransaction, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("invalid transaction: %v", r)
+		}
+	}()
+	return scripts.BtcTransactionFromRaw(raw)
+}
+
+// newTransaction returns the entry of tx without the outputs it spends
+func (c *Chain) newTransaction(tx *scripts.BtcTransaction, raw string) *transaction {
+	size := len(raw) / 2
+	stripped := len(tx.ToBytes(false))
+	entry := &transaction{id: tx.TxId(), tx: tx, raw: raw, size: size, weight: stripped*3 + size}
+	for _, out := range tx.Outputs {
+		script := out.ScriptPubKey.ToHex()
+		entry.outputs = append(entry.outputs, &output{value: out.Amount.Int64(), script: script, address: c.addressOf(script)})
+	}
+	return entry
+}
+
+// accept adds a checked transaction to the mempool
+func (c *Chain) accept(entry *transaction) {
+	if !entry.coinbase {
+		for _, input := range entry.tx.Inputs {
+			c.spentBy[Outpoint{TxId: input.TxID, Vout: input.TxIndex}] = entry.id
+		}
+	}
+	c.transactions[entry.id] = entry
+	c.mempool = append(c.mempool, entry)
+}
+
+// mine appends a block confirming the mempool
+func (c *Chain) mine() *block {
+	b := &block{height: len(c.blocks), time: time.Unix(genesisTime+int64(len(c.blocks))*600, 0), transactions: c.mempool}
+	c.mempool = nil
+	ids := make([][]byte, len(b.transactions))
+	for i, tx := range b.transactions {
+		tx.block = b
+		ids[i] = formating.ReverseBytes(formating.HexToBytes(tx.id))
+	}
+	previous := make([]byte, 32)
+	if len(c.blocks) > 0 {
+		previous = formating.ReverseBytes(formating.HexToBytes(c.blocks[len(c.blocks)-1].hash))
+	}
+	header := make([]byte, 80)
+	binary.LittleEndian.PutUint32(header[0:], 0x20000000)
+	copy(header[4:], previous)
+	copy(header[36:], merkleRoot(ids))
+	binary.LittleEndian.PutUint32(header[68:], uint32(b.time.Unix()))
+	binary.LittleEndian.PutUint32(header[72:], 0x207fffff)
+	b.header = header
+	b.hash = formating.BytesToHex(formating.ReverseBytes(digest.DoubleHash(header)))
+	c.blocks = append(c.blocks, b)
+	return b
+}
+
+// merkleRoot returns the merkle root of transaction ids in internal byte order, zero for no
+// transaction
+func merkleRoot(ids [][]byte) []byte {
+	if len(ids) == 0 {
+		return make([]byte, 32)
+	}
+	for len(ids) > 1 {
+		ids = merkleLevel(ids)
+	}
+	return ids[0]
+}
+
+// merkleLevel hashes the pairs of a level of the merkle tree, an odd last node is paired with itself
+func merkleLevel(nodes [][]byte) [][]byte {
+	if len(nodes)%2 == 1 {
+		nodes = append(nodes, nodes[len(nodes)-1])
+	}
+	level := make([][]byte, len(nodes)/2)
+	for i := range level {
+		level[i] = digest.DoubleHash(append(append([]byte{}, nodes[2*i]...), nodes[2*i+1]...))
+	}
+	return level
+}
+
+// merkleBranch returns the hashes proving the transaction at pos in a block, as displayed by the
+// APIs
+func (b *block) merkleBranch(pos int) []string {
+	nodes := make([][]byte, len(b.transactions))
+	for i, tx := range b.transactions {
+		nodes[i] = formating.ReverseBytes(formating.HexToBytes(tx.id))
+	}
+	branch := []string{}
+	for len(nodes) > 1 {
+		sibling := pos ^ 1
+		if sibling >= len(nodes) {
+			sibling = pos
+		}
+		branch = append(branch, formating.BytesToHex(formating.ReverseBytes(nodes[sibling])))
+		nodes = merkleLevel(nodes)
+		pos /= 2
+	}
+	return branch
+}
+
+// position returns the index of the transaction in its block
+func (tx *transaction) position() int {
+	for i, confirmed := range tx.block.transactions {
+		if confirmed == tx {
+			return i
+		}
+	}
+	return -1
+}
+
+// addressOf returns the address of a standard scriptPubKey, empty for other scripts
+func (c *Chain) addressOf(script string) string {
+	var addr address.BitcoinAddress
+	var err error
+	switch {
+	case len(script) == 44 && strings.HasPrefix(script, "0014"):
+		addr, err = address.P2WPKHAddresssFromProgram(script[4:])
+	case len(script) == 68 && strings.HasPrefix(script, "0020"):
+		addr, err = address.P2WSHAddresssFromProgram(script[4:])
+	case len(script) == 68 && strings.HasPrefix(script, "5120"):
+		addr, err = address.P2TRAddressFromProgram(script[4:])
+	case len(script) == 50 && strings.HasPrefix(script, "76a914") && strings.HasSuffix(script, "88ac"):
+		addr, err = address.P2PKHAddressFromHash160(script[6:46])
+	case len(script) == 46 && strings.HasPrefix(script, "a914") && strings.HasSuffix(script, "87"):
+		addr, err = address.P2SHAddressFromHash160(script[4:44])
+	default:
+		return ""
+	}
+	if err != nil {
+		return ""
+	}
+	return addr.Show(c.network)
+}
+
+// confirmations returns the number of confirmations of tx, 0 when unconfirmed
+func (c *Chain) confirmations(tx *transaction) int {
+	if tx.block == nil {
+		return 0
+	}
+	return len(c.blocks) - tx.block.height
+}
+
+// involves reports whether tx spends from or pays to addr
+func (tx *transaction) involves(addr string) bool {
+	for _, out := range append(append([]*output{}, tx.spent...), tx.outputs...) {
+		if out.address == addr {
+			return true
+		}
+	}
+	return false
+}
+
+// history returns the transactions of addr, the unconfirmed ones newest first then the confirmed
+// ones from the chain tip
+func (c *Chain) history(addr string) []*transaction {
+	result := []*transaction{}
+	for i := len(c.mempool) - 1; i >= 0; i-- {
+		if c.mempool[i].involves(addr) {
+			result = append(result, c.mempool[i])
+		}
+	}
+	for i := len(c.blocks) - 1; i >= 0; i-- {
+		transactions := c.blocks[i].transactions
+		for j := len(transactions) - 1; j >= 0; j-- {
+			if transactions[j].involves(addr) {
+				result = append(result, transactions[j])
+			}
+		}
+	}
+	return result
+}
+
+// unspent returns the unspent outputs paying to addr, the confirmed ones first
+func (c *Chain) unspent(addr string) []Outpoint {
+	result := []Outpoint{}
+	for id, tx := range c.transactions {
+		for vout, out := range tx.outputs {
+			outpoint := Outpoint{TxId: id, Vout: vout}
+			if _, spent := c.spentBy[outpoint]; !spent && out.address == addr {
+				result = append(result, outpoint)
+			}
+		}
+	}
+	sort.Slice(result, func(i, j int) bool {
+		first, second := c.transactions[result[i].TxId], c.transactions[result[j].TxId]
+		if c.height(first) != c.height(second) {
+			return c.height(first) > c.height(second)
+		}
+		if result[i].TxId != result[j].TxId {
+			return result[i].TxId < result[j].TxId
+		}
+		return result[i].Vout < result[j].Vout
+	})
+	return result
+}
+
+// height returns the height of the block of tx, used to sort the unconfirmed transactions last
+func (c *Chain) height(tx *transaction) int {
+	if tx.block == nil {
+		return -1
+	}
+	return tx.block.height
+}
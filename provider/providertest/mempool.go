@@ -0,0 +1,239 @@
+package providertest
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/mrtnetwork/bitcoin/formating"
+	"github.com/mrtnetwork/bitcoin/provider"
+)
+
+// esploraPageSize is the number of confirmed transactions of a page of the address API
+const esploraPageSize = 25
+
+// MempoolHandler returns the handler of the Mempool API of the chain, including the Esplora
+// endpoints used by EsploraProvider. Mount it with http.StripPrefix to serve it below a path.
+func (c *Chain) MempoolHandler() http.Handler {
+	return http.HandlerFunc(c.serveMempool)
+}
+
+func (c *Chain) serveMempool(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	if r.Method == http.MethodPost {
+		if len(parts) != 1 || parts[0] != "tx" {
+			http.NotFound(w, r)
+			return
+		}
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		id, err := c.Broadcast(strings.TrimSpace(string(body)))
+		var reject *RejectError
+		if errors.As(err, &reject) {
+			http.Error(w, fmt.Sprintf(`sendrawtransaction RPC error: {"code":%d,"message":"%s"}`, reject.Code, reject.Reason), http.StatusBadRequest)
+			return
+		}
+		fmt.Fprint(w, id)
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	switch {
+	case len(parts) == 3 && parts[0] == "address" && parts[2] == "utxo":
+		utxos := provider.MempolUtxoList{}
+		for _, outpoint := range c.unspent(parts[1]) {
+			tx := c.transactions[outpoint.TxId]
+			utxo := provider.MempolUtxo{Txid: outpoint.TxId, Vout: outpoint.Vout}
+			status := c.mempoolStatus(tx)
+			utxo.Status.Confirmed, utxo.Status.BlockHeight, utxo.Status.BlockHash = status.Confirmed, status.BlockHeight, status.BlockHash
+			utxo.Status.BlockTime = int(status.BlockTime)
+			utxo.Value.SetInt64(tx.outputs[outpoint.Vout].value)
+			utxos = append(utxos, utxo)
+		}
+		writeJSON(w, utxos)
+	case len(parts) >= 3 && parts[0] == "address" && parts[2] == "txs":
+		c.serveAddressTransactions(w, parts[1], parts[3:])
+	case len(parts) >= 2 && parts[0] == "tx":
+		tx, ok := c.transactions[parts[1]]
+		if !ok {
+			http.Error(w, "Transaction not found", http.StatusNotFound)
+			return
+		}
+		switch strings.Join(parts[2:], "/") {
+		case "":
+			writeJSON(w, c.mempoolTransaction(tx))
+		case "hex":
+			fmt.Fprint(w, tx.raw)
+		case "status":
+			writeJSON(w, c.mempoolStatus(tx))
+		case "merkle-proof":
+			if tx.block == nil {
+				http.Error(w, "Transaction not found", http.StatusNotFound)
+				return
+			}
+			pos := tx.position()
+			writeJSON(w, provider.MerkleProof{BlockHeight: tx.block.height, Merkle: tx.block.merkleBranch(pos), Pos: pos})
+		default:
+			http.NotFound(w, r)
+		}
+	case r.URL.Path == "/v1/fees/recommended":
+		writeJSON(w, map[string]int{
+			"fastestFee": c.fees.Fastest, "halfHourFee": c.fees.HalfHour, "hourFee": c.fees.Hour,
+			"economyFee": c.fees.Economy, "minimumFee": c.fees.Minimum,
+		})
+	case r.URL.Path == "/fee-estimates":
+		writeJSON(w, map[string]int{
+			"1": c.fees.Fastest, "2": c.fees.Fastest, "3": c.fees.HalfHour, "6": c.fees.Hour,
+			"144": c.fees.Economy, "1008": c.fees.Minimum,
+		})
+	case r.URL.Path == "/blocks/tip/height":
+		fmt.Fprint(w, len(c.blocks)-1)
+	case r.URL.Path == "/blocks/tip/hash":
+		fmt.Fprint(w, c.blocks[len(c.blocks)-1].hash)
+	case len(parts) == 2 && parts[0] == "block-height":
+		height, err := strconv.Atoi(parts[1])
+		if err != nil || height < 0 || height >= len(c.blocks) {
+			http.Error(w, "Block not found", http.StatusNotFound)
+			return
+		}
+		fmt.Fprint(w, c.blocks[height].hash)
+	case len(parts) >= 2 && parts[0] == "block":
+		b := c.block(parts[1])
+		if b == nil {
+			http.Error(w, "Block not found", http.StatusNotFound)
+			return
+		}
+		switch strings.Join(parts[2:], "/") {
+		case "":
+			writeJSON(w, map[string]interface{}{
+				"id": b.hash, "height": b.height, "timestamp": b.time.Unix(), "tx_count": len(b.transactions),
+				"merkle_root": formating.BytesToHex(formating.ReverseBytes(b.header[36:68])),
+			})
+		case "header":
+			fmt.Fprint(w, formating.BytesToHex(b.header))
+		default:
+			http.NotFound(w, r)
+		}
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// serveAddressTransactions answers a page of the transactions of addr. The first page holds the
+// unconfirmed transactions and the 25 most recent confirmed ones, /chain/LAST the 25 confirmed
+// ones following LAST.
+func (c *Chain) serveAddressTransactions(w http.ResponseWriter, addr string, chain []string) {
+	history := c.history(addr)
+	page := []provider.MempoolTransaction{}
+	confirmed := []*transaction{}
+	for _, tx := range history {
+		if tx.block == nil {
+			if len(chain) == 0 {
+				page = append(page, c.mempoolTransaction(tx))
+			}
+		} else {
+			confirmed = append(confirmed, tx)
+		}
+	}
+	if len(chain) > 2 || (len(chain) > 0 && chain[0] != "chain") {
+		http.Error(w, "Invalid path", http.StatusBadRequest)
+		return
+	}
+	if len(chain) == 2 {
+		last := -1
+		for i, tx := range confirmed {
+			if tx.id == chain[1] {
+				last = i
+			}
+		}
+		if last < 0 {
+			http.Error(w, "Transaction not found", http.StatusNotFound)
+			return
+		}
+		confirmed = confirmed[last+1:]
+	}
+	for i := 0; i < len(confirmed) && i < esploraPageSize; i++ {
+		page = append(page, c.mempoolTransaction(confirmed[i]))
+	}
+	writeJSON(w, page)
+}
+
+// block returns the block with the given hash, nil if unknown
+func (c *Chain) block(hash string) *block {
+	for _, b := range c.blocks {
+		if b.hash == hash {
+			return b
+		}
+	}
+	return nil
+}
+
+func (c *Chain) mempoolStatus(tx *transaction) provider.MempoolStatus {
+	if tx.block == nil {
+		return provider.MempoolStatus{}
+	}
+	return provider.MempoolStatus{Confirmed: true, BlockHeight: tx.block.height, BlockHash: tx.block.hash, BlockTime: tx.block.time.Unix()}
+}
+
+func (c *Chain) mempoolTransaction(tx *transaction) provider.MempoolTransaction {
+	result := provider.MempoolTransaction{
+		TxID:     tx.id,
+		Version:  int(binary.LittleEndian.Uint32(tx.tx.Version)),
+		Locktime: int(binary.LittleEndian.Uint32(tx.tx.Locktime)),
+		Size:     tx.size,
+		Weight:   tx.weight,
+		Fee:      int(tx.fee),
+		Status:   c.mempoolStatus(tx),
+	}
+	for i, input := range tx.tx.Inputs {
+		vin := provider.MempoolVin{
+			TxID:       input.TxID,
+			Vout:       input.TxIndex,
+			ScriptSig:  input.ScriptSig.ToHex(),
+			Witness:    witness(tx, i),
+			IsCoinbase: tx.coinbase,
+			Sequence:   int(binary.LittleEndian.Uint32(input.Sequence)),
+		}
+		if !tx.coinbase {
+			spent := tx.spent[i]
+			vin.PrevOut = provider.MempoolPrevOut{ScriptPubKey: spent.script, ScriptPubKeyAddress: spent.address, Value: int(spent.value)}
+		}
+		result.Vin = append(result.Vin, vin)
+	}
+	for _, out := range tx.outputs {
+		result.Vout = append(result.Vout, provider.MempoolVout{ScriptPubKey: out.script, ScriptPubKeyAddress: out.address, Value: int(out.value)})
+	}
+	return result
+}
+
+// witness returns the witness stack of an input, nil without witness
+func witness(tx *transaction, input int) []string {
+	if !tx.tx.HasSegwit || input >= len(tx.tx.Witnesses) {
+		return nil
+	}
+	return tx.tx.Witnesses[input].Stack
+}
+
+// sum returns the total value of outputs
+func sum(outputs []*output) *big.Int {
+	total := big.NewInt(0)
+	for _, out := range outputs {
+		total.Add(total, big.NewInt(out.value))
+	}
+	return total
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,71 @@
+package providertest
+
+import (
+	"net/http"
+	"net/http/httptest"
+
+	"github.com/mrtnetwork/bitcoin/address"
+	"github.com/mrtnetwork/bitcoin/provider"
+)
+
+// Server serves a Chain over HTTP, the Mempool API under /mempool and the BlockCypher API under
+// /blockcypher. Close it at the end of the test.
+type Server struct {
+	*Chain
+
+	// URL of the server, for example http://127.0.0.1:50000.
+	URL string
+
+	server *httptest.Server
+}
+
+// NewServer starts a server of a new chain, the addresses of its transactions are encoded for
+// network.
+func NewServer(network address.NetworkInfo) *Server {
+	chain := NewChain(network)
+	mux := http.NewServeMux()
+	mempool := http.StripPrefix("/mempool", chain.MempoolHandler())
+	blockCypher := http.StripPrefix("/blockcypher", chain.BlockCypherHandler())
+	mux.Handle("/mempool/", mempool)
+	mux.Handle("/blockcypher", blockCypher)
+	mux.Handle("/blockcypher/", blockCypher)
+	server := httptest.NewServer(mux)
+	return &Server{Chain: chain, URL: server.URL, server: server}
+}
+
+// Close shuts down the server.
+func (s *Server) Close() {
+	s.server.Close()
+}
+
+// MempoolURL returns the base URL of the Mempool API of the server.
+func (s *Server) MempoolURL() string {
+	return s.URL + "/mempool"
+}
+
+// BlockCypherURL returns the base URL of the BlockCypher API of the server.
+func (s *Server) BlockCypherURL() string {
+	return s.URL + "/blockcypher"
+}
+
+// MempoolProvider returns a MempoolProvider of the server.
+func (s *Server) MempoolProvider() *provider.MempoolProvider {
+	api := provider.NewMempoolProvider(s.network, s.server.Client())
+	api.BaseURL = s.MempoolURL()
+	return api
+}
+
+// EsploraProvider returns an EsploraProvider of the server, the Mempool API is a superset of the
+// Esplora one.
+func (s *Server) EsploraProvider() *provider.EsploraProvider {
+	api := provider.NewEsploraProvider(s.network, s.server.Client())
+	api.BaseURL = s.MempoolURL()
+	return api
+}
+
+// BlockCypherProvider returns a BlockCypherProvider of the server.
+func (s *Server) BlockCypherProvider() *provider.BlockCypherProvider {
+	api := provider.NewBlockCypherProvider(s.network, s.server.Client())
+	api.BaseURL = s.BlockCypherURL()
+	return api
+}
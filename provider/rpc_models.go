@@ -0,0 +1,299 @@
+package provider
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"time"
+)
+
+// satoshisPerBitcoin is the number of satoshis of one bitcoin
+var satoshisPerBitcoin = big.NewRat(100000000, 1)
+
+// btcToSatoshi converts an amount in bitcoins, as returned by the node, to satoshis without
+// going through a float
+func btcToSatoshi(amount json.Number) (*big.Int, error) {
+	if amount == "" {
+		return big.NewInt(0), nil
+	}
+	value, ok := new(big.Rat).SetString(string(amount))
+	if !ok {
+		return nil, fmt.Errorf("invalid amount %s", amount)
+	}
+	value.Mul(value, satoshisPerBitcoin)
+	if !value.IsInt() {
+		return nil, fmt.Errorf("invalid amount %s", amount)
+	}
+	return new(big.Int).Set(value.Num()), nil
+}
+
+// btcPerKvBToFeeRate converts a fee rate in bitcoins per 1000 virtual bytes, rounded to the
+// nearest satoshi per 1000 virtual bytes: the servers may return doubles of more than 8 decimals.
+func btcPerKvBToFeeRate(rate json.Number) (FeeRate, error) {
+	value, ok := new(big.Rat).SetString(string(rate))
+	if !ok {
+		return 0, fmt.Errorf("invalid fee rate %s", rate)
+	}
+	btc, _ := value.Float64()
+	return FeeRateFromSatPerVByte(btc * 1e5), nil
+}
+
+// MempoolAcceptResult is the result of testmempoolaccept for one transaction.
+type MempoolAcceptResult struct {
+	Txid  string
+	Wtxid string
+
+	// Allowed reports whether the transaction would be accepted to the mempool.
+	Allowed bool
+
+	// VSize and Fee of the transaction in satoshis, set when it is allowed.
+	VSize int
+	Fee   *big.Int
+
+	// RejectReason is the reason of the rejection, empty when it is allowed.
+	RejectReason string
+}
+
+// ScannedUtxo is an unspent output found by scantxoutset.
+type ScannedUtxo struct {
+	TxHash string
+	Vout   int
+
+	// Value of the output in satoshis.
+	Value *big.Int
+
+	// ScriptPubKey of the output in hexadecimal.
+	ScriptPubKey string
+
+	// Descriptor matching the output.
+	Descriptor string
+
+	// Height of the block including the output.
+	Height int
+
+	// Coinbase reports whether the output is an output of a coinbase transaction.
+	Coinbase bool
+}
+
+// ScannedUtxoList is the result of scantxoutset.
+type ScannedUtxoList []ScannedUtxo
+
+// ToUtxoWithOwner converts the outputs to the UTXOs spent by the transaction builder.
+func (scanned ScannedUtxoList) ToUtxoWithOwner(owner UtxoOwnerDetails) UtxoWithOwnerList {
+	utxos := make([]UtxoWithOwner, len(scanned))
+	for i := 0; i < len(scanned); i++ {
+		utxos[i] = UtxoWithOwner{
+			Utxo: BitcoinUtxo{
+				TxHash:      scanned[i].TxHash,
+				Value:       scanned[i].Value,
+				Vout:        scanned[i].Vout,
+				ScriptType:  owner.Address.GetType(),
+				BlockHeight: scanned[i].Height,
+			},
+			OwnerDetails: owner,
+		}
+	}
+	return utxos
+}
+
+// TxOut is an unspent output as returned by gettxout.
+type TxOut struct {
+	// BestBlock is the hash of the chain tip.
+	BestBlock string
+
+	// Confirmations of the output, 0 when it is in the mempool.
+	Confirmations int
+
+	// Value of the output in satoshis.
+	Value *big.Int
+
+	// ScriptPubKey of the output in hexadecimal and its address, empty when it has none.
+	ScriptPubKey string
+	Address      string
+
+	// Coinbase reports whether the output is an output of a coinbase transaction.
+	Coinbase bool
+}
+
+// MempoolEntry is a transaction of the mempool as returned by getmempoolentry.
+type MempoolEntry struct {
+	VSize  int
+	Weight int
+
+	// Time the transaction entered the mempool and the height of the tip at that time.
+	Time   time.Time
+	Height int
+
+	// Fee paid by the transaction and the fee modified by prioritisetransaction, in satoshis.
+	Fee         *big.Int
+	ModifiedFee *big.Int
+
+	// AncestorCount and DescendantCount count the transaction itself.
+	AncestorCount   int
+	DescendantCount int
+
+	// Depends are the unconfirmed parents and SpentBy the unconfirmed children of the transaction.
+	Depends []string
+	SpentBy []string
+
+	// Replaceable reports whether the transaction signals BIP125 replaceability.
+	Replaceable bool
+}
+
+// node responses
+
+type rpcMempoolAccept struct {
+	Txid         string `json:"txid"`
+	Wtxid        string `json:"wtxid"`
+	Allowed      bool   `json:"allowed"`
+	VSize        int    `json:"vsize"`
+	RejectReason string `json:"reject-reason"`
+	Fees         struct {
+		Base json.Number `json:"base"`
+	} `json:"fees"`
+}
+
+type rpcScriptPubKey struct {
+	Hex     string `json:"hex"`
+	Address string `json:"address"`
+}
+
+type rpcScanResult struct {
+	Success  bool `json:"success"`
+	Unspents []struct {
+		Txid         string      `json:"txid"`
+		Vout         int         `json:"vout"`
+		ScriptPubKey string      `json:"scriptPubKey"`
+		Desc         string      `json:"desc"`
+		Amount       json.Number `json:"amount"`
+		Coinbase     bool        `json:"coinbase"`
+		Height       int         `json:"height"`
+	} `json:"unspents"`
+}
+
+type rpcTxOut struct {
+	BestBlock     string          `json:"bestblock"`
+	Confirmations int             `json:"confirmations"`
+	Value         json.Number     `json:"value"`
+	ScriptPubKey  rpcScriptPubKey `json:"scriptPubKey"`
+	Coinbase      bool            `json:"coinbase"`
+}
+
+type rpcBlockHeader struct {
+	Hash              string `json:"hash"`
+	Height            int    `json:"height"`
+	Version           int32  `json:"version"`
+	MerkleRoot        string `json:"merkleroot"`
+	Time              int64  `json:"time"`
+	Nonce             uint32 `json:"nonce"`
+	Bits              string `json:"bits"`
+	PreviousBlockHash string `json:"previousblockhash"`
+}
+
+type rpcMempoolEntry struct {
+	VSize           int      `json:"vsize"`
+	Weight          int      `json:"weight"`
+	Time            int64    `json:"time"`
+	Height          int      `json:"height"`
+	DescendantCount int      `json:"descendantcount"`
+	AncestorCount   int      `json:"ancestorcount"`
+	Depends         []string `json:"depends"`
+	SpentBy         []string `json:"spentby"`
+	Replaceable     bool     `json:"bip125-replaceable"`
+	Fees            struct {
+		Base     json.Number `json:"base"`
+		Modified json.Number `json:"modified"`
+	} `json:"fees"`
+}
+
+type rpcTransaction struct {
+	Txid     string      `json:"txid"`
+	Version  int         `json:"version"`
+	Locktime int         `json:"locktime"`
+	Size     int         `json:"size"`
+	VSize    int         `json:"vsize"`
+	Weight   int         `json:"weight"`
+	Fee      json.Number `json:"fee"`
+	Vin      []struct {
+		Txid      string `json:"txid"`
+		Vout      int    `json:"vout"`
+		Coinbase  string `json:"coinbase"`
+		ScriptSig struct {
+			Hex string `json:"hex"`
+		} `json:"scriptSig"`
+		Witness  []string `json:"txinwitness"`
+		Sequence uint32   `json:"sequence"`
+		PrevOut  *struct {
+			Value        json.Number     `json:"value"`
+			ScriptPubKey rpcScriptPubKey `json:"scriptPubKey"`
+		} `json:"prevout"`
+	} `json:"vin"`
+	Vout []struct {
+		Value        json.Number     `json:"value"`
+		ScriptPubKey rpcScriptPubKey `json:"scriptPubKey"`
+	} `json:"vout"`
+	BlockHash     string `json:"blockhash"`
+	Confirmations int    `json:"confirmations"`
+	BlockTime     int64  `json:"blocktime"`
+}
+
+// toChainTransaction converts the transaction, tip is the height of the chain tip used to
+// compute the height of the block from the confirmations
+func (transaction *rpcTransaction) toChainTransaction(tip int) (*ChainTransaction, error) {
+	fee, err := btcToSatoshi(transaction.Fee)
+	if err != nil {
+		return nil, err
+	}
+	result := &ChainTransaction{
+		TxId:     transaction.Txid,
+		Version:  transaction.Version,
+		Locktime: transaction.Locktime,
+		Size:     transaction.Size,
+		VSize:    transaction.VSize,
+		Weight:   transaction.Weight,
+		Fee:      fee,
+	}
+	if transaction.Confirmations > 0 {
+		result.Status = TxStatus{
+			Confirmed:   true,
+			BlockHeight: tip - transaction.Confirmations + 1,
+			BlockHash:   transaction.BlockHash,
+			BlockTime:   time.Unix(transaction.BlockTime, 0),
+		}
+	}
+	for _, vin := range transaction.Vin {
+		input := ChainTxInput{
+			TxId:       vin.Txid,
+			Vout:       vin.Vout,
+			ScriptSig:  vin.ScriptSig.Hex,
+			Witness:    vin.Witness,
+			Sequence:   vin.Sequence,
+			IsCoinbase: vin.Coinbase != "",
+			Value:      big.NewInt(0),
+		}
+		if input.IsCoinbase {
+			input.ScriptSig = vin.Coinbase
+		}
+		// the spent output is only returned with verbosity 2 by nodes keeping the undo data
+		if vin.PrevOut != nil {
+			if input.Value, err = btcToSatoshi(vin.PrevOut.Value); err != nil {
+				return nil, err
+			}
+			input.Address = vin.PrevOut.ScriptPubKey.Address
+			input.ScriptPubKey = vin.PrevOut.ScriptPubKey.Hex
+		}
+		result.Inputs = append(result.Inputs, input)
+	}
+	for _, vout := range transaction.Vout {
+		value, err := btcToSatoshi(vout.Value)
+		if err != nil {
+			return nil, err
+		}
+		result.Outputs = append(result.Outputs, ChainTxOutput{
+			Address:      vout.ScriptPubKey.Address,
+			ScriptPubKey: vout.ScriptPubKey.Hex,
+			Value:        value,
+		})
+	}
+	return result, nil
+}
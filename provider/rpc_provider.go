@@ -0,0 +1,530 @@
+package provider
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/mrtnetwork/bitcoin/address"
+	"github.com/mrtnetwork/bitcoin/formating"
+	"github.com/mrtnetwork/bitcoin/scripts"
+)
+
+// RPCAuth holds the credentials of a Bitcoin Core node. CookieFile, when set, takes precedence
+// over User and Password and is read before every request, so a restarted node is picked up.
+type RPCAuth struct {
+	User     string
+	Password string
+
+	// CookieFile is the path of the .cookie file written by the node in its data directory.
+	CookieFile string
+}
+
+// credentials returns the user and password of the basic authentication
+func (auth RPCAuth) credentials() (string, string, error) {
+	if auth.CookieFile == "" {
+		return auth.User, auth.Password, nil
+	}
+	cookie, err := os.ReadFile(auth.CookieFile)
+	if err != nil {
+		return "", "", fmt.Errorf("error reading cookie file: %v", err)
+	}
+	user, password, ok := strings.Cut(strings.TrimSpace(string(cookie)), ":")
+	if !ok {
+		return "", "", fmt.Errorf("invalid cookie file")
+	}
+	return user, password, nil
+}
+
+// RPCError is an error returned by the node. Use errors.Is with ErrNotFound or ErrRejected to
+// check its kind.
+type RPCError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *RPCError) Error() string {
+	return fmt.Sprintf("rpc error %d: %s", e.Code, e.Message)
+}
+
+func (e *RPCError) Unwrap() error {
+	switch e.Code {
+	// RPC_INVALID_ADDRESS_OR_KEY, returned for unknown transactions and blocks
+	case -5:
+		return ErrNotFound
+	// RPC_VERIFY_ERROR, RPC_VERIFY_REJECTED and RPC_VERIFY_ALREADY_IN_CHAIN
+	case -25, -26, -27:
+		return ErrRejected
+	// RPC_IN_WARMUP
+	case -28:
+		return ErrUnavailable
+	}
+	return nil
+}
+
+// RPCRequest is a request of a batch. Result receives the decoded result and Err the error of
+// the request.
+type RPCRequest struct {
+	Method string
+	Params []interface{}
+	Result interface{}
+	Err    error
+}
+
+type rpcRequest struct {
+	JsonRPC string        `json:"jsonrpc"`
+	Id      int           `json:"id"`
+	Method  string        `json:"method"`
+	Params  []interface{} `json:"params"`
+}
+
+type rpcResponse struct {
+	Id     int             `json:"id"`
+	Result json.RawMessage `json:"result"`
+	Error  *RPCError       `json:"error"`
+}
+
+// decode decodes the result of the response into result
+func (response *rpcResponse) decode(result interface{}) error {
+	if response.Error != nil {
+		return response.Error
+	}
+	if result == nil {
+		return nil
+	}
+	if err := json.Unmarshal(response.Result, result); err != nil {
+		return fmt.Errorf("error decoding JSON: %v", err)
+	}
+	return nil
+}
+
+// RPCProvider is the ChainProvider of a Bitcoin Core node, queried through its JSON-RPC
+// interface. The node does not need a wallet: the UTXOs of an address are found with
+// scantxoutset, which only scans the confirmed outputs.
+type RPCProvider struct {
+	// URL of the node, for example http://127.0.0.1:8332.
+	URL string
+
+	// Network of the addresses.
+	Network address.NetworkInfo
+
+	auth   RPCAuth
+	client *http.Client
+}
+
+// NewRPCProvider returns the provider of the node at url. A nil client uses http.DefaultClient.
+func NewRPCProvider(url string, network address.NetworkInfo, auth RPCAuth, client *http.Client) *RPCProvider {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return &RPCProvider{URL: url, Network: network, auth: auth, client: client}
+}
+
+// post sends a request to the node and returns the body of the response. The node answers
+// the failed requests with an error status and the error in the body, so the body is
+// returned whenever it holds JSON.
+func (api *RPCProvider) post(ctx context.Context, payload interface{}) ([]byte, error) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return nil, fmt.Errorf("error marshaling JSON: %v", err)
+	}
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, api.URL, bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	user, password, err := api.auth.credentials()
+	if err != nil {
+		return nil, err
+	}
+	request.SetBasicAuth(user, password)
+	request.Header.Set("Content-Type", "application/json")
+	response, err := api.client.Do(request)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+
+	body, err := io.ReadAll(response.Body)
+	if err != nil {
+		return nil, err
+	}
+	if response.StatusCode >= 200 && response.StatusCode < 300 || json.Valid(body) {
+		return body, nil
+	}
+	apiError := &APIError{StatusCode: response.StatusCode, Message: strings.TrimSpace(string(body))}
+	switch {
+	case response.StatusCode == http.StatusTooManyRequests:
+		apiError.Err = ErrRateLimited
+	case response.StatusCode >= 500:
+		apiError.Err = ErrUnavailable
+	}
+	return nil, apiError
+}
+
+// Call sends a request to the node and decodes its result into result, which can be nil.
+func (api *RPCProvider) Call(ctx context.Context, method string, result interface{}, params ...interface{}) error {
+	if params == nil {
+		params = []interface{}{}
+	}
+	body, err := api.post(ctx, rpcRequest{JsonRPC: "1.0", Method: method, Params: params})
+	if err != nil {
+		return err
+	}
+	var response rpcResponse
+	if err := json.Unmarshal(body, &response); err != nil {
+		return fmt.Errorf("error decoding JSON: %v", err)
+	}
+	return response.decode(result)
+}
+
+// Batch sends the requests in a single round trip. The returned error is the error of the round
+// trip, the error of each request is set in its Err field.
+func (api *RPCProvider) Batch(ctx context.Context, requests ...*RPCRequest) error {
+	payload := make([]rpcRequest, len(requests))
+	for i, request := range requests {
+		params := request.Params
+		if params == nil {
+			params = []interface{}{}
+		}
+		payload[i] = rpcRequest{JsonRPC: "1.0", Id: i, Method: request.Method, Params: params}
+	}
+	body, err := api.post(ctx, payload)
+	if err != nil {
+		return err
+	}
+	var responses []rpcResponse
+	if err := json.Unmarshal(body, &responses); err != nil {
+		return fmt.Errorf("error decoding JSON: %v", err)
+	}
+	// the responses are matched by id, the node may not keep the order of the requests
+	for _, request := range requests {
+		request.Err = fmt.Errorf("missing response to %s", request.Method)
+	}
+	for i := range responses {
+		if responses[i].Id < 0 || responses[i].Id >= len(requests) {
+			continue
+		}
+		request := requests[responses[i].Id]
+		request.Err = responses[i].decode(request.Result)
+	}
+	return nil
+}
+
+// batch sends the requests and returns the first error of the round trip or of a request
+func (api *RPCProvider) batch(ctx context.Context, requests ...*RPCRequest) error {
+	if err := api.Batch(ctx, requests...); err != nil {
+		return err
+	}
+	for _, request := range requests {
+		if request.Err != nil {
+			return request.Err
+		}
+	}
+	return nil
+}
+
+// parseTransaction parses a serialized transaction returned by the node
+func parseTransaction(raw string) (transaction *scripts.BtcTransaction, err error) {
+	defer func() {
+		if recover() != nil {
+			transaction, err = nil, fmt.Errorf("invalid transaction")
+		}
+	}()
+	return scripts.BtcTransactionFromRaw(raw)
+}
+
+// GetRawTransaction returns the transaction with the given id. Nodes without -txindex only know
+// the transactions of the mempool and of their wallet.
+func (api *RPCProvider) GetRawTransaction(ctx context.Context, transactionId string) (*scripts.BtcTransaction, error) {
+	var raw string
+	if err := api.Call(ctx, "getrawtransaction", &raw, transactionId, false); err != nil {
+		return nil, err
+	}
+	return parseTransaction(raw)
+}
+
+// TestMempoolAccept reports whether the serialized transactions would be accepted to the mempool,
+// without broadcasting them.
+func (api *RPCProvider) TestMempoolAccept(ctx context.Context, rawTransactions ...string) ([]MempoolAcceptResult, error) {
+	var results []rpcMempoolAccept
+	if err := api.Call(ctx, "testmempoolaccept", &results, rawTransactions); err != nil {
+		return nil, err
+	}
+	accepts := make([]MempoolAcceptResult, len(results))
+	for i, result := range results {
+		fee, err := btcToSatoshi(result.Fees.Base)
+		if err != nil {
+			return nil, err
+		}
+		accepts[i] = MempoolAcceptResult{
+			Txid:         result.Txid,
+			Wtxid:        result.Wtxid,
+			Allowed:      result.Allowed,
+			VSize:        result.VSize,
+			Fee:          fee,
+			RejectReason: result.RejectReason,
+		}
+	}
+	return accepts, nil
+}
+
+type rpcSmartFee struct {
+	FeeRate json.Number `json:"feerate"`
+	Errors  []string    `json:"errors"`
+}
+
+// feeRate returns the estimated fee rate, the node returns bitcoins per 1000 virtual bytes
+func (fee *rpcSmartFee) feeRate() (FeeRate, error) {
+	if fee.FeeRate == "" {
+		return 0, fmt.Errorf("fee estimation unavailable: %s", strings.Join(fee.Errors, ", "))
+	}
+	return btcPerKvBToFeeRate(fee.FeeRate)
+}
+
+// EstimateSmartFee returns the fee rate for a confirmation within target blocks.
+func (api *RPCProvider) EstimateSmartFee(ctx context.Context, target int) (FeeRate, error) {
+	var fee rpcSmartFee
+	if err := api.Call(ctx, "estimatesmartfee", &fee, target); err != nil {
+		return 0, err
+	}
+	return fee.feeRate()
+}
+
+// GetFeeEstimates returns the fee rates by confirmation target in blocks, the targets without
+// enough data are left out.
+func (api *RPCProvider) GetFeeEstimates(ctx context.Context) (FeeEstimates, error) {
+	fees := make([]rpcSmartFee, len(feeTargets))
+	requests := make([]*RPCRequest, len(fees))
+	for i, target := range feeTargets {
+		requests[i] = &RPCRequest{Method: "estimatesmartfee", Params: []interface{}{target}, Result: &fees[i]}
+	}
+	if err := api.batch(ctx, requests...); err != nil {
+		return nil, err
+	}
+	estimates := FeeEstimates{}
+	var failure error
+	for i, target := range feeTargets {
+		rate, err := fees[i].feeRate()
+		if err != nil {
+			failure = err
+			continue
+		}
+		estimates[target] = rate
+	}
+	if len(estimates) == 0 {
+		return nil, failure
+	}
+	return estimates, nil
+}
+
+// ScanTxOutSet returns the unspent outputs matching the output descriptors, for example
+// "addr(bc1q...)". The scan of the UTXO set takes a while and a single scan runs at a time.
+func (api *RPCProvider) ScanTxOutSet(ctx context.Context, descriptors ...string) (ScannedUtxoList, error) {
+	var result rpcScanResult
+	if err := api.Call(ctx, "scantxoutset", &result, "start", descriptors); err != nil {
+		return nil, err
+	}
+	if !result.Success {
+		return nil, fmt.Errorf("scantxoutset failed")
+	}
+	utxos := make(ScannedUtxoList, len(result.Unspents))
+	for i, unspent := range result.Unspents {
+		value, err := btcToSatoshi(unspent.Amount)
+		if err != nil {
+			return nil, err
+		}
+		utxos[i] = ScannedUtxo{
+			TxHash:       unspent.Txid,
+			Vout:         unspent.Vout,
+			Value:        value,
+			ScriptPubKey: unspent.ScriptPubKey,
+			Descriptor:   unspent.Desc,
+			Height:       unspent.Height,
+			Coinbase:     unspent.Coinbase,
+		}
+	}
+	return utxos, nil
+}
+
+// GetTxOut returns an unspent output, ErrNotFound when it is spent or unknown. includeMempool
+// also looks at the outputs of the mempool and hides the outputs spent by it.
+func (api *RPCProvider) GetTxOut(ctx context.Context, transactionId string, vout int, includeMempool bool) (*TxOut, error) {
+	var result *rpcTxOut
+	if err := api.Call(ctx, "gettxout", &result, transactionId, vout, includeMempool); err != nil {
+		return nil, err
+	}
+	// the node returns null for the spent outputs
+	if result == nil {
+		return nil, ErrNotFound
+	}
+	value, err := btcToSatoshi(result.Value)
+	if err != nil {
+		return nil, err
+	}
+	return &TxOut{
+		BestBlock:     result.BestBlock,
+		Confirmations: result.Confirmations,
+		Value:         value,
+		ScriptPubKey:  result.ScriptPubKey.Hex,
+		Address:       result.ScriptPubKey.Address,
+		Coinbase:      result.Coinbase,
+	}, nil
+}
+
+// GetBlockHash returns the hash of the block of the main chain at height.
+func (api *RPCProvider) GetBlockHash(ctx context.Context, height int) (string, error) {
+	var hash string
+	if err := api.Call(ctx, "getblockhash", &hash, height); err != nil {
+		return "", err
+	}
+	return hash, nil
+}
+
+// GetBlockHeader returns the header of the block with the given hash.
+func (api *RPCProvider) GetBlockHeader(ctx context.Context, hash string) (*BlockHeader, error) {
+	var header rpcBlockHeader
+	if err := api.Call(ctx, "getblockheader", &header, hash, true); err != nil {
+		return nil, err
+	}
+	bits, err := formating.HexToBytesCatch(header.Bits)
+	if err != nil || len(bits) != 4 {
+		return nil, fmt.Errorf("invalid block bits %s", header.Bits)
+	}
+	return &BlockHeader{
+		Hash:       header.Hash,
+		Height:     header.Height,
+		Version:    header.Version,
+		PrevBlock:  header.PreviousBlockHash,
+		MerkleRoot: header.MerkleRoot,
+		Time:       time.Unix(header.Time, 0),
+		Bits:       uint32(formating.BytesToInt(bits).Uint64()),
+		Nonce:      header.Nonce,
+	}, nil
+}
+
+// GetBlock returns the block with the given hash and its transactions.
+func (api *RPCProvider) GetBlock(ctx context.Context, hash string) (*Block, error) {
+	var raw string
+	var header rpcBlockHeader
+	if err := api.batch(ctx,
+		&RPCRequest{Method: "getblock", Params: []interface{}{hash, 0}, Result: &raw},
+		&RPCRequest{Method: "getblockheader", Params: []interface{}{hash, true}, Result: &header},
+	); err != nil {
+		return nil, err
+	}
+	data, err := formating.HexToBytesCatch(raw)
+	if err != nil {
+		return nil, fmt.Errorf("invalid block: %v", err)
+	}
+	block, err := ParseBlock(data)
+	if err != nil {
+		return nil, err
+	}
+	block.Header.Height = header.Height
+	return block, nil
+}
+
+// GetMempoolEntry returns the mempool entry of a transaction, ErrNotFound when it is not in
+// the mempool.
+func (api *RPCProvider) GetMempoolEntry(ctx context.Context, transactionId string) (*MempoolEntry, error) {
+	var entry rpcMempoolEntry
+	if err := api.Call(ctx, "getmempoolentry", &entry, transactionId); err != nil {
+		return nil, err
+	}
+	fee, err := btcToSatoshi(entry.Fees.Base)
+	if err != nil {
+		return nil, err
+	}
+	modifiedFee, err := btcToSatoshi(entry.Fees.Modified)
+	if err != nil {
+		return nil, err
+	}
+	return &MempoolEntry{
+		VSize:           entry.VSize,
+		Weight:          entry.Weight,
+		Time:            time.Unix(entry.Time, 0),
+		Height:          entry.Height,
+		Fee:             fee,
+		ModifiedFee:     modifiedFee,
+		AncestorCount:   entry.AncestorCount,
+		DescendantCount: entry.DescendantCount,
+		Depends:         entry.Depends,
+		SpentBy:         entry.SpentBy,
+		Replaceable:     entry.Replaceable,
+	}, nil
+}
+
+// GetAccountUtxo returns the confirmed unspent transaction outputs of the owner's address.
+func (api *RPCProvider) GetAccountUtxo(ctx context.Context, owner UtxoOwnerDetails) (UtxoWithOwnerList, error) {
+	utxos, err := api.ScanTxOutSet(ctx, "addr("+owner.Address.Show(api.Network)+")")
+	if err != nil {
+		return nil, err
+	}
+	return utxos.ToUtxoWithOwner(owner), nil
+}
+
+// GetTransaction returns the transaction with the given id, the values and addresses of the spent
+// outputs are only known by nodes keeping the undo data (Bitcoin Core 25 or later).
+func (api *RPCProvider) GetTransaction(ctx context.Context, transactionId string) (*ChainTransaction, error) {
+	var transaction rpcTransaction
+	var tip int
+	if err := api.batch(ctx,
+		&RPCRequest{Method: "getrawtransaction", Params: []interface{}{transactionId, 2}, Result: &transaction},
+		&RPCRequest{Method: "getblockcount", Result: &tip},
+	); err != nil {
+		return nil, err
+	}
+	return transaction.toChainTransaction(tip)
+}
+
+// GetAccountTransactions returns ErrNotSupported, the node does not index the transactions of
+// the addresses.
+func (api *RPCProvider) GetAccountTransactions(ctx context.Context, addr address.BitcoinAddress, cursor string) (*TransactionPage, error) {
+	return nil, ErrNotSupported
+}
+
+// GetNetworkFee returns the fee rates estimated for a confirmation within 2, 6 and 144 blocks.
+func (api *RPCProvider) GetNetworkFee(ctx context.Context) (*BitcoinFeeRate, error) {
+	fees := make([]rpcSmartFee, 3)
+	requests := make([]*RPCRequest, len(fees))
+	for i, target := range []int{2, 6, 144} {
+		requests[i] = &RPCRequest{Method: "estimatesmartfee", Params: []interface{}{target}, Result: &fees[i]}
+	}
+	if err := api.batch(ctx, requests...); err != nil {
+		return nil, err
+	}
+	rates := make([]*big.Int, len(fees))
+	for i := range fees {
+		rate, err := fees[i].feeRate()
+		if err != nil {
+			return nil, err
+		}
+		rates[i] = big.NewInt(rate.SatPerKvB())
+	}
+	return &BitcoinFeeRate{High: rates[0], Medium: rates[1], Low: rates[2]}, nil
+}
+
+// SendRawTransaction broadcasts a serialized transaction and returns its id.
+func (api *RPCProvider) SendRawTransaction(ctx context.Context, rawTransaction string) (string, error) {
+	var transactionId string
+	if err := api.Call(ctx, "sendrawtransaction", &transactionId, rawTransaction); err != nil {
+		return "", err
+	}
+	return transactionId, nil
+}
+
+// GetBlockHeight returns the height of the chain tip.
+func (api *RPCProvider) GetBlockHeight(ctx context.Context) (int, error) {
+	var height int
+	if err := api.Call(ctx, "getblockcount", &height); err != nil {
+		return 0, err
+	}
+	return height, nil
+}
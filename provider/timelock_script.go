@@ -0,0 +1,392 @@
+package provider
+
+import (
+	"fmt"
+
+	"github.com/mrtnetwork/bitcoin/address"
+	"github.com/mrtnetwork/bitcoin/constant"
+	"github.com/mrtnetwork/bitcoin/formating"
+	"github.com/mrtnetwork/bitcoin/keypair"
+	"github.com/mrtnetwork/bitcoin/scripts"
+)
+
+// TimeLockTemplate identifies the script template used by a TimeLockScriptAddress.
+type TimeLockTemplate int
+
+const (
+	/*
+		CltvP2PKHTemplate locks the funds to a public key hash until an absolute lock time:
+		<locktime> OP_CHECKLOCKTIMEVERIFY OP_DROP OP_DUP OP_HASH160 <hash160> OP_EQUALVERIFY OP_CHECKSIG
+	*/
+	CltvP2PKHTemplate TimeLockTemplate = iota
+	/*
+		CltvTemplate locks the funds to a public key until an absolute lock time:
+		<locktime> OP_CHECKLOCKTIMEVERIFY OP_DROP <pubkey> OP_CHECKSIG
+	*/
+	CltvTemplate
+	/*
+		CsvTemplate requires a relative delay before the public key can spend:
+		<sequence> OP_CHECKSEQUENCEVERIFY OP_DROP <pubkey> OP_CHECKSIG
+	*/
+	CsvTemplate
+	/*
+		CsvBranchTemplate lets key A spend at any time, or key B after a relative delay:
+		OP_IF <pubkeyA> OP_CHECKSIG OP_ELSE <sequence> OP_CHECKSEQUENCEVERIFY OP_DROP <pubkeyB> OP_CHECKSIG OP_ENDIF
+	*/
+	CsvBranchTemplate
+)
+
+// TimeLockBranch selects which spending path of a TimeLockScriptAddress is used.
+type TimeLockBranch int
+
+const (
+	// TimeLockImmediateBranch spends with the immediate key of a CsvBranchTemplate
+	TimeLockImmediateBranch TimeLockBranch = iota
+	// TimeLockDelayedBranch spends with the timelocked key. Templates with a single
+	// spending path always use this branch.
+	TimeLockDelayedBranch
+)
+
+// TimeLockScriptAddress represents a timelocked script together with the address that wraps it
+// (P2SH, P2SH(P2WSH), P2WSH or P2TR) and everything the transaction builder needs to spend it.
+type TimeLockScriptAddress struct {
+	// Template is the script template of this address.
+	Template TimeLockTemplate
+
+	// ImmediatePublicKey is the public key of the branch without timelock (CsvBranchTemplate only).
+	ImmediatePublicKey string
+
+	// DelayedPublicKey is the public key that can spend once the timelock expired.
+	DelayedPublicKey string
+
+	// LockTime is the absolute lock time (block height or unix time) of CLTV templates.
+	LockTime int
+
+	// Sequence is the relative timelock of CSV templates.
+	Sequence *scripts.Sequence
+
+	// Address represents the Bitcoin address that wraps the timelocked script.
+	Address address.BitcoinAddress
+
+	// ScriptDetails is the redeem script (P2SH) or witness script (P2WSH) in hexadecimal.
+	// It is empty for P2TR addresses, which commit to TapLeafs instead.
+	ScriptDetails string
+
+	// TapLeafs are the taproot leaf scripts of a P2TR address. The first leaf is the
+	// immediate branch when the template has two branches.
+	TapLeafs []*scripts.Script
+
+	// InternalPublicKey is the taproot internal key; an unspendable point so that the
+	// address can only be spent through one of its leafs.
+	InternalPublicKey string
+}
+
+// CreateCltvP2PKHAddress creates a TimeLockScriptAddress that locks the funds to the public key hash
+// of publicKey until lockTime. lockTime below 500000000 is a block height, otherwise a unix timestamp.
+//
+// Parameters:
+// - publicKey: The public key that can spend the funds once lockTime has passed.
+// - lockTime: The absolute lock time checked by OP_CHECKLOCKTIMEVERIFY.
+// - addressType: One of P2PKHInP2SH, P2WSH, P2WSHInP2SH or P2TR.
+func CreateCltvP2PKHAddress(publicKey string, lockTime int, addressType address.AddressType) (*TimeLockScriptAddress, error) {
+	return createTimeLockAddress(&TimeLockScriptAddress{
+		Template:         CltvP2PKHTemplate,
+		DelayedPublicKey: publicKey,
+		LockTime:         lockTime,
+	}, addressType)
+}
+
+// CreateCltvAddress creates a TimeLockScriptAddress that locks the funds to publicKey until lockTime.
+// lockTime below 500000000 is a block height, otherwise a unix timestamp.
+//
+// Parameters:
+// - publicKey: The public key that can spend the funds once lockTime has passed.
+// - lockTime: The absolute lock time checked by OP_CHECKLOCKTIMEVERIFY.
+// - addressType: One of P2PKHInP2SH, P2WSH, P2WSHInP2SH or P2TR.
+func CreateCltvAddress(publicKey string, lockTime int, addressType address.AddressType) (*TimeLockScriptAddress, error) {
+	return createTimeLockAddress(&TimeLockScriptAddress{
+		Template:         CltvTemplate,
+		DelayedPublicKey: publicKey,
+		LockTime:         lockTime,
+	}, addressType)
+}
+
+// CreateCsvAddress creates a TimeLockScriptAddress that can only be spent by publicKey once the
+// output is sequence blocks (or 512 second units) old.
+//
+// Parameters:
+// - publicKey: The public key that can spend the funds after the delay.
+// - sequence: A relative timelock created with scripts.NewSequence(constant.TYPE_RELATIVE_TIMELOCK, ...).
+// - addressType: One of P2PKHInP2SH, P2WSH, P2WSHInP2SH or P2TR.
+func CreateCsvAddress(publicKey string, sequence *scripts.Sequence, addressType address.AddressType) (*TimeLockScriptAddress, error) {
+	return createTimeLockAddress(&TimeLockScriptAddress{
+		Template:         CsvTemplate,
+		DelayedPublicKey: publicKey,
+		Sequence:         sequence,
+	}, addressType)
+}
+
+// CreateCsvBranchAddress creates a TimeLockScriptAddress that immediatePublicKey can spend at any time
+// and delayedPublicKey can spend once the output is sequence blocks (or 512 second units) old.
+//
+// Parameters:
+// - immediatePublicKey: The public key of the branch without timelock.
+// - delayedPublicKey: The public key of the delayed branch.
+// - sequence: A relative timelock created with scripts.NewSequence(constant.TYPE_RELATIVE_TIMELOCK, ...).
+// - addressType: One of P2PKHInP2SH, P2WSH, P2WSHInP2SH or P2TR.
+func CreateCsvBranchAddress(immediatePublicKey string, delayedPublicKey string, sequence *scripts.Sequence, addressType address.AddressType) (*TimeLockScriptAddress, error) {
+	return createTimeLockAddress(&TimeLockScriptAddress{
+		Template:           CsvBranchTemplate,
+		ImmediatePublicKey: immediatePublicKey,
+		DelayedPublicKey:   delayedPublicKey,
+		Sequence:           sequence,
+	}, addressType)
+}
+
+// createTimeLockAddress validates the template parameters, builds the script(s) and wraps them
+// in the requested address type.
+func createTimeLockAddress(lock *TimeLockScriptAddress, addressType address.AddressType) (*TimeLockScriptAddress, error) {
+	delayed, err := keypair.NewECPPublicFromHex(lock.DelayedPublicKey)
+	if err != nil {
+		return nil, err
+	}
+	var immediate *keypair.ECPublic
+	if lock.Template == CsvBranchTemplate {
+		immediate, err = keypair.NewECPPublicFromHex(lock.ImmediatePublicKey)
+		if err != nil {
+			return nil, err
+		}
+	}
+	switch lock.Template {
+	case CltvP2PKHTemplate, CltvTemplate:
+		if lock.LockTime < 1 || lock.LockTime > 0xffffffff {
+			return nil, fmt.Errorf("lock time should be between 1 and 4294967295")
+		}
+	default:
+		if lock.Sequence == nil || !lock.Sequence.IsRelativeTimelock() {
+			return nil, fmt.Errorf("sequence should be a relative timelock")
+		}
+	}
+	isTaproot := addressType == address.P2TR
+	switch lock.Template {
+	case CltvP2PKHTemplate:
+		if isTaproot {
+			lock.TapLeafs = []*scripts.Script{
+				scripts.NewScript(lock.LockTime, "OP_CHECKLOCKTIMEVERIFY", "OP_DROP", delayed.ToXOnlyHex(), "OP_CHECKSIG"),
+			}
+			break
+		}
+		lock.ScriptDetails = scripts.NewScript(lock.LockTime, "OP_CHECKLOCKTIMEVERIFY", "OP_DROP",
+			"OP_DUP", "OP_HASH160", delayed.ToHash160(), "OP_EQUALVERIFY", "OP_CHECKSIG").ToHex()
+	case CltvTemplate:
+		if isTaproot {
+			lock.TapLeafs = []*scripts.Script{
+				scripts.NewScript(lock.LockTime, "OP_CHECKLOCKTIMEVERIFY", "OP_DROP", delayed.ToXOnlyHex(), "OP_CHECKSIG"),
+			}
+			break
+		}
+		lock.ScriptDetails = scripts.NewScript(lock.LockTime, "OP_CHECKLOCKTIMEVERIFY", "OP_DROP",
+			delayed.ToHex(), "OP_CHECKSIG").ToHex()
+	case CsvTemplate:
+		sequence, err := lock.Sequence.ForScript()
+		if err != nil {
+			return nil, err
+		}
+		if isTaproot {
+			lock.TapLeafs = []*scripts.Script{
+				scripts.NewScript(sequence, "OP_CHECKSEQUENCEVERIFY", "OP_DROP", delayed.ToXOnlyHex(), "OP_CHECKSIG"),
+			}
+			break
+		}
+		lock.ScriptDetails = scripts.NewScript(sequence, "OP_CHECKSEQUENCEVERIFY", "OP_DROP",
+			delayed.ToHex(), "OP_CHECKSIG").ToHex()
+	case CsvBranchTemplate:
+		sequence, err := lock.Sequence.ForScript()
+		if err != nil {
+			return nil, err
+		}
+		if isTaproot {
+			lock.TapLeafs = []*scripts.Script{
+				scripts.NewScript(immediate.ToXOnlyHex(), "OP_CHECKSIG"),
+				scripts.NewScript(sequence, "OP_CHECKSEQUENCEVERIFY", "OP_DROP", delayed.ToXOnlyHex(), "OP_CHECKSIG"),
+			}
+			break
+		}
+		lock.ScriptDetails = scripts.NewScript("OP_IF", immediate.ToHex(), "OP_CHECKSIG",
+			"OP_ELSE", sequence, "OP_CHECKSEQUENCEVERIFY", "OP_DROP", delayed.ToHex(), "OP_CHECKSIG",
+			"OP_ENDIF").ToHex()
+	default:
+		return nil, fmt.Errorf("invalid timelock template")
+	}
+
+	switch addressType {
+	case address.P2TR:
+		internal, err := keypair.NewECPPublicFromHex(constant.TAPROOT_UNSPENDABLE_PUBLIC_KEY)
+		if err != nil {
+			return nil, err
+		}
+		lock.InternalPublicKey = internal.ToHex()
+		lock.Address = internal.ToTaprootAddress(formating.ToInterfaceSlice(lock.TapLeafs)...)
+	case address.P2WSH:
+		addr, err := address.P2WSHAddresssFromScript(lock.script())
+		if err != nil {
+			return nil, err
+		}
+		lock.Address = addr
+	case address.P2WSHInP2SH:
+		p2wsh, err := address.P2WSHAddresssFromScript(lock.script())
+		if err != nil {
+			return nil, err
+		}
+		addr, err := address.P2SHAddressFromScript(p2wsh.ToScriptPubKey(), address.P2WSHInP2SH)
+		if err != nil {
+			return nil, err
+		}
+		lock.Address = addr
+	case address.P2PKHInP2SH:
+		addr, err := address.P2SHAddressFromScript(lock.script(), address.P2PKHInP2SH)
+		if err != nil {
+			return nil, err
+		}
+		lock.Address = addr
+	default:
+		return nil, fmt.Errorf("addressType should be P2PKHInP2SH, P2WSH, P2WSHInP2SH or P2TR")
+	}
+	return lock, nil
+}
+
+// script returns the redeem or witness script of a non-taproot address
+func (lock *TimeLockScriptAddress) script() *scripts.Script {
+	script, _ := scripts.ScriptFromRaw(formating.HexToBytes(lock.ScriptDetails), true)
+	return script
+}
+
+// IsTaproot reports whether the timelocked script is committed to a P2TR address
+func (lock *TimeLockScriptAddress) IsTaproot() bool {
+	return lock.Address.GetType() == address.P2TR
+}
+
+// branch returns the branch that is really used; templates with a single path only have a delayed branch
+func (lock *TimeLockScriptAddress) branch(branch TimeLockBranch) TimeLockBranch {
+	if lock.Template != CsvBranchTemplate {
+		return TimeLockDelayedBranch
+	}
+	return branch
+}
+
+// SigningPublicKey returns the public key that must sign to spend the given branch.
+func (lock *TimeLockScriptAddress) SigningPublicKey(branch TimeLockBranch) string {
+	if lock.branch(branch) == TimeLockImmediateBranch {
+		return lock.ImmediatePublicKey
+	}
+	return lock.DelayedPublicKey
+}
+
+// BranchScript returns the script executed when spending the given branch: the tapleaf of the
+// branch for P2TR addresses, otherwise the whole redeem or witness script.
+func (lock *TimeLockScriptAddress) BranchScript(branch TimeLockBranch) *scripts.Script {
+	if !lock.IsTaproot() {
+		return lock.script()
+	}
+	if len(lock.TapLeafs) == 2 && lock.branch(branch) == TimeLockDelayedBranch {
+		return lock.TapLeafs[1]
+	}
+	return lock.TapLeafs[0]
+}
+
+// InputSequence returns the nSequence the spending input must carry for the given branch.
+// The delayed branch of CSV templates encodes the relative timelock, CLTV templates need a
+// non final sequence and the immediate branch returns nil (default sequence).
+func (lock *TimeLockScriptAddress) InputSequence(branch TimeLockBranch) ([]byte, error) {
+	if lock.branch(branch) == TimeLockImmediateBranch {
+		return nil, nil
+	}
+	switch lock.Template {
+	case CltvP2PKHTemplate, CltvTemplate:
+		return constant.ABSOLUTE_TIMELOCK_SEQUENCE, nil
+	default:
+		return lock.Sequence.ForInputSequence()
+	}
+}
+
+// IsRelativeLock reports whether spending the given branch requires a relative timelock sequence
+func (lock *TimeLockScriptAddress) IsRelativeLock(branch TimeLockBranch) bool {
+	if lock.branch(branch) == TimeLockImmediateBranch {
+		return false
+	}
+	return lock.Template == CsvTemplate || lock.Template == CsvBranchTemplate
+}
+
+// InputLockTime returns the minimum transaction lock time required to spend the given branch,
+// or zero when the branch does not check the lock time.
+func (lock *TimeLockScriptAddress) InputLockTime(branch TimeLockBranch) int {
+	if lock.branch(branch) == TimeLockImmediateBranch {
+		return 0
+	}
+	switch lock.Template {
+	case CltvP2PKHTemplate, CltvTemplate:
+		return lock.LockTime
+	default:
+		return 0
+	}
+}
+
+// UnlockingStack returns the items that satisfy the script for the given branch, without the
+// script itself: the signature, the public key for P2PKH templates and the OP_IF branch selector.
+func (lock *TimeLockScriptAddress) UnlockingStack(branch TimeLockBranch, signature string) []string {
+	if lock.IsTaproot() {
+		return []string{signature}
+	}
+	switch lock.Template {
+	case CltvP2PKHTemplate:
+		return []string{signature, lock.DelayedPublicKey}
+	case CsvBranchTemplate:
+		// OP_IF in witness scripts requires a minimal selector, an empty item is false. A legacy
+		// scriptSig pushes it as an opcode, see UnlockingScriptSig
+		if lock.branch(branch) == TimeLockImmediateBranch {
+			return []string{signature, "01"}
+		}
+		return []string{signature, ""}
+	default:
+		return []string{signature}
+	}
+}
+
+// UnlockingScriptSig returns the scriptSig that spends the given branch of a legacy P2SH address:
+// the unlocking stack and the redeem script. The branch selector is pushed as OP_1 or OP_0, the
+// minimal pushes required by the relay policy.
+func (lock *TimeLockScriptAddress) UnlockingScriptSig(branch TimeLockBranch, signature string) *scripts.Script {
+	stack := formating.ToInterfaceSlice(lock.UnlockingStack(branch, signature))
+	if lock.Template == CsvBranchTemplate {
+		if lock.branch(branch) == TimeLockImmediateBranch {
+			stack[1] = 1
+		} else {
+			stack[1] = 0
+		}
+	}
+	return scripts.NewScript(append(stack, lock.ScriptDetails)...)
+}
+
+// ControlBlock returns the control block that proves the branch's tapleaf belongs to the P2TR address.
+func (lock *TimeLockScriptAddress) ControlBlock(branch TimeLockBranch) (*scripts.ControlBlock, error) {
+	if !lock.IsTaproot() {
+		return nil, fmt.Errorf("control block is only available for taproot addresses")
+	}
+	internal, err := keypair.NewECPPublicFromHex(lock.InternalPublicKey)
+	if err != nil {
+		return nil, err
+	}
+	isOdd, err := internal.ToTapRootParity(formating.ToInterfaceSlice(lock.TapLeafs))
+	if err != nil {
+		return nil, err
+	}
+	var path []byte
+	if len(lock.TapLeafs) == 2 {
+		if lock.branch(branch) == TimeLockDelayedBranch {
+			path = lock.TapLeafs[0].ToTapleafTaggedHash()
+		} else {
+			path = lock.TapLeafs[1].ToTapleafTaggedHash()
+		}
+	}
+	return scripts.NewControlBlockWithParity(internal.ToXOnlyHex(), path, isOdd), nil
+}
@@ -38,6 +38,11 @@ type BitcoinTransactionBuilder struct {
 		transaction that is taking longer than expected to get confirmed due to low transaction fees.
 	*/
 	EnableRBF bool
+	/*
+		Coin control applied to the UTXOs before building the transaction. The frozen, reserved
+		and quarantined coins are skipped unless included, see CoinControl.
+	*/
+	CoinControl CoinControl
 }
 
 func NewBitcoinTransactionBuilder(spenders []UtxoWithOwner, outPuts []BitcoinOutputDetails, fee *big.Int, network address.NetworkInfo, memo string, enableRBF bool) *BitcoinTransactionBuilder {
@@ -83,6 +88,20 @@ func (builder *BitcoinTransactionBuilder) HasTaproot() bool {
 
 // It is used to make the appropriate scriptSig
 func buildInputScriptPubKeys(utxo UtxoWithOwner, isTaproot bool) (*scripts.Script, error) {
+	if utxo.IsTimeLock() {
+		timeLockAddress := utxo.OwnerDetails.TimeLockAddress
+		if isTaproot {
+			return timeLockAddress.Address.ToScriptPubKey(), nil
+		}
+		switch timeLockAddress.Address.GetType() {
+		case address.P2TR:
+			return timeLockAddress.Address.ToScriptPubKey(), nil
+		case address.P2WSH, address.P2WSHInP2SH, address.P2PKHInP2SH:
+			return timeLockAddress.BranchScript(utxo.OwnerDetails.TimeLockBranch), nil
+		default:
+			return scripts.NewScript(), fmt.Errorf("invalid script type")
+		}
+	}
 	if utxo.IsMultiSig() {
 		script, e := scripts.ScriptFromRaw(formating.HexToBytes(utxo.OwnerDetails.MultiSigAddress.ScriptDetails), true)
 		if e != nil {
@@ -294,13 +313,62 @@ func (build *BitcoinTransactionBuilder) buildInputs() ([]*scripts.TxInput, error
 	inputs := make([]*scripts.TxInput, len(build.Utxos))
 	for i, e := range build.Utxos {
 		inputs[i] = scripts.NewTxInput(e.Utxo.TxHash, e.Utxo.Vout)
+		/*
+			A relative timelock lives in the input sequence and must win over RBF, a relative
+			timelock sequence already signals replaceability. CLTV only requires a non-final
+			sequence, which the RBF sequence is as well.
+		*/
+		if e.IsTimeLock() && e.OwnerDetails.TimeLockAddress.IsRelativeLock(e.OwnerDetails.TimeLockBranch) {
+			seqBytes, err := e.OwnerDetails.TimeLockAddress.InputSequence(e.OwnerDetails.TimeLockBranch)
+			if err != nil {
+				return nil, err
+			}
+			inputs[i].Sequence = seqBytes
+			continue
+		}
 		if i == 0 && build.EnableRBF {
 			inputs[i].Sequence = sequance
+			continue
+		}
+		if e.IsTimeLock() {
+			seqBytes, err := e.OwnerDetails.TimeLockAddress.InputSequence(e.OwnerDetails.TimeLockBranch)
+			if err != nil {
+				return nil, err
+			}
+			if seqBytes != nil {
+				inputs[i].Sequence = seqBytes
+			}
 		}
 	}
 	return inputs, nil
 }
 
+// buildLockTime returns the transaction lock time required by the CLTV inputs: the highest lock
+// time of all of them. Block height and timestamp lock times cannot be satisfied by the same
+// transaction and result in an error.
+func (build *BitcoinTransactionBuilder) buildLockTime() ([]byte, error) {
+	lockTime := 0
+	for _, e := range build.Utxos {
+		if !e.IsTimeLock() {
+			continue
+		}
+		inputLockTime := e.OwnerDetails.TimeLockAddress.InputLockTime(e.OwnerDetails.TimeLockBranch)
+		if inputLockTime == 0 {
+			continue
+		}
+		if lockTime != 0 && (lockTime < constant.LOCKTIME_THRESHOLD) != (inputLockTime < constant.LOCKTIME_THRESHOLD) {
+			return nil, fmt.Errorf("cannot spend block height and timestamp timelocks in the same transaction")
+		}
+		if inputLockTime > lockTime {
+			lockTime = inputLockTime
+		}
+	}
+	if lockTime == 0 {
+		return nil, nil
+	}
+	return formating.PackUint32LE(uint32(lockTime)), nil
+}
+
 func (build *BitcoinTransactionBuilder) buildOutputs() []*scripts.TxOutput {
 	outputs := make([]*scripts.TxOutput, len(build.OutPuts))
 	for i, e := range build.OutPuts {
@@ -346,7 +414,81 @@ func (build *BitcoinTransactionBuilder) sumUtxoAmount() *big.Int {
 	}
 	return sum
 }
+
+/*
+signTimeLockInput signs the input at index i that spends a timelocked script and sets its unlocking data.
+It returns the witness of the input, an empty witness for legacy P2SH inputs of a segwit transaction
+or nil when the transaction has no witness.
+
+For P2TR timelock inputs the digest is a script path digest, the signer must sign it with the
+untweaked key (SignTaprootTransaction with tweak false).
+*/
+func (build *BitcoinTransactionBuilder) signTimeLockInput(sign BitcoinSignerCallBack, i int, script *scripts.Script, transaction *scripts.BtcTransaction, taprootAmounts []*big.Int, taprootScripts []*scripts.Script) (*scripts.TxWitnessInput, error) {
+	utxo := build.Utxos[i]
+	timeLockAddress := utxo.OwnerDetails.TimeLockAddress
+	branch := utxo.OwnerDetails.TimeLockBranch
+	signer := timeLockAddress.SigningPublicKey(branch)
+	switch timeLockAddress.Address.GetType() {
+	case address.P2TR:
+		leaf := timeLockAddress.BranchScript(branch)
+		digest := transaction.GetTransactionTaprootDigest(i, taprootScripts, taprootAmounts, 1, leaf, constant.TAPROOT_SIGHASH_ALL)
+		sig, err := sign(digest, utxo, signer)
+		if err != nil {
+			return nil, err
+		}
+		controlBlock, err := timeLockAddress.ControlBlock(branch)
+		if err != nil {
+			return nil, err
+		}
+		stack := append(timeLockAddress.UnlockingStack(branch, sig), leaf.ToHex(), controlBlock.ToHex())
+		return scripts.NewTxWitnessInput(stack...), nil
+	case address.P2WSH, address.P2WSHInP2SH:
+		digest := transaction.GetTransactionSegwitDigit(i, script, utxo.Utxo.Value)
+		sig, err := sign(digest, utxo, signer)
+		if err != nil {
+			return nil, err
+		}
+		stack := append(timeLockAddress.UnlockingStack(branch, sig), timeLockAddress.ScriptDetails)
+		if timeLockAddress.Address.GetType() == address.P2WSHInP2SH {
+			p2wsh, err := address.P2WSHAddresssFromScript(script)
+			if err != nil {
+				return nil, err
+			}
+			transaction.SetScriptSig(i, scripts.NewScript(p2wsh.ToScriptPubKey().ToHex()))
+		}
+		return scripts.NewTxWitnessInput(stack...), nil
+	default:
+		digest := transaction.GetTransactionDigest(i, script, constant.SIGHASH_ALL)
+		sig, err := sign(digest, utxo, signer)
+		if err != nil {
+			return nil, err
+		}
+		transaction.SetScriptSig(i, timeLockAddress.UnlockingScriptSig(branch, sig))
+		if build.HasSegwit() {
+			return &scripts.TxWitnessInput{Stack: []string{}}, nil
+		}
+		return nil, nil
+	}
+}
+
 func (build *BitcoinTransactionBuilder) BuildTransaction(sign BitcoinSignerCallBack) (*scripts.BtcTransaction, error) {
+	// the coins kept by coin control are never spent
+	selected := UtxoWithOwnerList(build.Utxos).Select(build.CoinControl)
+	if len(selected) == len(build.Utxos) {
+		return build.buildTransaction(sign)
+	}
+	if len(selected) == 0 {
+		return nil, fmt.Errorf("no spendable utxo, %d excluded by coin control", len(build.Utxos))
+	}
+	if sign != nil && selected.SumOfUtxosValue().Cmp(new(big.Int).Add(build.sumAmounts(), build.FEE)) != 0 {
+		return nil, fmt.Errorf("sum value of utxo not spending, %d utxos excluded by coin control", len(build.Utxos)-len(selected))
+	}
+	filtered := *build
+	filtered.Utxos = selected
+	return filtered.buildTransaction(sign)
+}
+
+func (build *BitcoinTransactionBuilder) buildTransaction(sign BitcoinSignerCallBack) (*scripts.BtcTransaction, error) {
 	// build inputs
 	txIn, err := build.buildInputs()
 	if err != nil {
@@ -378,8 +520,18 @@ func (build *BitcoinTransactionBuilder) BuildTransaction(sign BitcoinSignerCallB
 		return nil, fmt.Errorf("sum value of utxo not spending")
 	}
 
+	// lock time required by CLTV inputs
+	lockTime, err := build.buildLockTime()
+	if err != nil {
+		return nil, err
+	}
 	// create new transaction with inputs and outputs and isSegwit transaction or not
-	transaction := scripts.NewBtcTransaction(txIn, txOut, hasSegwit)
+	var transaction *scripts.BtcTransaction
+	if lockTime != nil {
+		transaction = scripts.NewBtcTransaction(txIn, txOut, hasSegwit, lockTime)
+	} else {
+		transaction = scripts.NewBtcTransaction(txIn, txOut, hasSegwit)
+	}
 	// we define empty witnesses. maybe the transaction is segwit and We need this
 	wintnesses := make([]*scripts.TxWitnessInput, 0)
 
@@ -406,6 +558,17 @@ func (build *BitcoinTransactionBuilder) BuildTransaction(sign BitcoinSignerCallB
 		if err != nil {
 			return nil, err
 		}
+		// handle timelocked scripts
+		if build.Utxos[i].IsTimeLock() {
+			witness, err := build.signTimeLockInput(sign, i, script, transaction, taprootAmounts, taprootScripts)
+			if err != nil {
+				return nil, err
+			}
+			if witness != nil {
+				wintnesses = append(wintnesses, witness)
+			}
+			continue
+		}
 		// We generate transaction digest for current input
 		digest := generateTransactionDigest(
 			script, i, build.Utxos[i], *transaction,
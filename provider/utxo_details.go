@@ -21,6 +21,13 @@ type UtxoOwnerDetails struct {
 	// MultiSigAddress is a pointer to a MultiSignaturAddress instance representing a multi-signature address
 	// associated with the UTXO owner. It may be nil if the UTXO owner is not using a multi-signature scheme.
 	MultiSigAddress *MultiSignaturAddress
+
+	// TimeLockAddress is a pointer to a TimeLockScriptAddress instance when the UTXO is locked by a CLTV or CSV
+	// script. It may be nil if the UTXO is not timelocked.
+	TimeLockAddress *TimeLockScriptAddress
+
+	// TimeLockBranch selects the spending path of TimeLockAddress. It is ignored by templates with a single path.
+	TimeLockBranch TimeLockBranch
 }
 
 // UtxoWithOwner represents an unspent transaction output (UTXO) along with its associated owner details.
@@ -31,6 +38,10 @@ type UtxoWithOwner struct {
 
 	// OwnerDetails is a UtxoOwnerDetails instance containing information about the UTXO owner.
 	OwnerDetails UtxoOwnerDetails
+
+	// Metadata is the coin control state of the UTXO: frozen, reserved, labels, origin and dust
+	// quarantine. The transaction builder skips the coins it keeps, see CoinControl.
+	Metadata CoinMetadata
 }
 
 // UtxoWithOwnerList is a slice of UtxoWithOwner instances, representing a list of Bitcoin UTXOs along with their
@@ -132,6 +143,9 @@ func (utxo *UtxoWithOwner) Public() (*keypair.ECPublic, error) {
 	if utxo.IsMultiSig() {
 		return nil, fmt.Errorf("cannot access public in multisig address; use owner's public keys")
 	}
+	if utxo.IsTimeLock() {
+		return keypair.NewECPPublicFromHex(utxo.OwnerDetails.TimeLockAddress.SigningPublicKey(utxo.OwnerDetails.TimeLockBranch))
+	}
 	return keypair.NewECPPublicFromHex(utxo.OwnerDetails.PublicKey)
 }
 
@@ -145,6 +159,15 @@ func (utxo *UtxoWithOwner) IsMultiSig() bool {
 	return utxo.OwnerDetails.MultiSigAddress != nil
 }
 
+// IsTimeLock checks whether the UTXO is locked by a timelocked script based on the presence of a
+// TimeLockScriptAddress instance in the ownership details.
+//
+// Returns:
+// - bool: True if the UTXO is locked by a CLTV or CSV script, false otherwise.
+func (utxo *UtxoWithOwner) IsTimeLock() bool {
+	return utxo.OwnerDetails.TimeLockAddress != nil
+}
+
 // SumOfUtxosValue calculates and returns the total value of all UTXOs in the UtxoWithOwnerList. It iterates
 // through each UTXO in the list and adds their values to compute the sum of UTXO values.
 //
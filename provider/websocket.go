@@ -0,0 +1,297 @@
+package provider
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// websocketGUID is the key suffix of the opening handshake (RFC 6455 section 1.3)
+const websocketGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+// websocketMaxMessage is the largest message read, the projected mempool blocks of a busy
+// mempool are a few hundred kilobytes
+const websocketMaxMessage = 16 << 20
+
+// opcodes of the frames
+const (
+	wsContinuation = 0x0
+	wsText         = 0x1
+	wsBinary       = 0x2
+	wsClose        = 0x8
+	wsPing         = 0x9
+	wsPong         = 0xa
+)
+
+// wsConn is the client side of a WebSocket connection. Messages are read by a single goroutine,
+// frames can be written concurrently.
+type wsConn struct {
+	conn   net.Conn
+	reader *bufio.Reader
+
+	// readTimeout bounds the wait for the next frame, zero waits forever
+	readTimeout time.Duration
+
+	writeMu sync.Mutex
+}
+
+// dialWebSocket opens a WebSocket connection to a ws, wss, http or https URL
+func dialWebSocket(ctx context.Context, rawUrl string, tlsConfig *tls.Config) (*wsConn, error) {
+	target, err := url.Parse(rawUrl)
+	if err != nil {
+		return nil, err
+	}
+	secure := false
+	switch target.Scheme {
+	case "ws", "http":
+	case "wss", "https":
+		secure = true
+	default:
+		return nil, fmt.Errorf("invalid websocket scheme %s", target.Scheme)
+	}
+	host := target.Host
+	if target.Port() == "" {
+		if secure {
+			host = net.JoinHostPort(target.Hostname(), "443")
+		} else {
+			host = net.JoinHostPort(target.Hostname(), "80")
+		}
+	}
+	var conn net.Conn
+	if secure {
+		config := &tls.Config{}
+		if tlsConfig != nil {
+			config = tlsConfig.Clone()
+		}
+		if config.ServerName == "" {
+			config.ServerName = target.Hostname()
+		}
+		conn, err = (&tls.Dialer{Config: config}).DialContext(ctx, "tcp", host)
+	} else {
+		conn, err = (&net.Dialer{}).DialContext(ctx, "tcp", host)
+	}
+	if err != nil {
+		return nil, err
+	}
+	ws, err := handshake(ctx, conn, target)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return ws, nil
+}
+
+// handshake sends the opening handshake and checks the answer of the server
+func handshake(ctx context.Context, conn net.Conn, target *url.URL) (*wsConn, error) {
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+	// unblock the handshake when the context is cancelled
+	stop := context.AfterFunc(ctx, func() { conn.SetDeadline(time.Now()) })
+	defer stop()
+
+	nonce := make([]byte, 16)
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	key := base64.StdEncoding.EncodeToString(nonce)
+	request := &http.Request{
+		Method:     http.MethodGet,
+		URL:        &url.URL{Path: target.Path, RawQuery: target.RawQuery},
+		Proto:      "HTTP/1.1",
+		ProtoMajor: 1,
+		ProtoMinor: 1,
+		Host:       target.Host,
+		Header: http.Header{
+			"Upgrade":               {"websocket"},
+			"Connection":            {"Upgrade"},
+			"Sec-Websocket-Key":     {key},
+			"Sec-Websocket-Version": {"13"},
+		},
+	}
+	if request.URL.Path == "" {
+		request.URL.Path = "/"
+	}
+	if err := request.Write(conn); err != nil {
+		return nil, err
+	}
+	reader := bufio.NewReader(conn)
+	response, err := http.ReadResponse(reader, request)
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return nil, err
+	}
+	response.Body.Close()
+	if response.StatusCode != http.StatusSwitchingProtocols {
+		return nil, &APIError{StatusCode: response.StatusCode, Message: "websocket handshake failed: " + response.Status, Err: statusError(response.StatusCode)}
+	}
+	accept := sha1.Sum([]byte(key + websocketGUID))
+	if !strings.EqualFold(response.Header.Get("Upgrade"), "websocket") ||
+		response.Header.Get("Sec-Websocket-Accept") != base64.StdEncoding.EncodeToString(accept[:]) {
+		return nil, fmt.Errorf("invalid websocket handshake response")
+	}
+	conn.SetDeadline(time.Time{})
+	return &wsConn{conn: conn, reader: reader}, nil
+}
+
+// statusError returns the sentinel error of an unsuccessful HTTP status of the handshake
+func statusError(status int) error {
+	switch {
+	case status == http.StatusTooManyRequests:
+		return ErrRateLimited
+	case status == http.StatusNotFound:
+		return ErrNotFound
+	case status >= 500:
+		return ErrUnavailable
+	}
+	return nil
+}
+
+// writeFrame writes a single masked frame
+func (c *wsConn) writeFrame(opcode byte, payload []byte) error {
+	header := []byte{0x80 | opcode}
+	switch {
+	case len(payload) < 126:
+		header = append(header, 0x80|byte(len(payload)))
+	case len(payload) <= 0xffff:
+		header = append(header, 0x80|126, 0, 0)
+		binary.BigEndian.PutUint16(header[2:], uint16(len(payload)))
+	default:
+		header = append(header, 0x80|127, 0, 0, 0, 0, 0, 0, 0, 0)
+		binary.BigEndian.PutUint64(header[2:], uint64(len(payload)))
+	}
+	mask := make([]byte, 4)
+	if _, err := rand.Read(mask); err != nil {
+		return err
+	}
+	frame := append(header, mask...)
+	for i, b := range payload {
+		frame = append(frame, b^mask[i%4])
+	}
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	_, err := c.conn.Write(frame)
+	return err
+}
+
+// writeText writes a text message, the deadline of ctx bounds the write
+func (c *wsConn) writeText(ctx context.Context, message []byte) error {
+	if deadline, ok := ctx.Deadline(); ok {
+		c.conn.SetWriteDeadline(deadline)
+		defer c.conn.SetWriteDeadline(time.Time{})
+	}
+	return c.writeFrame(wsText, message)
+}
+
+// readFrame reads the next frame
+func (c *wsConn) readFrame() (fin bool, opcode byte, payload []byte, err error) {
+	if c.readTimeout > 0 {
+		c.conn.SetReadDeadline(time.Now().Add(c.readTimeout))
+	}
+	header := make([]byte, 2)
+	if _, err := io.ReadFull(c.reader, header); err != nil {
+		return false, 0, nil, err
+	}
+	fin, opcode = header[0]&0x80 != 0, header[0]&0x0f
+	length := uint64(header[1] & 0x7f)
+	switch length {
+	case 126:
+		extended := make([]byte, 2)
+		if _, err := io.ReadFull(c.reader, extended); err != nil {
+			return false, 0, nil, err
+		}
+		length = uint64(binary.BigEndian.Uint16(extended))
+	case 127:
+		extended := make([]byte, 8)
+		if _, err := io.ReadFull(c.reader, extended); err != nil {
+			return false, 0, nil, err
+		}
+		length = binary.BigEndian.Uint64(extended)
+	}
+	if length > websocketMaxMessage {
+		return false, 0, nil, fmt.Errorf("websocket frame of %d bytes too large", length)
+	}
+	var mask []byte
+	if header[1]&0x80 != 0 {
+		mask = make([]byte, 4)
+		if _, err := io.ReadFull(c.reader, mask); err != nil {
+			return false, 0, nil, err
+		}
+	}
+	payload = make([]byte, length)
+	if _, err := io.ReadFull(c.reader, payload); err != nil {
+		return false, 0, nil, err
+	}
+	if mask != nil {
+		for i := range payload {
+			payload[i] ^= mask[i%4]
+		}
+	}
+	return fin, opcode, payload, nil
+}
+
+// readMessage returns the next data message, reassembling fragmented ones. Pings are answered,
+// a close frame is acknowledged and returned as io.EOF.
+func (c *wsConn) readMessage() ([]byte, error) {
+	var message []byte
+	fragmented := false
+	for {
+		fin, opcode, payload, err := c.readFrame()
+		if err != nil {
+			return nil, err
+		}
+		switch opcode {
+		case wsPing:
+			if err := c.writeFrame(wsPong, payload); err != nil {
+				return nil, err
+			}
+			continue
+		case wsPong:
+			continue
+		case wsClose:
+			c.writeFrame(wsClose, payload)
+			return nil, io.EOF
+		case wsText, wsBinary:
+			if fragmented {
+				return nil, errors.New("websocket message interrupted by a new message")
+			}
+			message = payload
+		case wsContinuation:
+			if !fragmented {
+				return nil, errors.New("unexpected websocket continuation frame")
+			}
+			if len(message)+len(payload) > websocketMaxMessage {
+				return nil, fmt.Errorf("websocket message too large")
+			}
+			message = append(message, payload...)
+		default:
+			return nil, fmt.Errorf("unknown websocket opcode %d", opcode)
+		}
+		if fin {
+			return message, nil
+		}
+		fragmented = true
+	}
+}
+
+// close sends a normal closure frame and closes the connection
+func (c *wsConn) close() error {
+	c.conn.SetWriteDeadline(time.Now().Add(time.Second))
+	c.writeFrame(wsClose, []byte{0x03, 0xe8})
+	return c.conn.Close()
+}
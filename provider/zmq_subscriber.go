@@ -0,0 +1,341 @@
+package provider
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/mrtnetwork/bitcoin/formating"
+	"github.com/mrtnetwork/bitcoin/scripts"
+)
+
+// topics of the ZMQ notifications of Bitcoin Core
+const (
+	ZMQRawTx     = "rawtx"
+	ZMQRawBlock  = "rawblock"
+	ZMQHashTx    = "hashtx"
+	ZMQHashBlock = "hashblock"
+	ZMQSequence  = "sequence"
+)
+
+// ZMQSequenceKind is the kind of change of a sequence notification.
+type ZMQSequenceKind byte
+
+const (
+	ZMQBlockConnected     ZMQSequenceKind = 'C'
+	ZMQBlockDisconnected  ZMQSequenceKind = 'D'
+	ZMQTransactionAdded   ZMQSequenceKind = 'A'
+	ZMQTransactionRemoved ZMQSequenceKind = 'R'
+)
+
+// ZMQSequenceEvent is a block connected to or disconnected from the chain, or a transaction added
+// to or removed from the mempool.
+type ZMQSequenceEvent struct {
+	// Hash of the block or id of the transaction.
+	Hash string
+	Kind ZMQSequenceKind
+
+	// MempoolSequence is the sequence number of the mempool change, only set for the transactions.
+	MempoolSequence uint64
+}
+
+// ZMQGap reports notifications of a topic lost between Expected and Received, the sequence
+// numbers of the publisher. Notifications are dropped when the subscriber falls behind or while
+// it reconnects.
+type ZMQGap struct {
+	Topic    string
+	Expected uint32
+	Received uint32
+}
+
+// Missed returns the number of lost notifications, zero when the publisher restarted its numbering.
+func (gap ZMQGap) Missed() uint32 {
+	if gap.Received < gap.Expected {
+		return 0
+	}
+	return gap.Received - gap.Expected
+}
+
+// ZMQSubscriber receives the ZMQ notifications of a Bitcoin Core node (-zmqpubrawtx,
+// -zmqpubrawblock, -zmqpubhashtx, -zmqpubhashblock and -zmqpubsequence) and calls the handlers of
+// their topic. Only the topics with a handler are subscribed. Handlers are called one at a time
+// from the goroutine of Run and should not block.
+type ZMQSubscriber struct {
+	// Address of the publisher, for example tcp://127.0.0.1:28332.
+	Address string
+
+	// ReconnectDelay is the delay between the reconnections of a lost connection.
+	ReconnectDelay time.Duration
+
+	mu       sync.Mutex
+	handlers zmqHandlers
+
+	// last holds the last sequence number received by topic
+	last map[string]uint32
+}
+
+// zmqHandlers are the handlers of a ZMQSubscriber by topic
+type zmqHandlers struct {
+	transactions []func(txId string, tx *scripts.BtcTransaction)
+	blocks       []func(block *Block)
+	txHashes     []func(txId string)
+	blockHashes  []func(hash string)
+	sequences    []func(event ZMQSequenceEvent)
+	gaps         []func(gap ZMQGap)
+	errors       []func(err error)
+}
+
+// NewZMQSubscriber returns a subscriber of the publisher at address, register the handlers then
+// call Run.
+func NewZMQSubscriber(address string) *ZMQSubscriber {
+	return &ZMQSubscriber{Address: address, ReconnectDelay: time.Second, last: map[string]uint32{}}
+}
+
+// OnRawTransaction calls handler with the transactions entering the mempool or confirmed in a block.
+func (s *ZMQSubscriber) OnRawTransaction(handler func(txId string, tx *scripts.BtcTransaction)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.handlers.transactions = append(s.handlers.transactions, handler)
+}
+
+// OnRawBlock calls handler with the blocks connected to the chain.
+func (s *ZMQSubscriber) OnRawBlock(handler func(block *Block)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.handlers.blocks = append(s.handlers.blocks, handler)
+}
+
+// OnHashTransaction calls handler with the ids of the transactions entering the mempool or
+// confirmed in a block.
+func (s *ZMQSubscriber) OnHashTransaction(handler func(txId string)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.handlers.txHashes = append(s.handlers.txHashes, handler)
+}
+
+// OnHashBlock calls handler with the hashes of the blocks connected to the chain.
+func (s *ZMQSubscriber) OnHashBlock(handler func(hash string)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.handlers.blockHashes = append(s.handlers.blockHashes, handler)
+}
+
+// OnSequence calls handler with the changes of the chain and of the mempool.
+func (s *ZMQSubscriber) OnSequence(handler func(event ZMQSequenceEvent)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.handlers.sequences = append(s.handlers.sequences, handler)
+}
+
+// OnGap calls handler when notifications were lost.
+func (s *ZMQSubscriber) OnGap(handler func(gap ZMQGap)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.handlers.gaps = append(s.handlers.gaps, handler)
+}
+
+// OnError calls handler with the invalid notifications and the lost connections.
+func (s *ZMQSubscriber) OnError(handler func(err error)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.handlers.errors = append(s.handlers.errors, handler)
+}
+
+// topics returns the topics with a handler
+func (s *ZMQSubscriber) topics() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	topics := []string{}
+	if len(s.handlers.transactions) > 0 {
+		topics = append(topics, ZMQRawTx)
+	}
+	if len(s.handlers.blocks) > 0 {
+		topics = append(topics, ZMQRawBlock)
+	}
+	if len(s.handlers.txHashes) > 0 {
+		topics = append(topics, ZMQHashTx)
+	}
+	if len(s.handlers.blockHashes) > 0 {
+		topics = append(topics, ZMQHashBlock)
+	}
+	if len(s.handlers.sequences) > 0 {
+		topics = append(topics, ZMQSequence)
+	}
+	return topics
+}
+
+// Run receives the notifications until ctx is done, a lost connection is re-established after
+// ReconnectDelay. It returns the error of the first connection, or the one of ctx.
+func (s *ZMQSubscriber) Run(ctx context.Context) error {
+	topics := s.topics()
+	if len(topics) == 0 {
+		return errors.New("no notification handler")
+	}
+	conn, err := s.connect(ctx, topics)
+	if err != nil {
+		return err
+	}
+	for {
+		err := s.receive(ctx, conn)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		s.report(fmt.Errorf("zmq connection lost: %v", err))
+		for {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(s.ReconnectDelay):
+			}
+			if conn, err = s.connect(ctx, topics); err == nil {
+				break
+			}
+			s.report(fmt.Errorf("zmq reconnection failed: %v", err))
+		}
+	}
+}
+
+// connect opens a connection subscribed to topics
+func (s *ZMQSubscriber) connect(ctx context.Context, topics []string) (*zmtpConn, error) {
+	conn, err := dialZMTP(ctx, s.Address)
+	if err != nil {
+		return nil, err
+	}
+	for _, topic := range topics {
+		if err := conn.subscribe(topic); err != nil {
+			conn.close()
+			return nil, err
+		}
+	}
+	return conn, nil
+}
+
+// receive dispatches the notifications of a connection until it is lost or ctx is done
+func (s *ZMQSubscriber) receive(ctx context.Context, conn *zmtpConn) error {
+	stop := context.AfterFunc(ctx, func() { conn.close() })
+	defer stop()
+	defer conn.close()
+	for {
+		frames, err := conn.readMessage()
+		if err != nil {
+			return err
+		}
+		s.dispatch(frames)
+	}
+}
+
+// dispatch calls the handlers of a notification: its topic, its body and its sequence number
+func (s *ZMQSubscriber) dispatch(frames [][]byte) {
+	if len(frames) != 3 || len(frames[2]) != 4 {
+		s.report(fmt.Errorf("invalid zmq notification of %d frames", len(frames)))
+		return
+	}
+	topic, body, sequence := string(frames[0]), frames[1], binary.LittleEndian.Uint32(frames[2])
+	if last, ok := s.last[topic]; ok && sequence != last+1 {
+		gap := ZMQGap{Topic: topic, Expected: last + 1, Received: sequence}
+		for _, handler := range s.snapshot().gaps {
+			handler(gap)
+		}
+	}
+	s.last[topic] = sequence
+
+	handlers := s.snapshot()
+	switch topic {
+	case ZMQRawTx:
+		tx, txId, err := parseRawTransaction(body)
+		if err != nil {
+			s.report(fmt.Errorf("invalid rawtx notification: %v", err))
+			return
+		}
+		for _, handler := range handlers.transactions {
+			handler(txId, tx)
+		}
+	case ZMQRawBlock:
+		block, err := ParseBlock(body)
+		if err != nil {
+			s.report(fmt.Errorf("invalid rawblock notification: %v", err))
+			return
+		}
+		for _, handler := range handlers.blocks {
+			handler(block)
+		}
+	case ZMQHashTx, ZMQHashBlock:
+		if len(body) != 32 {
+			s.report(fmt.Errorf("invalid %s notification", topic))
+			return
+		}
+		hash := formating.BytesToHex(body)
+		callbacks := handlers.txHashes
+		if topic == ZMQHashBlock {
+			callbacks = handlers.blockHashes
+		}
+		for _, handler := range callbacks {
+			handler(hash)
+		}
+	case ZMQSequence:
+		event, err := parseSequence(body)
+		if err != nil {
+			s.report(err)
+			return
+		}
+		for _, handler := range handlers.sequences {
+			handler(*event)
+		}
+	}
+}
+
+// snapshot returns the handlers, a handler can register other ones
+func (s *ZMQSubscriber) snapshot() zmqHandlers {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.handlers
+}
+
+func (s *ZMQSubscriber) report(err error) {
+	for _, handler := range s.snapshot().errors {
+		handler(err)
+	}
+}
+
+// parseRawTransaction parses a serialized transaction and computes its id from the raw bytes
+func parseRawTransaction(raw []byte) (tx *scripts.BtcTransaction, txId string, err error) {
+	defer func() {
+		if recover() != nil {
+			tx, txId, err = nil, "", fmt.Errorf("invalid transaction")
+		}
+	}()
+	tx, size, err := scripts.BtcTransactionFromBytes(raw)
+	if err != nil {
+		return nil, "", err
+	}
+	if size != len(raw) {
+		return nil, "", fmt.Errorf("invalid transaction length")
+	}
+	return tx, txIdFromRaw(raw, tx), nil
+}
+
+// parseSequence parses the body of a sequence notification: a hash, the kind of change and the
+// mempool sequence number of a transaction
+func parseSequence(body []byte) (*ZMQSequenceEvent, error) {
+	if len(body) < 33 {
+		return nil, fmt.Errorf("invalid sequence notification")
+	}
+	event := &ZMQSequenceEvent{Hash: formating.BytesToHex(body[:32]), Kind: ZMQSequenceKind(body[32])}
+	switch event.Kind {
+	case ZMQBlockConnected, ZMQBlockDisconnected:
+		if len(body) != 33 {
+			return nil, fmt.Errorf("invalid sequence notification")
+		}
+	case ZMQTransactionAdded, ZMQTransactionRemoved:
+		if len(body) != 41 {
+			return nil, fmt.Errorf("invalid sequence notification")
+		}
+		event.MempoolSequence = binary.LittleEndian.Uint64(body[33:])
+	default:
+		return nil, fmt.Errorf("unknown sequence notification %c", event.Kind)
+	}
+	return event, nil
+}
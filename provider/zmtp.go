@@ -0,0 +1,175 @@
+package provider
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"time"
+)
+
+// zmtpMaxFrame is the largest frame read, a serialized block is at most 4 MB
+const zmtpMaxFrame = 64 << 20
+
+// flags of the frames
+const (
+	zmtpMore    = 0x01
+	zmtpLong    = 0x02
+	zmtpCommand = 0x04
+)
+
+// zmtpConn is the SUB side of a ZMTP 3.0 connection with the NULL security mechanism
+// (https://rfc.zeromq.org/spec/23/), the one of the ZMQ notifications of Bitcoin Core
+type zmtpConn struct {
+	conn   net.Conn
+	reader *bufio.Reader
+}
+
+// dialZMTP connects to a publisher at address, tcp://host:port or host:port
+func dialZMTP(ctx context.Context, address string) (*zmtpConn, error) {
+	conn, err := (&net.Dialer{}).DialContext(ctx, "tcp", strings.TrimPrefix(address, "tcp://"))
+	if err != nil {
+		return nil, err
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+	// unblock the handshake when the context is cancelled
+	stop := context.AfterFunc(ctx, func() { conn.SetDeadline(time.Now()) })
+	defer stop()
+
+	z := &zmtpConn{conn: conn, reader: bufio.NewReader(conn)}
+	if err := z.handshake(); err != nil {
+		conn.Close()
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return nil, fmt.Errorf("zmtp handshake failed: %v", err)
+	}
+	conn.SetDeadline(time.Time{})
+	return z, nil
+}
+
+// handshake exchanges the greetings and the READY commands
+func (z *zmtpConn) handshake() error {
+	greeting := make([]byte, 64)
+	greeting[0], greeting[9] = 0xff, 0x7f
+	greeting[10], greeting[11] = 3, 0
+	copy(greeting[12:32], "NULL")
+	if _, err := z.conn.Write(greeting); err != nil {
+		return err
+	}
+	peer := make([]byte, 64)
+	if _, err := io.ReadFull(z.reader, peer); err != nil {
+		return err
+	}
+	if peer[0] != 0xff || peer[9]&0x01 != 0x01 || peer[10] < 3 {
+		return fmt.Errorf("unsupported peer greeting")
+	}
+	if mechanism := string(bytes.TrimRight(peer[12:32], "\x00")); mechanism != "NULL" {
+		return fmt.Errorf("unsupported security mechanism %s", mechanism)
+	}
+
+	ready := append([]byte{5}, "READY"...)
+	ready = append(ready, zmtpProperty("Socket-Type", "SUB")...)
+	if err := z.writeFrame(zmtpCommand, ready); err != nil {
+		return err
+	}
+	flags, body, err := z.readFrame()
+	if err != nil {
+		return err
+	}
+	if flags&zmtpCommand == 0 || len(body) == 0 || int(body[0]) >= len(body) {
+		return fmt.Errorf("expected the READY command")
+	}
+	name := string(body[1 : 1+body[0]])
+	if name == "ERROR" && len(body) > 6 {
+		return fmt.Errorf("peer error: %s", body[7:])
+	}
+	if name != "READY" {
+		return fmt.Errorf("unexpected command %s", name)
+	}
+	return nil
+}
+
+// zmtpProperty encodes a metadata property of a command
+func zmtpProperty(name string, value string) []byte {
+	property := append([]byte{byte(len(name))}, name...)
+	size := make([]byte, 4)
+	binary.BigEndian.PutUint32(size, uint32(len(value)))
+	return append(append(property, size...), value...)
+}
+
+// subscribe subscribes to the messages starting with topic, a ZMTP 3.0 subscription is a message
+// starting with 1
+func (z *zmtpConn) subscribe(topic string) error {
+	return z.writeFrame(0, append([]byte{1}, topic...))
+}
+
+func (z *zmtpConn) writeFrame(flags byte, body []byte) error {
+	var header []byte
+	if len(body) > 255 {
+		header = make([]byte, 9)
+		header[0] = flags | zmtpLong
+		binary.BigEndian.PutUint64(header[1:], uint64(len(body)))
+	} else {
+		header = []byte{flags, byte(len(body))}
+	}
+	_, err := z.conn.Write(append(header, body...))
+	return err
+}
+
+func (z *zmtpConn) readFrame() (byte, []byte, error) {
+	flags, err := z.reader.ReadByte()
+	if err != nil {
+		return 0, nil, err
+	}
+	var size uint64
+	if flags&zmtpLong != 0 {
+		extended := make([]byte, 8)
+		if _, err := io.ReadFull(z.reader, extended); err != nil {
+			return 0, nil, err
+		}
+		size = binary.BigEndian.Uint64(extended)
+	} else {
+		short, err := z.reader.ReadByte()
+		if err != nil {
+			return 0, nil, err
+		}
+		size = uint64(short)
+	}
+	if size > zmtpMaxFrame {
+		return 0, nil, fmt.Errorf("zmtp frame of %d bytes too large", size)
+	}
+	body := make([]byte, size)
+	if _, err := io.ReadFull(z.reader, body); err != nil {
+		return 0, nil, err
+	}
+	return flags, body, nil
+}
+
+// readMessage returns the frames of the next message, commands are skipped
+func (z *zmtpConn) readMessage() ([][]byte, error) {
+	var frames [][]byte
+	for {
+		flags, body, err := z.readFrame()
+		if err != nil {
+			return nil, err
+		}
+		if flags&zmtpCommand != 0 {
+			continue
+		}
+		frames = append(frames, body)
+		if flags&zmtpMore == 0 {
+			return frames, nil
+		}
+	}
+}
+
+func (z *zmtpConn) close() error {
+	return z.conn.Close()
+}
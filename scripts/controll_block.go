@@ -10,6 +10,8 @@ type ControlBlock struct {
 	PublicXonly string
 	// concatenated path (leafs/branches) hashes in bytes
 	Scripts []byte
+	// true when the y coordinate of the tweaked output key is odd
+	OutputKeyOdd bool
 }
 
 // NewControlBlock creates a new control block with the specified public key and scripts,
@@ -21,9 +23,22 @@ func NewControlBlock(public string, scripts []byte) *ControlBlock {
 	}
 }
 
+// NewControlBlockWithParity creates a new control block like NewControlBlock and records
+// the parity of the tweaked output key, which is encoded in the leaf version byte.
+func NewControlBlockWithParity(public string, scripts []byte, outputKeyOdd bool) *ControlBlock {
+	return &ControlBlock{
+		PublicXonly:  public,
+		Scripts:      scripts,
+		OutputKeyOdd: outputKeyOdd,
+	}
+}
+
 // returns the control block as bytes
 func (cb *ControlBlock) ToBytes() []byte {
 	version := []byte{constant.LEAF_VERSION_TAPSCRIPT}
+	if cb.OutputKeyOdd {
+		version[0] |= 0x01
+	}
 
 	pubKey := formating.HexToBytes(cb.PublicXonly)
 
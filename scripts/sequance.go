@@ -62,3 +62,8 @@ func (s *Sequence) ForScript() (int, error) {
 	}
 	return scriptInteger, nil
 }
+
+// IsRelativeTimelock reports whether the sequence describes a BIP68 relative timelock
+func (s *Sequence) IsRelativeTimelock() bool {
+	return s.seqType == constant.TYPE_RELATIVE_TIMELOCK
+}
@@ -1,6 +1,7 @@
 package scripts
 
 import (
+	"fmt"
 	"math/big"
 
 	"github.com/mrtnetwork/bitcoin/constant"
@@ -40,8 +41,8 @@ func NewBtcTransaction(inputs []*TxInput, outputs []*TxOutput, hasSegwit bool, o
 				version = v
 			}
 		case []TxWitnessInput:
-			for _, input := range v {
-				w = append(w, &input)
+			for i := range v {
+				w = append(w, &v[i])
 			}
 		case []*TxWitnessInput:
 			w = append(w, v...)
@@ -64,8 +65,6 @@ func NewBtcTransaction(inputs []*TxInput, outputs []*TxOutput, hasSegwit bool, o
 		HasSegwit: hasSegwit,
 	}
 
-	transaction.Witnesses = append(transaction.Witnesses, w...)
-
 	return transaction
 }
 
@@ -97,6 +96,22 @@ func (tx *BtcTransaction) Copy() *BtcTransaction {
 }
 func BtcTransactionFromRaw(raw string) (*BtcTransaction, error) {
 	txBytes := formating.HexToBytes(raw)
+	tx, size, err := BtcTransactionFromBytes(txBytes)
+	if err != nil {
+		return nil, err
+	}
+	if size != len(txBytes) {
+		return nil, fmt.Errorf("invalid transaction length")
+	}
+	return tx, nil
+}
+
+// BtcTransactionFromBytes parses the transaction at the start of txBytes, for example in a block,
+// and returns it with its serialized size.
+func BtcTransactionFromBytes(txBytes []byte) (*BtcTransaction, int, error) {
+	if len(txBytes) < 10 {
+		return nil, 0, fmt.Errorf("invalid transaction length")
+	}
 	cursor := 4
 	var flag []byte
 	hasSegwit := false
@@ -116,7 +131,7 @@ func BtcTransactionFromRaw(raw string) (*BtcTransaction, error) {
 	for index := 0; index < len(inputs); index++ {
 		inp, inpCursor, err := TxInputFromRaw(txBytes, cursor, hasSegwit)
 		if err != nil {
-			return nil, err
+			return nil, 0, err
 		}
 		inputs[index] = inp
 		cursor = inpCursor
@@ -128,7 +143,7 @@ func BtcTransactionFromRaw(raw string) (*BtcTransaction, error) {
 	for index := 0; index < len(outputs); index++ {
 		out, outCursor, err := TxOutputFromRaw(txBytes, cursor, hasSegwit)
 		if err != nil {
-			return nil, err
+			return nil, 0, err
 		}
 		outputs[index] = out
 		cursor = outCursor
@@ -151,7 +166,12 @@ func BtcTransactionFromRaw(raw string) (*BtcTransaction, error) {
 			witnesses[n] = TxWitnessInput{Stack: witnessesTmp}
 		}
 	}
-	return NewBtcTransaction(inputs, outputs, hasSegwit, witnesses), nil
+	if len(txBytes) < cursor+4 {
+		return nil, 0, fmt.Errorf("invalid transaction length")
+	}
+	version := txBytes[0:4]
+	locktime := txBytes[cursor : cursor+4]
+	return NewBtcTransaction(inputs, outputs, hasSegwit, locktime, version, witnesses), cursor + 4, nil
 
 }
 
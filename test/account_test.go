@@ -0,0 +1,157 @@
+package test
+
+import (
+	"context"
+	"math/big"
+	"testing"
+
+	"github.com/mrtnetwork/bitcoin/address"
+	hdwallet "github.com/mrtnetwork/bitcoin/hd_wallet"
+	"github.com/mrtnetwork/bitcoin/keypair"
+	"github.com/mrtnetwork/bitcoin/provider"
+	"github.com/mrtnetwork/bitcoin/provider/providertest"
+	"github.com/mrtnetwork/bitcoin/wallet"
+)
+
+func TestAccount(t *testing.T) {
+	ctx := context.Background()
+	network := address.MainnetNetwork
+	master, _ := hdwallet.FromMnemonic("abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon about", "")
+
+	// BIP84 test vectors
+	account, err := wallet.NewAccount(master, "m/84'/0'/0'", address.P2WPKH, &network)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if xpub := account.XPublicKey(); xpub != "zpub6rFR7y4Q2AijBEqTUquhVz398htDFrtymD9xYYfG1m4wAcvPhXNfE3EfH1r1ADqtfSdVCToUG868RvUUkgDKf31mGDtKsAYz2oz2AGutZYs" {
+		t.Errorf("Unexpected account key %s", xpub)
+	}
+	account.GapLimit = 3
+	receive, err := account.NextReceiveAddress()
+	if err != nil || receive.Address.Show(&network) != "bc1qcr8te4kr609gcawutmrza0j4xv80jy8z306fyu" || receive.Path != "m/84'/0'/0'/0/0" {
+		t.Errorf("Unexpected receive address %s %s %v", receive.Address.Show(&network), receive.Path, err)
+	}
+	change, err := account.ChangeAddress()
+	if err != nil || change.Address.Show(&network) != "bc1q8c6fshw2dlwun7ekn9qwf37cu2rn755upcp6el" || change.Chain != wallet.ChangeChain || change.Index != 0 {
+		t.Errorf("Unexpected change address %s %v", change.Address.Show(&network), err)
+	}
+
+	// fresh addresses until the gap limit, then the first unused one again
+	for i := 1; i < 3; i++ {
+		if addr, _ := account.NextReceiveAddress(); addr.Index != i {
+			t.Errorf("Expected the receive address %d, got %d", i, addr.Index)
+		}
+	}
+	if addr, _ := account.NextReceiveAddress(); addr.Index != 0 || account.Gap(wallet.ReceiveChain) != 3 {
+		t.Errorf("Expected the first unused address at the gap limit, got %d", addr.Index)
+	}
+	if _, ok, _ := account.MarkUsed(receive.Address.ToScriptPubKey().ToHex()); !ok || account.Gap(wallet.ReceiveChain) != 2 {
+		t.Errorf("Unexpected gap %d", account.Gap(wallet.ReceiveChain))
+	}
+	if addr, _ := account.NextReceiveAddress(); addr.Index != 3 {
+		t.Errorf("Expected a fresh address after a payment, got %d", addr.Index)
+	}
+
+	// payments to the addresses derived ahead are recognized
+	script := account.Owners()[6].Address.ToScriptPubKey().ToHex()
+	if addr, ok := account.Lookup(script); !ok || addr.Chain != wallet.ReceiveChain || addr.Index != 6 || addr.Path != "m/84'/0'/0'/0/6" {
+		t.Errorf("Unexpected lookup %+v %v", addr, ok)
+	}
+	account.MarkUsed(script)
+	if len(account.Addresses(wallet.ReceiveChain)) != 7 || account.Gap(wallet.ReceiveChain) != 0 {
+		t.Errorf("Unexpected receive addresses %d", len(account.Addresses(wallet.ReceiveChain)))
+	}
+	if _, ok := account.Lookup(change.Address.ToScriptPubKey().ToHex()); !ok {
+		t.Errorf("Expected the change address to be found")
+	}
+	if _, ok, _ := account.MarkUsed("0014" + "00"); ok {
+		t.Errorf("Expected an unknown script")
+	}
+	// each transaction gets its own change address, before its change is seen
+	if addr, _ := account.ChangeAddress(); addr.Index != 1 {
+		t.Errorf("Expected a fresh change address, got %d", addr.Index)
+	}
+	if addr, _ := account.ChangeAddress(); addr.Index != 2 {
+		t.Errorf("Expected a fresh change address, got %d", addr.Index)
+	}
+	// at the gap limit the first unused one is given out again
+	if addr, _ := account.ChangeAddress(); addr.Index != 0 {
+		t.Errorf("Expected the first unused change address at the gap limit, got %d", addr.Index)
+	}
+	account.MarkUsed(change.Address.ToScriptPubKey().ToHex())
+	if addr, _ := account.ChangeAddress(); addr.Index != 3 {
+		t.Errorf("Expected the next change address, got %d", addr.Index)
+	}
+
+	// the signer finds the key of each input from its owner
+	testnet := address.TestnetNetwork
+	server := providertest.NewServer(&testnet)
+	defer server.Close()
+	testAccount, err := wallet.NewAccount(master, "m/84'/1'/0'", address.P2WPKH, &testnet)
+	if err != nil {
+		t.Fatal(err)
+	}
+	testAccount.GapLimit = 3
+	first, _ := testAccount.NextReceiveAddress()
+	second, _ := testAccount.NextReceiveAddress()
+	third, _ := testAccount.NextReceiveAddress()
+	testChange, _ := testAccount.ChangeAddress()
+	server.Fund(first.Address, big.NewInt(30000))
+	server.Fund(third.Address, big.NewInt(20000))
+	server.Mine(1)
+	utxos := provider.UtxoWithOwnerList{}
+	for _, addr := range []wallet.AccountAddress{first, second, third} {
+		found, err := server.MempoolProvider().GetAccountUtxo(ctx, addr.Owner())
+		if err != nil {
+			t.Fatal(err)
+		}
+		utxos = append(utxos, found...)
+	}
+	builder := provider.NewBitcoinTransactionBuilder(utxos, []provider.BitcoinOutputDetails{
+		{Address: testChange.Address, Value: big.NewInt(49000)},
+	}, big.NewInt(1000), &testnet, "", true)
+	tx, err := builder.BuildTransaction(testAccount.Signer())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, input := range tx.Inputs {
+		expected := first.PublicKey.ToHex()
+		if input.TxID == utxos[1].Utxo.TxHash {
+			expected = third.PublicKey.ToHex()
+		}
+		if tx.Witnesses[i].Stack[1] != expected {
+			t.Errorf("Unexpected key of input %d", i)
+		}
+	}
+	if _, err := server.MempoolProvider().SendRawTransaction(ctx, tx.Serialize()); err != nil {
+		t.Fatal(err)
+	}
+	server.Mine(1)
+	key, _ := keypair.NewECPrivateFromWIF("cTALNpTpRbbxTCJ2A5Vq88UxT44w1PE2cYqiB3n4hRvzyCev1Wwo")
+	foreign := provider.UtxoWithOwner{Utxo: provider.BitcoinUtxo{ScriptType: address.P2WPKH}, OwnerDetails: provider.UtxoOwnerDetails{PublicKey: key.GetPublic().ToHex()}}
+	if _, err := testAccount.Signer()(make([]byte, 32), foreign, ""); err == nil {
+		t.Errorf("Expected an error for a key of another wallet")
+	}
+
+	// the used addresses are restored from the history
+	restored, _ := wallet.NewAccount(master, "m/84'/1'/0'", address.P2WPKH, &testnet)
+	restored.GapLimit = 3
+	if err := restored.Discover(ctx, server.MempoolProvider()); err != nil {
+		t.Fatal(err)
+	}
+	used := []int{}
+	for _, addr := range restored.Addresses(wallet.ReceiveChain) {
+		if addr.Used {
+			used = append(used, addr.Index)
+		}
+	}
+	if len(used) != 2 || used[0] != 0 || used[1] != 2 {
+		t.Errorf("Unexpected used addresses %v", used)
+	}
+	if addr, _ := restored.ChangeAddress(); addr.Index != 1 {
+		t.Errorf("Expected the change address after the used one, got %d", addr.Index)
+	}
+	if addr, _ := restored.NextReceiveAddress(); addr.Index != 3 {
+		t.Errorf("Expected a fresh receive address, got %d", addr.Index)
+	}
+}
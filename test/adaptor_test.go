@@ -0,0 +1,165 @@
+package test
+
+import (
+	"math/big"
+	"strings"
+	"testing"
+
+	"github.com/mrtnetwork/bitcoin/address"
+	"github.com/mrtnetwork/bitcoin/constant"
+	"github.com/mrtnetwork/bitcoin/digest"
+	"github.com/mrtnetwork/bitcoin/ecc"
+	"github.com/mrtnetwork/bitcoin/formating"
+	"github.com/mrtnetwork/bitcoin/keypair"
+	"github.com/mrtnetwork/bitcoin/provider"
+)
+
+func TestSchnorrAdaptor(t *testing.T) {
+	sk, _ := keypair.NewECPrivateFromWIF("cTALNpTpRbbxTCJ2A5Vq88UxT44w1PE2cYqiB3n4hRvzyCev1Wwo")
+	publicKey := formating.HexToBytes(sk.GetPublic().ToXOnlyHex())
+	aux := make([]byte, 32)
+	// cover both parities of the final nonce
+	for i := 0; i < 8; i++ {
+		msg := digest.SingleHash([]byte{byte(i)})
+		adaptorSecret, _ := digest.GenerateRandom(32)
+		x, y := ecc.P256k1().ScalarBaseMult(adaptorSecret)
+		adaptorPoint := ecc.MarshalCompressed(ecc.P256k1(), x, y)
+
+		preSignature, err := ecc.SchnorrAdaptorPreSign(msg, sk.ToBytes(), adaptorPoint, aux)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !ecc.VerifySchnorrAdaptor(msg, publicKey, adaptorPoint, preSignature) {
+			t.Errorf("Invalid pre-signature")
+		}
+		if ecc.VerifySchnorr(msg, publicKey, preSignature[1:]) {
+			t.Errorf("A pre-signature must not be a valid signature")
+		}
+		otherX, otherY := ecc.P256k1().ScalarBaseMult(msg)
+		if ecc.VerifySchnorrAdaptor(msg, publicKey, ecc.MarshalCompressed(ecc.P256k1(), otherX, otherY), preSignature) {
+			t.Errorf("Expected invalid pre-signature for another adaptor point")
+		}
+
+		signature, err := ecc.AdaptSchnorr(preSignature, adaptorSecret)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !ecc.VerifySchnorr(msg, publicKey, signature) {
+			t.Errorf("Invalid adapted signature")
+		}
+		secret, err := ecc.ExtractSchnorrAdaptorSecret(preSignature, signature, adaptorPoint)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.EqualFold(formating.BytesToHex(secret), formating.BytesToHex(adaptorSecret)) {
+			t.Errorf("Expected %v, but got %v", formating.BytesToHex(adaptorSecret), formating.BytesToHex(secret))
+		}
+		other := ecc.SchnorrSign(msg, sk.ToBytes(), aux)
+		if _, err := ecc.ExtractSchnorrAdaptorSecret(preSignature, other, adaptorPoint); err == nil {
+			t.Errorf("Expected error for unrelated signature")
+		}
+	}
+}
+
+func TestSchnorrSignWithNonce(t *testing.T) {
+	sk, _ := keypair.NewECPrivateFromWIF("cTALNpTpRbbxTCJ2A5Vq88UxT44w1PE2cYqiB3n4hRvzyCev1Wwo")
+	publicKey := formating.HexToBytes(sk.GetPublic().ToXOnlyHex())
+	// cover both parities of the nonce
+	for i := 0; i < 8; i++ {
+		msg := digest.SingleHash([]byte{byte(i)})
+		nonce := digest.SingleHash([]byte{byte(i), 1})
+		rx, _ := ecc.P256k1().ScalarBaseMult(nonce)
+		signature, err := ecc.SchnorrSignWithNonce(msg, sk.ToBytes(), nonce)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !ecc.VerifySchnorr(msg, publicKey, signature) || !strings.EqualFold(formating.BytesToHex(signature[:32]), formating.BytesToHex(rx.FillBytes(make([]byte, 32)))) {
+			t.Errorf("Invalid signature with the nonce")
+		}
+		// the signature point is known before the signature
+		point, err := ecc.SchnorrSignaturePoint(msg, publicKey, signature[:32])
+		if err != nil {
+			t.Fatal(err)
+		}
+		sx, sy := ecc.P256k1().ScalarBaseMult(signature[32:])
+		if !strings.EqualFold(formating.BytesToHex(point), formating.BytesToHex(ecc.MarshalCompressed(ecc.P256k1(), sx, sy))) {
+			t.Errorf("Unexpected signature point")
+		}
+	}
+	if _, err := ecc.SchnorrSignWithNonce(make([]byte, 32), sk.ToBytes(), make([]byte, 32)); err == nil {
+		t.Errorf("Expected an error for a zero nonce")
+	}
+	// an x coordinate above the field prime is not a point
+	if _, err := ecc.SchnorrSignaturePoint(make([]byte, 32), publicKey, formating.HexToBytes(strings.Repeat("ff", 32))); err == nil {
+		t.Errorf("Expected an error for an invalid nonce")
+	}
+}
+
+func TestEcdsaAdaptor(t *testing.T) {
+	sk, _ := keypair.NewECPrivateFromWIF("cTALNpTpRbbxTCJ2A5Vq88UxT44w1PE2cYqiB3n4hRvzyCev1Wwo")
+	pub := sk.GetPublic()
+	adaptorSecret := digest.SingleHash([]byte("adaptor secret"))
+	x, y := ecc.P256k1().ScalarBaseMult(adaptorSecret)
+	adaptorPoint := ecc.MarshalCompressed(ecc.P256k1(), x, y)
+	txHash := "6e9a0692ed4b3328909d66d41531854988dc39edba5df186affaefda91824e69"
+
+	for i := 0; i < 8; i++ {
+		msg := digest.SingleHash([]byte{byte(i)})
+		// the verifier agrees with the repository's own ECDSA signatures
+		if !ecc.VerifyDER(msg, pub.ToCompressedBytes(), formating.HexToBytes(sk.SingInput(msg, constant.SIGHASH_ALL))) {
+			t.Errorf("Invalid ECDSA signature")
+		}
+		adaptorSignature, err := ecc.EcdsaAdaptorEncryptSign(msg, sk.ToBytes(), adaptorPoint)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !ecc.VerifyEcdsaAdaptor(msg, pub.ToCompressedBytes(), adaptorPoint, adaptorSignature) {
+			t.Errorf("Invalid adaptor signature")
+		}
+		if ecc.VerifyEcdsaAdaptor(msg, pub.ToCompressedBytes(), pub.ToCompressedBytes(), adaptorSignature) {
+			t.Errorf("Expected invalid adaptor signature for another adaptor point")
+		}
+		signature, err := ecc.DecryptEcdsaAdaptor(adaptorSignature, adaptorSecret, constant.SIGHASH_ALL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(signature) > 144 || !ecc.VerifyDER(msg, pub.ToCompressedBytes(), formating.HexToBytes(signature)) {
+			t.Errorf("Invalid decrypted signature %v", signature)
+		}
+		secret, err := ecc.RecoverEcdsaAdaptorSecret(adaptorSignature, formating.HexToBytes(signature), adaptorPoint)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.EqualFold(formating.BytesToHex(secret), formating.BytesToHex(adaptorSecret)) {
+			t.Errorf("Expected %v, but got %v", formating.BytesToHex(adaptorSecret), formating.BytesToHex(secret))
+		}
+	}
+
+	t.Run("spend_p2wpkh", func(t *testing.T) {
+		var digests [][]byte
+		signer := func(trDigest []byte, utxo provider.UtxoWithOwner, publicKey string) (string, error) {
+			digests = append(digests, trDigest)
+			adaptorSignature, err := ecc.EcdsaAdaptorEncryptSign(trDigest, sk.ToBytes(), adaptorPoint)
+			if err != nil {
+				return "", err
+			}
+			return ecc.DecryptEcdsaAdaptor(adaptorSignature, adaptorSecret, constant.SIGHASH_ALL)
+		}
+		utxo := provider.UtxoWithOwner{
+			Utxo:         provider.BitcoinUtxo{TxHash: txHash, Value: big.NewInt(100000), Vout: 0, ScriptType: address.P2WPKH},
+			OwnerDetails: provider.UtxoOwnerDetails{PublicKey: pub.ToHex(), Address: pub.ToSegwitAddress()},
+		}
+		builder := provider.NewBitcoinTransactionBuilder(
+			[]provider.UtxoWithOwner{utxo},
+			[]provider.BitcoinOutputDetails{{Address: pub.ToSegwitAddress(), Value: big.NewInt(99000)}},
+			big.NewInt(1000), &address.TestnetNetwork, "", false)
+		tx, err := builder.BuildTransaction(signer)
+		if err != nil {
+			t.Fatal(err)
+		}
+		witness := tx.Witnesses[0].Stack
+		if !ecc.VerifyDER(digests[0], pub.ToCompressedBytes(), formating.HexToBytes(witness[0])) {
+			t.Errorf("Invalid witness signature")
+		}
+	})
+}
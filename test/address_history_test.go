@@ -0,0 +1,178 @@
+package test
+
+import (
+	"context"
+	"math/big"
+	"testing"
+
+	"github.com/mrtnetwork/bitcoin/address"
+	"github.com/mrtnetwork/bitcoin/constant"
+	"github.com/mrtnetwork/bitcoin/keypair"
+	"github.com/mrtnetwork/bitcoin/provider"
+	"github.com/mrtnetwork/bitcoin/provider/providertest"
+)
+
+func TestAddressHistory(t *testing.T) {
+	network := address.TestnetNetwork
+	ctx := context.Background()
+	key, _ := keypair.NewECPrivateFromWIF("cTALNpTpRbbxTCJ2A5Vq88UxT44w1PE2cYqiB3n4hRvzyCev1Wwo")
+	segwit := key.GetPublic().ToSegwitAddress()
+	legacy := key.GetPublic().ToAddress()
+
+	server := providertest.NewServer(&network)
+	defer server.Close()
+
+	// 27 deposits confirmed in their own block, more than a page of the Mempool API
+	total := big.NewInt(0)
+	for i := 0; i < 27; i++ {
+		server.Fund(segwit, big.NewInt(int64(10000+i)))
+		server.Mine(1)
+		total.Add(total, big.NewInt(int64(10000+i)))
+	}
+	first := server.Height() - 26
+
+	// everything is spent to legacy, then a new deposit arrives, both stay in the mempool
+	utxos, err := server.MempoolProvider().GetAccountUtxo(ctx, provider.UtxoOwnerDetails{PublicKey: key.GetPublic().ToHex(), Address: segwit})
+	if err != nil {
+		t.Fatal(err)
+	}
+	builder := provider.NewBitcoinTransactionBuilder(utxos, []provider.BitcoinOutputDetails{{Address: legacy, Value: new(big.Int).Sub(total, big.NewInt(2000))}},
+		big.NewInt(2000), &network, "", true)
+	tx, err := builder.BuildTransaction(func(trDigest []byte, utxo provider.UtxoWithOwner, publicKey string) (string, error) {
+		return key.SingInput(trDigest, constant.SIGHASH_ALL), nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := server.Broadcast(tx.Serialize()); err != nil {
+		t.Fatal(err)
+	}
+	deposit := server.Fund(segwit, big.NewInt(5000))
+
+	for _, backend := range []struct {
+		name string
+		api  provider.ChainProvider
+	}{
+		{"mempool", server.MempoolProvider()},
+		{"esplora", server.EsploraProvider()},
+		{"blockcypher", server.BlockCypherProvider()},
+	} {
+		t.Run(backend.name, func(t *testing.T) {
+			items, err := provider.GetAddressHistory(ctx, backend.api, segwit, &network)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(items) != 29 {
+				t.Fatalf("Expected 29 transactions, got %d", len(items))
+			}
+			balance := big.NewInt(0)
+			for i, item := range items {
+				balance.Add(balance, item.Net)
+				if item.Pending() != (i < 2) || item.Pending() != (item.Confirmations == 0) {
+					t.Errorf("Unexpected status of %s: %+v confirmations %d", item.TxId, item.Status, item.Confirmations)
+				}
+				switch item.TxId {
+				case tx.TxId():
+					if item.Sent.Cmp(total) != 0 || item.Received.Sign() != 0 || item.Net.Cmp(new(big.Int).Neg(total)) != 0 || item.Fee.Int64() != 2000 {
+						t.Errorf("Unexpected spend %+v", item)
+					}
+				case deposit.TxId:
+					if item.Net.Int64() != 5000 || item.Sent.Sign() != 0 {
+						t.Errorf("Unexpected deposit %+v", item)
+					}
+				}
+			}
+			if balance.Int64() != 5000 {
+				t.Errorf("Expected a balance of 5000, got %v", balance)
+			}
+			oldest := items[len(items)-1]
+			if oldest.Net.Int64() != 10000 || oldest.Status.BlockHeight != first || oldest.Confirmations != 27 || oldest.Status.BlockTime.IsZero() {
+				t.Errorf("Unexpected oldest transaction %+v confirmations %d", oldest.Status, oldest.Confirmations)
+			}
+
+			// the receiver sees the spend as an incoming payment
+			received, err := provider.GetAddressHistory(ctx, backend.api, legacy, &network)
+			if err != nil || len(received) != 1 || received[0].Net.Cmp(new(big.Int).Sub(total, big.NewInt(2000))) != 0 {
+				t.Errorf("Unexpected history of the receiver %+v %v", received, err)
+			}
+		})
+	}
+
+	// the pages of the backend are followed one at a time
+	history := provider.NewAddressHistory(server.MempoolProvider(), segwit, &network)
+	page, err := history.Next(ctx)
+	if err != nil || len(page) != 27 || history.Done() {
+		t.Fatalf("Expected a first page of 27 transactions, got %d %v", len(page), err)
+	}
+	if page, err = history.Next(ctx); err != nil || len(page) != 2 || !history.Done() {
+		t.Errorf("Expected a last page of 2 transactions, got %d %v", len(page), err)
+	}
+	if page, _ := history.Next(ctx); page != nil {
+		t.Errorf("Expected no page after the last one")
+	}
+
+	// the node does not index the addresses
+	if _, err := provider.GetAddressHistory(ctx, provider.NewRPCProvider("http://127.0.0.1:1", &network, provider.RPCAuth{}, nil), segwit, &network); err == nil {
+		t.Errorf("Expected an error")
+	}
+}
+
+func TestAddressHistoryFullPages(t *testing.T) {
+	network := address.TestnetNetwork
+	ctx := context.Background()
+	key, _ := keypair.NewECPrivateFromWIF("cTALNpTpRbbxTCJ2A5Vq88UxT44w1PE2cYqiB3n4hRvzyCev1Wwo")
+	segwit := key.GetPublic().ToSegwitAddress()
+	legacy := key.GetPublic().ToAddress()
+
+	server := providertest.NewServer(&network)
+	defer server.Close()
+	// 3 deposits in a block, then 60 in a single block, more than a page of BlockCypher
+	for i := 0; i < 3; i++ {
+		server.Fund(segwit, big.NewInt(int64(10000+i)))
+	}
+	server.Mine(1)
+	for i := 0; i < 60; i++ {
+		server.Fund(segwit, big.NewInt(int64(20000+i)))
+	}
+	server.Mine(1)
+	// 5 confirmed deposits then 55 unconfirmed ones, the first page ends in the mempool
+	for i := 0; i < 5; i++ {
+		server.Fund(legacy, big.NewInt(int64(30000+i)))
+	}
+	server.Mine(1)
+	for i := 0; i < 55; i++ {
+		server.Fund(legacy, big.NewInt(int64(40000+i)))
+	}
+
+	for _, backend := range []struct {
+		name string
+		api  provider.ChainProvider
+	}{
+		{"mempool", server.MempoolProvider()},
+		{"esplora", server.EsploraProvider()},
+		{"blockcypher", server.BlockCypherProvider()},
+	} {
+		t.Run(backend.name, func(t *testing.T) {
+			for _, expected := range []struct {
+				addr        address.BitcoinAddress
+				count       int
+				unconfirmed int
+			}{{segwit, 63, 0}, {legacy, 60, 55}} {
+				items, err := provider.GetAddressHistory(ctx, backend.api, expected.addr, &network)
+				if err != nil {
+					t.Fatal(err)
+				}
+				ids, pending := map[string]bool{}, 0
+				for _, item := range items {
+					ids[item.TxId] = true
+					if item.Pending() {
+						pending++
+					}
+				}
+				if len(items) != expected.count || len(ids) != expected.count || pending != expected.unconfirmed {
+					t.Errorf("Expected %d transactions with %d unconfirmed, got %d (%d distinct) with %d unconfirmed", expected.count, expected.unconfirmed, len(items), len(ids), pending)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,153 @@
+package test
+
+import (
+	"encoding/base64"
+	"math/big"
+	"testing"
+
+	"github.com/mrtnetwork/bitcoin/address"
+	"github.com/mrtnetwork/bitcoin/bip322"
+	"github.com/mrtnetwork/bitcoin/formating"
+	"github.com/mrtnetwork/bitcoin/keypair"
+	"github.com/mrtnetwork/bitcoin/scripts"
+)
+
+func TestBip322(t *testing.T) {
+	// test vectors of BIP322
+	key, _ := keypair.NewECPrivateFromWIF("L3VFeEujGtevx9w18HD1fhRbCH67Az2dpCymeRE1SoPK6XQtaN2k")
+	segwit := key.GetPublic().ToSegwitAddress()
+	t.Run("vectors", func(t *testing.T) {
+		if segwit.Show(address.MainnetNetwork) != "bc1q9vza2e8x573nczrlzms0wvx3gsqjx7vavgkx0l" {
+			t.Fatalf("Unexpected address %v", segwit.Show(address.MainnetNetwork))
+		}
+		for _, vector := range []struct{ message, hash, toSpend, toSign, signature string }{
+			{"", "c90c269c4f8fcbe6880f72a721ddfbf1914268a794cbb21cfafee13770ae19f1",
+				"c5680aa69bb8d860bf82d4e9cd3504b55dde018de765a91bb566283c545a99a7",
+				"1e9654e951a5ba44c8604c4de6c67fd78a27e81dcadcfe1edf638ba3aaebaed6",
+				"AkcwRAIgM2gBAQqvZX15ZiysmKmQpDrG83avLIT492QBzLnQIxYCIBaTpOaD20qRlEylyxFSeEA2ba9YOixpX8z46TSDtS40ASECx/EgAxlkQpQ9hYjgGu6EBCPMVPwVIVJqO4XCsMvViHI="},
+			{"Hello World", "f0eb03b1a75ac6d9847f55c624a99169b5dccba2a31f5b23bea77ba270de0a7a",
+				"b79d196740ad5217771c1098fc4a4b51e0535c32236c71f1ea4d61a2d603352b",
+				"88737ae86f2077145f93cc4b153ae9a1cb8d56afa511988c149c5c8c9d93bddf",
+				"AkcwRAIgZRfIY3p7/DoVTty6YZbWS71bc5Vct9p9Fia83eRmw2QCICK/ENGfwLtptFluMGs2KsqoNSk89pO7F29zJLUx9a/sASECx/EgAxlkQpQ9hYjgGu6EBCPMVPwVIVJqO4XCsMvViHI="},
+		} {
+			if formating.BytesToHex(bip322.MessageHash(vector.message)) != vector.hash {
+				t.Errorf("Unexpected message hash of %q", vector.message)
+			}
+			toSpend := bip322.ToSpend(vector.message, segwit.ToScriptPubKey())
+			if toSpend.TxId() != vector.toSpend {
+				t.Errorf("Expected to_spend %v, but got %v", vector.toSpend, toSpend.TxId())
+			}
+			if toSign := bip322.ToSign(toSpend, nil); toSign.TxId() != vector.toSign {
+				t.Errorf("Expected to_sign %v, but got %v", vector.toSign, toSign.TxId())
+			}
+			signer := &bip322.Signer{Address: segwit, Keys: []*keypair.ECPrivate{key}}
+			signature, err := signer.SignSimple(vector.message)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, signature := range []string{signature, vector.signature} {
+				if err := bip322.Verify(vector.message, segwit, signature); err != nil {
+					t.Error(err)
+				}
+			}
+			if err := bip322.Verify(vector.message+"!", segwit, vector.signature); err == nil {
+				t.Errorf("Expected error for another message")
+			}
+		}
+		taproot := key.GetPublic().ToTaprootAddress()
+		if taproot.Show(address.MainnetNetwork) != "bc1ppv609nr0vr25u07u95waq5lucwfm6tde4nydujnu8npg4q75mr5sxq8lt3" {
+			t.Fatalf("Unexpected address %v", taproot.Show(address.MainnetNetwork))
+		}
+	})
+
+	other, _ := keypair.NewECPrivateFromWIF("cTALNpTpRbbxTCJ2A5Vq88UxT44w1PE2cYqiB3n4hRvzyCev1Wwo")
+	third, _ := keypair.NewECPrivateFromWIF("cRvyLwCPLU88jsyj94L7iJjQX5C2f8koG4G2gevN4BeSGcEvfKe9")
+	multisig := scripts.NewScript("OP_2", key.GetPublic().ToHex(), other.GetPublic().ToHex(), third.GetPublic().ToHex(), "OP_3", "OP_CHECKMULTISIG")
+	p2wsh, _ := address.P2WSHAddresssFromScript(multisig)
+	p2shP2wsh, _ := address.P2SHAddressFromScript(p2wsh.ToScriptPubKey(), address.P2WSHInP2SH)
+	signers := map[string]*bip322.Signer{
+		"p2wpkh":      {Address: segwit, Keys: []*keypair.ECPrivate{key}},
+		"p2sh_p2wpkh": {Address: key.GetPublic().ToP2WPKHInP2SH(), Keys: []*keypair.ECPrivate{key}},
+		"p2tr":        {Address: key.GetPublic().ToTaprootAddress(), Keys: []*keypair.ECPrivate{key}},
+		"p2wsh":       {Address: p2wsh, Keys: []*keypair.ECPrivate{third, key}, WitnessScript: multisig},
+		"p2sh_p2wsh":  {Address: p2shP2wsh, Keys: []*keypair.ECPrivate{other, third}, WitnessScript: multisig},
+	}
+	for name, signer := range signers {
+		t.Run(name, func(t *testing.T) {
+			simple, err := signer.SignSimple("Hello World")
+			if err != nil {
+				t.Fatal(err)
+			}
+			full, err := signer.SignFull("Hello World")
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, signature := range []string{simple, full} {
+				if err := bip322.Verify("Hello World", signer.Address, signature); err != nil {
+					t.Error(err)
+				}
+				if err := bip322.Verify("Hello World!", signer.Address, signature); err == nil {
+					t.Errorf("Expected error for another message")
+				}
+				if err := bip322.Verify("Hello World", other.GetPublic().ToSegwitAddress(), signature); err == nil {
+					t.Errorf("Expected error for another address")
+				}
+			}
+		})
+	}
+	t.Run("wrong_key", func(t *testing.T) {
+		signer := &bip322.Signer{Address: segwit, Keys: []*keypair.ECPrivate{other}}
+		if _, err := signer.SignSimple("Hello World"); err == nil {
+			t.Errorf("Expected error for a key of another address")
+		}
+		signer = &bip322.Signer{Address: p2wsh, Keys: []*keypair.ECPrivate{other}, WitnessScript: multisig}
+		if _, err := signer.SignSimple("Hello World"); err == nil {
+			t.Errorf("Expected error for missing multisig keys")
+		}
+	})
+	t.Run("p2pkh", func(t *testing.T) {
+		legacy := key.GetPublic().ToAddress()
+		signer := &bip322.Signer{Address: legacy, Keys: []*keypair.ECPrivate{key}}
+		if _, err := signer.SignSimple("Hello World"); err == nil {
+			t.Errorf("Expected error for simple signature of a P2PKH address")
+		}
+		full, err := signer.SignFull("Hello World")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := bip322.Verify("Hello World", legacy, full); err != nil {
+			t.Error(err)
+		}
+		// legacy signatures of ECPrivate.SignMessage are still accepted for P2PKH addresses
+		message := base64.StdEncoding.EncodeToString(formating.HexToBytes(key.SignMessage("Hello World", true)))
+		if err := bip322.Verify("Hello World", legacy, message); err != nil {
+			t.Error(err)
+		}
+		if err := bip322.Verify("Hello World!", legacy, message); err == nil {
+			t.Errorf("Expected error for another message")
+		}
+	})
+	t.Run("proof_of_funds", func(t *testing.T) {
+		utxos := []bip322.Utxo{
+			{TxHash: "6e9a0692ed4b3328909d66d41531854988dc39edba5df186affaefda91824e69", Vout: 1, Value: big.NewInt(50000)},
+			{TxHash: "b79d196740ad5217771c1098fc4a4b51e0535c32236c71f1ea4d61a2d603352b", Vout: 0, Value: big.NewInt(1000)},
+		}
+		for _, name := range []string{"p2wpkh", "p2tr", "p2sh_p2wsh"} {
+			signer := signers[name]
+			signature, err := signer.SignProofOfFunds("Hello World", utxos)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := bip322.VerifyProofOfFunds("Hello World", signer.Address, signature, utxos); err != nil {
+				t.Errorf("%s: %v", name, err)
+			}
+			if err := bip322.Verify("Hello World", signer.Address, signature); err == nil {
+				t.Errorf("%s: expected error for unexpected inputs", name)
+			}
+			changed := []bip322.Utxo{utxos[0], {TxHash: utxos[1].TxHash, Vout: 0, Value: big.NewInt(2000)}}
+			if err := bip322.VerifyProofOfFunds("Hello World", signer.Address, signature, changed); err == nil {
+				t.Errorf("%s: expected error for another utxo value", name)
+			}
+		}
+	})
+}
@@ -0,0 +1,135 @@
+package test
+
+import (
+	"math/big"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mrtnetwork/bitcoin/address"
+	"github.com/mrtnetwork/bitcoin/constant"
+	"github.com/mrtnetwork/bitcoin/keypair"
+	"github.com/mrtnetwork/bitcoin/provider"
+	"github.com/mrtnetwork/bitcoin/scripts"
+	"github.com/mrtnetwork/bitcoin/wallet"
+)
+
+func TestCoinControl(t *testing.T) {
+	network := address.TestnetNetwork
+	key, _ := keypair.NewECPrivateFromWIF("cTALNpTpRbbxTCJ2A5Vq88UxT44w1PE2cYqiB3n4hRvzyCev1Wwo")
+	segwit := key.GetPublic().ToSegwitAddress()
+	legacy := key.GetPublic().ToAddress()
+	owner := provider.UtxoOwnerDetails{PublicKey: key.GetPublic().ToHex(), Address: segwit}
+	coin := func(txByte string, value int64, metadata provider.CoinMetadata) provider.UtxoWithOwner {
+		return provider.UtxoWithOwner{
+			Utxo:         provider.BitcoinUtxo{TxHash: strings.Repeat(txByte, 32), Vout: 0, Value: big.NewInt(value), ScriptType: address.P2WPKH},
+			OwnerDetails: owner,
+			Metadata:     metadata,
+		}
+	}
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	utxos := provider.UtxoWithOwnerList{
+		coin("01", 50000, provider.CoinMetadata{}),
+		coin("02", 40000, provider.CoinMetadata{Frozen: true, Labels: []string{"kyc"}}),
+		coin("03", 30000, provider.CoinMetadata{ReservedUntil: now.Add(time.Hour), Labels: []string{"payout"}}),
+		coin("04", 20000, provider.CoinMetadata{Origin: "exchange", Labels: []string{"kyc"}}),
+		coin("05", 600, provider.CoinMetadata{}),
+	}
+
+	// the tiny output to the reused address is quarantined
+	if count := utxos.QuarantineDust(big.NewInt(provider.DustAttackThreshold), nil); count != 1 || !utxos[4].Metadata.Quarantined {
+		t.Errorf("Unexpected quarantine %d %+v", count, utxos[4].Metadata)
+	}
+	if count := (provider.UtxoWithOwnerList{coin("06", 600, provider.CoinMetadata{})}).QuarantineDust(big.NewInt(provider.DustAttackThreshold), nil); count != 0 {
+		t.Errorf("Expected an output to a fresh address to be kept")
+	}
+	reused := provider.UtxoWithOwnerList{coin("06", 600, provider.CoinMetadata{})}
+	if count := reused.QuarantineDust(big.NewInt(provider.DustAttackThreshold), func(script string) bool { return script == segwit.ToScriptPubKey().ToHex() }); count != 1 {
+		t.Errorf("Expected an output to an address of the history to be quarantined")
+	}
+
+	values := func(list provider.UtxoWithOwnerList) []int64 {
+		result := []int64{}
+		for _, utxo := range list {
+			result = append(result, utxo.Utxo.Value.Int64())
+		}
+		return result
+	}
+	for name, test := range map[string]struct {
+		control  provider.CoinControl
+		expected []int64
+	}{
+		"default":        {provider.CoinControl{Now: now}, []int64{50000, 20000}},
+		"expired":        {provider.CoinControl{Now: now.Add(2 * time.Hour)}, []int64{50000, 30000, 20000}},
+		"include":        {provider.CoinControl{Now: now, IncludeFrozen: true, IncludeReserved: true, IncludeQuarantined: true}, []int64{50000, 40000, 30000, 20000, 600}},
+		"labels":         {provider.CoinControl{Now: now, IncludeFrozen: true, Labels: []string{"kyc"}}, []int64{40000, 20000}},
+		"exclude labels": {provider.CoinControl{Now: now, ExcludeLabels: []string{"kyc"}}, []int64{50000}},
+		"origins":        {provider.CoinControl{Now: now, Origins: []string{"exchange"}}, []int64{20000}},
+		"exclude origin": {provider.CoinControl{Now: now, ExcludeOrigins: []string{"exchange"}}, []int64{50000}},
+	} {
+		if selected := values(utxos.Select(test.control)); len(selected) != len(test.expected) || (len(selected) > 0 && selected[0] != test.expected[0]) || (len(selected) > 1 && selected[len(selected)-1] != test.expected[len(test.expected)-1]) {
+			t.Errorf("%s: unexpected selection %v", name, selected)
+		}
+	}
+
+	// the builder never spends the coins kept by coin control
+	sign := func(trDigest []byte, utxo provider.UtxoWithOwner, publicKey string) (string, error) {
+		return key.SingInput(trDigest, constant.SIGHASH_ALL), nil
+	}
+	builder := provider.NewBitcoinTransactionBuilder(utxos, []provider.BitcoinOutputDetails{{Address: legacy, Value: big.NewInt(69000)}},
+		big.NewInt(1000), &network, "", true)
+	builder.CoinControl = provider.CoinControl{Now: now}
+	tx, err := builder.BuildTransaction(sign)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tx.Inputs) != 2 || tx.Inputs[0].TxID != strings.Repeat("01", 32) || tx.Inputs[1].TxID != strings.Repeat("04", 32) {
+		t.Errorf("Unexpected inputs %v", tx.Inputs)
+	}
+	builder.OutPuts[0].Value = big.NewInt(139600)
+	if _, err := builder.BuildTransaction(sign); err == nil || !strings.Contains(err.Error(), "coin control") {
+		t.Errorf("Expected the excluded coins to be reported, got %v", err)
+	}
+	builder.CoinControl = provider.CoinControl{Now: now, IncludeFrozen: true, IncludeReserved: true, IncludeQuarantined: true}
+	if tx, err := builder.BuildTransaction(sign); err != nil || len(tx.Inputs) != 5 {
+		t.Errorf("Expected every coin to be spent %v", err)
+	}
+	builder.CoinControl = provider.CoinControl{Now: now, Labels: []string{"none"}}
+	if _, err := builder.BuildTransaction(sign); err == nil {
+		t.Errorf("Expected an error without spendable coin")
+	}
+
+	// the wallet quarantines dust to reused addresses as it arrives and keeps the metadata
+	store, _ := wallet.NewUtxoStore(wallet.NewMemoryStorage())
+	store.Track(owner)
+	external := strings.Repeat("aa", 32)
+	deposit := unsignedTx([]wallet.Outpoint{{TxId: external, Vout: 0}}, map[*scripts.Script]int64{segwit.ToScriptPubKey(): 50000})
+	dust := unsignedTx([]wallet.Outpoint{{TxId: external, Vout: 1}}, map[*scripts.Script]int64{segwit.ToScriptPubKey(): 546})
+	store.AddTransaction(deposit)
+	store.AddTransaction(dust)
+	if utxo, _ := store.Utxo(wallet.Outpoint{TxId: dust.TxId()}); !utxo.Metadata.Quarantined {
+		t.Errorf("Expected the dust to be quarantined")
+	}
+	if utxo, _ := store.Utxo(wallet.Outpoint{TxId: deposit.TxId()}); utxo.Metadata.Quarantined {
+		t.Errorf("Expected the deposit to be spendable")
+	}
+	if err := store.SetMetadata(wallet.Outpoint{TxId: deposit.TxId()}, provider.CoinMetadata{Frozen: true, Labels: []string{"kyc"}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.SetMetadata(wallet.Outpoint{TxId: external}, provider.CoinMetadata{}); err == nil {
+		t.Errorf("Expected an error for an unknown output")
+	}
+	spendable := store.Spendable(0)
+	if len(spendable) != 2 || len(spendable.Select(provider.CoinControl{})) != 0 {
+		t.Errorf("Expected the frozen and quarantined coins to be kept %v", spendable)
+	}
+	if selected := spendable.Select(provider.CoinControl{IncludeFrozen: true, Labels: []string{"kyc"}}); len(selected) != 1 || selected[0].Utxo.TxHash != deposit.TxId() {
+		t.Errorf("Unexpected selection %v", selected)
+	}
+	// the small change of a transaction of the wallet is not a dust attack
+	change := unsignedTx([]wallet.Outpoint{{TxId: deposit.TxId(), Vout: 0}}, map[*scripts.Script]int64{segwit.ToScriptPubKey(): 800})
+	store.AddTransaction(change)
+	if utxo, _ := store.Utxo(wallet.Outpoint{TxId: change.TxId()}); utxo.Metadata.Quarantined {
+		t.Errorf("Expected the change to be spendable")
+	}
+}
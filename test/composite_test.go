@@ -0,0 +1,267 @@
+package test
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mrtnetwork/bitcoin/address"
+	"github.com/mrtnetwork/bitcoin/provider"
+	"github.com/mrtnetwork/bitcoin/scripts"
+)
+
+// stubProvider is a ChainProvider answering from functions and counting its requests
+type stubProvider struct {
+	mu       sync.Mutex
+	requests int
+
+	utxos     func() (provider.UtxoWithOwnerList, error)
+	height    func() (int, error)
+	broadcast func(raw string) (string, error)
+	history   func(cursor string) (*provider.TransactionPage, error)
+}
+
+func (s *stubProvider) count() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.requests
+}
+
+func (s *stubProvider) request() {
+	s.mu.Lock()
+	s.requests++
+	s.mu.Unlock()
+}
+
+func (s *stubProvider) GetAccountUtxo(ctx context.Context, owner provider.UtxoOwnerDetails) (provider.UtxoWithOwnerList, error) {
+	s.request()
+	return s.utxos()
+}
+
+func (s *stubProvider) GetTransaction(ctx context.Context, transactionId string) (*provider.ChainTransaction, error) {
+	s.request()
+	return nil, provider.ErrNotFound
+}
+
+func (s *stubProvider) GetAccountTransactions(ctx context.Context, addr address.BitcoinAddress, cursor string) (*provider.TransactionPage, error) {
+	s.request()
+	return s.history(cursor)
+}
+
+func (s *stubProvider) GetNetworkFee(ctx context.Context) (*provider.BitcoinFeeRate, error) {
+	s.request()
+	return nil, provider.ErrNotSupported
+}
+
+func (s *stubProvider) SendRawTransaction(ctx context.Context, rawTransaction string) (string, error) {
+	s.request()
+	return s.broadcast(rawTransaction)
+}
+
+func (s *stubProvider) GetBlockHeight(ctx context.Context) (int, error) {
+	s.request()
+	return s.height()
+}
+
+func TestCompositeProvider(t *testing.T) {
+	ctx := context.Background()
+	unavailable := &provider.APIError{StatusCode: 502, Err: provider.ErrUnavailable}
+	rateLimited := &provider.APIError{StatusCode: 429, Err: provider.ErrRateLimited, RetryAfter: 20 * time.Millisecond}
+	fast := func(composite *provider.CompositeProvider) *provider.CompositeProvider {
+		composite.BaseDelay, composite.MaxDelay = time.Millisecond, 50*time.Millisecond
+		return composite
+	}
+	utxo := func(id string, value int64) provider.UtxoWithOwner {
+		return provider.UtxoWithOwner{Utxo: provider.BitcoinUtxo{TxHash: id, Value: big.NewInt(value)}}
+	}
+
+	t.Run("failover", func(t *testing.T) {
+		down := &stubProvider{height: func() (int, error) { return 0, unavailable }}
+		up := &stubProvider{height: func() (int, error) { return 100, nil }}
+		composite := fast(provider.NewCompositeProvider(down, up))
+		for i := 0; i < 5; i++ {
+			if height, err := composite.GetBlockHeight(ctx); err != nil || height != 100 {
+				t.Fatalf("Unexpected height %v %v", height, err)
+			}
+		}
+		// the failing backend is skipped once unhealthy
+		if down.count() != 3 || up.count() != 5 {
+			t.Errorf("Unexpected requests %d %d", down.count(), up.count())
+		}
+		status := composite.Status()
+		if status[0].Healthy || status[0].Failures != 3 || !errors.Is(status[0].LastError, provider.ErrUnavailable) || !status[1].Healthy {
+			t.Errorf("Unexpected status %+v", status)
+		}
+	})
+
+	t.Run("retry", func(t *testing.T) {
+		attempts := 0
+		limited := &stubProvider{height: func() (int, error) {
+			if attempts++; attempts < 3 {
+				return 0, rateLimited
+			}
+			return 7, nil
+		}}
+		composite := fast(provider.NewCompositeProvider(limited))
+		start := time.Now()
+		if height, err := composite.GetBlockHeight(ctx); err != nil || height != 7 {
+			t.Fatalf("Unexpected height %v %v", height, err)
+		}
+		if elapsed := time.Since(start); elapsed < 40*time.Millisecond {
+			t.Errorf("Expected the Retry-After delay to be respected, retried after %v", elapsed)
+		}
+
+		broken := &stubProvider{height: func() (int, error) { return 0, unavailable }}
+		composite = fast(provider.NewCompositeProvider(broken))
+		composite.MaxRetries = 2
+		if _, err := composite.GetBlockHeight(ctx); !errors.Is(err, provider.ErrUnavailable) || broken.count() != 3 {
+			t.Errorf("Expected ErrUnavailable after 3 attempts, got %v after %d", err, broken.count())
+		}
+
+		cancelled, cancel := context.WithCancel(ctx)
+		composite.BaseDelay = time.Second
+		time.AfterFunc(10*time.Millisecond, cancel)
+		if _, err := composite.GetBlockHeight(cancelled); !errors.Is(err, context.Canceled) {
+			t.Errorf("Expected context.Canceled, got %v", err)
+		}
+	})
+
+	t.Run("answers", func(t *testing.T) {
+		first, second := &stubProvider{}, &stubProvider{}
+		composite := fast(provider.NewCompositeProvider(first, second))
+		if _, err := composite.GetTransaction(ctx, "unknown"); !errors.Is(err, provider.ErrNotFound) {
+			t.Errorf("Expected ErrNotFound, got %v", err)
+		}
+		// an answer is not retried and does not affect the health
+		if first.count() != 1 || second.count() != 1 || !composite.Status()[0].Healthy {
+			t.Errorf("Unexpected requests %d %d", first.count(), second.count())
+		}
+	})
+
+	t.Run("quorum", func(t *testing.T) {
+		same := func() (provider.UtxoWithOwnerList, error) {
+			return provider.UtxoWithOwnerList{utxo("a", 1000), utxo("b", 500)}, nil
+		}
+		reordered := func() (provider.UtxoWithOwnerList, error) {
+			return provider.UtxoWithOwnerList{utxo("b", 500), utxo("a", 1000)}, nil
+		}
+		different := func() (provider.UtxoWithOwnerList, error) {
+			return provider.UtxoWithOwnerList{utxo("a", 1000)}, nil
+		}
+		failing := func() (provider.UtxoWithOwnerList, error) { return nil, unavailable }
+
+		composite := fast(provider.NewCompositeProvider(&stubProvider{utxos: same}, &stubProvider{utxos: reordered}))
+		composite.Quorum = 2
+		balance, err := composite.GetBalance(ctx, provider.UtxoOwnerDetails{})
+		if err != nil || balance.Int64() != 1500 {
+			t.Errorf("Unexpected balance %v %v", balance, err)
+		}
+
+		composite = fast(provider.NewCompositeProvider(&stubProvider{utxos: same}, &stubProvider{utxos: different}))
+		composite.Quorum = 2
+		if _, err := composite.GetAccountUtxo(ctx, provider.UtxoOwnerDetails{}); !errors.Is(err, provider.ErrNoQuorum) {
+			t.Errorf("Expected ErrNoQuorum, got %v", err)
+		}
+
+		// a failing backend is replaced by the next one
+		composite = fast(provider.NewCompositeProvider(&stubProvider{utxos: failing}, &stubProvider{utxos: same}, &stubProvider{utxos: reordered}))
+		composite.Quorum, composite.MaxRetries = 2, 1
+		if utxos, err := composite.GetAccountUtxo(ctx, provider.UtxoOwnerDetails{}); err != nil || len(utxos) != 2 {
+			t.Errorf("Unexpected utxos %v %v", utxos, err)
+		}
+		composite.Quorum = 3
+		if _, err := composite.GetAccountUtxo(ctx, provider.UtxoOwnerDetails{}); !errors.Is(err, provider.ErrUnavailable) {
+			t.Errorf("Expected ErrUnavailable without quorum, got %v", err)
+		}
+
+		// a stale backend, the healthiest one, is outvoted by the others agreeing
+		composite = fast(provider.NewCompositeProvider(&stubProvider{utxos: different}, &stubProvider{utxos: same}, &stubProvider{utxos: reordered}))
+		composite.Quorum = 2
+		if utxos, err := composite.GetAccountUtxo(ctx, provider.UtxoOwnerDetails{}); err != nil || len(utxos) != 2 {
+			t.Errorf("Unexpected utxos %v %v", utxos, err)
+		}
+
+		// the answer does not wait for a slow backend once the quorum is reached
+		release := make(chan struct{})
+		defer close(release)
+		slow := func() (provider.UtxoWithOwnerList, error) {
+			<-release
+			return nil, unavailable
+		}
+		composite = fast(provider.NewCompositeProvider(&stubProvider{utxos: slow}, &stubProvider{utxos: same}, &stubProvider{utxos: reordered}))
+		composite.Quorum = 2
+		done := make(chan error, 1)
+		go func() {
+			_, err := composite.GetAccountUtxo(ctx, provider.UtxoOwnerDetails{})
+			done <- err
+		}()
+		select {
+		case err := <-done:
+			if err != nil {
+				t.Errorf("Unexpected error %v", err)
+			}
+		case <-time.After(5 * time.Second):
+			t.Errorf("Expected the quorum without the slow backend")
+		}
+	})
+
+	t.Run("broadcast", func(t *testing.T) {
+		raw := "0200000001" + "6e9a0692ed4b3328909d66d41531854988dc39edba5df186affaefda91824e69" + "0000000000fdffffff0100000000000000000000000000"
+		accepted := &stubProvider{broadcast: func(raw string) (string, error) { return "txid", nil }}
+		known := &stubProvider{broadcast: func(raw string) (string, error) {
+			return "", &provider.APIError{StatusCode: 400, Err: provider.ErrRejected, Message: `sendrawtransaction RPC error: {"code":-27,"message":"Transaction already in block chain"}`}
+		}}
+		rejected := &stubProvider{broadcast: func(raw string) (string, error) {
+			return "", &provider.APIError{StatusCode: 400, Err: provider.ErrRejected, Message: "bad-txns-inputs-missingorspent"}
+		}}
+		down := &stubProvider{broadcast: func(raw string) (string, error) { return "", unavailable }}
+
+		composite := fast(provider.NewCompositeProvider(known, accepted, down))
+		if id, err := composite.SendRawTransaction(ctx, raw); err != nil || id != "txid" {
+			t.Errorf("Unexpected broadcast result %v %v", id, err)
+		}
+		if known.count() != 1 || accepted.count() != 1 || down.count() != 4 {
+			t.Errorf("Expected the transaction to be sent to every backend %d %d %d", known.count(), accepted.count(), down.count())
+		}
+
+		composite = fast(provider.NewCompositeProvider(known, rejected))
+		tx, _ := scripts.BtcTransactionFromRaw(raw)
+		if id, err := composite.SendRawTransaction(ctx, raw); err != nil || id != tx.TxId() {
+			t.Errorf("Expected the id of an already known transaction, got %v %v", id, err)
+		}
+
+		composite = fast(provider.NewCompositeProvider(rejected, down))
+		composite.MaxRetries = 0
+		if _, err := composite.SendRawTransaction(ctx, raw); !errors.Is(err, provider.ErrRejected) {
+			t.Errorf("Expected ErrRejected, got %v", err)
+		}
+	})
+
+	t.Run("pagination", func(t *testing.T) {
+		down := &stubProvider{history: func(cursor string) (*provider.TransactionPage, error) { return nil, unavailable }}
+		pages := &stubProvider{history: func(cursor string) (*provider.TransactionPage, error) {
+			if cursor == "" {
+				return &provider.TransactionPage{Transactions: []provider.ChainTransaction{{TxId: "a"}}, Next: "a"}, nil
+			}
+			if cursor != "a" {
+				t.Errorf("Unexpected backend cursor %s", cursor)
+			}
+			return &provider.TransactionPage{Transactions: []provider.ChainTransaction{{TxId: "b"}}}, nil
+		}}
+		composite := fast(provider.NewCompositeProvider(down, pages))
+		page, err := composite.GetAccountTransactions(ctx, nil, "")
+		if err != nil || page.Next == "" {
+			t.Fatalf("Unexpected page %+v %v", page, err)
+		}
+		page, err = composite.GetAccountTransactions(ctx, nil, page.Next)
+		if err != nil || page.Next != "" || page.Transactions[0].TxId != "b" {
+			t.Errorf("Unexpected page %+v %v", page, err)
+		}
+		if _, err := composite.GetAccountTransactions(ctx, nil, "9:a"); err == nil {
+			t.Errorf("Expected error for an invalid cursor")
+		}
+	})
+}
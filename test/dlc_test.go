@@ -0,0 +1,213 @@
+package test
+
+import (
+	"fmt"
+	"math/big"
+	"testing"
+
+	"github.com/mrtnetwork/bitcoin/address"
+	"github.com/mrtnetwork/bitcoin/constant"
+	"github.com/mrtnetwork/bitcoin/digest"
+	"github.com/mrtnetwork/bitcoin/dlc"
+	"github.com/mrtnetwork/bitcoin/ecc"
+	"github.com/mrtnetwork/bitcoin/formating"
+	"github.com/mrtnetwork/bitcoin/keypair"
+	"github.com/mrtnetwork/bitcoin/provider"
+)
+
+func TestDLC(t *testing.T) {
+	offerKey, _ := keypair.NewECPrivateFromWIF("cTALNpTpRbbxTCJ2A5Vq88UxT44w1PE2cYqiB3n4hRvzyCev1Wwo")
+	acceptKey, _ := keypair.NewECPrivateFromWIF("cRvyLwCPLU88jsyj94L7iJjQX5C2f8koG4G2gevN4BeSGcEvfKe9")
+	offer := dlc.Party{FundingPublicKey: offerKey.GetPublic().ToHex(), PayoutAddress: offerKey.GetPublic().ToSegwitAddress(), Collateral: big.NewInt(60000)}
+	accept := dlc.Party{FundingPublicKey: acceptKey.GetPublic().ToHex(), PayoutAddress: acceptKey.GetPublic().ToSegwitAddress(), Collateral: big.NewInt(40000)}
+	oracleSecret := digest.SingleHash([]byte("oracle"))
+	nonces := func(count int) [][]byte {
+		result := make([][]byte, count)
+		for i := range result {
+			result[i] = digest.SingleHash([]byte(fmt.Sprintf("nonce %d", i)))
+		}
+		return result
+	}
+	fee := big.NewInt(1000)
+
+	// fund builds the funding transaction from one P2WPKH UTXO of each party
+	fund := func(contract *dlc.Contract) {
+		utxos := []provider.UtxoWithOwner{}
+		for _, key := range []*keypair.ECPrivate{offerKey, acceptKey} {
+			utxos = append(utxos, provider.UtxoWithOwner{
+				Utxo: provider.BitcoinUtxo{
+					TxHash:     "6e9a0692ed4b3328909d66d41531854988dc39edba5df186affaefda91824e69",
+					Value:      big.NewInt(60000),
+					Vout:       len(utxos),
+					ScriptType: address.P2WPKH,
+				},
+				OwnerDetails: provider.UtxoOwnerDetails{PublicKey: key.GetPublic().ToHex(), Address: key.GetPublic().ToSegwitAddress()},
+			})
+		}
+		builder := provider.NewBitcoinTransactionBuilder(utxos, []provider.BitcoinOutputDetails{
+			{Address: contract.FundingAddress, Value: contract.FundingAmount()},
+			{Address: acceptKey.GetPublic().ToSegwitAddress(), Value: big.NewInt(19000)},
+		}, big.NewInt(1000), &address.TestnetNetwork, "", false)
+		tx, err := builder.BuildTransaction(func(trDigest []byte, utxo provider.UtxoWithOwner, publicKey string) (string, error) {
+			if utxo.OwnerDetails.PublicKey == offerKey.GetPublic().ToHex() {
+				return offerKey.SingInput(trDigest, constant.SIGHASH_ALL), nil
+			}
+			return acceptKey.SingInput(trDigest, constant.SIGHASH_ALL), nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		contract.SetFundingOutpoint(tx.TxId(), 0)
+	}
+	// exchange runs the signature exchange and returns the CET signatures of the offer party
+	exchange := func(contract *dlc.Contract) []string {
+		offerSignatures, err := contract.SignCets(offerKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+		acceptSignatures, err := contract.SignCets(acceptKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := contract.VerifyCetSignatures(offerKey.GetPublic().ToHex(), offerSignatures); err != nil {
+			t.Error(err)
+		}
+		if err := contract.VerifyCetSignatures(offerKey.GetPublic().ToHex(), acceptSignatures); err == nil {
+			t.Errorf("Expected error for signatures of the other party")
+		}
+		return offerSignatures
+	}
+	// checkWitness verifies both signatures of a transaction spending the funding output
+	checkWitness := func(contract *dlc.Contract, witness []string, digest []byte) {
+		if len(witness) != 4 || witness[0] != "" {
+			t.Fatalf("Unexpected witness %v", witness)
+		}
+		script := contract.FundingScript.Script
+		for i := 0; i < 2; i++ {
+			if !ecc.VerifyDER(digest, formating.HexToBytes(script[i+1].(string)), formating.HexToBytes(witness[i+1])) {
+				t.Errorf("Invalid funding signature %d", i)
+			}
+		}
+	}
+
+	t.Run("enumerated", func(t *testing.T) {
+		oracle, err := dlc.NewOracleAnnouncement(oracleSecret, nonces(1))
+		if err != nil {
+			t.Fatal(err)
+		}
+		contract, err := dlc.NewEnumeratedContract(offer, accept, oracle, []dlc.EnumeratedOutcome{
+			{Outcome: "home", OfferPayout: big.NewInt(100000)},
+			{Outcome: "draw", OfferPayout: big.NewInt(60000)},
+			{Outcome: "away", OfferPayout: big.NewInt(0)},
+		}, 800000, fee)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := contract.CetTransaction(0); err == nil {
+			t.Errorf("Expected error before the funding outpoint is set")
+		}
+		fund(contract)
+		signatures := exchange(contract)
+
+		attestation, _ := dlc.Attest(oracleSecret, nonces(1), []string{"draw"})
+		if err := oracle.VerifyAttestation(attestation); err != nil {
+			t.Fatal(err)
+		}
+		forged, _ := dlc.Attest(digest.SingleHash([]byte("other oracle")), nonces(1), []string{"away"})
+		if _, err := contract.Close(forged, acceptKey, signatures); err == nil {
+			t.Errorf("Expected error for an attestation of another oracle")
+		}
+		tx, err := contract.Close(attestation, acceptKey, signatures)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(tx.Outputs) != 2 || tx.Outputs[0].Amount.Int64() != 59500 || tx.Outputs[1].Amount.Int64() != 39500 {
+			t.Errorf("Unexpected CET outputs")
+		}
+		checkWitness(contract, tx.Witnesses[0].Stack, tx.GetTransactionSegwitDigit(0, contract.FundingScript, contract.FundingAmount()))
+
+		// the winner takes everything minus the whole fee
+		home, _ := dlc.Attest(oracleSecret, nonces(1), []string{"home"})
+		tx, err = contract.Close(home, acceptKey, signatures)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(tx.Outputs) != 1 || tx.Outputs[0].Amount.Int64() != 99000 {
+			t.Errorf("Unexpected CET outputs")
+		}
+	})
+	t.Run("numeric", func(t *testing.T) {
+		oracle, err := dlc.NewOracleAnnouncement(oracleSecret, nonces(4))
+		if err != nil {
+			t.Fatal(err)
+		}
+		ranges := []dlc.NumericRange{
+			{Start: 0, End: 4, OfferPayout: big.NewInt(0)},
+			{Start: 5, End: 10, OfferPayout: big.NewInt(50000)},
+			{Start: 11, End: 15, OfferPayout: big.NewInt(100000)},
+		}
+		contract, err := dlc.NewNumericContract(offer, accept, oracle, ranges, 800000, fee)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// 0-4: 00**, 0100; 5-10: 0101, 011*, 100*, 1010; 11-15: 1011, 11**
+		if len(contract.Cets) != 8 {
+			t.Errorf("Expected 8 CETs, got %d", len(contract.Cets))
+		}
+		if _, err := dlc.NewNumericContract(offer, accept, oracle, ranges[:2], 800000, fee); err == nil {
+			t.Errorf("Expected error for ranges that do not cover every value")
+		}
+		fund(contract)
+		signatures := exchange(contract)
+		for value, expected := range map[int]int64{3: 0, 7: 49500, 12: 99000} {
+			outcomes, _ := dlc.NumericOutcomes(value, 4)
+			attestation, _ := dlc.Attest(oracleSecret, nonces(4), outcomes)
+			if _, err := contract.Close(attestation, acceptKey, signatures[1:]); err == nil {
+				t.Errorf("Expected error for missing CET signatures")
+			}
+			tx, err := contract.Close(attestation, acceptKey, signatures)
+			if err != nil {
+				t.Fatal(err)
+			}
+			offerAmount := int64(0)
+			for _, out := range tx.Outputs {
+				if out.ScriptPubKey.ToHex() == offer.PayoutAddress.ToScriptPubKey().ToHex() {
+					offerAmount = out.Amount.Int64()
+				}
+			}
+			if offerAmount != expected {
+				t.Errorf("Value %d: expected offer payout %d, got %d", value, expected, offerAmount)
+			}
+			checkWitness(contract, tx.Witnesses[0].Stack, tx.GetTransactionSegwitDigit(0, contract.FundingScript, contract.FundingAmount()))
+		}
+	})
+	t.Run("refund", func(t *testing.T) {
+		oracle, _ := dlc.NewOracleAnnouncement(oracleSecret, nonces(1))
+		contract, err := dlc.NewEnumeratedContract(offer, accept, oracle, []dlc.EnumeratedOutcome{
+			{Outcome: "yes", OfferPayout: big.NewInt(100000)},
+			{Outcome: "no", OfferPayout: big.NewInt(0)},
+		}, 800000, fee)
+		if err != nil {
+			t.Fatal(err)
+		}
+		fund(contract)
+		acceptSignature, err := contract.SignRefund(acceptKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := contract.Refund(offerKey, offerKey.SingInput(make([]byte, 32), constant.SIGHASH_ALL)); err == nil {
+			t.Errorf("Expected error for invalid refund signature")
+		}
+		tx, err := contract.Refund(offerKey, acceptSignature)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if formating.BytesToHex(tx.Locktime) != formating.BytesToHex(formating.PackUint32LE(800000)) {
+			t.Errorf("Unexpected refund lock time")
+		}
+		if tx.Outputs[0].Amount.Int64() != 59500 || tx.Outputs[1].Amount.Int64() != 39500 {
+			t.Errorf("Unexpected refund outputs")
+		}
+		checkWitness(contract, tx.Witnesses[0].Stack, tx.GetTransactionSegwitDigit(0, contract.FundingScript, contract.FundingAmount()))
+	})
+}
@@ -0,0 +1,397 @@
+package test
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mrtnetwork/bitcoin/address"
+	"github.com/mrtnetwork/bitcoin/constant"
+	"github.com/mrtnetwork/bitcoin/keypair"
+	"github.com/mrtnetwork/bitcoin/provider"
+	"github.com/mrtnetwork/bitcoin/scripts"
+)
+
+// electrumHandler answers an Electrum request with a result or an error
+type electrumHandler func(params []json.RawMessage) (interface{}, *provider.ElectrumError)
+
+// fakeElectrum is a local Electrum server. The responses are sent from concurrent goroutines
+// after a delay decreasing with the id, so pipelined requests are answered out of order.
+type fakeElectrum struct {
+	listener net.Listener
+	handlers map[string]electrumHandler
+
+	mu       sync.Mutex
+	conns    []*fakeElectrumConn
+	inFlight int
+	peak     int
+}
+
+type fakeElectrumConn struct {
+	conn net.Conn
+	mu   sync.Mutex
+}
+
+func (c *fakeElectrumConn) send(message interface{}) {
+	data, _ := json.Marshal(message)
+	c.mu.Lock()
+	c.conn.Write(append(data, '\n'))
+	c.mu.Unlock()
+}
+
+func newFakeElectrum(t *testing.T, listener net.Listener, handlers map[string]electrumHandler) *fakeElectrum {
+	server := &fakeElectrum{listener: listener, handlers: handlers}
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			client := &fakeElectrumConn{conn: conn}
+			server.mu.Lock()
+			server.conns = append(server.conns, client)
+			server.mu.Unlock()
+			go server.serve(client)
+		}
+	}()
+	t.Cleanup(server.close)
+	return server
+}
+
+func (s *fakeElectrum) serve(client *fakeElectrumConn) {
+	reader := bufio.NewReader(client.conn)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if err != nil {
+			return
+		}
+		var request struct {
+			Id     int               `json:"id"`
+			Method string            `json:"method"`
+			Params []json.RawMessage `json:"params"`
+		}
+		if json.Unmarshal(line, &request) != nil {
+			continue
+		}
+		s.mu.Lock()
+		s.inFlight++
+		if s.inFlight > s.peak {
+			s.peak = s.inFlight
+		}
+		s.mu.Unlock()
+		go func() {
+			time.Sleep(time.Duration(10-request.Id%10) * time.Millisecond)
+			response := map[string]interface{}{"jsonrpc": "2.0", "id": request.Id}
+			if handler, ok := s.handlers[request.Method]; !ok {
+				response["error"] = provider.ElectrumError{Code: -32601, Message: "unknown method " + request.Method}
+			} else if result, err := handler(request.Params); err != nil {
+				response["error"] = err
+			} else {
+				response["result"] = result
+			}
+			s.mu.Lock()
+			s.inFlight--
+			s.mu.Unlock()
+			client.send(response)
+		}()
+	}
+}
+
+// notify sends a notification to every connection
+func (s *fakeElectrum) notify(method string, params ...interface{}) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, client := range s.conns {
+		client.send(map[string]interface{}{"jsonrpc": "2.0", "method": method, "params": params})
+	}
+}
+
+func (s *fakeElectrum) close() {
+	s.listener.Close()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, client := range s.conns {
+		client.conn.Close()
+	}
+}
+
+func TestElectrumProvider(t *testing.T) {
+	network := address.TestnetNetwork
+	ctx := context.Background()
+	key, _ := keypair.NewECPrivateFromWIF("cTALNpTpRbbxTCJ2A5Vq88UxT44w1PE2cYqiB3n4hRvzyCev1Wwo")
+	addr := key.GetPublic().ToSegwitAddress()
+	receiver := key.GetPublic().ToAddress()
+	genesisHeader := genesisBlock[:160]
+
+	parent := scripts.NewBtcTransaction([]*scripts.TxInput{scripts.NewTxInput(strings.Repeat("11", 32), 0)},
+		[]*scripts.TxOutput{scripts.NewTxOutput(big.NewInt(101000), receiver.ToScriptPubKey())}, false)
+	funding := scripts.NewBtcTransaction([]*scripts.TxInput{scripts.NewTxInput(parent.TxId(), 0)},
+		[]*scripts.TxOutput{scripts.NewTxOutput(big.NewInt(100000), addr.ToScriptPubKey())}, false)
+	builder := provider.NewBitcoinTransactionBuilder([]provider.UtxoWithOwner{{
+		Utxo:         provider.BitcoinUtxo{TxHash: funding.TxId(), Vout: 0, Value: big.NewInt(100000), ScriptType: address.P2WPKH},
+		OwnerDetails: provider.UtxoOwnerDetails{PublicKey: key.GetPublic().ToHex(), Address: addr},
+	}}, []provider.BitcoinOutputDetails{{Address: receiver, Value: big.NewInt(99000)}}, big.NewInt(1000), &network, "", false)
+	spending, err := builder.BuildTransaction(func(trDigest []byte, utxo provider.UtxoWithOwner, publicKey string) (string, error) {
+		return key.SingInput(trDigest, constant.SIGHASH_ALL), nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	transactions := map[string]string{parent.TxId(): parent.Serialize(), funding.TxId(): funding.Serialize(), spending.TxId(): spending.Serialize()}
+	histories := map[string][]map[string]interface{}{
+		provider.ElectrumScriptHash(addr):     {{"tx_hash": funding.TxId(), "height": 110}, {"tx_hash": spending.TxId(), "height": 111}},
+		provider.ElectrumScriptHash(receiver): {{"tx_hash": spending.TxId(), "height": 111}},
+	}
+
+	stringParam := func(param json.RawMessage) string {
+		var value string
+		json.Unmarshal(param, &value)
+		return value
+	}
+	handlers := map[string]electrumHandler{
+		"server.version": func(params []json.RawMessage) (interface{}, *provider.ElectrumError) {
+			return []string{"fake 1.0", "1.4"}, nil
+		},
+		"blockchain.scripthash.get_history": func(params []json.RawMessage) (interface{}, *provider.ElectrumError) {
+			return histories[stringParam(params[0])], nil
+		},
+		"blockchain.scripthash.listunspent": func(params []json.RawMessage) (interface{}, *provider.ElectrumError) {
+			if stringParam(params[0]) != provider.ElectrumScriptHash(receiver) {
+				return []interface{}{}, nil
+			}
+			return []interface{}{map[string]interface{}{"tx_hash": spending.TxId(), "tx_pos": 0, "height": 111, "value": 99000}}, nil
+		},
+		"blockchain.scripthash.get_balance": func(params []json.RawMessage) (interface{}, *provider.ElectrumError) {
+			return map[string]interface{}{"confirmed": 99000, "unconfirmed": -500}, nil
+		},
+		"blockchain.scripthash.subscribe": func(params []json.RawMessage) (interface{}, *provider.ElectrumError) {
+			if _, ok := histories[stringParam(params[0])]; !ok {
+				return nil, nil
+			}
+			return "status0", nil
+		},
+		"blockchain.headers.subscribe": func(params []json.RawMessage) (interface{}, *provider.ElectrumError) {
+			return map[string]interface{}{"hex": genesisHeader, "height": 111}, nil
+		},
+		"blockchain.block.header": func(params []json.RawMessage) (interface{}, *provider.ElectrumError) {
+			return genesisHeader, nil
+		},
+		"blockchain.transaction.get": func(params []json.RawMessage) (interface{}, *provider.ElectrumError) {
+			raw, ok := transactions[stringParam(params[0])]
+			if !ok {
+				return nil, &provider.ElectrumError{Code: 2, Message: "daemon error: No such mempool or blockchain transaction"}
+			}
+			return raw, nil
+		},
+		"blockchain.transaction.broadcast": func(params []json.RawMessage) (interface{}, *provider.ElectrumError) {
+			tx, err := scripts.BtcTransactionFromRaw(stringParam(params[0]))
+			if err != nil {
+				return nil, &provider.ElectrumError{Code: 1, Message: "the transaction was rejected by network rules"}
+			}
+			return tx.TxId(), nil
+		},
+		"blockchain.transaction.get_merkle": func(params []json.RawMessage) (interface{}, *provider.ElectrumError) {
+			return map[string]interface{}{"block_height": 111, "merkle": []string{strings.Repeat("22", 32)}, "pos": 1}, nil
+		},
+		"blockchain.estimatefee": func(params []json.RawMessage) (interface{}, *provider.ElectrumError) {
+			// doubles not a whole number of satoshis are rounded
+			fees := map[string]interface{}{"2": 0.0002, "3": json.RawMessage("1.0000000000000001e-05"), "6": 0.0001, "12": json.RawMessage("0.000123456789"), "144": -1}
+			if _, ok := fees[string(params[0])]; !ok {
+				return -1, nil
+			}
+			return fees[string(params[0])], nil
+		},
+	}
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := newFakeElectrum(t, listener, handlers)
+
+	api, err := provider.DialElectrum(ctx, listener.Addr().String(), &network, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer api.Close()
+
+	t.Run("scripthash", func(t *testing.T) {
+		genesis, _ := address.P2PKHAddressFromAddress("1A1zP1eP5QGefi2DMPTfTL5SLmv7DivfNa", &address.MainnetNetwork)
+		if hash := provider.ElectrumScriptHash(genesis); hash != "8b01df4e368ea28f8dc0423bcf7a4923e3a12d307c875e47a0cfbf90b5c39161" {
+			t.Errorf("Unexpected script hash %s", hash)
+		}
+	})
+
+	t.Run("pipelining", func(t *testing.T) {
+		var wg sync.WaitGroup
+		errs := make([]error, 10)
+		for i := range errs {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				scriptHash := provider.ElectrumScriptHash(addr)
+				if i%2 == 1 {
+					scriptHash = provider.ElectrumScriptHash(receiver)
+				}
+				history, err := api.GetHistory(ctx, scriptHash)
+				if err == nil && len(history) != len(histories[scriptHash]) {
+					err = errors.New("response of another request")
+				}
+				errs[i] = err
+			}(i)
+		}
+		wg.Wait()
+		for _, err := range errs {
+			if err != nil {
+				t.Error(err)
+			}
+		}
+		server.mu.Lock()
+		defer server.mu.Unlock()
+		if server.peak < 2 {
+			t.Errorf("Expected pipelined requests, peak %d", server.peak)
+		}
+	})
+
+	t.Run("queries", func(t *testing.T) {
+		utxos, err := api.GetAccountUtxo(ctx, provider.UtxoOwnerDetails{Address: receiver})
+		if err != nil || len(utxos) != 1 || utxos[0].Utxo.Value.Int64() != 99000 || utxos[0].Utxo.ScriptType != address.P2PKH {
+			t.Errorf("Unexpected utxos %+v %v", utxos, err)
+		}
+		balance, err := api.GetBalance(ctx, provider.ElectrumScriptHash(receiver))
+		if err != nil || balance.Confirmed.Int64() != 99000 || balance.Unconfirmed.Int64() != -500 {
+			t.Errorf("Unexpected balance %+v %v", balance, err)
+		}
+		merkle, err := api.GetMerkle(ctx, spending.TxId(), 111)
+		if err != nil || merkle.BlockHeight != 111 || len(merkle.Merkle) != 1 || merkle.Pos != 1 {
+			t.Errorf("Unexpected merkle proof %+v %v", merkle, err)
+		}
+		if fee, err := api.EstimateFee(ctx, 6); err != nil || fee.SatPerKvB() != 10000 {
+			t.Errorf("Unexpected fee %v %v", fee, err)
+		}
+		if _, err := api.GetNetworkFee(ctx); err == nil {
+			t.Errorf("Expected error without estimation for 144 blocks")
+		}
+		if estimates, err := api.GetFeeEstimates(ctx); err != nil || len(estimates) != 4 || estimates[2] != 20000 || estimates[3] != 1000 || estimates[6] != 10000 || estimates[12] != 12346 {
+			t.Errorf("Unexpected estimates %v %v", estimates, err)
+		}
+		if height, err := api.GetBlockHeight(ctx); err != nil || height != 111 {
+			t.Errorf("Unexpected height %v %v", height, err)
+		}
+	})
+
+	t.Run("transactions", func(t *testing.T) {
+		tx, err := api.GetTransaction(ctx, spending.TxId())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if tx.TxId != spending.TxId() || tx.Fee.Int64() != 1000 || tx.Inputs[0].Value.Int64() != 100000 || len(tx.Inputs[0].Witness) != 2 ||
+			tx.Outputs[0].ScriptPubKey != receiver.ToScriptPubKey().ToHex() || tx.Size != len(spending.ToBytes(true)) || tx.VSize >= tx.Size {
+			t.Errorf("Unexpected transaction %+v", tx)
+		}
+		if !tx.Status.Confirmed || tx.Status.BlockHeight != 111 || tx.Status.BlockHash != genesisHash {
+			t.Errorf("Unexpected status %+v", tx.Status)
+		}
+		if _, err := api.GetRawTransaction(ctx, strings.Repeat("33", 32)); !errors.Is(err, provider.ErrNotFound) {
+			t.Errorf("Expected ErrNotFound, got %v", err)
+		}
+
+		page, err := api.GetAccountTransactions(ctx, addr, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(page.Transactions) != 2 || page.Next != "" || page.Transactions[0].TxId != spending.TxId() || page.Transactions[1].TxId != funding.TxId() || page.Transactions[1].Fee.Int64() != 1000 {
+			t.Errorf("Unexpected page %+v", page)
+		}
+
+		if id, err := api.SendRawTransaction(ctx, spending.Serialize()); err != nil || id != spending.TxId() {
+			t.Errorf("Unexpected broadcast result %v %v", id, err)
+		}
+		if _, err := api.SendRawTransaction(ctx, "00"); !errors.Is(err, provider.ErrRejected) {
+			t.Errorf("Expected ErrRejected, got %v", err)
+		}
+	})
+
+	t.Run("subscriptions", func(t *testing.T) {
+		subscriber, err := provider.DialElectrum(ctx, listener.Addr().String(), &network, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		status, statuses, err := subscriber.SubscribeScriptHash(ctx, provider.ElectrumScriptHash(addr))
+		if err != nil || status != "status0" {
+			t.Fatalf("Unexpected status %v %v", status, err)
+		}
+		tip, headers, err := subscriber.SubscribeHeaders(ctx)
+		if err != nil || tip.Height != 111 || tip.Header.Height != 111 {
+			t.Fatalf("Unexpected tip %+v %v", tip, err)
+		}
+		server.notify("blockchain.scripthash.subscribe", provider.ElectrumScriptHash(addr), "status1")
+		server.notify("blockchain.scripthash.subscribe", provider.ElectrumScriptHash(receiver), "other")
+		server.notify("blockchain.headers.subscribe", map[string]interface{}{"hex": genesisHeader, "height": 112})
+		select {
+		case status := <-statuses:
+			if status != "status1" {
+				t.Errorf("Unexpected status %s", status)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("Expected a status notification")
+		}
+		select {
+		case header := <-headers:
+			if header.Height != 112 {
+				t.Errorf("Unexpected header %+v", header)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("Expected a header notification")
+		}
+		subscriber.Close()
+		<-subscriber.Done()
+		if _, ok := <-statuses; ok {
+			t.Errorf("Expected the channel to be closed")
+		}
+		if _, err := subscriber.GetBlockHeight(ctx); err == nil {
+			t.Errorf("Expected error on a closed connection")
+		}
+	})
+
+	t.Run("tls", func(t *testing.T) {
+		certificates := httptest.NewUnstartedServer(nil)
+		certificates.StartTLS()
+		defer certificates.Close()
+		tcp, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		secure := tls.NewListener(tcp, certificates.TLS)
+		newFakeElectrum(t, secure, handlers)
+		config := certificates.Client().Transport.(*http.Transport).TLSClientConfig
+		api, err := provider.DialElectrum(ctx, tcp.Addr().String(), &network, config)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer api.Close()
+		if height, err := api.GetBlockHeight(ctx); err != nil || height != 111 {
+			t.Errorf("Unexpected height %v %v", height, err)
+		}
+		if _, err := provider.DialElectrum(ctx, tcp.Addr().String(), &network, &tls.Config{}); err == nil {
+			t.Errorf("Expected error for an untrusted certificate")
+		}
+	})
+
+	t.Run("context", func(t *testing.T) {
+		cancelled, cancel := context.WithCancel(ctx)
+		cancel()
+		if err := api.Call(cancelled, "server.version", nil); !errors.Is(err, context.Canceled) {
+			t.Errorf("Expected context.Canceled, got %v", err)
+		}
+	})
+}
@@ -0,0 +1,134 @@
+package test
+
+import (
+	"context"
+	"math/big"
+	"testing"
+
+	"github.com/mrtnetwork/bitcoin/address"
+	"github.com/mrtnetwork/bitcoin/provider"
+	"github.com/mrtnetwork/bitcoin/provider/providertest"
+)
+
+// feeSource returns fixed estimates
+type feeSource struct {
+	estimates provider.FeeEstimates
+	err       error
+}
+
+func (s feeSource) GetFeeEstimates(ctx context.Context) (provider.FeeEstimates, error) {
+	return s.estimates, s.err
+}
+
+func TestFeeEstimator(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("rate", func(t *testing.T) {
+		rate := provider.FeeRateFromSatPerVByte(12.5)
+		if rate.SatPerKvB() != 12500 || rate.SatPerVByte() != 12.5 || rate.String() != "12.5 sat/vB" {
+			t.Errorf("Unexpected rate %v %d", rate, rate.SatPerKvB())
+		}
+		// 141 vbytes at 12.5 sat/vB, rounded up
+		if fee := rate.Fee(141); fee.Int64() != 1763 {
+			t.Errorf("Expected a fee of 1763, got %v", fee)
+		}
+		if fee := provider.FeeRateFromSatPerKvB(1000).Fee(250); fee.Int64() != 250 {
+			t.Errorf("Expected a fee of 250, got %v", fee)
+		}
+		fee := provider.BitcoinFeeRate{Medium: big.NewInt(2000)}
+		if estimate := fee.GetEstimate(250, fee.Medium); estimate.Int64() != 500 {
+			t.Errorf("Expected an estimate of 500, got %v", estimate)
+		}
+
+		estimates := provider.FeeEstimates{2: 20000, 6: 10000, 144: 2000}
+		for target, expected := range map[int]provider.FeeRate{1: 20000, 2: 20000, 5: 20000, 6: 10000, 100: 10000, 1008: 2000} {
+			if rate, ok := estimates.Target(target); !ok || rate != expected {
+				t.Errorf("Unexpected rate for %d blocks: %v", target, rate)
+			}
+		}
+		if _, ok := (provider.FeeEstimates{}).Target(2); ok {
+			t.Errorf("Expected no estimate")
+		}
+	})
+
+	t.Run("combine", func(t *testing.T) {
+		node := feeSource{estimates: provider.FeeEstimates{2: 20000, 6: 12000, 144: 3000}}
+		explorer := feeSource{estimates: provider.FeeEstimates{1: 25000, 3: 15000, 6: 10000, 1008: 500}}
+		// a backend reporting a fee spike
+		spike := feeSource{estimates: provider.FeeEstimates{1: 900000, 6: 800000, 144: 700000}}
+		failing := feeSource{err: provider.ErrUnavailable}
+
+		estimator := provider.NewFeeEstimator(node, explorer, spike, failing)
+		estimates, err := estimator.GetFeeEstimates(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// the lower median of every target
+		expected := provider.FeeEstimates{1: 25000, 2: 25000, 3: 20000, 6: 12000, 144: 10000, 1008: 3000}
+		if len(estimates) != len(expected) {
+			t.Errorf("Unexpected estimates %v", estimates)
+		}
+		for target, rate := range expected {
+			if estimates[target] != rate {
+				t.Errorf("Unexpected rate for %d blocks: %v instead of %v", target, estimates[target], rate)
+			}
+		}
+
+		estimator.Mode = provider.FeeConservative
+		estimator.MaxFee = provider.FeeRateFromSatPerVByte(500)
+		if rate, err := estimator.EstimateFee(ctx, 6); err != nil || rate != 500000 {
+			t.Errorf("Expected the highest rate bounded to 500 sat/vB, got %v %v", rate, err)
+		}
+		estimator.Sources = []provider.FeeSource{node, explorer}
+		if rate, err := estimator.EstimateFee(ctx, 6); err != nil || rate != 12000 {
+			t.Errorf("Expected the highest rate, got %v %v", rate, err)
+		}
+		// the estimate of a longer target is never above the one of a shorter target, nor below
+		// the minimum relay fee
+		estimator.Sources = []provider.FeeSource{feeSource{estimates: provider.FeeEstimates{2: 5000, 6: 8000, 144: 400}}}
+		if estimates, _ := estimator.GetFeeEstimates(ctx); estimates[6] != 5000 || estimates[144] != 1000 {
+			t.Errorf("Unexpected estimates %v", estimates)
+		}
+
+		estimator.Sources = []provider.FeeSource{failing, feeSource{}}
+		if _, err := estimator.GetFeeEstimates(ctx); err == nil {
+			t.Errorf("Expected an error without estimate")
+		}
+		if _, err := provider.NewFeeEstimator().EstimateFee(ctx, 2); err == nil {
+			t.Errorf("Expected an error without source")
+		}
+		if _, err := provider.NewFeeEstimator(node).EstimateFee(ctx, 0); err == nil {
+			t.Errorf("Expected an error for an invalid target")
+		}
+	})
+
+	t.Run("backends", func(t *testing.T) {
+		network := address.TestnetNetwork
+		server := providertest.NewServer(&network)
+		defer server.Close()
+		server.SetFees(providertest.Fees{Fastest: 30, HalfHour: 12, Hour: 6, Economy: 3, Minimum: 2})
+
+		mempool, err := server.MempoolProvider().GetFeeEstimates(ctx)
+		if err != nil || mempool[1] != 30000 || mempool[3] != 12000 || mempool[6] != 6000 || mempool[144] != 3000 || mempool[1008] != 2000 {
+			t.Errorf("Unexpected mempool estimates %v %v", mempool, err)
+		}
+		blockCypher, err := server.BlockCypherProvider().GetFeeEstimates(ctx)
+		if err != nil || blockCypher[1] != 30000 || blockCypher[3] != 12000 || blockCypher[7] != 2000 {
+			t.Errorf("Unexpected BlockCypher estimates %v %v", blockCypher, err)
+		}
+		composite := provider.NewCompositeProvider(&stubProvider{}, server.EsploraProvider())
+		esplora, err := composite.GetFeeEstimates(ctx)
+		if err != nil || esplora[2] != 30000 || esplora[6] != 6000 || esplora[144] != 3000 {
+			t.Errorf("Unexpected Esplora estimates %v %v", esplora, err)
+		}
+
+		estimator := provider.NewFeeEstimator(server.MempoolProvider(), server.BlockCypherProvider(), server.EsploraProvider())
+		if rate, err := estimator.EstimateFee(ctx, 6); err != nil || rate != 6000 {
+			t.Errorf("Unexpected combined rate %v %v", rate, err)
+		}
+		server.Close()
+		if _, err := estimator.EstimateFee(ctx, 6); err == nil {
+			t.Errorf("Expected an error once the backends are down")
+		}
+	})
+}
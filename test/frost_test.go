@@ -0,0 +1,186 @@
+package test
+
+import (
+	"math/big"
+	"strings"
+	"testing"
+
+	"github.com/mrtnetwork/bitcoin/address"
+	"github.com/mrtnetwork/bitcoin/ecc"
+	"github.com/mrtnetwork/bitcoin/formating"
+	"github.com/mrtnetwork/bitcoin/frost"
+	"github.com/mrtnetwork/bitcoin/provider"
+)
+
+// frostSign runs both signing rounds with the given participants
+func frostSign(t *testing.T, keys []*frost.KeyPackage, pub *frost.PublicKeyPackage, msg []byte, tweak []byte) []byte {
+	nonces := make([]*frost.SigningNonces, len(keys))
+	commitments := make([]*frost.SigningCommitment, len(keys))
+	for i, key := range keys {
+		n, err := frost.Commit(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		nonces[i] = n
+		commitments[i] = n.Commitment
+	}
+	pkg := frost.NewSigningPackage(commitments, msg, tweak)
+	shares := map[int][]byte{}
+	for i, key := range keys {
+		share, err := frost.Sign(pkg, nonces[i], key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := frost.VerifySignatureShare(pkg, key.Identifier, share, pub); err != nil {
+			t.Error(err)
+		}
+		shares[key.Identifier] = share
+	}
+	sig, err := frost.Aggregate(pkg, shares, pub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return sig
+}
+
+func TestFrost(t *testing.T) {
+	msg := formating.HexToBytes("0101010101010101010101010101010101010101010101010101010101010101")
+	secret := formating.HexToBytes("0c28fca386c7a227600b2fe50b7cae11ec86d3bf1fbe471be89827e19d72aa1d")
+	shares, pub, err := frost.TrustedDealerKeygen(secret, 2, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys := make([]*frost.KeyPackage, len(shares))
+	for i, share := range shares {
+		if keys[i], err = frost.NewKeyPackage(share); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	t.Run("trusted_dealer", func(t *testing.T) {
+		x, y := ecc.P256k1().ScalarBaseMult(secret)
+		if !strings.EqualFold(formating.BytesToHex(pub.GroupPublicKey), formating.BytesToHex(ecc.MarshalCompressed(ecc.P256k1(), x, y))) {
+			t.Errorf("Group public key does not match the secret")
+		}
+		xOnly, _ := pub.XOnlyPublicKey(nil)
+		for _, signers := range [][]*frost.KeyPackage{{keys[0], keys[1]}, {keys[0], keys[2]}, {keys[1], keys[2]}, keys} {
+			if !ecc.VerifySchnorr(msg, xOnly, frostSign(t, signers, pub, msg, nil)) {
+				t.Errorf("Invalid schnorr signature")
+			}
+		}
+		tampered := *shares[1]
+		tampered.Value = formating.HexToBytes("0000000000000000000000000000000000000000000000000000000000000001")
+		if _, err := frost.NewKeyPackage(&tampered); err == nil {
+			t.Errorf("Expected error for invalid share")
+		}
+	})
+	t.Run("dkg", func(t *testing.T) {
+		n := 3
+		secrets := make([]*frost.DkgRound1Secret, n)
+		round1 := make([]*frost.DkgRound1Package, n)
+		for i := 0; i < n; i++ {
+			if secrets[i], round1[i], err = frost.DkgPart1(i+1, 2, n); err != nil {
+				t.Fatal(err)
+			}
+		}
+		others := func(i int) []*frost.DkgRound1Package {
+			result := []*frost.DkgRound1Package{}
+			for j, pkg := range round1 {
+				if j != i {
+					result = append(result, pkg)
+				}
+			}
+			return result
+		}
+		received := make([][]*frost.DkgRound2Package, n)
+		for i := 0; i < n; i++ {
+			packages, err := frost.DkgPart2(secrets[i], others(i))
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, pkg := range packages {
+				received[pkg.To-1] = append(received[pkg.To-1], pkg)
+			}
+		}
+		dkgKeys := make([]*frost.KeyPackage, n)
+		var dkgPub *frost.PublicKeyPackage
+		for i := 0; i < n; i++ {
+			key, p, err := frost.DkgPart3(secrets[i], others(i), received[i])
+			if err != nil {
+				t.Fatal(err)
+			}
+			if dkgPub != nil && !strings.EqualFold(formating.BytesToHex(p.GroupPublicKey), formating.BytesToHex(dkgPub.GroupPublicKey)) {
+				t.Errorf("Participants computed different group keys")
+			}
+			dkgKeys[i], dkgPub = key, p
+		}
+		tweak := dkgPub.TaprootTweak(nil)
+		xOnly, _ := dkgPub.XOnlyPublicKey(tweak)
+		if !ecc.VerifySchnorr(msg, xOnly, frostSign(t, dkgKeys[1:], dkgPub, msg, tweak)) {
+			t.Errorf("Invalid schnorr signature")
+		}
+		// an invalid proof of knowledge is rejected
+		forged := *round1[0]
+		forged.ProofOfKnowledge = round1[1].ProofOfKnowledge
+		if _, err := frost.DkgPart2(secrets[1], []*frost.DkgRound1Package{&forged, round1[2]}); err == nil {
+			t.Errorf("Expected error for invalid proof of knowledge")
+		}
+	})
+	t.Run("invalid_share", func(t *testing.T) {
+		n0, _ := frost.Commit(keys[0])
+		n1, _ := frost.Commit(keys[1])
+		pkg := frost.NewSigningPackage([]*frost.SigningCommitment{n0.Commitment, n1.Commitment}, msg, nil)
+		s0, _ := frost.Sign(pkg, n0, keys[0])
+		s1, _ := frost.Sign(pkg, n1, keys[1])
+		if _, err := frost.Sign(pkg, n0, keys[0]); err == nil {
+			t.Errorf("Expected error on nonce reuse")
+		}
+		if _, err := frost.Aggregate(pkg, map[int][]byte{1: s0, 2: s0}, pub); err == nil {
+			t.Errorf("Expected error for invalid signature share")
+		}
+		if _, err := frost.Aggregate(pkg, map[int][]byte{1: s0, 2: s1}, pub); err != nil {
+			t.Error(err)
+		}
+		single := frost.NewSigningPackage([]*frost.SigningCommitment{n0.Commitment}, msg, nil)
+		if _, err := frost.Aggregate(single, map[int][]byte{1: s0}, pub); err == nil {
+			t.Errorf("Expected error below the threshold")
+		}
+	})
+	t.Run("spend_p2tr_key_path", func(t *testing.T) {
+		group, err := pub.PublicKey()
+		if err != nil {
+			t.Fatal(err)
+		}
+		addr := group.ToTaprootAddress()
+		tweak := pub.TaprootTweak(nil)
+		xOnly, _ := pub.XOnlyPublicKey(tweak)
+		program, _ := group.ToTapRotHex(nil)
+		if !strings.EqualFold(program, formating.BytesToHex(xOnly)) {
+			t.Errorf("Expected %v, but got %v", program, formating.BytesToHex(xOnly))
+		}
+		signer := func(trDigest []byte, utxo provider.UtxoWithOwner, publicKey string) (string, error) {
+			return formating.BytesToHex(frostSign(t, []*frost.KeyPackage{keys[2], keys[0]}, pub, trDigest, tweak)), nil
+		}
+		utxo := provider.UtxoWithOwner{
+			Utxo: provider.BitcoinUtxo{
+				TxHash:     "6e9a0692ed4b3328909d66d41531854988dc39edba5df186affaefda91824e69",
+				Value:      big.NewInt(100000),
+				Vout:       0,
+				ScriptType: address.P2TR,
+			},
+			OwnerDetails: provider.UtxoOwnerDetails{PublicKey: group.ToHex(), Address: addr},
+		}
+		builder := provider.NewBitcoinTransactionBuilder(
+			[]provider.UtxoWithOwner{utxo},
+			[]provider.BitcoinOutputDetails{{Address: addr, Value: big.NewInt(99000)}},
+			big.NewInt(1000), &address.TestnetNetwork, "", false)
+		tx, err := builder.BuildTransaction(signer)
+		if err != nil {
+			t.Fatal(err)
+		}
+		witness := tx.Witnesses[0].Stack
+		if len(witness) != 1 || len(formating.HexToBytes(witness[0])) != 64 {
+			t.Fatalf("Expected a single 64 bytes signature, got %v", witness)
+		}
+	})
+}
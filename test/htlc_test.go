@@ -0,0 +1,143 @@
+package test
+
+import (
+	"math/big"
+	"strings"
+	"testing"
+
+	"github.com/mrtnetwork/bitcoin/constant"
+	"github.com/mrtnetwork/bitcoin/ecc"
+	"github.com/mrtnetwork/bitcoin/formating"
+	"github.com/mrtnetwork/bitcoin/htlc"
+	"github.com/mrtnetwork/bitcoin/keypair"
+	"github.com/mrtnetwork/bitcoin/scripts"
+)
+
+func TestHTLC(t *testing.T) {
+	receiver, _ := keypair.NewECPrivateFromWIF("cTALNpTpRbbxTCJ2A5Vq88UxT44w1PE2cYqiB3n4hRvzyCev1Wwo")
+	sender, _ := keypair.NewECPrivateFromWIF("cRvyLwCPLU88jsyj94L7iJjQX5C2f8koG4G2gevN4BeSGcEvfKe9")
+	preimage := "0101010101010101010101010101010101010101010101010101010101010101"
+	paymentHash := htlc.PaymentHash(htlc.SHA256, formating.HexToBytes(preimage))
+	utxo := htlc.ContractUtxo{
+		TxHash: "6e9a0692ed4b3328909d66d41531854988dc39edba5df186affaefda91824e69",
+		Vout:   1,
+		Value:  big.NewInt(100000),
+	}
+	destination := receiver.GetPublic().ToSegwitAddress()
+	fee := big.NewInt(500)
+
+	t.Run("payment_hash", func(t *testing.T) {
+		expected := "72cd6e8422c407fb6d098690f1130b7ded7ec2f7f5e1d30bd9d521f015363793"
+		if !strings.EqualFold(paymentHash, expected) {
+			t.Errorf("Expected %v, but got %v", expected, paymentHash)
+		}
+	})
+	t.Run("p2wsh_script", func(t *testing.T) {
+		contract, err := htlc.NewP2WSHContract(htlc.SHA256, paymentHash, receiver.GetPublic().ToHex(), sender.GetPublic().ToHex(), 800000)
+		if err != nil {
+			t.Fatal(err)
+		}
+		expected := "6382012088a820" + paymentHash + "8821" + receiver.GetPublic().ToHex() +
+			"670300350cb17521" + sender.GetPublic().ToHex() + "68ac"
+		if !strings.EqualFold(contract.WitnessScript.ToHex(), expected) {
+			t.Errorf("Expected %v, but got %v", expected, contract.WitnessScript.ToHex())
+		}
+	})
+	t.Run("invalid_parameters", func(t *testing.T) {
+		if _, err := htlc.NewP2WSHContract(htlc.HASH160, paymentHash, receiver.GetPublic().ToHex(), sender.GetPublic().ToHex(), 800000); err == nil {
+			t.Errorf("Expected error for invalid hash length")
+		}
+		if _, err := htlc.NewP2TRContract(htlc.SHA256, paymentHash, receiver.GetPublic().ToHex(), sender.GetPublic().ToHex(), 0); err == nil {
+			t.Errorf("Expected error for invalid lock time")
+		}
+	})
+	t.Run("p2wsh_claim_and_extract", func(t *testing.T) {
+		contract, _ := htlc.NewP2WSHContract(htlc.SHA256, paymentHash, receiver.GetPublic().ToHex(), sender.GetPublic().ToHex(), 800000)
+		if _, err := contract.BuildClaimTransaction(utxo, destination, fee, preimage[2:]+"02", receiver); err == nil {
+			t.Errorf("Expected error for wrong preimage")
+		}
+		if _, err := contract.BuildClaimTransaction(utxo, destination, fee, preimage, sender); err == nil {
+			t.Errorf("Expected error for wrong key")
+		}
+		tx, err := contract.BuildClaimTransaction(utxo, destination, fee, preimage, receiver)
+		if err != nil {
+			t.Fatal(err)
+		}
+		stack := tx.Witnesses[0].Stack
+		if len(stack) != 4 || stack[1] != preimage || stack[2] != "01" || stack[3] != contract.WitnessScript.ToHex() {
+			t.Errorf("Unexpected witness %v", stack)
+		}
+		digest := tx.GetTransactionSegwitDigit(0, contract.WitnessScript, utxo.Value)
+		if !strings.EqualFold(stack[0], receiver.SingInput(digest, constant.SIGHASH_ALL)) {
+			t.Errorf("Expected signature of the receiver")
+		}
+		extracted, err := contract.ExtractPreimageFromRaw(tx.Serialize())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.EqualFold(extracted, preimage) {
+			t.Errorf("Expected %v, but got %v", preimage, extracted)
+		}
+	})
+	t.Run("p2wsh_refund", func(t *testing.T) {
+		contract, _ := htlc.NewP2WSHContract(htlc.HASH160, htlc.PaymentHash(htlc.HASH160, formating.HexToBytes(preimage)),
+			receiver.GetPublic().ToHex(), sender.GetPublic().ToHex(), 800000)
+		tx, err := contract.BuildRefundTransaction(utxo, sender.GetPublic().ToSegwitAddress(), fee, sender)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.EqualFold(formating.BytesToHex(tx.Locktime), "00350c00") {
+			t.Errorf("Expected %v, but got %v", "00350c00", formating.BytesToHex(tx.Locktime))
+		}
+		if !strings.EqualFold(formating.BytesToHex(tx.Inputs[0].Sequence), "feffffff") {
+			t.Errorf("Expected %v, but got %v", "feffffff", formating.BytesToHex(tx.Inputs[0].Sequence))
+		}
+		stack := tx.Witnesses[0].Stack
+		if len(stack) != 3 || stack[1] != "" {
+			t.Errorf("Unexpected witness %v", stack)
+		}
+		if _, err := contract.ExtractPreimage(tx); err == nil {
+			t.Errorf("Expected error, refund does not reveal the preimage")
+		}
+	})
+	t.Run("p2tr_claim_and_refund", func(t *testing.T) {
+		contract, err := htlc.NewP2TRContract(htlc.SHA256, paymentHash, receiver.GetPublic().ToHex(), sender.GetPublic().ToHex(), 800000)
+		if err != nil {
+			t.Fatal(err)
+		}
+		internal, _ := keypair.NewECPPublicFromHex(contract.InternalPublicKey)
+		program, _ := internal.ToTapRotHex([]interface{}{contract.ClaimLeaf, contract.RefundLeaf})
+		if !strings.EqualFold(contract.Address.ToScriptPubKey().ToHex(), "5120"+program) {
+			t.Errorf("Expected %v, but got %v", "5120"+program, contract.Address.ToScriptPubKey().ToHex())
+		}
+		claim, err := contract.BuildClaimTransaction(utxo, destination, fee, preimage, receiver)
+		if err != nil {
+			t.Fatal(err)
+		}
+		refund, err := contract.BuildRefundTransaction(utxo, destination, fee, sender)
+		if err != nil {
+			t.Fatal(err)
+		}
+		checks := []struct {
+			tx   *scripts.BtcTransaction
+			leaf *scripts.Script
+			key  *keypair.ECPrivate
+		}{{claim, contract.ClaimLeaf, receiver}, {refund, contract.RefundLeaf, sender}}
+		for _, check := range checks {
+			stack := check.tx.Witnesses[0].Stack
+			if stack[len(stack)-2] != check.leaf.ToHex() {
+				t.Errorf("Expected %v, but got %v", check.leaf.ToHex(), stack[len(stack)-2])
+			}
+			digest := check.tx.GetTransactionTaprootDigest(0, []*scripts.Script{contract.Address.ToScriptPubKey()},
+				[]*big.Int{utxo.Value}, 1, check.leaf, constant.TAPROOT_SIGHASH_ALL)
+			xOnly := formating.HexToBytes(check.key.GetPublic().ToXOnlyHex())
+			if !ecc.VerifySchnorr(digest, xOnly, formating.HexToBytes(stack[0])) {
+				t.Errorf("Invalid schnorr signature")
+			}
+		}
+		extracted, err := contract.ExtractPreimage(claim)
+		if err != nil || !strings.EqualFold(extracted, preimage) {
+			t.Errorf("Expected %v, but got %v", preimage, extracted)
+		}
+	})
+}
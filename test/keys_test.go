@@ -2,6 +2,7 @@ package test
 
 import (
 	"bytes"
+	"encoding/base64"
 	"fmt"
 	"strings"
 	"testing"
@@ -56,6 +57,59 @@ func TestSignAndVerify(t *testing.T) {
 		}
 	})
 }
+func TestVerifyMessage(t *testing.T) {
+	message := "The test!"
+	key, _ := keypair.NewECPrivateFromWIF("KwDiBf89QgGbjEhKnhXJuH7LrciVrZi3qYjgd9M7rFU73sVHnoWn")
+	other, _ := keypair.NewECPrivateFromWIF("cTALNpTpRbbxTCJ2A5Vq88UxT44w1PE2cYqiB3n4hRvzyCev1Wwo")
+	pub := key.GetPublic()
+	p2wpkh, _ := key.SignSegwitMessage(message, address.P2WPKH)
+	p2shP2wpkh, _ := key.SignSegwitMessage(message, address.P2WPKHInP2SH)
+	if _, err := key.SignSegwitMessage(message, address.P2TR); err == nil {
+		t.Errorf("Expected error for taproot address")
+	}
+	legacy := key.SignMessage(message, true)
+	uncompressed := key.SignMessage(message, false)
+	// base64 signatures as produced by wallets
+	electrum := base64.StdEncoding.EncodeToString(formating.HexToBytes(legacy))
+	for _, test := range []struct {
+		name      string
+		addr      address.BitcoinAddress
+		signature string
+		options   []keypair.MessageVerifyOption
+		expected  bool
+	}{
+		{"p2pkh", pub.ToAddress(), legacy, nil, true},
+		{"p2pkh_uncompressed", pub.ToAddress(false), uncompressed, nil, true},
+		{"p2pkh_wrong_compression", pub.ToAddress(false), legacy, nil, false},
+		{"p2wpkh", pub.ToSegwitAddress(), p2wpkh, nil, true},
+		{"p2sh_p2wpkh", pub.ToP2WPKHInP2SH(), p2shP2wpkh, nil, true},
+		{"p2wpkh_header_of_p2sh", pub.ToSegwitAddress(), p2shP2wpkh, nil, false},
+		{"p2wpkh_header_of_p2sh_trezor", pub.ToSegwitAddress(), p2shP2wpkh, []keypair.MessageVerifyOption{keypair.TrezorLeniency}, true},
+		{"p2sh_header_of_p2wpkh_trezor", pub.ToP2WPKHInP2SH(), p2wpkh, []keypair.MessageVerifyOption{keypair.TrezorLeniency}, true},
+		{"electrum_p2wpkh", pub.ToSegwitAddress(), electrum, nil, false},
+		{"electrum_p2wpkh_lenient", pub.ToSegwitAddress(), electrum, []keypair.MessageVerifyOption{keypair.ElectrumLeniency}, true},
+		{"electrum_p2sh_lenient", pub.ToP2WPKHInP2SH(), electrum, []keypair.MessageVerifyOption{keypair.ElectrumLeniency}, true},
+		{"other_address", other.GetPublic().ToSegwitAddress(), p2wpkh, []keypair.MessageVerifyOption{keypair.TrezorLeniency, keypair.ElectrumLeniency}, false},
+		{"taproot", pub.ToTaprootAddress(), p2wpkh, nil, false},
+		{"invalid", pub.ToAddress(), "invalid", nil, false},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			if keypair.VerifyMessage(test.addr, message, test.signature, test.options...) != test.expected {
+				t.Errorf("Expected %v", test.expected)
+			}
+			if test.expected && keypair.VerifyMessage(test.addr, message+"!", test.signature, test.options...) {
+				t.Errorf("Expected invalid signature for another message")
+			}
+		})
+	}
+	if header := formating.HexToBytes(p2wpkh)[0]; header < 39 || header > 42 {
+		t.Errorf("Unexpected P2WPKH header %d", header)
+	}
+	if header := formating.HexToBytes(p2shP2wpkh)[0]; header < 35 || header > 38 {
+		t.Errorf("Unexpected P2SH-P2WPKH header %d", header)
+	}
+}
+
 func TestPublicKeys(t *testing.T) {
 	publicKeyHex := "0479be667ef9dcbbac55a06295ce870b07029bfcdb2dce28d959f2815b16f81798483ada7726a3c4655da4fbfc0e1108a8fd17b448a68554199c47d08ffb10d4b8"
 	unCompressedAddress := "1EHNa6Q4Jz2uvNExL497mE43ikXhwF6kZm"
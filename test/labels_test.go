@@ -0,0 +1,180 @@
+package test
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/mrtnetwork/bitcoin/address"
+	hdwallet "github.com/mrtnetwork/bitcoin/hd_wallet"
+	"github.com/mrtnetwork/bitcoin/keypair"
+	"github.com/mrtnetwork/bitcoin/provider"
+	"github.com/mrtnetwork/bitcoin/scripts"
+	"github.com/mrtnetwork/bitcoin/wallet"
+)
+
+func TestLabels(t *testing.T) {
+	key, _ := keypair.NewECPrivateFromWIF("cTALNpTpRbbxTCJ2A5Vq88UxT44w1PE2cYqiB3n4hRvzyCev1Wwo")
+	segwit := key.GetPublic().ToSegwitAddress()
+	storage := wallet.NewMemoryStorage()
+	store, _ := wallet.NewUtxoStore(storage)
+	store.Track(provider.UtxoOwnerDetails{PublicKey: key.GetPublic().ToHex(), Address: segwit})
+	deposit := unsignedTx([]wallet.Outpoint{{TxId: strings.Repeat("aa", 32), Vout: 0}}, map[*scripts.Script]int64{segwit.ToScriptPubKey(): 100000})
+	store.AddTransaction(deposit)
+	output := wallet.Outpoint{TxId: deposit.TxId(), Vout: 0}
+
+	// the records of the BIP329 example, with fields reserved by the BIP and of other wallets,
+	// empty and null fields
+	records := []string{
+		`{"type":"addr","ref":"bc1q34aq5drpuwy3wgl9lhup9892qp6svr8ldzyy7c","label":"Address","keypath":"/1/123"}`,
+		`{"type":"input","ref":"f91d0a8a78462bc59398f2c5d7a84fcff491c26ba54c4833478b202796c8aafd:0","label":"Input"}`,
+		`{"type":"input","ref":"f91d0a8a78462bc59398f2c5d7a84fcff491c26ba54c4833478b202796c8aafd:1","label":"","origin":""}`,
+		`{"type":"output","ref":"` + output.String() + `","label":"KYC <exchange> & co","origin":"wpkh([d34db33f/84'/0'/0'])","spendable":false,"fmv":{"USD":1.23456789012345678901},"x-tool":[1,{"a":null}]}`,
+		`{"type":"pubkey","ref":"0283409659355b6d1cc3c32decd5d561abaac86c37a353b52895a5e6c196d6f448","label":"Public Key"}`,
+		`{"type":"tx","ref":"` + deposit.TxId() + `","label":"Deposit"}`,
+		`{"type":"tx","ref":"f91d0a8a78462bc59398f2c5d7a84fcff491c26ba54c4833478b202796c8aafd","label":"Transaction","origin":"wpkh([d34db33f/84'/0'/0'])","height":800000}`,
+		`{"type":"tx","ref":"` + strings.Repeat("ff", 32) + `","label":null,"spendable":null}`,
+		`{"type":"xpub","ref":"xpub661MyMwAqRbcFtXgS5sYJABqqG9YLmC4Q1Rdap9gSE8NqtwybGhePY2gZ29ESFjqJoCu1Rupje8YtGqsefD265TMg7usUDFdp6W1EGMcet8","label":"Extended Public Key"}`,
+	}
+	labels, err := wallet.NewLabelStore(storage)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count, err := labels.Import(strings.NewReader(strings.Join(records, "\n") + "\n\n")); err != nil || count != 9 {
+		t.Fatalf("Unexpected import %d %v", count, err)
+	}
+	if _, err := labels.Import(strings.NewReader(`{"type":"tx","ref":"ab","label":"x"}` + "\n" + `{"ref":"ab"}`)); err == nil || !strings.Contains(err.Error(), "line 2") {
+		t.Errorf("Expected an invalid record, got %v", err)
+	}
+	if _, ok := labels.Get(wallet.LabelTx, "ab"); ok {
+		t.Errorf("Expected nothing imported from an invalid export")
+	}
+	var exported bytes.Buffer
+	if err := labels.Export(&exported); err != nil {
+		t.Fatal(err)
+	}
+	if exported.String() != strings.Join(records, "\n")+"\n" {
+		t.Errorf("Unexpected export\n%s", exported.String())
+	}
+	if tx, ok := labels.Get(wallet.LabelTx, "f91d0a8a78462bc59398f2c5d7a84fcff491c26ba54c4833478b202796c8aafd"); !ok || tx.Label != "Transaction" || tx.Origin != "wpkh([d34db33f/84'/0'/0'])" || string(tx.Extra["height"]) != "800000" {
+		t.Errorf("Unexpected transaction label %+v", tx)
+	}
+	if addr, ok := labels.Get(wallet.LabelAddress, "bc1q34aq5drpuwy3wgl9lhup9892qp6svr8ldzyy7c"); !ok || addr.Label != "Address" || addr.Spendable != nil {
+		t.Errorf("Unexpected address label %+v", addr)
+	}
+
+	// the output record freezes and labels the coin, the transaction record labels the deposit
+	if updated, err := labels.Apply(store); err != nil || updated != 2 {
+		t.Fatalf("Unexpected apply %d %v", updated, err)
+	}
+	utxo, _ := store.Utxo(output)
+	if !utxo.Metadata.Frozen || !utxo.Metadata.HasLabel("KYC <exchange> & co") || utxo.Metadata.Origin != "" || len(store.Spendable(0).Select(provider.CoinControl{})) != 0 {
+		t.Errorf("Unexpected metadata %+v", utxo.Metadata)
+	}
+	if label := store.TransactionLabel(deposit.TxId()); label != "Deposit" {
+		t.Errorf("Unexpected transaction label %s", label)
+	}
+	if updated, _ := labels.Apply(store); updated != 0 {
+		t.Errorf("Expected the store to be up to date, %d updated", updated)
+	}
+
+	// coin control and transaction labels are collected back, the other fields are kept
+	store.SetMetadata(output, provider.CoinMetadata{Labels: []string{"kyc", "payout"}, Origin: "binance"})
+	store.SetTransactionLabel(deposit.TxId(), "Salary")
+	if err := labels.Collect(store); err != nil {
+		t.Fatal(err)
+	}
+	record, _ := labels.Get(wallet.LabelOutput, output.String())
+	data, _ := record.MarshalJSON()
+	if expected := `{"type":"output","ref":"` + output.String() + `","label":"kyc, payout","origin":"wpkh([d34db33f/84'/0'/0'])","spendable":true,"fmv":{"USD":1.23456789012345678901},"x-tool":[1,{"a":null}]}`; string(data) != expected {
+		t.Errorf("Unexpected collected record %s", data)
+	}
+	if tx, _ := labels.Get(wallet.LabelTx, deposit.TxId()); tx.Label != "Salary" {
+		t.Errorf("Unexpected collected transaction label %+v", tx)
+	}
+	// the labels of a coin keep their representation both ways
+	store.SetMetadata(output, provider.CoinMetadata{})
+	if updated, err := labels.Apply(store); err != nil || updated != 1 {
+		t.Fatalf("Unexpected apply %d %v", updated, err)
+	}
+	if utxo, _ := store.Utxo(output); len(utxo.Metadata.Labels) != 2 || utxo.Metadata.Labels[0] != "kyc" || utxo.Metadata.Labels[1] != "payout" {
+		t.Errorf("Unexpected labels %v", utxo.Metadata.Labels)
+	}
+	record.Label = "kyc,payout"
+	labels.Set(record)
+	labels.Collect(store)
+	if collected, _ := labels.Get(wallet.LabelOutput, output.String()); collected.Label != "kyc,payout" {
+		t.Errorf("Expected the label of the same coin labels to be kept, got %s", collected.Label)
+	}
+
+	// the labels are persisted with the wallet and round-trip through another store
+	reopened, err := wallet.NewLabelStore(storage)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(reopened.Labels()) != 9 {
+		t.Errorf("Unexpected persisted labels %d", len(reopened.Labels()))
+	}
+	var first, second bytes.Buffer
+	reopened.Export(&first)
+	other, _ := wallet.NewLabelStore(wallet.NewMemoryStorage())
+	other.Import(bytes.NewReader(first.Bytes()))
+	other.Export(&second)
+	if first.String() != second.String() || !strings.Contains(first.String(), `"label":"","origin":""}`) || !strings.Contains(first.String(), `"label":null,"spendable":null}`) {
+		t.Errorf("Unexpected round trip\n%s\n%s", first.String(), second.String())
+	}
+	if err := reopened.Delete(wallet.LabelXPublicKey, "xpub661MyMwAqRbcFtXgS5sYJABqqG9YLmC4Q1Rdap9gSE8NqtwybGhePY2gZ29ESFjqJoCu1Rupje8YtGqsefD265TMg7usUDFdp6W1EGMcet8"); err != nil || len(reopened.Labels()) != 8 {
+		t.Errorf("Unexpected delete %v", err)
+	}
+}
+
+func TestAccountLabels(t *testing.T) {
+	network := address.TestnetNetwork
+	master, _ := hdwallet.FromMnemonic("abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon about", "")
+	account, err := wallet.NewAccount(master, "m/84'/1'/0'", address.P2WPKH, &network)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var receive [3]wallet.AccountAddress
+	for i := range receive {
+		receive[i], _ = account.NextReceiveAddress()
+	}
+	change, _ := account.ChangeAddress()
+	// addresses derived later, beyond the lookahead
+	used, _ := hdwallet.DrivePath(master, "m/84'/1'/0'/0/15")
+	node, _ := hdwallet.DrivePath(master, "m/84'/1'/0'/0/30")
+	later := node.GetPublic().ToSegwitAddress()
+
+	labels, _ := wallet.NewLabelStore(wallet.NewMemoryStorage())
+	records := []string{
+		`{"type":"addr","ref":"` + receive[0].Address.Show(&network) + `","label":"Invoice 1"}`,
+		`{"type":"pubkey","ref":"` + receive[1].PublicKey.ToHex() + `","label":"Key 1"}`,
+		`{"type":"pubkey","ref":"` + change.PublicKey.ToHex() + `","label":"Key of the change"}`,
+		`{"type":"addr","ref":"` + change.Address.Show(&network) + `","label":"Change"}`,
+		`{"type":"addr","ref":"` + later.Show(&network) + `","label":"Invoice 30"}`,
+		`{"type":"xpub","ref":"` + account.XPublicKey() + `","label":"Savings"}`,
+	}
+	if _, err := labels.Import(strings.NewReader(strings.Join(records, "\n"))); err != nil {
+		t.Fatal(err)
+	}
+	if labeled := labels.ApplyAccount(account); labeled != 3 || account.Label != "Savings" {
+		t.Errorf("Unexpected labeled addresses %d %s", labeled, account.Label)
+	}
+	addresses := account.Addresses(wallet.ReceiveChain)
+	if addresses[0].Label != "Invoice 1" || addresses[1].Label != "Key 1" || addresses[2].Label != "" || account.Addresses(wallet.ChangeChain)[0].Label != "Change" {
+		t.Errorf("Unexpected address labels %+v", addresses)
+	}
+	if addr, ok := account.Lookup(receive[1].Address.ToScriptPubKey().ToHex()); !ok || addr.Label != "Key 1" {
+		t.Errorf("Unexpected label of the address found %+v", addr)
+	}
+	// the addresses derived afterwards are labeled too
+	if _, ok := account.Lookup(later.ToScriptPubKey().ToHex()); ok {
+		t.Fatalf("Expected the address not derived yet")
+	}
+	if _, ok, err := account.MarkUsed(used.GetPublic().ToSegwitAddress().ToScriptPubKey().ToHex()); !ok || err != nil {
+		t.Fatalf("Unexpected mark used %v %v", ok, err)
+	}
+	if addr, ok := account.Lookup(later.ToScriptPubKey().ToHex()); !ok || addr.Label != "Invoice 30" {
+		t.Errorf("Expected the label of the address derived later, got %+v", addr)
+	}
+}
@@ -0,0 +1,310 @@
+package test
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mrtnetwork/bitcoin/address"
+	"github.com/mrtnetwork/bitcoin/keypair"
+	"github.com/mrtnetwork/bitcoin/provider"
+)
+
+// wsPeer is the server side of a WebSocket connection of the stand-in server
+type wsPeer struct {
+	t      *testing.T
+	conn   net.Conn
+	reader *bufio.Reader
+}
+
+// wsStandIn starts a WebSocket server handing its connections over a channel
+func wsStandIn(t *testing.T) (*httptest.Server, chan *wsPeer) {
+	peers := make(chan *wsPeer, 4)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Upgrade") != "websocket" || r.Header.Get("Sec-Websocket-Version") != "13" {
+			http.Error(w, "not a websocket handshake", http.StatusBadRequest)
+			return
+		}
+		accept := sha1.Sum([]byte(r.Header.Get("Sec-Websocket-Key") + "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"))
+		conn, buffer, err := w.(http.Hijacker).Hijack()
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		buffer.WriteString("HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\nSec-WebSocket-Accept: " +
+			base64.StdEncoding.EncodeToString(accept[:]) + "\r\n\r\n")
+		buffer.Flush()
+		peers <- &wsPeer{t: t, conn: conn, reader: buffer.Reader}
+	}))
+	return server, peers
+}
+
+// frame reads a frame of the client, which must be masked
+func (p *wsPeer) frame() (byte, []byte) {
+	p.conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	header := make([]byte, 2)
+	if _, err := io.ReadFull(p.reader, header); err != nil {
+		p.t.Fatalf("read frame: %v", err)
+	}
+	if header[1]&0x80 == 0 {
+		p.t.Fatalf("unmasked client frame")
+	}
+	length := int(header[1] & 0x7f)
+	if length == 126 {
+		extended := make([]byte, 2)
+		io.ReadFull(p.reader, extended)
+		length = int(binary.BigEndian.Uint16(extended))
+	}
+	mask := make([]byte, 4)
+	io.ReadFull(p.reader, mask)
+	payload := make([]byte, length)
+	io.ReadFull(p.reader, payload)
+	for i := range payload {
+		payload[i] ^= mask[i%4]
+	}
+	return header[0] & 0x0f, payload
+}
+
+// message reads the next text message of the client, skipping the pings
+func (p *wsPeer) message() map[string]interface{} {
+	for {
+		opcode, payload := p.frame()
+		if opcode == 0x9 {
+			continue
+		}
+		if opcode != 0x1 {
+			p.t.Fatalf("Unexpected opcode %d", opcode)
+		}
+		var message map[string]interface{}
+		if err := json.Unmarshal(payload, &message); err != nil {
+			p.t.Fatal(err)
+		}
+		return message
+	}
+}
+
+// write writes an unmasked frame
+func (p *wsPeer) write(fin bool, opcode byte, payload []byte) {
+	first := opcode
+	if fin {
+		first |= 0x80
+	}
+	frame := []byte{first}
+	if len(payload) < 126 {
+		frame = append(frame, byte(len(payload)))
+	} else {
+		frame = append(frame, 126, byte(len(payload)>>8), byte(len(payload)))
+	}
+	if _, err := p.conn.Write(append(frame, payload...)); err != nil {
+		p.t.Fatal(err)
+	}
+}
+
+func (p *wsPeer) send(message string) {
+	p.write(true, 0x1, []byte(message))
+}
+
+func TestMempoolWebSocket(t *testing.T) {
+	network := address.TestnetNetwork
+	ctx := context.Background()
+	addr, _ := address.P2WPKHAddresssFromAddress("tb1q92nmnvhj04sqd4x7wjaewlt5jn8n3ngmplcymy")
+	key, _ := keypair.NewECPrivateFromWIF("cTALNpTpRbbxTCJ2A5Vq88UxT44w1PE2cYqiB3n4hRvzyCev1Wwo")
+	other := key.GetPublic().ToAddress()
+	txId := "d4bad8e07d30ca4389ec8a203318aa523cc3e36c9730d0a6852a3801d086c5fe"
+	transaction := `{"txid":"` + txId + `","version":2,"size":222,"weight":561,"fee":1410,"status":{"confirmed":false},
+		"vin":[{"txid":"` + strings.Repeat("11", 32) + `","vout":1,"prevout":{"scriptpubkey_address":"` + addr.Show(&network) + `","value":100000}}],
+		"vout":[{"scriptpubkey":"0014aa","scriptpubkey_address":"` + addr.Show(&network) + `","value":98590}]}`
+
+	server, peers := wsStandIn(t)
+	defer server.Close()
+	newClient := func() *provider.MempoolWebSocket {
+		ws := provider.NewMempoolWebSocket(&network)
+		ws.URL = "ws" + strings.TrimPrefix(server.URL, "http") + "/api/v1/ws"
+		ws.ReconnectDelay, ws.MaxReconnectDelay = 10*time.Millisecond, 50*time.Millisecond
+		return ws
+	}
+	receive := func(t *testing.T, events interface{}) interface{} {
+		t.Helper()
+		var event interface{}
+		var ok bool
+		timeout := time.After(5 * time.Second)
+		switch events := events.(type) {
+		case <-chan provider.MempoolBlockEvent:
+			select {
+			case event, ok = <-events:
+			case <-timeout:
+			}
+		case <-chan []provider.MempoolBlockProjection:
+			select {
+			case event, ok = <-events:
+			case <-timeout:
+			}
+		case <-chan provider.MempoolAddressEvent:
+			select {
+			case event, ok = <-events:
+			case <-timeout:
+			}
+		case <-chan provider.MempoolTransactionEvent:
+			select {
+			case event, ok = <-events:
+			case <-timeout:
+			}
+		}
+		if !ok {
+			t.Fatalf("No event received")
+		}
+		return event
+	}
+
+	t.Run("events", func(t *testing.T) {
+		ws := newClient()
+		// subscriptions made before connecting are sent on connection
+		blocks, _ := ws.SubscribeBlocks(ctx)
+		projections, _ := ws.SubscribeMempoolBlocks(ctx)
+		addresses, _ := ws.TrackAddress(ctx, addr)
+		transactions, _ := ws.TrackTransaction(ctx, txId)
+		if err := ws.Connect(ctx); err != nil {
+			t.Fatal(err)
+		}
+		peer := <-peers
+		subscriptions := func(peer *wsPeer, tracked string) {
+			t.Helper()
+			want := peer.message()
+			if want["action"] != "want" || len(want["data"].([]interface{})) != 2 {
+				t.Errorf("Unexpected want message %v", want)
+			}
+			if track := peer.message(); track[tracked] == nil {
+				t.Errorf("Expected %s, got %v", tracked, track)
+			}
+			if track := peer.message(); track["track-tx"] != txId {
+				t.Errorf("Unexpected track-tx message %v", track)
+			}
+		}
+		subscriptions(peer, "track-address")
+
+		peer.send(`{"block":{"id":"00ff","height":2500001,"timestamp":1700000600,"tx_count":3},
+			"mempool-blocks":[{"blockVSize":997000,"nTx":2100,"medianFee":12.5,"feeRange":[10,11,40]},{"nTx":10,"medianFee":3}]}`)
+		block := receive(t, blocks).(provider.MempoolBlockEvent)
+		if block.Hash != "00ff" || block.Height != 2500001 || block.TxCount != 3 {
+			t.Errorf("Unexpected block %+v", block)
+		}
+		projected := receive(t, projections).([]provider.MempoolBlockProjection)
+		if len(projected) != 2 || projected[0].MedianFee != 12.5 || len(projected[0].FeeRange) != 3 {
+			t.Errorf("Unexpected projections %+v", projected)
+		}
+
+		// a fragmented message interleaved with a ping
+		message := []byte(`{"address-transactions":[` + transaction + `]}`)
+		peer.write(false, 0x1, message[:50])
+		peer.write(true, 0x9, []byte("keepalive"))
+		peer.write(false, 0x0, message[50:100])
+		peer.write(true, 0x0, message[100:])
+		if opcode, payload := peer.frame(); opcode != 0xa || string(payload) != "keepalive" {
+			t.Errorf("Expected the pong, got %d %s", opcode, payload)
+		}
+		event := receive(t, addresses).(provider.MempoolAddressEvent)
+		if event.Address != addr.Show(&network) || event.Transaction.TxId != txId || event.Transaction.Status.Confirmed || event.Removed ||
+			event.Transaction.Fee.Int64() != 1410 || event.Transaction.Inputs[0].Value.Int64() != 100000 {
+			t.Errorf("Unexpected address event %+v", event)
+		}
+
+		peer.send(`{"txPosition":{"txid":"` + txId + `","position":{"block":1,"vsize":140.25}}}`)
+		if event := receive(t, transactions).(provider.MempoolTransactionEvent); event.Position == nil || event.Position.Block != 1 || event.Confirmed {
+			t.Errorf("Unexpected transaction event %+v", event)
+		}
+		peer.send(`{"txConfirmed":"` + txId + `","block":{"id":"01ff","height":2500002}}`)
+		if event := receive(t, transactions).(provider.MempoolTransactionEvent); !event.Confirmed || event.TxId != txId {
+			t.Errorf("Unexpected transaction event %+v", event)
+		}
+		receive(t, blocks)
+
+		// a second address switches to the multi-address subscription
+		others, err := ws.TrackAddress(ctx, other)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if track := peer.message(); len(track["track-addresses"].([]interface{})) != 2 {
+			t.Errorf("Unexpected track-addresses message %v", track)
+		}
+		peer.send(`{"multi-address-transactions":{"` + other.Show(&network) + `":{"mempool":[],"confirmed":[],"removed":[` + transaction + `]}}}`)
+		if event := receive(t, others).(provider.MempoolAddressEvent); !event.Removed || event.Address != other.Show(&network) {
+			t.Errorf("Unexpected address event %+v", event)
+		}
+
+		// a lost connection is re-established with the subscriptions
+		peer.conn.Close()
+		peer = <-peers
+		subscriptions(peer, "track-addresses")
+		peer.send(`{"block":{"id":"02ff","height":2500003}}`)
+		if block := receive(t, blocks).(provider.MempoolBlockEvent); block.Height != 2500003 {
+			t.Errorf("Unexpected block %+v", block)
+		}
+
+		// and so is a connection closed by the server
+		peer.write(true, 0x8, []byte{0x03, 0xe8})
+		if opcode, _ := peer.frame(); opcode != 0x8 {
+			t.Errorf("Expected the close frame to be acknowledged")
+		}
+		peer = <-peers
+		subscriptions(peer, "track-addresses")
+
+		ws.Close()
+		if _, ok := <-blocks; ok {
+			t.Errorf("Expected the channels to be closed")
+		}
+		<-ws.Done()
+		if _, err := ws.SubscribeBlocks(ctx); !errors.Is(err, provider.ErrClosed) {
+			t.Errorf("Expected ErrClosed, got %v", err)
+		}
+	})
+
+	t.Run("keepalive", func(t *testing.T) {
+		ws := newClient()
+		ws.PingInterval = 20 * time.Millisecond
+		if err := ws.Connect(ctx); err != nil {
+			t.Fatal(err)
+		}
+		defer ws.Close()
+		peer := <-peers
+		if opcode, _ := peer.frame(); opcode != 0x9 {
+			t.Errorf("Expected a ping, got %d", opcode)
+		}
+		// the server never answers, the connection is considered lost
+		select {
+		case <-peers:
+		case <-time.After(5 * time.Second):
+			t.Fatalf("Expected a reconnection")
+		}
+	})
+
+	t.Run("handshake", func(t *testing.T) {
+		unavailable := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			http.Error(w, "maintenance", http.StatusServiceUnavailable)
+		}))
+		defer unavailable.Close()
+		ws := newClient()
+		ws.URL = "ws" + strings.TrimPrefix(unavailable.URL, "http")
+		if err := ws.Connect(ctx); !errors.Is(err, provider.ErrUnavailable) {
+			t.Errorf("Expected ErrUnavailable, got %v", err)
+		}
+		cancelled, cancel := context.WithCancel(ctx)
+		cancel()
+		ws.URL = "ws" + strings.TrimPrefix(server.URL, "http")
+		if err := ws.Connect(cancelled); !errors.Is(err, context.Canceled) {
+			t.Errorf("Expected context.Canceled, got %v", err)
+		}
+		ws.Close()
+		<-ws.Done()
+	})
+}
@@ -0,0 +1,427 @@
+package test
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/mrtnetwork/bitcoin/ecc"
+	"github.com/mrtnetwork/bitcoin/formating"
+	"github.com/mrtnetwork/bitcoin/keypair"
+	"github.com/mrtnetwork/bitcoin/musig2"
+)
+
+// BIP327 test vectors, https://github.com/bitcoin/bips/tree/master/bip-0327/vectors
+func loadBip327Vector(t *testing.T, name string, v interface{}) {
+	data, err := os.ReadFile("testdata/bip327/" + name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		t.Fatal(err)
+	}
+}
+
+type bip327Error struct {
+	Type    string `json:"type"`
+	Signer  *int   `json:"signer"`
+	Contrib string `json:"contrib"`
+	Message string `json:"message"`
+}
+
+func checkBip327Error(t *testing.T, err error, expected bip327Error, comment string) {
+	if err == nil {
+		t.Errorf("%s: expected error", comment)
+		return
+	}
+	if expected.Type != "invalid_contribution" {
+		return
+	}
+	var contribErr *musig2.InvalidContributionError
+	if !errors.As(err, &contribErr) {
+		t.Errorf("%s: expected invalid contribution, but got %v", comment, err)
+		return
+	}
+	signer := -1
+	if expected.Signer != nil {
+		signer = *expected.Signer
+	}
+	if contribErr.Signer != signer || (expected.Contrib != "" && contribErr.Contrib != expected.Contrib) {
+		t.Errorf("%s: expected %v, but got %v", comment, expected, contribErr)
+	}
+}
+
+func pick(list []string, indices []int) [][]byte {
+	result := make([][]byte, len(indices))
+	for i, index := range indices {
+		result[i] = formating.HexToBytes(list[index])
+	}
+	return result
+}
+
+func TestMuSig2(t *testing.T) {
+	t.Run("key_sort", func(t *testing.T) {
+		var v struct {
+			Pubkeys       []string `json:"pubkeys"`
+			SortedPubkeys []string `json:"sorted_pubkeys"`
+		}
+		loadBip327Vector(t, "key_sort_vectors.json", &v)
+		sorted := musig2.KeySort(pick(v.Pubkeys, []int{0, 1, 2, 3, 4}))
+		for i, pk := range sorted {
+			if !strings.EqualFold(formating.BytesToHex(pk), v.SortedPubkeys[i]) {
+				t.Errorf("Expected %v, but got %v", v.SortedPubkeys[i], formating.BytesToHex(pk))
+			}
+		}
+	})
+	t.Run("key_agg", func(t *testing.T) {
+		var v struct {
+			Pubkeys        []string `json:"pubkeys"`
+			Tweaks         []string `json:"tweaks"`
+			ValidTestCases []struct {
+				KeyIndices []int  `json:"key_indices"`
+				Expected   string `json:"expected"`
+			} `json:"valid_test_cases"`
+			ErrorTestCases []struct {
+				KeyIndices   []int       `json:"key_indices"`
+				TweakIndices []int       `json:"tweak_indices"`
+				IsXOnly      []bool      `json:"is_xonly"`
+				Error        bip327Error `json:"error"`
+				Comment      string      `json:"comment"`
+			} `json:"error_test_cases"`
+		}
+		loadBip327Vector(t, "key_agg_vectors.json", &v)
+		for _, c := range v.ValidTestCases {
+			ctx, err := musig2.KeyAgg(pick(v.Pubkeys, c.KeyIndices))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !strings.EqualFold(formating.BytesToHex(ctx.XOnlyPublicKey()), c.Expected) {
+				t.Errorf("Expected %v, but got %v", c.Expected, formating.BytesToHex(ctx.XOnlyPublicKey()))
+			}
+		}
+		for _, c := range v.ErrorTestCases {
+			ctx, err := musig2.KeyAgg(pick(v.Pubkeys, c.KeyIndices))
+			tweaks := pick(v.Tweaks, c.TweakIndices)
+			for i := 0; err == nil && i < len(tweaks); i++ {
+				ctx, err = ctx.ApplyTweak(tweaks[i], c.IsXOnly[i])
+			}
+			checkBip327Error(t, err, c.Error, c.Comment)
+		}
+	})
+	t.Run("nonce_gen", func(t *testing.T) {
+		var v struct {
+			TestCases []struct {
+				Rand     string  `json:"rand_"`
+				Sk       *string `json:"sk"`
+				Pk       string  `json:"pk"`
+				AggPk    *string `json:"aggpk"`
+				Msg      *string `json:"msg"`
+				ExtraIn  *string `json:"extra_in"`
+				Expected string  `json:"expected"`
+			} `json:"test_cases"`
+		}
+		loadBip327Vector(t, "nonce_gen_vectors.json", &v)
+		optional := func(s *string) []byte {
+			if s == nil {
+				return nil
+			}
+			return append([]byte{}, formating.HexToBytes(*s)...)
+		}
+		for _, c := range v.TestCases {
+			secnonce, pubnonce, err := musig2.NonceGenWithRand(formating.HexToBytes(c.Rand), optional(c.Sk),
+				formating.HexToBytes(c.Pk), optional(c.AggPk), optional(c.Msg), optional(c.ExtraIn))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !strings.EqualFold(formating.BytesToHex(secnonce), c.Expected) {
+				t.Errorf("Expected %v, but got %v", c.Expected, formating.BytesToHex(secnonce))
+			}
+			if len(pubnonce) != 66 {
+				t.Errorf("Expected 66 bytes public nonce, but got %v", len(pubnonce))
+			}
+		}
+	})
+	t.Run("nonce_agg", func(t *testing.T) {
+		var v struct {
+			Pnonces        []string `json:"pnonces"`
+			ValidTestCases []struct {
+				PnonceIndices []int  `json:"pnonce_indices"`
+				Expected      string `json:"expected"`
+			} `json:"valid_test_cases"`
+			ErrorTestCases []struct {
+				PnonceIndices []int       `json:"pnonce_indices"`
+				Error         bip327Error `json:"error"`
+				Comment       string      `json:"comment"`
+			} `json:"error_test_cases"`
+		}
+		loadBip327Vector(t, "nonce_agg_vectors.json", &v)
+		for _, c := range v.ValidTestCases {
+			aggnonce, err := musig2.NonceAgg(pick(v.Pnonces, c.PnonceIndices))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !strings.EqualFold(formating.BytesToHex(aggnonce), c.Expected) {
+				t.Errorf("Expected %v, but got %v", c.Expected, formating.BytesToHex(aggnonce))
+			}
+		}
+		for _, c := range v.ErrorTestCases {
+			_, err := musig2.NonceAgg(pick(v.Pnonces, c.PnonceIndices))
+			checkBip327Error(t, err, c.Error, c.Comment)
+		}
+	})
+	t.Run("sign_verify", func(t *testing.T) {
+		var v struct {
+			Sk             string   `json:"sk"`
+			Pubkeys        []string `json:"pubkeys"`
+			Secnonces      []string `json:"secnonces"`
+			Pnonces        []string `json:"pnonces"`
+			Aggnonces      []string `json:"aggnonces"`
+			Msgs           []string `json:"msgs"`
+			ValidTestCases []struct {
+				KeyIndices    []int  `json:"key_indices"`
+				NonceIndices  []int  `json:"nonce_indices"`
+				AggnonceIndex int    `json:"aggnonce_index"`
+				MsgIndex      int    `json:"msg_index"`
+				SignerIndex   int    `json:"signer_index"`
+				Expected      string `json:"expected"`
+			} `json:"valid_test_cases"`
+			SignErrorTestCases []struct {
+				KeyIndices    []int       `json:"key_indices"`
+				AggnonceIndex int         `json:"aggnonce_index"`
+				MsgIndex      int         `json:"msg_index"`
+				SecnonceIndex int         `json:"secnonce_index"`
+				Error         bip327Error `json:"error"`
+				Comment       string      `json:"comment"`
+			} `json:"sign_error_test_cases"`
+			VerifyFailTestCases []struct {
+				Sig          string `json:"sig"`
+				KeyIndices   []int  `json:"key_indices"`
+				NonceIndices []int  `json:"nonce_indices"`
+				MsgIndex     int    `json:"msg_index"`
+				SignerIndex  int    `json:"signer_index"`
+				Comment      string `json:"comment"`
+			} `json:"verify_fail_test_cases"`
+			VerifyErrorTestCases []struct {
+				Sig          string      `json:"sig"`
+				KeyIndices   []int       `json:"key_indices"`
+				NonceIndices []int       `json:"nonce_indices"`
+				MsgIndex     int         `json:"msg_index"`
+				SignerIndex  int         `json:"signer_index"`
+				Error        bip327Error `json:"error"`
+				Comment      string      `json:"comment"`
+			} `json:"verify_error_test_cases"`
+		}
+		loadBip327Vector(t, "sign_verify_vectors.json", &v)
+		sk := formating.HexToBytes(v.Sk)
+		for _, c := range v.ValidTestCases {
+			pubkeys := pick(v.Pubkeys, c.KeyIndices)
+			pubnonces := pick(v.Pnonces, c.NonceIndices)
+			aggnonce, err := musig2.NonceAgg(pubnonces)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !strings.EqualFold(formating.BytesToHex(aggnonce), v.Aggnonces[c.AggnonceIndex]) {
+				t.Errorf("Expected %v, but got %v", v.Aggnonces[c.AggnonceIndex], formating.BytesToHex(aggnonce))
+			}
+			msg := formating.HexToBytes(v.Msgs[c.MsgIndex])
+			session := musig2.NewSessionContext(aggnonce, pubkeys, nil, nil, msg)
+			psig, err := musig2.Sign(formating.HexToBytes(v.Secnonces[0]), sk, session)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !strings.EqualFold(formating.BytesToHex(psig), c.Expected) {
+				t.Errorf("Expected %v, but got %v", c.Expected, formating.BytesToHex(psig))
+			}
+			ok, err := musig2.PartialSigVerify(psig, pubnonces, pubkeys, nil, nil, msg, c.SignerIndex)
+			if err != nil || !ok {
+				t.Errorf("Expected valid partial signature")
+			}
+		}
+		for _, c := range v.SignErrorTestCases {
+			session := musig2.NewSessionContext(formating.HexToBytes(v.Aggnonces[c.AggnonceIndex]),
+				pick(v.Pubkeys, c.KeyIndices), nil, nil, formating.HexToBytes(v.Msgs[c.MsgIndex]))
+			_, err := musig2.Sign(formating.HexToBytes(v.Secnonces[c.SecnonceIndex]), sk, session)
+			checkBip327Error(t, err, c.Error, c.Comment)
+		}
+		for _, c := range v.VerifyFailTestCases {
+			ok, err := musig2.PartialSigVerify(formating.HexToBytes(c.Sig), pick(v.Pnonces, c.NonceIndices),
+				pick(v.Pubkeys, c.KeyIndices), nil, nil, formating.HexToBytes(v.Msgs[c.MsgIndex]), c.SignerIndex)
+			if err != nil || ok {
+				t.Errorf("%s: expected verification failure", c.Comment)
+			}
+		}
+		for _, c := range v.VerifyErrorTestCases {
+			_, err := musig2.PartialSigVerify(formating.HexToBytes(c.Sig), pick(v.Pnonces, c.NonceIndices),
+				pick(v.Pubkeys, c.KeyIndices), nil, nil, formating.HexToBytes(v.Msgs[c.MsgIndex]), c.SignerIndex)
+			checkBip327Error(t, err, c.Error, c.Comment)
+		}
+	})
+	t.Run("tweak", func(t *testing.T) {
+		var v struct {
+			Sk             string   `json:"sk"`
+			Pubkeys        []string `json:"pubkeys"`
+			Secnonce       string   `json:"secnonce"`
+			Pnonces        []string `json:"pnonces"`
+			Aggnonce       string   `json:"aggnonce"`
+			Tweaks         []string `json:"tweaks"`
+			Msg            string   `json:"msg"`
+			ValidTestCases []struct {
+				KeyIndices   []int  `json:"key_indices"`
+				NonceIndices []int  `json:"nonce_indices"`
+				TweakIndices []int  `json:"tweak_indices"`
+				IsXOnly      []bool `json:"is_xonly"`
+				SignerIndex  int    `json:"signer_index"`
+				Expected     string `json:"expected"`
+			} `json:"valid_test_cases"`
+			ErrorTestCases []struct {
+				KeyIndices   []int       `json:"key_indices"`
+				NonceIndices []int       `json:"nonce_indices"`
+				TweakIndices []int       `json:"tweak_indices"`
+				IsXOnly      []bool      `json:"is_xonly"`
+				Error        bip327Error `json:"error"`
+				Comment      string      `json:"comment"`
+			} `json:"error_test_cases"`
+		}
+		loadBip327Vector(t, "tweak_vectors.json", &v)
+		sk := formating.HexToBytes(v.Sk)
+		msg := formating.HexToBytes(v.Msg)
+		for _, c := range v.ValidTestCases {
+			pubkeys := pick(v.Pubkeys, c.KeyIndices)
+			pubnonces := pick(v.Pnonces, c.NonceIndices)
+			tweaks := pick(v.Tweaks, c.TweakIndices)
+			session := musig2.NewSessionContext(formating.HexToBytes(v.Aggnonce), pubkeys, tweaks, c.IsXOnly, msg)
+			psig, err := musig2.Sign(formating.HexToBytes(v.Secnonce), sk, session)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !strings.EqualFold(formating.BytesToHex(psig), c.Expected) {
+				t.Errorf("Expected %v, but got %v", c.Expected, formating.BytesToHex(psig))
+			}
+			ok, err := musig2.PartialSigVerify(psig, pubnonces, pubkeys, tweaks, c.IsXOnly, msg, c.SignerIndex)
+			if err != nil || !ok {
+				t.Errorf("Expected valid partial signature")
+			}
+		}
+		for _, c := range v.ErrorTestCases {
+			session := musig2.NewSessionContext(formating.HexToBytes(v.Aggnonce), pick(v.Pubkeys, c.KeyIndices),
+				pick(v.Tweaks, c.TweakIndices), c.IsXOnly, msg)
+			_, err := musig2.Sign(formating.HexToBytes(v.Secnonce), sk, session)
+			checkBip327Error(t, err, c.Error, c.Comment)
+		}
+	})
+	t.Run("sig_agg", func(t *testing.T) {
+		var v struct {
+			Pubkeys        []string `json:"pubkeys"`
+			Pnonces        []string `json:"pnonces"`
+			Tweaks         []string `json:"tweaks"`
+			Psigs          []string `json:"psigs"`
+			Msg            string   `json:"msg"`
+			ValidTestCases []struct {
+				Aggnonce     string `json:"aggnonce"`
+				NonceIndices []int  `json:"nonce_indices"`
+				KeyIndices   []int  `json:"key_indices"`
+				TweakIndices []int  `json:"tweak_indices"`
+				IsXOnly      []bool `json:"is_xonly"`
+				PsigIndices  []int  `json:"psig_indices"`
+				Expected     string `json:"expected"`
+			} `json:"valid_test_cases"`
+			ErrorTestCases []struct {
+				Aggnonce     string      `json:"aggnonce"`
+				KeyIndices   []int       `json:"key_indices"`
+				TweakIndices []int       `json:"tweak_indices"`
+				IsXOnly      []bool      `json:"is_xonly"`
+				PsigIndices  []int       `json:"psig_indices"`
+				Error        bip327Error `json:"error"`
+				Comment      string      `json:"comment"`
+			} `json:"error_test_cases"`
+		}
+		loadBip327Vector(t, "sig_agg_vectors.json", &v)
+		msg := formating.HexToBytes(v.Msg)
+		for _, c := range v.ValidTestCases {
+			aggnonce, err := musig2.NonceAgg(pick(v.Pnonces, c.NonceIndices))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !strings.EqualFold(formating.BytesToHex(aggnonce), c.Aggnonce) {
+				t.Errorf("Expected %v, but got %v", c.Aggnonce, formating.BytesToHex(aggnonce))
+			}
+			pubkeys := pick(v.Pubkeys, c.KeyIndices)
+			tweaks := pick(v.Tweaks, c.TweakIndices)
+			session := musig2.NewSessionContext(aggnonce, pubkeys, tweaks, c.IsXOnly, msg)
+			sig, err := musig2.PartialSigAgg(pick(v.Psigs, c.PsigIndices), session)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !strings.EqualFold(formating.BytesToHex(sig), c.Expected) {
+				t.Errorf("Expected %v, but got %v", c.Expected, formating.BytesToHex(sig))
+			}
+			ctx, _ := musig2.KeyAgg(pubkeys)
+			for i := range tweaks {
+				ctx, _ = ctx.ApplyTweak(tweaks[i], c.IsXOnly[i])
+			}
+			if !ecc.VerifySchnorr(msg, ctx.XOnlyPublicKey(), sig) {
+				t.Errorf("Invalid schnorr signature")
+			}
+		}
+		for _, c := range v.ErrorTestCases {
+			session := musig2.NewSessionContext(formating.HexToBytes(c.Aggnonce), pick(v.Pubkeys, c.KeyIndices),
+				pick(v.Tweaks, c.TweakIndices), c.IsXOnly, msg)
+			_, err := musig2.PartialSigAgg(pick(v.Psigs, c.PsigIndices), session)
+			checkBip327Error(t, err, c.Error, c.Comment)
+		}
+	})
+	t.Run("taproot_key_path", func(t *testing.T) {
+		sk1, _ := keypair.NewECPrivateFromWIF("cTALNpTpRbbxTCJ2A5Vq88UxT44w1PE2cYqiB3n4hRvzyCev1Wwo")
+		sk2, _ := keypair.NewECPrivateFromWIF("cRvyLwCPLU88jsyj94L7iJjQX5C2f8koG4G2gevN4BeSGcEvfKe9")
+		signers := []*keypair.ECPrivate{sk1, sk2}
+		pubkeys := musig2.KeySort([][]byte{sk1.GetPublic().ToCompressedBytes(), sk2.GetPublic().ToCompressedBytes()})
+		ctx, err := musig2.KeyAgg(pubkeys)
+		if err != nil {
+			t.Fatal(err)
+		}
+		tweak := ctx.TaprootTweak(nil)
+		tweaked, err := ctx.ApplyTweak(tweak, true)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// the tweaked key must be the taproot output key of the aggregate key
+		aggregate, _ := keypair.NewECPPublicFromBytes(ctx.PublicKey())
+		program, _ := aggregate.ToTapRotHex(nil)
+		if !strings.EqualFold(program, formating.BytesToHex(tweaked.XOnlyPublicKey())) {
+			t.Errorf("Expected %v, but got %v", program, formating.BytesToHex(tweaked.XOnlyPublicKey()))
+		}
+		msg := formating.HexToBytes("0101010101010101010101010101010101010101010101010101010101010101")
+		secnonces := make([][]byte, len(signers))
+		pubnonces := make([][]byte, len(signers))
+		for i, signer := range signers {
+			secnonces[i], pubnonces[i], err = musig2.NonceGen(signer.ToBytes(), signer.GetPublic().ToCompressedBytes(), tweaked.XOnlyPublicKey(), msg, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+		aggnonce, _ := musig2.NonceAgg(pubnonces)
+		session := musig2.NewSessionContext(aggnonce, pubkeys, [][]byte{tweak}, []bool{true}, msg)
+		psigs := make([][]byte, len(signers))
+		for i, signer := range signers {
+			psigs[i], err = musig2.Sign(secnonces[i], signer.ToBytes(), session)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if ok, _ := session.VerifyPartialSignature(psigs[i], pubnonces[i], signer.GetPublic().ToCompressedBytes()); !ok {
+				t.Errorf("Invalid partial signature")
+			}
+		}
+		if _, err := musig2.Sign(secnonces[0], sk1.ToBytes(), session); err == nil {
+			t.Errorf("Expected error on secret nonce reuse")
+		}
+		sig, err := musig2.PartialSigAgg(psigs, session)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !ecc.VerifySchnorr(msg, tweaked.XOnlyPublicKey(), sig) {
+			t.Errorf("Invalid schnorr signature")
+		}
+	})
+}
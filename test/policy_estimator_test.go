@@ -0,0 +1,167 @@
+package test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"testing"
+
+	"github.com/mrtnetwork/bitcoin/provider"
+	"github.com/mrtnetwork/bitcoin/scripts"
+)
+
+func TestBlockPolicyEstimator(t *testing.T) {
+	ctx := context.Background()
+	estimator := provider.NewBlockPolicyEstimator()
+	if _, err := estimator.EstimateFee(2, 0.85); err == nil {
+		t.Errorf("Expected an error without data")
+	}
+
+	// every block, 5 transactions of each class enter the mempool: 50 sat/vB confirmed in the next
+	// block, 20 sat/vB half in the next block and half after 6 blocks, 10 sat/vB after 3 blocks
+	// and 2 sat/vB after 10 blocks
+	classes := []struct {
+		rate  provider.FeeRate
+		waits []int
+	}{
+		{50000, []int{1}},
+		{20000, []int{1, 6}},
+		{10000, []int{3}},
+		{2000, []int{10}},
+	}
+	pending := map[int][]string{}
+	count := 0
+	for height := 100; height < 400; height++ {
+		estimator.ProcessBlock(height, &provider.Block{TxIds: pending[height]})
+		for _, class := range classes {
+			for i := 0; i < 5; i++ {
+				count++
+				txId := fmt.Sprintf("%064x", count)
+				estimator.AddEntry(txId, class.rate, height)
+				wait := class.waits[i%len(class.waits)]
+				pending[height+wait] = append(pending[height+wait], txId)
+			}
+		}
+	}
+	if estimator.Height() != 399 {
+		t.Errorf("Unexpected height %d", estimator.Height())
+	}
+	if estimator.ProcessBlock(399, &provider.Block{}) {
+		t.Errorf("Expected a processed block to be ignored")
+	}
+
+	for _, test := range []struct {
+		target     int
+		confidence float64
+		expected   provider.FeeRate
+	}{
+		{1, 0.85, 50000},
+		{1, 0.4, 20000},
+		{2, 0.85, 50000},
+		// the 20 sat/vB bucket fails, the cheaper buckets are not considered
+		{3, 0.85, 50000},
+		{3, 0.7, 50000},
+		{5, 0.85, 50000},
+		{6, 0.95, 10000},
+		{10, 0.85, 2000},
+		{144, 0.95, 2000},
+		{1008, 0.95, 2000},
+	} {
+		if rate, err := estimator.EstimateFee(test.target, test.confidence); err != nil || rate != test.expected {
+			t.Errorf("Unexpected rate for %d blocks at %v: %v %v", test.target, test.confidence, rate, err)
+		}
+	}
+	for _, invalid := range [][2]float64{{0, 0.85}, {1009, 0.85}, {2, 0}, {2, 1.5}} {
+		if _, err := estimator.EstimateFee(int(invalid[0]), invalid[1]); err == nil {
+			t.Errorf("Expected an error for %v", invalid)
+		}
+	}
+
+	// the estimator is a fee source
+	estimates, err := estimator.GetFeeEstimates(ctx)
+	if err != nil || estimates[1] != 50000 || estimates[6] != 10000 || estimates[12] != 2000 || estimates[1008] != 2000 {
+		t.Errorf("Unexpected estimates %v %v", estimates, err)
+	}
+	if rate, err := provider.NewFeeEstimator(estimator).EstimateFee(ctx, 6); err != nil || rate != 10000 {
+		t.Errorf("Unexpected combined rate %v %v", rate, err)
+	}
+
+	// the state is restored with the transactions still waiting
+	data, err := json.Marshal(estimator)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var restored provider.BlockPolicyEstimator
+	if err := json.Unmarshal(data, &restored); err != nil {
+		t.Fatal(err)
+	}
+	if restored.Height() != 399 || restored.Confidence != provider.DefaultFeeConfidence {
+		t.Errorf("Unexpected restored estimator %d %v", restored.Height(), restored.Confidence)
+	}
+	for _, target := range []int{1, 6, 10, 144} {
+		expected, _ := estimator.EstimateFee(target, 0.85)
+		if rate, err := restored.EstimateFee(target, 0.85); err != nil || rate != expected {
+			t.Errorf("Unexpected restored rate for %d blocks: %v %v", target, rate, err)
+		}
+	}
+	restored.ProcessBlock(400, &provider.Block{TxIds: pending[400]})
+	if err := json.Unmarshal([]byte(`{"buckets":[1000],"height":1}`), &restored); err == nil {
+		t.Errorf("Expected an invalid state error")
+	}
+
+	// transactions evicted after waiting 3 blocks are failures for the targets up to 3 blocks, a
+	// cheaper bucket does not pass with them
+	tx, err := scripts.BtcTransactionFromRaw(genesisBlock[162:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	vsize := tx.GetVSize()
+	estimator.AddTransaction(tx, big.NewInt(int64(vsize*200)), 399)
+	for i := 0; i < 200; i++ {
+		estimator.AddEntry(fmt.Sprintf("ff%062x", i), 200000, 399)
+	}
+	for height := 400; height < 403; height++ {
+		estimator.ProcessBlock(height, &provider.Block{TxIds: pending[height]})
+	}
+	estimator.RemoveTransaction(tx.TxId())
+	for i := 0; i < 200; i++ {
+		estimator.RemoveTransaction(fmt.Sprintf("ff%062x", i))
+	}
+	if _, err := estimator.EstimateFee(3, 0.85); err == nil {
+		t.Errorf("Expected the evicted transactions to fail the estimation")
+	}
+	if rate, err := estimator.EstimateFee(10, 0.85); err != nil || rate != 2000 {
+		t.Errorf("Unexpected rate for 10 blocks %v %v", rate, err)
+	}
+}
+
+func TestBlockPolicyEstimatorFailingBucket(t *testing.T) {
+	// 5 transactions at 30 sat/vB wait 8 blocks while 50 at 5 sat/vB confirm in the next block,
+	// the two buckets together would confirm 90% of the transactions within 2 blocks
+	estimator := provider.NewBlockPolicyEstimator()
+	pending := map[int][]string{}
+	count := 0
+	for height := 100; height < 300; height++ {
+		estimator.ProcessBlock(height, &provider.Block{TxIds: pending[height]})
+		for _, class := range []struct {
+			rate  provider.FeeRate
+			wait  int
+			count int
+		}{{30000, 8, 5}, {5000, 1, 50}} {
+			for i := 0; i < class.count; i++ {
+				count++
+				txId := fmt.Sprintf("%064x", count)
+				estimator.AddEntry(txId, class.rate, height)
+				pending[height+class.wait] = append(pending[height+class.wait], txId)
+			}
+		}
+	}
+	// the failing expensive bucket ends the search before the cheap one passing
+	if rate, err := estimator.EstimateFee(2, 0.85); err == nil {
+		t.Errorf("Expected no estimate below a failing bucket, got %v", rate)
+	}
+	if rate, err := estimator.EstimateFee(8, 0.85); err != nil || rate != 5000 {
+		t.Errorf("Unexpected rate for 8 blocks %v %v", rate, err)
+	}
+}
@@ -0,0 +1,296 @@
+package test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mrtnetwork/bitcoin/address"
+	"github.com/mrtnetwork/bitcoin/provider"
+)
+
+// countingTransport counts the requests sent through an injected http.Client
+type countingTransport struct {
+	requests int
+}
+
+func (c *countingTransport) RoundTrip(request *http.Request) (*http.Response, error) {
+	c.requests++
+	return http.DefaultTransport.RoundTrip(request)
+}
+
+func TestChainProvider(t *testing.T) {
+	network := address.TestnetNetwork
+	addr, _ := address.P2WPKHAddresssFromAddress("tb1q92nmnvhj04sqd4x7wjaewlt5jn8n3ngmplcymy")
+	owner := provider.UtxoOwnerDetails{Address: addr}
+	txId := "d4bad8e07d30ca4389ec8a203318aa523cc3e36c9730d0a6852a3801d086c5fe"
+	ctx := context.Background()
+
+	mempoolTx := func(id string, confirmed bool) map[string]interface{} {
+		status := map[string]interface{}{"confirmed": confirmed}
+		if confirmed {
+			status = map[string]interface{}{"confirmed": true, "block_height": 2500000, "block_hash": "00ff", "block_time": 1700000000}
+		}
+		return map[string]interface{}{
+			"txid": id, "version": 2, "locktime": 0, "size": 222, "weight": 561, "fee": 1410,
+			"vin": []interface{}{map[string]interface{}{
+				"txid": strings.Repeat("11", 32), "vout": 1, "sequence": 4294967293, "witness": []string{"30", "02"},
+				"prevout": map[string]interface{}{"scriptpubkey_address": addr.Show(network), "value": 100000},
+			}},
+			"vout":   []interface{}{map[string]interface{}{"scriptpubkey": "0014aa", "scriptpubkey_address": addr.Show(network), "value": 98590}},
+			"status": status,
+		}
+	}
+
+	mempool := http.NewServeMux()
+	mempool.HandleFunc("/address/"+addr.Show(network)+"/utxo", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `[{"txid":"`+txId+`","vout":1,"status":{"confirmed":true,"block_height":2500000},"value":5000}]`)
+	})
+	mempool.HandleFunc("/tx/"+txId, func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(mempoolTx(txId, true))
+	})
+	mempool.HandleFunc("/address/"+addr.Show(network)+"/txs", func(w http.ResponseWriter, r *http.Request) {
+		transactions := []interface{}{mempoolTx("unconfirmed", false)}
+		for i := 0; i < 25; i++ {
+			transactions = append(transactions, mempoolTx(fmt.Sprintf("first%d", i), true))
+		}
+		json.NewEncoder(w).Encode(transactions)
+	})
+	mempool.HandleFunc("/address/"+addr.Show(network)+"/txs/chain/first24", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode([]interface{}{mempoolTx("last", true)})
+	})
+	mempool.HandleFunc("/v1/fees/recommended", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"fastestFee":20,"halfHourFee":10,"hourFee":5,"economyFee":2,"minimumFee":1}`)
+	})
+	mempool.HandleFunc("/tx", func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if string(body) != "0200" {
+			http.Error(w, "sendrawtransaction RPC error: TX decode failed", http.StatusBadRequest)
+			return
+		}
+		fmt.Fprint(w, txId)
+	})
+	mempool.HandleFunc("/blocks/tip/height", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "2500010")
+	})
+	// Esplora endpoints, the API of mempool.space is derived from it
+	mempool.HandleFunc("/fee-estimates", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"1":25.3,"2":20,"3":15.1,"6":10,"25":3.2,"144":1,"1008":1.0}`)
+	})
+	mempool.HandleFunc("/tx/"+txId+"/status", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(mempoolTx(txId, true)["status"])
+	})
+	mempool.HandleFunc("/tx/"+txId+"/merkle-proof", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"block_height":2500000,"merkle":["`+strings.Repeat("22", 32)+`"],"pos":3}`)
+	})
+	mempool.HandleFunc("/tx/"+txId+"/hex", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "0200000001"+strings.Repeat("11", 32)+"0100000000fdffffff01e803000000000000160014"+strings.Repeat("aa", 20)+"00000000")
+	})
+	mempool.HandleFunc("/block-height/0", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, genesisHash)
+	})
+	mempool.HandleFunc("/block/"+genesisHash+"/header", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, genesisBlock[:160])
+	})
+	mempool.HandleFunc("/block/"+genesisHash, func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"id":"`+genesisHash+`","height":0}`)
+	})
+	mempoolServer := httptest.NewServer(mempool)
+	defer mempoolServer.Close()
+
+	blockCypher := http.NewServeMux()
+	blockCypher.HandleFunc("/addrs/"+addr.Show(network), func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"txrefs":[{"tx_hash":"`+txId+`","block_height":2500000,"tx_output_n":1,"value":5000}],
+			"unconfirmed_txrefs":[{"tx_hash":"`+txId+`","block_height":-1,"tx_output_n":2,"value":700}]}`)
+	})
+	blockCypher.HandleFunc("/txs/"+txId, func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"block_height":-1,"hash":"`+txId+`","fees":1410,"size":222,"vsize":141,"ver":2,
+			"inputs":[{"prev_hash":"`+strings.Repeat("11", 32)+`","output_index":1,"output_value":100000,"addresses":["`+addr.Show(network)+`"]}],
+			"outputs":[{"value":98590,"script":"0014aa","addresses":["`+addr.Show(network)+`"]}]}`)
+	})
+	blockCypher.HandleFunc("/addrs/"+addr.Show(network)+"/full", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("before") == "" {
+			fmt.Fprint(w, `{"txs":[{"hash":"a","block_height":-1},{"hash":"b","block_height":2500005}],"hasMore":true}`)
+			return
+		}
+		fmt.Fprint(w, `{"txs":[{"hash":"c","block_height":2400000}],"hasMore":false}`)
+	})
+	blockCypher.HandleFunc("/txs/push", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"tx":{"hash":"`+txId+`"}}`)
+	})
+	blockCypher.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/" {
+			http.NotFound(w, r)
+			return
+		}
+		fmt.Fprint(w, `{"height":2500010,"high_fee_per_kb":20000,"medium_fee_per_kb":10000,"low_fee_per_kb":1000}`)
+	})
+	blockCypherServer := httptest.NewServer(blockCypher)
+	defer blockCypherServer.Close()
+
+	transport := &countingTransport{}
+	client := &http.Client{Transport: transport}
+	mempoolApi := provider.NewMempoolProvider(&network, client)
+	mempoolApi.BaseURL = mempoolServer.URL
+	blockCypherApi := provider.NewBlockCypherProvider(&network, client)
+	blockCypherApi.BaseURL = blockCypherServer.URL
+	esploraApi := provider.NewEsploraProvider(&network, client)
+	esploraApi.BaseURL = mempoolServer.URL
+
+	for name, api := range map[string]provider.ChainProvider{"mempool": mempoolApi, "blockcypher": blockCypherApi, "esplora": esploraApi} {
+		t.Run(name, func(t *testing.T) {
+			utxos, err := api.GetAccountUtxo(ctx, owner)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(utxos) == 0 || utxos[0].Utxo.TxHash != txId || utxos[0].Utxo.Vout != 1 || utxos[0].Utxo.Value.Int64() != 5000 ||
+				utxos[0].Utxo.BlockHeight != 2500000 || utxos[0].Utxo.ScriptType != address.P2WPKH {
+				t.Errorf("Unexpected utxos %+v", utxos)
+			}
+
+			tx, err := api.GetTransaction(ctx, txId)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tx.TxId != txId || tx.Fee.Int64() != 1410 || tx.VSize != 141 || len(tx.Inputs) != 1 || len(tx.Outputs) != 1 {
+				t.Errorf("Unexpected transaction %+v", tx)
+			}
+			if tx.Inputs[0].Value.Int64() != 100000 || tx.Inputs[0].Address != addr.Show(network) || tx.Outputs[0].Value.Int64() != 98590 {
+				t.Errorf("Unexpected inputs or outputs %+v", tx)
+			}
+
+			fee, err := api.GetNetworkFee(ctx)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if fee.High.Int64() != 20000 || fee.Medium.Int64() != 10000 || fee.Low.Int64() != 1000 {
+				t.Errorf("Unexpected fee %v", fee)
+			}
+
+			id, err := api.SendRawTransaction(ctx, "0200")
+			if err != nil || id != txId {
+				t.Errorf("Unexpected broadcast result %v %v", id, err)
+			}
+
+			height, err := api.GetBlockHeight(ctx)
+			if err != nil || height != 2500010 {
+				t.Errorf("Unexpected height %v %v", height, err)
+			}
+
+			if _, err := api.GetTransaction(ctx, "unknown"); !errors.Is(err, provider.ErrNotFound) {
+				t.Errorf("Expected ErrNotFound, got %v", err)
+			}
+			cancelled, cancel := context.WithCancel(ctx)
+			cancel()
+			if _, err := api.GetBlockHeight(cancelled); !errors.Is(err, context.Canceled) {
+				t.Errorf("Expected context.Canceled, got %v", err)
+			}
+		})
+	}
+
+	t.Run("status", func(t *testing.T) {
+		mempoolConfirmed, _ := mempoolApi.GetTransaction(ctx, txId)
+		if !mempoolConfirmed.Status.Confirmed || mempoolConfirmed.Status.BlockHeight != 2500000 || mempoolConfirmed.Status.BlockTime.Unix() != 1700000000 {
+			t.Errorf("Unexpected status %+v", mempoolConfirmed.Status)
+		}
+		blockCypherUnconfirmed, _ := blockCypherApi.GetTransaction(ctx, txId)
+		if blockCypherUnconfirmed.Status.Confirmed || blockCypherUnconfirmed.Status.BlockHeight != 0 {
+			t.Errorf("Unexpected status %+v", blockCypherUnconfirmed.Status)
+		}
+		utxos, _ := blockCypherApi.GetAccountUtxo(ctx, owner)
+		if len(utxos) != 2 || utxos[1].Utxo.BlockHeight != 0 {
+			t.Errorf("Expected the unconfirmed utxo")
+		}
+	})
+
+	t.Run("pagination", func(t *testing.T) {
+		for name, api := range map[string]provider.ChainProvider{"mempool": mempoolApi, "blockcypher": blockCypherApi, "esplora": esploraApi} {
+			ids := []string{}
+			cursor := ""
+			for {
+				page, err := api.GetAccountTransactions(ctx, addr, cursor)
+				if err != nil {
+					t.Fatal(err)
+				}
+				for _, transaction := range page.Transactions {
+					ids = append(ids, transaction.TxId)
+				}
+				if page.Next == "" {
+					break
+				}
+				cursor = page.Next
+			}
+			expected := map[string]int{"mempool": 27, "blockcypher": 3, "esplora": 27}[name]
+			if len(ids) != expected || ids[len(ids)-1] != map[string]string{"mempool": "last", "blockcypher": "c", "esplora": "last"}[name] {
+				t.Errorf("%s: unexpected history %v", name, ids)
+			}
+		}
+	})
+
+	t.Run("esplora", func(t *testing.T) {
+		status, err := esploraApi.GetTransactionStatus(ctx, txId)
+		if err != nil || !status.Confirmed || status.BlockHeight != 2500000 || status.BlockTime.Unix() != 1700000000 {
+			t.Errorf("Unexpected status %+v %v", status, err)
+		}
+		proof, err := esploraApi.GetMerkleProof(ctx, txId)
+		if err != nil || proof.BlockHeight != 2500000 || len(proof.Merkle) != 1 || proof.Pos != 3 {
+			t.Errorf("Unexpected merkle proof %+v %v", proof, err)
+		}
+		tx, err := esploraApi.GetRawTransaction(ctx, txId)
+		if err != nil || len(tx.Inputs) != 1 || tx.Outputs[0].Amount.Int64() != 1000 {
+			t.Errorf("Unexpected raw transaction %v", err)
+		}
+		hash, err := esploraApi.GetBlockHash(ctx, 0)
+		if err != nil || hash != genesisHash {
+			t.Fatalf("Unexpected block hash %v %v", hash, err)
+		}
+		header, err := esploraApi.GetBlockHeader(ctx, hash)
+		if err != nil || header.Hash != genesisHash || header.Height != 0 || header.Nonce != 2083236893 {
+			t.Errorf("Unexpected header %+v %v", header, err)
+		}
+		// targets between two estimates use the estimate of the lower one
+		if fee, err := esploraApi.EstimateFee(ctx, 10); err != nil || fee.SatPerKvB() != 10000 {
+			t.Errorf("Unexpected fee %v %v", fee, err)
+		}
+		if _, err := esploraApi.EstimateFee(ctx, 0); err == nil {
+			t.Errorf("Expected error for a target below the estimates")
+		}
+		if _, ok := provider.SelectApi(provider.BlockstreamApi, &network).(*provider.EsploraProvider); !ok {
+			t.Errorf("Expected the Esplora provider")
+		}
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		if _, err := mempoolApi.SendRawTransaction(ctx, "invalid"); !errors.Is(err, provider.ErrRejected) {
+			t.Errorf("Expected ErrRejected, got %v", err)
+		}
+		status := http.StatusTooManyRequests
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Retry-After", "3")
+			http.Error(w, "slow down", status)
+		}))
+		defer server.Close()
+		api := provider.NewMempoolProvider(&network, client)
+		api.BaseURL = server.URL
+		_, err := api.GetNetworkFee(ctx)
+		var apiError *provider.APIError
+		if !errors.Is(err, provider.ErrRateLimited) || !errors.As(err, &apiError) || apiError.RetryAfter != 3*time.Second {
+			t.Errorf("Expected ErrRateLimited, got %v", err)
+		}
+		status = http.StatusBadGateway
+		if _, err := api.GetNetworkFee(ctx); !errors.Is(err, provider.ErrUnavailable) {
+			t.Errorf("Expected ErrUnavailable, got %v", err)
+		}
+	})
+
+	if transport.requests == 0 {
+		t.Errorf("Expected the requests to use the injected client")
+	}
+}
@@ -0,0 +1,247 @@
+package test
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"testing"
+
+	"github.com/mrtnetwork/bitcoin/address"
+	"github.com/mrtnetwork/bitcoin/constant"
+	"github.com/mrtnetwork/bitcoin/digest"
+	"github.com/mrtnetwork/bitcoin/formating"
+	"github.com/mrtnetwork/bitcoin/keypair"
+	"github.com/mrtnetwork/bitcoin/provider"
+	"github.com/mrtnetwork/bitcoin/provider/providertest"
+	"github.com/mrtnetwork/bitcoin/scripts"
+)
+
+func TestMockServer(t *testing.T) {
+	network := address.TestnetNetwork
+	ctx := context.Background()
+	key, _ := keypair.NewECPrivateFromWIF("cTALNpTpRbbxTCJ2A5Vq88UxT44w1PE2cYqiB3n4hRvzyCev1Wwo")
+	segwit := key.GetPublic().ToSegwitAddress()
+	legacy := key.GetPublic().ToAddress()
+	taproot := key.GetPublic().ToTaprootAddress()
+
+	server := providertest.NewServer(&network)
+	defer server.Close()
+
+	// send spends every utxo of owner to receiver and returns the serialized transaction
+	send := func(api provider.ChainProvider, owner address.BitcoinAddress, receiver address.BitcoinAddress, fee int64) (string, string) {
+		utxos, err := api.GetAccountUtxo(ctx, provider.UtxoOwnerDetails{PublicKey: key.GetPublic().ToHex(), Address: owner})
+		if err != nil {
+			t.Fatal(err)
+		}
+		total := big.NewInt(-fee)
+		for _, utxo := range utxos {
+			total.Add(total, utxo.Utxo.Value)
+		}
+		builder := provider.NewBitcoinTransactionBuilder(utxos, []provider.BitcoinOutputDetails{{Address: receiver, Value: total}}, big.NewInt(fee), &network, "", true)
+		tx, err := builder.BuildTransaction(func(trDigest []byte, utxo provider.UtxoWithOwner, publicKey string) (string, error) {
+			return key.SingInput(trDigest, constant.SIGHASH_ALL), nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return tx.TxId(), tx.Serialize()
+	}
+
+	apis := []struct {
+		name string
+		api  provider.ChainProvider
+	}{
+		{"mempool", server.MempoolProvider()},
+		{"esplora", server.EsploraProvider()},
+		{"blockcypher", server.BlockCypherProvider()},
+	}
+	for _, backend := range apis {
+		t.Run(backend.name, func(t *testing.T) {
+			api := backend.api
+			funding := server.Fund(segwit, big.NewInt(60000))
+			server.Fund(segwit, big.NewInt(40000))
+			utxos, err := api.GetAccountUtxo(ctx, provider.UtxoOwnerDetails{Address: segwit})
+			if err != nil || len(utxos) != 2 || utxos[0].Utxo.BlockHeight != 0 {
+				t.Fatalf("Expected 2 unconfirmed utxos, got %+v %v", utxos, err)
+			}
+			server.Mine(1)
+
+			id, raw := send(api, segwit, legacy, 1000)
+			if sent, err := api.SendRawTransaction(ctx, raw); err != nil || sent != id {
+				t.Fatalf("Unexpected broadcast result %v %v", sent, err)
+			}
+			tx, err := api.GetTransaction(ctx, id)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tx.Status.Confirmed || tx.Fee.Int64() != 1000 || len(tx.Inputs) != 2 || tx.Inputs[0].Address != segwit.Show(&network) ||
+				tx.Outputs[0].Address != legacy.Show(&network) || tx.Outputs[0].Value.Int64() != 99000 {
+				t.Errorf("Unexpected transaction %+v", tx)
+			}
+			if utxos, _ := api.GetAccountUtxo(ctx, provider.UtxoOwnerDetails{Address: segwit}); len(utxos) != 0 {
+				t.Errorf("Expected the spent utxos to be removed, got %+v", utxos)
+			}
+
+			if _, err := api.SendRawTransaction(ctx, raw); !errors.Is(err, provider.ErrRejected) {
+				t.Errorf("Expected ErrRejected for a known transaction, got %v", err)
+			}
+
+			hashes := server.Mine(2)
+			tx, err = api.GetTransaction(ctx, id)
+			if err != nil || !tx.Status.Confirmed || tx.Status.BlockHash != hashes[0] || tx.Status.BlockHeight != server.Height()-1 {
+				t.Errorf("Unexpected status %+v %v", tx, err)
+			}
+			funded, err := api.GetTransaction(ctx, funding.TxId)
+			if err != nil || !funded.Inputs[0].IsCoinbase || funded.Outputs[0].Value.Int64() != 60000 {
+				t.Errorf("Unexpected funding transaction %+v %v", funded, err)
+			}
+
+			// move the coins away for the next backend
+			id, raw = send(api, legacy, taproot, 500)
+			if _, err := api.SendRawTransaction(ctx, raw); err != nil {
+				t.Fatal(err)
+			}
+			server.Mine(1)
+			page, err := api.GetAccountTransactions(ctx, legacy, "")
+			if err != nil || len(page.Transactions) < 2 || page.Transactions[0].TxId != id {
+				t.Errorf("Unexpected history %+v %v", page, err)
+			}
+		})
+	}
+
+	t.Run("rejects", func(t *testing.T) {
+		api := server.MempoolProvider()
+		server.Fund(segwit, big.NewInt(10000))
+		server.Mine(1)
+		utxos, _ := api.GetAccountUtxo(ctx, provider.UtxoOwnerDetails{PublicKey: key.GetPublic().ToHex(), Address: segwit})
+		_, first := send(api, segwit, legacy, 1000)
+		_, second := send(api, segwit, segwit, 2000)
+		if _, err := api.SendRawTransaction(ctx, first); err != nil {
+			t.Fatal(err)
+		}
+		var apiError *provider.APIError
+		if _, err := api.SendRawTransaction(ctx, second); !errors.As(err, &apiError) || !errors.Is(err, provider.ErrRejected) ||
+			apiError.Message != `sendrawtransaction RPC error: {"code":-26,"message":"txn-mempool-conflict"}` {
+			t.Errorf("Expected a mempool conflict, got %v", err)
+		}
+		server.Mine(1)
+		if _, err := server.BlockCypherProvider().SendRawTransaction(ctx, second); !errors.Is(err, provider.ErrRejected) {
+			t.Errorf("Expected a double spend, got %v", err)
+		}
+		if _, err := server.Broadcast(second); err == nil || err.Error() != "bad-txns-inputs-missingorspent" {
+			t.Errorf("Expected bad-txns-inputs-missingorspent, got %v", err)
+		}
+		if _, err := server.Broadcast("0200"); err == nil {
+			t.Errorf("Expected a decode error")
+		}
+
+		// outputs above the inputs, the signatures are not verified
+		server.Fund(legacy, big.NewInt(10000))
+		_, raw := send(api, legacy, segwit, 1000)
+		tx, _ := scripts.BtcTransactionFromRaw(raw)
+		tx.Outputs[0].Amount = big.NewInt(100000000)
+		var reject *providertest.RejectError
+		if _, err := server.Broadcast(tx.Serialize()); !errors.As(err, &reject) || reject.Code != -26 || reject.Reason != "bad-txns-in-belowout" {
+			t.Errorf("Expected bad-txns-in-belowout, got %v", err)
+		}
+		if len(utxos) != 1 || len(server.Mempool()) != 1 {
+			t.Errorf("Unexpected mempool %v", server.Mempool())
+		}
+	})
+
+	t.Run("pagination", func(t *testing.T) {
+		receiver := key.GetPublic().ToP2WSHAddress()
+		for i := 0; i < 60; i++ {
+			server.Fund(receiver, big.NewInt(int64(1000+i)))
+			server.Mine(1)
+		}
+		server.Fund(receiver, big.NewInt(1))
+		for _, backend := range apis {
+			seen := map[string]bool{}
+			cursor := ""
+			for pages := 0; ; pages++ {
+				page, err := backend.api.GetAccountTransactions(ctx, receiver, cursor)
+				if err != nil || pages > 5 {
+					t.Fatalf("%s: unexpected page %v", backend.name, err)
+				}
+				for _, transaction := range page.Transactions {
+					seen[transaction.TxId] = true
+				}
+				if cursor = page.Next; cursor == "" {
+					break
+				}
+			}
+			if len(seen) != 61 {
+				t.Errorf("%s: expected 61 transactions, got %d", backend.name, len(seen))
+			}
+		}
+		server.Mine(1)
+	})
+
+	t.Run("fees", func(t *testing.T) {
+		server.SetFees(providertest.Fees{Fastest: 30, HalfHour: 12, Hour: 6, Economy: 3, Minimum: 2})
+		for _, backend := range apis {
+			fee, err := backend.api.GetNetworkFee(ctx)
+			if err != nil {
+				t.Fatal(err)
+			}
+			// in satoshis per 1000 virtual bytes
+			expected := []int64{30000, 12000, 2000}
+			if backend.name == "esplora" {
+				// the targets of 2, 6 and 144 blocks
+				expected = []int64{30000, 6000, 3000}
+			}
+			if fee.High.Int64() != expected[0] || fee.Medium.Int64() != expected[1] || fee.Low.Int64() != expected[2] {
+				t.Errorf("%s: unexpected fee %v", backend.name, fee)
+			}
+		}
+		server.SetFees(providertest.DefaultFees)
+	})
+
+	t.Run("blocks", func(t *testing.T) {
+		api := server.EsploraProvider()
+		height, err := api.GetBlockHeight(ctx)
+		if err != nil || height != server.Height() {
+			t.Fatalf("Unexpected height %v %v", height, err)
+		}
+		// a block of three transactions
+		ids := []string{server.Fund(segwit, big.NewInt(1)).TxId, server.Fund(segwit, big.NewInt(2)).TxId}
+		ids = append(ids, server.Mempool()...)
+		hash := server.Mine(1)[0]
+		if found, err := api.GetBlockHash(ctx, height+1); err != nil || found != hash {
+			t.Fatalf("Unexpected block hash %v %v", found, err)
+		}
+		header, err := api.GetBlockHeader(ctx, hash)
+		if err != nil || header.Hash != hash || header.Height != height+1 {
+			t.Fatalf("Unexpected header %+v %v", header, err)
+		}
+		previous, _ := api.GetBlockHash(ctx, height)
+		if header.PrevBlock != previous {
+			t.Errorf("Unexpected previous block %s", header.PrevBlock)
+		}
+		for _, id := range ids {
+			proof, err := api.GetMerkleProof(ctx, id)
+			if err != nil || proof.BlockHeight != height+1 {
+				t.Fatalf("Unexpected proof %+v %v", proof, err)
+			}
+			node := formating.ReverseBytes(formating.HexToBytes(id))
+			pos := proof.Pos
+			for _, sibling := range proof.Merkle {
+				siblingBytes := formating.ReverseBytes(formating.HexToBytes(sibling))
+				if pos%2 == 0 {
+					node = digest.DoubleHash(append(node, siblingBytes...))
+				} else {
+					node = digest.DoubleHash(append(siblingBytes, node...))
+				}
+				pos /= 2
+			}
+			if formating.BytesToHex(formating.ReverseBytes(node)) != header.MerkleRoot {
+				t.Errorf("Invalid merkle proof of %s", id)
+			}
+		}
+		raw, err := api.GetRawTransaction(ctx, ids[0])
+		if err != nil || raw.TxId() != ids[0] {
+			t.Errorf("Unexpected raw transaction %v", err)
+		}
+	})
+}
@@ -0,0 +1,316 @@
+package test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/mrtnetwork/bitcoin/address"
+	"github.com/mrtnetwork/bitcoin/constant"
+	"github.com/mrtnetwork/bitcoin/formating"
+	"github.com/mrtnetwork/bitcoin/keypair"
+	"github.com/mrtnetwork/bitcoin/provider"
+	"github.com/mrtnetwork/bitcoin/scripts"
+)
+
+// genesisBlock is the serialized genesis block of the main network
+const genesisBlock = "0100000000000000000000000000000000000000000000000000000000000000000000003ba3edfd7a7b12b27ac72c3e67768f617fc81bc3888a51323a9fb8aa4b1e5e4a29ab5f49ffff001d1dac2b7c" +
+	"0101000000010000000000000000000000000000000000000000000000000000000000000000ffffffff4d04ffff001d0104455468652054696d65732030332f4a616e2f32303039204368616e63656c6c6f72206f6e206272696e6b206f66207365636f6e64206261696c6f757420666f722062616e6b73ffffffff0100f2052a01000000434104678afdb0fe5548271967f1a67130b7105cd6a828e03909a67962e0ea1f61deb649f6bc3f4cef38c4f35504e51ec112de5c384df7ba0b8d578a4c702b6bf11d5fac00000000"
+
+// genesisHash is the hash of the genesis block of the main network
+const genesisHash = "000000000019d6689c085ae165831e934ff763ae46a2a6c172b3f1b60a8ce26f"
+
+// rpcHandler answers a JSON-RPC request with a result or an error
+type rpcHandler func(params []json.RawMessage) (interface{}, *provider.RPCError)
+
+// rpcServer is a stand-in of the JSON-RPC interface of Bitcoin Core. It answers the batches in
+// reverse order and the failed single requests with status 500, like the node.
+func rpcServer(t *testing.T, user, password string, handlers map[string]rpcHandler) *httptest.Server {
+	type request struct {
+		Id     int               `json:"id"`
+		Method string            `json:"method"`
+		Params []json.RawMessage `json:"params"`
+	}
+	answer := func(r request) map[string]interface{} {
+		handler, ok := handlers[r.Method]
+		if !ok {
+			return map[string]interface{}{"id": r.Id, "result": nil, "error": provider.RPCError{Code: -32601, Message: "Method not found"}}
+		}
+		result, err := handler(r.Params)
+		if err != nil {
+			return map[string]interface{}{"id": r.Id, "result": nil, "error": err}
+		}
+		return map[string]interface{}{"id": r.Id, "result": result, "error": nil}
+	}
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if u, p, ok := r.BasicAuth(); !ok || u != user || p != password {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		var raw json.RawMessage
+		if err := json.NewDecoder(r.Body).Decode(&raw); err != nil {
+			t.Errorf("invalid request: %v", err)
+			return
+		}
+		var batch []request
+		if json.Unmarshal(raw, &batch) == nil {
+			responses := []interface{}{}
+			for i := len(batch) - 1; i >= 0; i-- {
+				responses = append(responses, answer(batch[i]))
+			}
+			json.NewEncoder(w).Encode(responses)
+			return
+		}
+		var single request
+		json.Unmarshal(raw, &single)
+		response := answer(single)
+		if response["error"] != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+		json.NewEncoder(w).Encode(response)
+	}))
+}
+
+func TestRPCProvider(t *testing.T) {
+	network := address.TestnetNetwork
+	ctx := context.Background()
+	key, _ := keypair.NewECPrivateFromWIF("cTALNpTpRbbxTCJ2A5Vq88UxT44w1PE2cYqiB3n4hRvzyCev1Wwo")
+	addr := key.GetPublic().ToSegwitAddress()
+	fundingTx := "6e9a0692ed4b3328909d66d41531854988dc39edba5df186affaefda91824e69"
+	mempool := map[string]string{}
+
+	var stringParam = func(param json.RawMessage) string {
+		var value string
+		json.Unmarshal(param, &value)
+		return value
+	}
+	handlers := map[string]rpcHandler{
+		"getblockcount": func(params []json.RawMessage) (interface{}, *provider.RPCError) {
+			return 120, nil
+		},
+		"scantxoutset": func(params []json.RawMessage) (interface{}, *provider.RPCError) {
+			var descriptors []string
+			json.Unmarshal(params[1], &descriptors)
+			if stringParam(params[0]) != "start" || len(descriptors) != 1 || descriptors[0] != "addr("+addr.Show(network)+")" {
+				return nil, &provider.RPCError{Code: -8, Message: "Invalid descriptor"}
+			}
+			return json.RawMessage(`{"success":true,"height":120,"unspents":[{"txid":"` + fundingTx + `","vout":1,
+				"scriptPubKey":"` + addr.ToScriptPubKey().ToHex() + `","desc":"addr(` + addr.Show(network) + `)#x","amount":0.00100000,"height":110}]}`), nil
+		},
+		"testmempoolaccept": func(params []json.RawMessage) (interface{}, *provider.RPCError) {
+			var raws []string
+			json.Unmarshal(params[0], &raws)
+			results := []interface{}{}
+			for _, raw := range raws {
+				tx, err := scripts.BtcTransactionFromRaw(raw)
+				if err != nil {
+					results = append(results, map[string]interface{}{"txid": "", "allowed": false, "reject-reason": "TX decode failed"})
+					continue
+				}
+				results = append(results, json.RawMessage(`{"txid":"`+tx.TxId()+`","wtxid":"`+tx.TxId()+`","allowed":true,"vsize":110,"fees":{"base":0.00001000}}`))
+			}
+			return results, nil
+		},
+		"sendrawtransaction": func(params []json.RawMessage) (interface{}, *provider.RPCError) {
+			raw := stringParam(params[0])
+			tx, err := scripts.BtcTransactionFromRaw(raw)
+			if err != nil {
+				return nil, &provider.RPCError{Code: -22, Message: "TX decode failed"}
+			}
+			if _, ok := mempool[tx.TxId()]; ok {
+				return nil, &provider.RPCError{Code: -27, Message: "Transaction already in block chain"}
+			}
+			mempool[tx.TxId()] = raw
+			return tx.TxId(), nil
+		},
+		"getrawtransaction": func(params []json.RawMessage) (interface{}, *provider.RPCError) {
+			id := stringParam(params[0])
+			if string(params[1]) == "2" && id == fundingTx {
+				return json.RawMessage(`{"txid":"` + fundingTx + `","version":2,"locktime":0,"size":222,"vsize":141,"weight":561,"fee":0.00001410,
+					"vin":[{"txid":"` + fundingTx + `","vout":0,"scriptSig":{"hex":""},"txinwitness":["30","02"],"sequence":4294967293,
+						"prevout":{"value":0.00102410,"scriptPubKey":{"hex":"0014aa","address":"` + addr.Show(network) + `"}}}],
+					"vout":[{"value":0.00001000,"n":0,"scriptPubKey":{"hex":"0014bb"}},{"value":0.00100000,"n":1,"scriptPubKey":{"hex":"0014aa","address":"` + addr.Show(network) + `"}}],
+					"blockhash":"00ff","confirmations":11,"blocktime":1700000000}`), nil
+			}
+			raw, ok := mempool[id]
+			if !ok {
+				return nil, &provider.RPCError{Code: -5, Message: "No such mempool or blockchain transaction"}
+			}
+			return raw, nil
+		},
+		"gettxout": func(params []json.RawMessage) (interface{}, *provider.RPCError) {
+			if stringParam(params[0]) != fundingTx || string(params[1]) != "1" {
+				return nil, nil
+			}
+			return json.RawMessage(`{"bestblock":"00ff","confirmations":11,"value":0.00100000,"scriptPubKey":{"hex":"0014aa","address":"` + addr.Show(network) + `"},"coinbase":false}`), nil
+		},
+		"estimatesmartfee": func(params []json.RawMessage) (interface{}, *provider.RPCError) {
+			fees := map[string]string{"2": "0.00020000", "6": "0.00010000", "144": "0.00001000"}
+			if _, ok := fees[string(params[0])]; !ok {
+				return json.RawMessage(`{"errors":["Insufficient data or no feerate found"],"blocks":0}`), nil
+			}
+			return json.RawMessage(`{"feerate":` + fees[string(params[0])] + `,"blocks":` + string(params[0]) + `}`), nil
+		},
+		"getblock": func(params []json.RawMessage) (interface{}, *provider.RPCError) {
+			return genesisBlock, nil
+		},
+		"getblockheader": func(params []json.RawMessage) (interface{}, *provider.RPCError) {
+			return json.RawMessage(`{"hash":"` + stringParam(params[0]) + `","height":0,"version":1,"merkleroot":"4a5e1e4baab89f3a32518a88c31bc87f618f76673e2cc77ab2127b7afdeda33b",
+				"time":1231006505,"nonce":2083236893,"bits":"1d00ffff"}`), nil
+		},
+		"getmempoolentry": func(params []json.RawMessage) (interface{}, *provider.RPCError) {
+			if _, ok := mempool[stringParam(params[0])]; !ok {
+				return nil, &provider.RPCError{Code: -5, Message: "Transaction not in mempool"}
+			}
+			return json.RawMessage(`{"vsize":110,"weight":437,"time":1700000000,"height":120,"descendantcount":1,"ancestorcount":1,
+				"fees":{"base":0.00001000,"modified":0.00001000},"depends":[],"spentby":[],"bip125-replaceable":true}`), nil
+		},
+	}
+	server := rpcServer(t, "__cookie__", "secret", handlers)
+	defer server.Close()
+
+	cookie := filepath.Join(t.TempDir(), ".cookie")
+	if err := os.WriteFile(cookie, []byte("__cookie__:secret\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	api := provider.NewRPCProvider(server.URL, &network, provider.RPCAuth{CookieFile: cookie}, nil)
+
+	t.Run("auth", func(t *testing.T) {
+		if height, err := provider.NewRPCProvider(server.URL, &network, provider.RPCAuth{User: "__cookie__", Password: "secret"}, nil).GetBlockHeight(ctx); err != nil || height != 120 {
+			t.Errorf("Unexpected height %v %v", height, err)
+		}
+		var apiError *provider.APIError
+		_, err := provider.NewRPCProvider(server.URL, &network, provider.RPCAuth{User: "user", Password: "wrong"}, nil).GetBlockHeight(ctx)
+		if !errors.As(err, &apiError) || apiError.StatusCode != http.StatusUnauthorized {
+			t.Errorf("Expected unauthorized, got %v", err)
+		}
+		missing := provider.NewRPCProvider(server.URL, &network, provider.RPCAuth{CookieFile: cookie + ".missing"}, nil)
+		if _, err := missing.GetBlockHeight(ctx); err == nil {
+			t.Errorf("Expected error for missing cookie file")
+		}
+	})
+
+	t.Run("batch", func(t *testing.T) {
+		var height int
+		var hash string
+		requests := []*provider.RPCRequest{
+			{Method: "getblockcount", Result: &height},
+			{Method: "unknown"},
+			{Method: "getblockheader", Params: []interface{}{"00ff", true}, Result: &json.RawMessage{}},
+		}
+		if err := api.Batch(ctx, requests...); err != nil {
+			t.Fatal(err)
+		}
+		var rpcError *provider.RPCError
+		if height != 120 || requests[0].Err != nil || !errors.As(requests[1].Err, &rpcError) || rpcError.Code != -32601 || requests[2].Err != nil {
+			t.Errorf("Unexpected batch results %v %v", height, requests)
+		}
+		if err := api.Call(ctx, "getblockhash", &hash, 0); err == nil {
+			t.Errorf("Expected error for unknown method")
+		}
+	})
+
+	t.Run("build_and_broadcast", func(t *testing.T) {
+		owner := provider.UtxoOwnerDetails{PublicKey: key.GetPublic().ToHex(), Address: addr}
+		utxos, err := api.GetAccountUtxo(ctx, owner)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(utxos) != 1 || utxos[0].Utxo.Value.Int64() != 100000 || utxos[0].Utxo.BlockHeight != 110 || utxos[0].Utxo.ScriptType != address.P2WPKH {
+			t.Fatalf("Unexpected utxos %+v", utxos)
+		}
+		builder := provider.NewBitcoinTransactionBuilder(utxos, []provider.BitcoinOutputDetails{
+			{Address: addr, Value: big.NewInt(99000)},
+		}, big.NewInt(1000), &network, "", true)
+		tx, err := builder.BuildTransaction(func(trDigest []byte, utxo provider.UtxoWithOwner, publicKey string) (string, error) {
+			return key.SingInput(trDigest, constant.SIGHASH_ALL), nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		raw := tx.Serialize()
+
+		accepts, err := api.TestMempoolAccept(ctx, raw, "00")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(accepts) != 2 || !accepts[0].Allowed || accepts[0].Txid != tx.TxId() || accepts[0].Fee.Int64() != 1000 ||
+			accepts[1].Allowed || accepts[1].RejectReason != "TX decode failed" {
+			t.Errorf("Unexpected testmempoolaccept results %+v", accepts)
+		}
+
+		id, err := api.SendRawTransaction(ctx, raw)
+		if err != nil || id != tx.TxId() {
+			t.Fatalf("Unexpected broadcast result %v %v", id, err)
+		}
+		if _, err := api.SendRawTransaction(ctx, raw); !errors.Is(err, provider.ErrRejected) {
+			t.Errorf("Expected ErrRejected, got %v", err)
+		}
+
+		broadcast, err := api.GetRawTransaction(ctx, id)
+		if err != nil || broadcast.TxId() != id || broadcast.Serialize() != raw {
+			t.Errorf("Unexpected transaction %v", err)
+		}
+		entry, err := api.GetMempoolEntry(ctx, id)
+		if err != nil || entry.Fee.Int64() != 1000 || entry.VSize != 110 || !entry.Replaceable {
+			t.Errorf("Unexpected mempool entry %+v %v", entry, err)
+		}
+	})
+
+	t.Run("queries", func(t *testing.T) {
+		tx, err := api.GetTransaction(ctx, fundingTx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if tx.Fee.Int64() != 1410 || tx.Status.BlockHeight != 110 || !tx.Status.Confirmed || tx.Inputs[0].Value.Int64() != 102410 ||
+			tx.Inputs[0].Address != addr.Show(network) || len(tx.Outputs) != 2 || tx.Outputs[1].Value.Int64() != 100000 {
+			t.Errorf("Unexpected transaction %+v", tx)
+		}
+		out, err := api.GetTxOut(ctx, fundingTx, 1, true)
+		if err != nil || out.Value.Int64() != 100000 || out.Confirmations != 11 {
+			t.Errorf("Unexpected output %+v %v", out, err)
+		}
+		if _, err := api.GetTxOut(ctx, fundingTx, 0, true); !errors.Is(err, provider.ErrNotFound) {
+			t.Errorf("Expected ErrNotFound, got %v", err)
+		}
+		fee, err := api.GetNetworkFee(ctx)
+		if err != nil || fee.High.Int64() != 20000 || fee.Medium.Int64() != 10000 || fee.Low.Int64() != 1000 {
+			t.Errorf("Unexpected fee %v %v", fee, err)
+		}
+		estimates, err := api.GetFeeEstimates(ctx)
+		if err != nil || len(estimates) != 3 || estimates[2] != 20000 || estimates[6] != 10000 || estimates[144] != 1000 {
+			t.Errorf("Unexpected estimates %v %v", estimates, err)
+		}
+		if _, err := api.GetRawTransaction(ctx, "unknown"); !errors.Is(err, provider.ErrNotFound) {
+			t.Errorf("Expected ErrNotFound, got %v", err)
+		}
+		if _, err := api.GetAccountTransactions(ctx, addr, ""); !errors.Is(err, provider.ErrNotSupported) {
+			t.Errorf("Expected ErrNotSupported, got %v", err)
+		}
+	})
+
+	t.Run("block", func(t *testing.T) {
+		hash := genesisHash
+		block, err := api.GetBlock(ctx, hash)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if block.Header.Hash != hash || block.Header.Bits != 0x1d00ffff || block.Header.Time.Unix() != 1231006505 || len(block.TxIds) != 1 ||
+			block.TxIds[0] != block.Header.MerkleRoot || block.Transactions[0].Outputs[0].Amount.Int64() != 5000000000 {
+			t.Errorf("Unexpected block %+v", block)
+		}
+		header, err := api.GetBlockHeader(ctx, hash)
+		if err != nil || header.MerkleRoot != block.Header.MerkleRoot || header.Bits != block.Header.Bits || header.Nonce != block.Header.Nonce {
+			t.Errorf("Unexpected header %+v %v", header, err)
+		}
+		if _, err := provider.ParseBlock(formating.HexToBytes(genesisBlock + "00")); err == nil {
+			t.Errorf("Expected error for trailing bytes")
+		}
+	})
+}
@@ -0,0 +1,240 @@
+package test
+
+import (
+	"fmt"
+	"math/big"
+	"strings"
+	"testing"
+
+	"github.com/mrtnetwork/bitcoin/address"
+	"github.com/mrtnetwork/bitcoin/constant"
+	"github.com/mrtnetwork/bitcoin/ecc"
+	"github.com/mrtnetwork/bitcoin/formating"
+	"github.com/mrtnetwork/bitcoin/keypair"
+	"github.com/mrtnetwork/bitcoin/provider"
+	"github.com/mrtnetwork/bitcoin/scripts"
+)
+
+func TestTimeLock(t *testing.T) {
+	sk1, _ := keypair.NewECPrivateFromWIF("cTALNpTpRbbxTCJ2A5Vq88UxT44w1PE2cYqiB3n4hRvzyCev1Wwo")
+	sk2, _ := keypair.NewECPrivateFromWIF("cRvyLwCPLU88jsyj94L7iJjQX5C2f8koG4G2gevN4BeSGcEvfKe9")
+	pub1 := sk1.GetPublic()
+	pub2 := sk2.GetPublic()
+	destination := pub1.ToSegwitAddress()
+	sequence, _ := scripts.NewSequence(constant.TYPE_RELATIVE_TIMELOCK, 10, true)
+	txHash := "6e9a0692ed4b3328909d66d41531854988dc39edba5df186affaefda91824e69"
+
+	signer := func(trDigest []byte, utxo provider.UtxoWithOwner, publicKey string) (string, error) {
+		var key *keypair.ECPrivate
+		switch publicKey {
+		case pub1.ToHex():
+			key = sk1
+		case pub2.ToHex():
+			key = sk2
+		default:
+			return "", fmt.Errorf("cannot find private key")
+		}
+		if utxo.Utxo.IsP2tr() {
+			return key.SignTaprootTransaction(trDigest, constant.TAPROOT_SIGHASH_ALL, []interface{}{}, false), nil
+		}
+		return key.SingInput(trDigest, constant.SIGHASH_ALL), nil
+	}
+	build := func(lock *provider.TimeLockScriptAddress, branch provider.TimeLockBranch) (*scripts.BtcTransaction, error) {
+		utxo := provider.UtxoWithOwner{
+			Utxo: provider.BitcoinUtxo{
+				TxHash:     txHash,
+				Value:      big.NewInt(100000),
+				Vout:       0,
+				ScriptType: lock.Address.GetType(),
+			},
+			OwnerDetails: provider.UtxoOwnerDetails{
+				Address:         lock.Address,
+				TimeLockAddress: lock,
+				TimeLockBranch:  branch,
+			},
+		}
+		builder := provider.NewBitcoinTransactionBuilder(
+			[]provider.UtxoWithOwner{utxo},
+			[]provider.BitcoinOutputDetails{{Address: destination, Value: big.NewInt(99000)}},
+			big.NewInt(1000), &address.TestnetNetwork, "", false)
+		return builder.BuildTransaction(signer)
+	}
+
+	t.Run("csv_script", func(t *testing.T) {
+		lock, err := provider.CreateCsvAddress(pub1.ToHex(), sequence, address.P2WSH)
+		if err != nil {
+			t.Fatal(err)
+		}
+		expected := "5ab27521" + pub1.ToHex() + "ac"
+		if !strings.EqualFold(lock.ScriptDetails, expected) {
+			t.Errorf("Expected %v, but got %v", expected, lock.ScriptDetails)
+		}
+	})
+	t.Run("invalid_parameters", func(t *testing.T) {
+		if _, err := provider.CreateCltvAddress(pub1.ToHex(), 0, address.P2WSH); err == nil {
+			t.Errorf("Expected error for zero lock time")
+		}
+		absolute, _ := scripts.NewSequence(constant.TYPE_ABSOLUTE_TIMELOCK, 10, true)
+		if _, err := provider.CreateCsvAddress(pub1.ToHex(), absolute, address.P2WSH); err == nil {
+			t.Errorf("Expected error for absolute sequence")
+		}
+		if _, err := provider.CreateCsvAddress(pub1.ToHex(), sequence, address.P2WPKH); err == nil {
+			t.Errorf("Expected error for unsupported address type")
+		}
+	})
+	t.Run("spend_cltv_p2pkh_in_p2sh", func(t *testing.T) {
+		lock, err := provider.CreateCltvP2PKHAddress(pub1.ToHex(), 2500000, address.P2PKHInP2SH)
+		if err != nil {
+			t.Fatal(err)
+		}
+		tx, err := build(lock, provider.TimeLockDelayedBranch)
+		if err != nil {
+			t.Fatal(err)
+		}
+		lockTime := formating.BytesToHex(tx.Locktime)
+		if !strings.EqualFold(lockTime, "a0252600") {
+			t.Errorf("Expected %v, but got %v", "a0252600", lockTime)
+		}
+		seq := formating.BytesToHex(tx.Inputs[0].Sequence)
+		if !strings.EqualFold(seq, "feffffff") {
+			t.Errorf("Expected %v, but got %v", "feffffff", seq)
+		}
+		scriptSig := tx.Inputs[0].ScriptSig.Script
+		if len(scriptSig) != 3 || scriptSig[1] != pub1.ToHex() || scriptSig[2] != lock.ScriptDetails {
+			t.Errorf("Unexpected scriptSig %v", scriptSig)
+		}
+	})
+	t.Run("spend_csv_branch_p2sh", func(t *testing.T) {
+		lock, err := provider.CreateCsvBranchAddress(pub2.ToHex(), pub1.ToHex(), sequence, address.P2PKHInP2SH)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, branch := range []provider.TimeLockBranch{provider.TimeLockImmediateBranch, provider.TimeLockDelayedBranch} {
+			tx, err := build(lock, branch)
+			if err != nil {
+				t.Fatal(err)
+			}
+			key, selector := sk2, "51"
+			if branch == provider.TimeLockDelayedBranch {
+				key, selector = sk1, "00"
+			}
+			digest := tx.GetTransactionDigest(0, lock.BranchScript(branch), constant.SIGHASH_ALL)
+			// the selector of OP_IF is a minimal push, OP_1 and not the push of the byte 01
+			expected := formating.BytesToHex(formating.OpPushData(key.SingInput(digest, constant.SIGHASH_ALL))) + selector +
+				formating.BytesToHex(formating.OpPushData(lock.ScriptDetails))
+			if scriptSig := tx.Inputs[0].ScriptSig.ToHex(); !strings.EqualFold(scriptSig, expected) {
+				t.Errorf("Expected scriptSig %v, but got %v", expected, scriptSig)
+			}
+		}
+	})
+	t.Run("cltv_mixed_lock_types", func(t *testing.T) {
+		height, _ := provider.CreateCltvAddress(pub1.ToHex(), 2500000, address.P2WSH)
+		timestamp, _ := provider.CreateCltvAddress(pub1.ToHex(), 1700000000, address.P2WSH)
+		utxos := []provider.UtxoWithOwner{}
+		for _, lock := range []*provider.TimeLockScriptAddress{height, timestamp} {
+			utxos = append(utxos, provider.UtxoWithOwner{
+				Utxo:         provider.BitcoinUtxo{TxHash: txHash, Value: big.NewInt(50000), ScriptType: address.P2WSH},
+				OwnerDetails: provider.UtxoOwnerDetails{Address: lock.Address, TimeLockAddress: lock},
+			})
+		}
+		builder := provider.NewBitcoinTransactionBuilder(utxos,
+			[]provider.BitcoinOutputDetails{{Address: destination, Value: big.NewInt(99000)}},
+			big.NewInt(1000), &address.TestnetNetwork, "", false)
+		if _, err := builder.BuildTransaction(signer); err == nil {
+			t.Errorf("Expected error for mixed lock time types")
+		}
+	})
+	t.Run("spend_csv_branch_p2wsh", func(t *testing.T) {
+		lock, err := provider.CreateCsvBranchAddress(pub2.ToHex(), pub1.ToHex(), sequence, address.P2WSH)
+		if err != nil {
+			t.Fatal(err)
+		}
+		tx, err := build(lock, provider.TimeLockDelayedBranch)
+		if err != nil {
+			t.Fatal(err)
+		}
+		seq := formating.BytesToHex(tx.Inputs[0].Sequence)
+		if !strings.EqualFold(seq, "0a000000") {
+			t.Errorf("Expected %v, but got %v", "0a000000", seq)
+		}
+		stack := tx.Witnesses[0].Stack
+		if len(stack) != 3 || stack[1] != "" || stack[2] != lock.ScriptDetails {
+			t.Errorf("Unexpected witness %v", stack)
+		}
+		digest := tx.GetTransactionSegwitDigit(0, lock.BranchScript(provider.TimeLockDelayedBranch), big.NewInt(100000))
+		if !strings.EqualFold(stack[0], sk1.SingInput(digest, constant.SIGHASH_ALL)) {
+			t.Errorf("Expected signature of the delayed key")
+		}
+
+		tx, err = build(lock, provider.TimeLockImmediateBranch)
+		if err != nil {
+			t.Fatal(err)
+		}
+		seq = formating.BytesToHex(tx.Inputs[0].Sequence)
+		if !strings.EqualFold(seq, "ffffffff") {
+			t.Errorf("Expected %v, but got %v", "ffffffff", seq)
+		}
+		if tx.Witnesses[0].Stack[1] != "01" {
+			t.Errorf("Expected %v, but got %v", "01", tx.Witnesses[0].Stack[1])
+		}
+	})
+	t.Run("spend_csv_p2wsh_in_p2sh", func(t *testing.T) {
+		lock, err := provider.CreateCsvAddress(pub1.ToHex(), sequence, address.P2WSHInP2SH)
+		if err != nil {
+			t.Fatal(err)
+		}
+		tx, err := build(lock, provider.TimeLockDelayedBranch)
+		if err != nil {
+			t.Fatal(err)
+		}
+		p2wsh, _ := address.P2WSHAddresssFromScript(lock.BranchScript(provider.TimeLockDelayedBranch))
+		scriptSig := tx.Inputs[0].ScriptSig.Script
+		if len(scriptSig) != 1 || scriptSig[0] != p2wsh.ToScriptPubKey().ToHex() {
+			t.Errorf("Unexpected scriptSig %v", scriptSig)
+		}
+	})
+	t.Run("spend_csv_branch_p2tr", func(t *testing.T) {
+		lock, err := provider.CreateCsvBranchAddress(pub2.ToHex(), pub1.ToHex(), sequence, address.P2TR)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, branch := range []provider.TimeLockBranch{provider.TimeLockImmediateBranch, provider.TimeLockDelayedBranch} {
+			tx, err := build(lock, branch)
+			if err != nil {
+				t.Fatal(err)
+			}
+			stack := tx.Witnesses[0].Stack
+			leaf := lock.BranchScript(branch)
+			if len(stack) != 3 || stack[1] != leaf.ToHex() {
+				t.Fatalf("Unexpected witness %v", stack)
+			}
+			scriptPubKey := lock.Address.ToScriptPubKey()
+			digest := tx.GetTransactionTaprootDigest(0, []*scripts.Script{scriptPubKey}, []*big.Int{big.NewInt(100000)}, 1, leaf, constant.TAPROOT_SIGHASH_ALL)
+			signing, _ := keypair.NewECPPublicFromHex(lock.SigningPublicKey(branch))
+			if !ecc.VerifySchnorr(digest, formating.HexToBytes(signing.ToXOnlyHex()), formating.HexToBytes(stack[0])) {
+				t.Errorf("Invalid schnorr signature for branch %v", branch)
+			}
+			// the control block must commit to the output key of the address
+			controlBlock := formating.HexToBytes(stack[2])
+			sibling := controlBlock[33:]
+			internal, _ := keypair.NewECPPublicFromHex(lock.InternalPublicKey)
+			var tree []interface{}
+			if branch == provider.TimeLockImmediateBranch {
+				tree = []interface{}{leaf, lock.TapLeafs[1]}
+			} else {
+				tree = []interface{}{lock.TapLeafs[0], leaf}
+			}
+			if !strings.EqualFold(formating.BytesToHex(sibling), formating.BytesToHex(lock.BranchScript(1-branch).ToTapleafTaggedHash())) {
+				t.Errorf("Unexpected merkle path")
+			}
+			odd, _ := internal.ToTapRootParity(tree)
+			if (controlBlock[0]&1 == 1) != odd {
+				t.Errorf("Unexpected control block parity")
+			}
+			program, _ := internal.ToTapRotHex(tree)
+			if !strings.EqualFold(scriptPubKey.ToHex(), "5120"+program) {
+				t.Errorf("Expected %v, but got %v", scriptPubKey.ToHex(), "5120"+program)
+			}
+		}
+	})
+}
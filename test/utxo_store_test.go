@@ -0,0 +1,249 @@
+package test
+
+import (
+	"errors"
+	"math/big"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/mrtnetwork/bitcoin/address"
+	"github.com/mrtnetwork/bitcoin/constant"
+	"github.com/mrtnetwork/bitcoin/keypair"
+	"github.com/mrtnetwork/bitcoin/provider"
+	"github.com/mrtnetwork/bitcoin/scripts"
+	"github.com/mrtnetwork/bitcoin/wallet"
+)
+
+// unsignedTx spends the outpoints to the scripts, signatures do not matter to the store
+func unsignedTx(inputs []wallet.Outpoint, outputs map[*scripts.Script]int64) *scripts.BtcTransaction {
+	txInputs := []*scripts.TxInput{}
+	for _, input := range inputs {
+		txInputs = append(txInputs, scripts.NewDefaultTxInput(input.TxId, input.Vout))
+	}
+	txOutputs := []*scripts.TxOutput{}
+	for script, amount := range outputs {
+		txOutputs = append(txOutputs, scripts.NewTxOutput(big.NewInt(amount), script))
+	}
+	return scripts.NewBtcTransaction(txInputs, txOutputs, false)
+}
+
+func TestUtxoStore(t *testing.T) {
+	network := address.TestnetNetwork
+	key, _ := keypair.NewECPrivateFromWIF("cTALNpTpRbbxTCJ2A5Vq88UxT44w1PE2cYqiB3n4hRvzyCev1Wwo")
+	segwit := key.GetPublic().ToSegwitAddress()
+	owner := provider.UtxoOwnerDetails{PublicKey: key.GetPublic().ToHex(), Address: segwit}
+	ours := segwit.ToScriptPubKey()
+	external := key.GetPublic().ToAddress().ToScriptPubKey()
+
+	path := filepath.Join(t.TempDir(), "wallet.json")
+	storage, err := wallet.OpenFileStorage(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	store, err := wallet.NewUtxoStore(storage)
+	if err != nil {
+		t.Fatal(err)
+	}
+	store.Track(owner)
+
+	// a deposit seen in the mempool, then confirmed
+	deposit := unsignedTx([]wallet.Outpoint{{TxId: strings.Repeat("aa", 32), Vout: 0}}, map[*scripts.Script]int64{ours: 100000})
+	if conflicts, err := store.AddTransaction(deposit); err != nil || len(conflicts) != 0 {
+		t.Fatalf("Unexpected deposit %v %v", conflicts, err)
+	}
+	funding := wallet.Outpoint{TxId: deposit.TxId(), Vout: 0}
+	if confirmed, unconfirmed := store.Balance(); confirmed.Int64() != 0 || unconfirmed.Int64() != 100000 {
+		t.Errorf("Unexpected balance %v %v", confirmed, unconfirmed)
+	}
+	// transactions not involving the wallet are ignored
+	store.AddTransaction(unsignedTx([]wallet.Outpoint{{TxId: strings.Repeat("bb", 32), Vout: 1}}, map[*scripts.Script]int64{external: 5000}))
+	if len(store.Utxos()) != 1 {
+		t.Errorf("Unexpected outputs %v", store.Utxos())
+	}
+	if _, err := store.ConnectBlock(1, &provider.Block{Header: provider.BlockHeader{Hash: "h1"}, Transactions: []*scripts.BtcTransaction{deposit}}); err != nil {
+		t.Fatal(err)
+	}
+	if utxo, ok := store.Utxo(funding); !ok || utxo.State() != wallet.UtxoConfirmed || utxo.BlockHeight != 1 || utxo.BlockHash != "h1" {
+		t.Errorf("Unexpected confirmed output %+v", utxo)
+	}
+
+	// a payment with change and a child spending the change, both unconfirmed: the spend is marked
+	// as soon as the payment is broadcast
+	payment := unsignedTx([]wallet.Outpoint{funding}, map[*scripts.Script]int64{external: 60000, ours: 39000})
+	store.AddTransaction(payment)
+	if utxo, _ := store.Utxo(funding); utxo.State() != wallet.UtxoSpent || utxo.SpentBy != payment.TxId() || utxo.SpentHeight != 0 {
+		t.Errorf("Expected the output to be spent by the payment %+v", utxo)
+	}
+	change := store.Unspent(0)
+	if len(change) != 1 || change[0].TxId != payment.TxId() || change[0].Value.Int64() != 39000 {
+		t.Fatalf("Unexpected unspent outputs %v", change)
+	}
+	child := unsignedTx([]wallet.Outpoint{change[0].Outpoint}, map[*scripts.Script]int64{ours: 38000})
+	store.AddTransaction(child)
+
+	// a replacement of the payment drops it and its child
+	replacement := unsignedTx([]wallet.Outpoint{funding}, map[*scripts.Script]int64{external: 60000, ours: 38500})
+	conflicts, err := store.AddTransaction(replacement)
+	if err != nil || len(conflicts) != 2 {
+		t.Fatalf("Unexpected conflicts %v %v", conflicts, err)
+	}
+	if conflicts[0] != (wallet.Conflict{TxId: payment.TxId(), ReplacedBy: replacement.TxId()}) || conflicts[1].TxId != child.TxId() {
+		t.Errorf("Unexpected conflicts %v", conflicts)
+	}
+	if unspent := store.Unspent(0); len(unspent) != 1 || unspent[0].TxId != replacement.TxId() || unspent[0].Value.Int64() != 38500 {
+		t.Errorf("Unexpected unspent outputs after the replacement %v", unspent)
+	}
+
+	// the replacement confirms, a late double spend of a confirmed output is ignored
+	if _, err := store.ConnectBlock(2, &provider.Block{Header: provider.BlockHeader{Hash: "h2", PrevBlock: "h1"}, Transactions: []*scripts.BtcTransaction{replacement}}); err != nil {
+		t.Fatal(err)
+	}
+	if conflicts, _ := store.AddTransaction(payment); len(conflicts) != 0 {
+		t.Errorf("Unexpected conflicts %v", conflicts)
+	}
+	if utxo, _ := store.Utxo(funding); utxo.SpentBy != replacement.TxId() || utxo.SpentHeight != 2 {
+		t.Errorf("Unexpected spent output %+v", utxo)
+	}
+	if spendable := store.Spendable(1); len(spendable) != 1 || spendable[0].Utxo.TxHash != replacement.TxId() || spendable[0].Utxo.ScriptType != address.P2WPKH {
+		t.Errorf("Unexpected spendable outputs %v", spendable)
+	}
+
+	// a reorganization replaces block 2 without the replacement, it is unconfirmed again
+	if _, err := store.ConnectBlock(2, &provider.Block{Header: provider.BlockHeader{Hash: "h2b", PrevBlock: "h1"}}); err != nil {
+		t.Fatal(err)
+	}
+	if height, hash := store.Tip(); height != 2 || hash != "h2b" {
+		t.Errorf("Unexpected tip %d %s", height, hash)
+	}
+	if utxo, _ := store.Utxo(funding); utxo.SpentBy != replacement.TxId() || utxo.SpentHeight != 0 {
+		t.Errorf("Unexpected output after the reorganization %+v", utxo)
+	}
+	if spendable := store.Spendable(1); len(spendable) != 0 {
+		t.Errorf("Expected no confirmed output %v", spendable)
+	}
+	if _, err := store.ConnectBlock(3, &provider.Block{Header: provider.BlockHeader{Hash: "h3", PrevBlock: "h2"}}); err == nil {
+		t.Errorf("Expected an error for a block of another chain")
+	}
+
+	// the state survives reopening the file
+	storage, err = wallet.OpenFileStorage(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	reopened, err := wallet.NewUtxoStore(storage)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if height, hash := reopened.Tip(); height != 2 || hash != "h2b" || len(reopened.Utxos()) != 2 {
+		t.Errorf("Unexpected reopened store %d %s %v", height, hash, reopened.Utxos())
+	}
+	if spendable := reopened.Spendable(0); len(spendable) != 0 {
+		t.Errorf("Expected no spendable output before tracking the owner %v", spendable)
+	}
+	reopened.Track(owner)
+
+	// the spendable outputs feed the builder and the signed transaction is marked spent
+	spendable := reopened.Spendable(0)
+	builder := provider.NewBitcoinTransactionBuilder(spendable, []provider.BitcoinOutputDetails{{Address: segwit, Value: big.NewInt(37500)}},
+		big.NewInt(1000), &network, "", true)
+	signed, err := builder.BuildTransaction(func(trDigest []byte, utxo provider.UtxoWithOwner, publicKey string) (string, error) {
+		return key.SingInput(trDigest, constant.SIGHASH_ALL), nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	reopened.AddTransaction(signed)
+	if unspent := reopened.Unspent(0); len(unspent) != 1 || unspent[0].TxId != signed.TxId() {
+		t.Errorf("Unexpected unspent outputs %v", unspent)
+	}
+
+	// a conflicting transaction confirmed in a block drops the unconfirmed chain
+	conflicting := unsignedTx([]wallet.Outpoint{funding}, map[*scripts.Script]int64{external: 99000})
+	conflicts, err = reopened.ConnectBlock(3, &provider.Block{Header: provider.BlockHeader{Hash: "h3", PrevBlock: "h2b"}, Transactions: []*scripts.BtcTransaction{conflicting}})
+	if err != nil || len(conflicts) != 2 || conflicts[0] != (wallet.Conflict{TxId: replacement.TxId(), ReplacedBy: conflicting.TxId(), Confirmed: true}) {
+		t.Errorf("Unexpected conflicts %v %v", conflicts, err)
+	}
+	if confirmed, unconfirmed := reopened.Balance(); confirmed.Int64() != 0 || unconfirmed.Int64() != 0 {
+		t.Errorf("Unexpected balance %v %v", confirmed, unconfirmed)
+	}
+
+	// outputs imported from a provider, in memory
+	memory, _ := wallet.NewUtxoStore(wallet.NewMemoryStorage())
+	memory.Import(provider.UtxoWithOwnerList{{
+		Utxo:         provider.BitcoinUtxo{TxHash: deposit.TxId(), Vout: 0, Value: big.NewInt(100000), ScriptType: address.P2WPKH, BlockHeight: 1},
+		OwnerDetails: owner,
+	}})
+	memory.ConnectBlock(3, &provider.Block{Header: provider.BlockHeader{Hash: "h3"}})
+	if spendable := memory.Spendable(3); len(spendable) != 1 || spendable[0].Utxo.Value.Int64() != 100000 {
+		t.Errorf("Unexpected imported outputs %v", spendable)
+	}
+	if spendable := memory.Spendable(4); len(spendable) != 0 {
+		t.Errorf("Expected 3 confirmations %v", spendable)
+	}
+}
+
+// failingStorage is a MemoryStorage whose writes fail while fail is set
+type failingStorage struct {
+	*wallet.MemoryStorage
+	fail bool
+}
+
+func (s *failingStorage) Write(batch map[string][]byte) error {
+	if s.fail {
+		return errors.New("disk full")
+	}
+	return s.MemoryStorage.Write(batch)
+}
+
+func TestUtxoStoreFailingStorage(t *testing.T) {
+	key, _ := keypair.NewECPrivateFromWIF("cTALNpTpRbbxTCJ2A5Vq88UxT44w1PE2cYqiB3n4hRvzyCev1Wwo")
+	segwit := key.GetPublic().ToSegwitAddress()
+	ours := segwit.ToScriptPubKey()
+	external := key.GetPublic().ToAddress().ToScriptPubKey()
+	storage := &failingStorage{MemoryStorage: wallet.NewMemoryStorage()}
+	store, _ := wallet.NewUtxoStore(storage)
+	store.Track(provider.UtxoOwnerDetails{PublicKey: key.GetPublic().ToHex(), Address: segwit})
+	deposit := unsignedTx([]wallet.Outpoint{{TxId: strings.Repeat("aa", 32), Vout: 0}}, map[*scripts.Script]int64{ours: 100000})
+	if _, err := store.ConnectBlock(1, &provider.Block{Header: provider.BlockHeader{Hash: "h1"}, Transactions: []*scripts.BtcTransaction{deposit}}); err != nil {
+		t.Fatal(err)
+	}
+	funding := wallet.Outpoint{TxId: deposit.TxId(), Vout: 0}
+
+	// the operations failing to write leave the store as stored
+	storage.fail = true
+	payment := unsignedTx([]wallet.Outpoint{funding}, map[*scripts.Script]int64{external: 60000, ours: 39000})
+	if _, err := store.AddTransaction(payment); err == nil {
+		t.Errorf("Expected the write to fail")
+	}
+	if _, err := store.ConnectBlock(2, &provider.Block{Header: provider.BlockHeader{Hash: "h2", PrevBlock: "h1"}, Transactions: []*scripts.BtcTransaction{payment}}); err == nil {
+		t.Errorf("Expected the write to fail")
+	}
+	if err := store.Rollback(0); err == nil {
+		t.Errorf("Expected the write to fail")
+	}
+	if err := store.SetMetadata(funding, provider.CoinMetadata{Frozen: true}); err == nil {
+		t.Errorf("Expected the write to fail")
+	}
+	if height, hash := store.Tip(); height != 1 || hash != "h1" {
+		t.Errorf("Unexpected tip %d %s", height, hash)
+	}
+	if utxo, _ := store.Utxo(funding); utxo.State() != wallet.UtxoConfirmed || utxo.Metadata.Frozen || len(store.Utxos()) != 1 {
+		t.Errorf("Unexpected output after the failed writes %+v", utxo)
+	}
+	if confirmed, unconfirmed := store.Balance(); confirmed.Int64() != 100000 || unconfirmed.Int64() != 0 {
+		t.Errorf("Unexpected balance %v %v", confirmed, unconfirmed)
+	}
+
+	// the same operations succeed once the storage recovers
+	storage.fail = false
+	if _, err := store.AddTransaction(payment); err != nil {
+		t.Fatal(err)
+	}
+	if utxo, _ := store.Utxo(funding); utxo.SpentBy != payment.TxId() {
+		t.Errorf("Expected the output to be spent %+v", utxo)
+	}
+	if confirmed, unconfirmed := store.Balance(); confirmed.Int64() != 0 || unconfirmed.Int64() != 39000 {
+		t.Errorf("Unexpected balance after the payment %v %v", confirmed, unconfirmed)
+	}
+}
@@ -0,0 +1,171 @@
+package test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"strings"
+	"testing"
+
+	"github.com/mrtnetwork/bitcoin/address"
+	hdwallet "github.com/mrtnetwork/bitcoin/hd_wallet"
+	"github.com/mrtnetwork/bitcoin/keypair"
+	"github.com/mrtnetwork/bitcoin/provider"
+	"github.com/mrtnetwork/bitcoin/provider/providertest"
+	"github.com/mrtnetwork/bitcoin/wallet"
+)
+
+func TestWatchOnlyWallet(t *testing.T) {
+	ctx := context.Background()
+	network := address.TestnetNetwork
+	master, _ := hdwallet.FromMnemonic("abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon about", "")
+
+	// the offline machine exports the descriptor of its account
+	offline, err := wallet.NewAccount(master, "m/84'/1'/0'", address.P2WPKH, &network)
+	if err != nil {
+		t.Fatal(err)
+	}
+	descriptor := offline.Descriptor()
+	if offline.Fingerprint != "73c5da0a" || !strings.HasPrefix(descriptor, "wpkh([73c5da0a/84'/1'/0']tpub") || !strings.Contains(descriptor, "/<0;1>/*)#") {
+		t.Errorf("Unexpected descriptor %s", descriptor)
+	}
+
+	t.Run("descriptor", func(t *testing.T) {
+		// the checksum example of BIP380, a valid checksum of an unsupported descriptor
+		if _, err := wallet.NewAccountFromDescriptor("raw(deadbeef)#89f8spxm", &network); err == nil || !strings.Contains(err.Error(), "unsupported") {
+			t.Errorf("Expected an unsupported descriptor, got %v", err)
+		}
+		if _, err := wallet.NewAccountFromDescriptor("raw(deadbeef)#89f8spxx", &network); err == nil || !strings.Contains(err.Error(), "checksum") {
+			t.Errorf("Expected an invalid checksum, got %v", err)
+		}
+		if _, err := wallet.NewAccountFromDescriptor(strings.Replace(descriptor, "<0;1>", "<0;1>/0", 1), &network); err == nil {
+			t.Errorf("Expected an error for a modified descriptor")
+		}
+		// a single chain does not describe the receive and change addresses of an account
+		for _, chain := range []string{"0/*", "1/*"} {
+			single := strings.Replace(descriptor[:strings.IndexByte(descriptor, '#')], "<0;1>/*", chain, 1)
+			if _, err := wallet.NewAccountFromDescriptor(single, &network); err == nil || !strings.Contains(err.Error(), "/<0;1>/*") {
+				t.Errorf("Expected an error for the single chain /%s, got %v", chain, err)
+			}
+		}
+		if _, err := wallet.NewAccountFromXPublicKey("tpubinvalid", "m/84'/1'/0'", address.P2WPKH, &network); err == nil {
+			t.Errorf("Expected an error for an invalid extended key")
+		}
+		fromKey, err := wallet.NewAccountFromXPublicKey(offline.XPublicKey(), "m/84'/1'/0'", address.P2WPKH, &network)
+		if err != nil {
+			t.Fatal(err)
+		}
+		expected := offline.Owners()[0].Address.Show(&network)
+		if addr, _ := fromKey.NextReceiveAddress(); addr.Address.Show(&network) != expected || addr.Path != "m/84'/1'/0'/0/0" {
+			t.Errorf("Unexpected watch-only address %s %s", addr.Address.Show(&network), addr.Path)
+		}
+		for _, addressType := range []address.AddressType{address.P2PKH, address.P2WPKHInP2SH, address.P2TR} {
+			account, _ := wallet.NewAccount(master, "m/86'/1'/0'", addressType, &network)
+			restored, err := wallet.NewAccountFromDescriptor(account.Descriptor(), &network)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if restored.Type != addressType || restored.Path != "m/86'/1'/0'" || restored.Descriptor() != account.Descriptor() {
+				t.Errorf("Unexpected restored account %s", restored.Descriptor())
+			}
+		}
+	})
+
+	// the server watches the account from the descriptor
+	watch, err := wallet.NewAccountFromDescriptor(descriptor, &network)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if watch.Fingerprint != offline.Fingerprint || watch.Path != offline.Path {
+		t.Errorf("Unexpected watch-only account %s %s", watch.Fingerprint, watch.Path)
+	}
+	if _, err := watch.PrivateKey(wallet.ReceiveChain, 0); err == nil {
+		t.Errorf("Expected no private key in a watch-only account")
+	}
+	server := providertest.NewServer(&network)
+	defer server.Close()
+	first, _ := offline.NextReceiveAddress()
+	second, _ := offline.NextReceiveAddress()
+	server.Fund(first.Address, big.NewInt(40000))
+	server.Fund(second.Address, big.NewInt(30000))
+	server.Mine(1)
+
+	store, _ := wallet.NewUtxoStore(wallet.NewMemoryStorage())
+	w := wallet.NewWatchOnlyWallet(watch, store, server.MempoolProvider())
+	if err := w.Sync(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if confirmed, unconfirmed := w.Balance(); confirmed.Int64() != 70000 || unconfirmed.Int64() != 0 {
+		t.Errorf("Unexpected balance %v %v", confirmed, unconfirmed)
+	}
+	if addr, _ := watch.NextReceiveAddress(); addr.Index != 2 {
+		t.Errorf("Expected a fresh address after the used ones, got %d", addr.Index)
+	}
+
+	// a payment needing both coins, the change goes back to the account
+	key, _ := keypair.NewECPrivateFromWIF("cTALNpTpRbbxTCJ2A5Vq88UxT44w1PE2cYqiB3n4hRvzyCev1Wwo")
+	recipient := key.GetPublic().ToAddress()
+	request, err := w.CreateTransaction([]provider.BitcoinOutputDetails{{Address: recipient, Value: big.NewInt(50000)}}, provider.FeeRateFromSatPerVByte(2), provider.CoinControl{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(request.Inputs) != 2 || request.Inputs[0].Value.Int64() != 40000 || request.Inputs[0].Path != first.Path || request.Inputs[0].Fingerprint != "73c5da0a" {
+		t.Errorf("Unexpected inputs %+v", request.Inputs)
+	}
+	if len(request.Outputs) != 2 || request.Outputs[1].Path != "m/84'/1'/0'/1/0" {
+		t.Fatalf("Unexpected outputs %+v", request.Outputs)
+	}
+	// 2 P2WPKH inputs and 2 outputs at 2 sat/vB
+	change := request.Outputs[1].Value.Int64()
+	if fee := request.Fee.Int64(); fee < 400 || fee > 500 || change != 70000-50000-fee {
+		t.Errorf("Unexpected fee %d and change %d", fee, change)
+	}
+	if _, err := w.CreateTransaction([]provider.BitcoinOutputDetails{{Address: recipient, Value: big.NewInt(70000)}}, provider.FeeRateFromSatPerVByte(2), provider.CoinControl{}); err == nil {
+		t.Errorf("Expected insufficient funds")
+	}
+
+	// the request travels as JSON to the offline signer
+	data, err := json.Marshal(request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var received wallet.SigningRequest
+	if err := json.Unmarshal(data, &received); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := watch.Sign(&received); err == nil {
+		t.Errorf("Expected a watch-only account not to sign")
+	}
+	signed, err := offline.Sign(&received)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// a signed transaction paying other outputs is refused
+	tampered := signed.Copy()
+	tampered.Outputs[0].Amount = big.NewInt(60000)
+	tampered.Outputs[1].Amount = big.NewInt(change - 10000)
+	if _, err := w.Broadcast(ctx, request, tampered.Serialize()); !errors.Is(err, wallet.ErrTemplateMismatch) {
+		t.Errorf("Expected a template mismatch, got %v", err)
+	}
+	unsigned := signed.Copy()
+	unsigned.Witnesses[1].Stack = []string{}
+	if _, err := w.Broadcast(ctx, request, unsigned.Serialize()); err == nil {
+		t.Errorf("Expected an error for an unsigned input")
+	}
+
+	txId, err := w.Broadcast(ctx, request, signed.Serialize())
+	if err != nil || txId != signed.TxId() {
+		t.Fatalf("Unexpected broadcast %s %v", txId, err)
+	}
+	if confirmed, unconfirmed := w.Balance(); confirmed.Int64() != 0 || unconfirmed.Int64() != change {
+		t.Errorf("Unexpected balance after the payment %v %v", confirmed, unconfirmed)
+	}
+	if addresses := watch.Addresses(wallet.ChangeChain); len(addresses) == 0 || !addresses[0].Used {
+		t.Errorf("Expected the change address to be used")
+	}
+	if addr, _ := watch.ChangeAddress(); addr.Index == 0 {
+		t.Errorf("Expected a fresh change address, got %d", addr.Index)
+	}
+}
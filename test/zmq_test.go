@@ -0,0 +1,192 @@
+package test
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mrtnetwork/bitcoin/formating"
+	"github.com/mrtnetwork/bitcoin/provider"
+	"github.com/mrtnetwork/bitcoin/scripts"
+)
+
+// zmqPeer is a connection of the publisher stand-in with the topics subscribed by the subscriber
+type zmqPeer struct {
+	conn   net.Conn
+	topics []string
+}
+
+// zmqFrame writes a ZMTP frame
+func zmqFrame(w io.Writer, flags byte, body []byte) {
+	if len(body) > 255 {
+		size := make([]byte, 8)
+		binary.BigEndian.PutUint64(size, uint64(len(body)))
+		w.Write(append(append([]byte{flags | 0x02}, size...), body...))
+		return
+	}
+	w.Write(append([]byte{flags, byte(len(body))}, body...))
+}
+
+// readZmqFrame reads a short ZMTP frame
+func readZmqFrame(t *testing.T, reader *bufio.Reader) (byte, []byte) {
+	header := make([]byte, 2)
+	if _, err := io.ReadFull(reader, header); err != nil {
+		t.Errorf("read frame: %v", err)
+		return 0, nil
+	}
+	body := make([]byte, header[1])
+	io.ReadFull(reader, body)
+	return header[0], body
+}
+
+// zmqPublisher accepts ZMTP 3 connections, answers the handshake and waits for the given number of
+// subscriptions before handing the connection over
+func zmqPublisher(t *testing.T, subscriptions int) (net.Listener, chan *zmqPeer) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	peers := make(chan *zmqPeer, 4)
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			conn.SetDeadline(time.Now().Add(5 * time.Second))
+			reader := bufio.NewReader(conn)
+			greeting := make([]byte, 64)
+			if _, err := io.ReadFull(reader, greeting); err != nil || greeting[0] != 0xff || greeting[9] != 0x7f || greeting[10] != 3 ||
+				!bytes.HasPrefix(greeting[12:], []byte("NULL")) {
+				t.Errorf("Unexpected greeting %x %v", greeting, err)
+				conn.Close()
+				continue
+			}
+			reply := make([]byte, 64)
+			reply[0], reply[9], reply[10], reply[11] = 0xff, 0x7f, 3, 1
+			copy(reply[12:], "NULL")
+			conn.Write(reply)
+			if flags, ready := readZmqFrame(t, reader); flags != 0x04 || !bytes.Contains(ready, []byte("READY\x0bSocket-Type\x00\x00\x00\x03SUB")) {
+				t.Errorf("Unexpected READY command %x", ready)
+			}
+			zmqFrame(conn, 0x04, []byte("\x05READY\x0bSocket-Type\x00\x00\x00\x03PUB"))
+			peer := &zmqPeer{conn: conn}
+			for i := 0; i < subscriptions; i++ {
+				if _, subscription := readZmqFrame(t, reader); len(subscription) > 0 && subscription[0] == 1 {
+					peer.topics = append(peer.topics, string(subscription[1:]))
+				}
+			}
+			conn.SetDeadline(time.Time{})
+			peers <- peer
+		}
+	}()
+	return listener, peers
+}
+
+// publish sends a notification like Bitcoin Core: topic, body and sequence number
+func (p *zmqPeer) publish(topic string, body []byte, sequence uint32) {
+	zmqFrame(p.conn, 0x01, []byte(topic))
+	zmqFrame(p.conn, 0x01, body)
+	number := make([]byte, 4)
+	binary.LittleEndian.PutUint32(number, sequence)
+	zmqFrame(p.conn, 0x00, number)
+}
+
+func TestZMQSubscriber(t *testing.T) {
+	listener, peers := zmqPublisher(t, 4)
+	defer listener.Close()
+
+	subscriber := provider.NewZMQSubscriber("tcp://" + listener.Addr().String())
+	subscriber.ReconnectDelay = 10 * time.Millisecond
+	events := make(chan interface{}, 32)
+	subscriber.OnRawTransaction(func(txId string, tx *scripts.BtcTransaction) { events <- txId })
+	subscriber.OnRawBlock(func(block *provider.Block) { events <- block })
+	subscriber.OnHashBlock(func(hash string) { events <- "block " + hash })
+	subscriber.OnSequence(func(event provider.ZMQSequenceEvent) { events <- event })
+	subscriber.OnGap(func(gap provider.ZMQGap) { events <- gap })
+	subscriber.OnError(func(err error) { events <- err })
+	next := func() interface{} {
+		t.Helper()
+		select {
+		case event := <-events:
+			return event
+		case <-time.After(5 * time.Second):
+			t.Fatalf("No event received")
+			return nil
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	result := make(chan error, 1)
+	go func() { result <- subscriber.Run(ctx) }()
+	peer := <-peers
+	if strings.Join(peer.topics, ",") != "rawtx,rawblock,hashblock,sequence" {
+		t.Errorf("Unexpected subscriptions %v", peer.topics)
+	}
+
+	// the coinbase of the genesis block, its id is computed from the raw bytes
+	peer.publish("rawtx", formating.HexToBytes(genesisBlock[162:]), 10)
+	if txId := next(); txId != "4a5e1e4baab89f3a32518a88c31bc87f618f76673e2cc77ab2127b7afdeda33b" {
+		t.Errorf("Unexpected transaction %v", txId)
+	}
+	peer.publish("rawblock", formating.HexToBytes(genesisBlock), 0)
+	if block, ok := next().(*provider.Block); !ok || block.Header.Hash != genesisHash || len(block.Transactions) != 1 {
+		t.Errorf("Unexpected block %+v", block)
+	}
+	peer.publish("hashblock", formating.HexToBytes(genesisHash), 1)
+	if hash := next(); hash != "block "+genesisHash {
+		t.Errorf("Unexpected hash %v", hash)
+	}
+	added := append(formating.HexToBytes(strings.Repeat("ab", 32)), 'A', 7, 0, 0, 0, 0, 0, 0, 0)
+	peer.publish("sequence", added, 5)
+	if event := next().(provider.ZMQSequenceEvent); event.Kind != provider.ZMQTransactionAdded || event.MempoolSequence != 7 || event.Hash != strings.Repeat("ab", 32) {
+		t.Errorf("Unexpected sequence event %+v", event)
+	}
+
+	// two rawtx notifications lost
+	peer.publish("rawtx", formating.HexToBytes(genesisBlock[162:]), 13)
+	if gap := next().(provider.ZMQGap); gap.Topic != "rawtx" || gap.Expected != 11 || gap.Missed() != 2 {
+		t.Errorf("Unexpected gap %+v", gap)
+	}
+	next()
+	peer.publish("rawtx", []byte{0x02, 0x00}, 14)
+	if err, ok := next().(error); !ok || !strings.Contains(err.Error(), "invalid rawtx") {
+		t.Errorf("Expected an invalid transaction error, got %v", err)
+	}
+
+	// the connection is re-established, the notifications published meanwhile are detected as lost
+	peer.conn.Close()
+	if err, ok := next().(error); !ok || !strings.Contains(err.Error(), "connection lost") {
+		t.Errorf("Expected a lost connection, got %v", err)
+	}
+	peer = <-peers
+	connected := append(formating.HexToBytes(genesisHash), 'C')
+	peer.publish("sequence", connected, 9)
+	if gap := next().(provider.ZMQGap); gap.Topic != "sequence" || gap.Missed() != 3 {
+		t.Errorf("Unexpected gap %+v", gap)
+	}
+	if event := next().(provider.ZMQSequenceEvent); event.Kind != provider.ZMQBlockConnected || event.Hash != genesisHash {
+		t.Errorf("Unexpected sequence event %+v", event)
+	}
+
+	cancel()
+	if err := <-result; !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected context.Canceled, got %v", err)
+	}
+
+	// the first connection must succeed
+	listener.Close()
+	if err := subscriber.Run(context.Background()); err == nil {
+		t.Errorf("Expected a connection error")
+	}
+	if err := provider.NewZMQSubscriber(listener.Addr().String()).Run(context.Background()); err == nil {
+		t.Errorf("Expected an error without handler")
+	}
+}
@@ -0,0 +1,400 @@
+package wallet
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"sync"
+
+	"github.com/mrtnetwork/bitcoin/address"
+	"github.com/mrtnetwork/bitcoin/constant"
+	"github.com/mrtnetwork/bitcoin/digest"
+	hdwallet "github.com/mrtnetwork/bitcoin/hd_wallet"
+	"github.com/mrtnetwork/bitcoin/keypair"
+	"github.com/mrtnetwork/bitcoin/provider"
+)
+
+// DefaultGapLimit is the number of consecutive unused addresses after which a wallet stops
+// looking for funds, the gap limit of BIP44.
+const DefaultGapLimit = 20
+
+// Chain is a BIP32 chain of an account.
+type Chain int
+
+const (
+	// ReceiveChain is the external chain, the addresses given out to receive payments.
+	ReceiveChain Chain = 0
+
+	// ChangeChain is the internal chain, the addresses receiving the change of the wallet.
+	ChangeChain Chain = 1
+)
+
+func (chain Chain) String() string {
+	if chain == ChangeChain {
+		return "change"
+	}
+	return "receive"
+}
+
+// AccountAddress is an address of an account with its derivation.
+type AccountAddress struct {
+	// Chain and Index of the address in the account.
+	Chain Chain
+	Index int
+
+	// Path is the full derivation path of the key, for example m/84'/0'/0'/0/5.
+	Path string
+
+	PublicKey *keypair.ECPublic
+	Address   address.BitcoinAddress
+
+	// Used reports whether the address received funds.
+	Used bool
+
+	// Label of the address attached by LabelStore.ApplyAccount, from the BIP329 record of the
+	// address or else of its public key.
+	Label string
+}
+
+// Owner returns the owner details of the outputs paying the address, as expected by
+// provider.NewBitcoinTransactionBuilder.
+func (addr *AccountAddress) Owner() provider.UtxoOwnerDetails {
+	return provider.UtxoOwnerDetails{PublicKey: addr.PublicKey.ToHex(), Address: addr.Address}
+}
+
+// accountChain holds the addresses derived on a chain, the ones given out first
+type accountChain struct {
+	node      *hdwallet.HdWallet
+	addresses []*AccountAddress
+	issued    int
+}
+
+// lastUsed returns the index of the last used address, -1 when none is used
+func (c *accountChain) lastUsed() int {
+	for i := len(c.addresses) - 1; i >= 0; i-- {
+		if c.addresses[i].Used {
+			return i
+		}
+	}
+	return -1
+}
+
+// Account manages a BIP32 account (for example m/84'/0'/0'): it gives out fresh receive
+// addresses, picks the change addresses on the internal chain, follows the used addresses and
+// the gap, and maps the scripts and public keys of its addresses back to their derivation. The
+// addresses up to the gap limit after the last used one are derived ahead, so the payments they
+// receive are recognized.
+type Account struct {
+	// Path is the derivation path of the account.
+	Path string
+
+	// Fingerprint of the master key in hexadecimal, empty when unknown. With Path, it tells an
+	// offline signer which key derives the account.
+	Fingerprint string
+
+	// Type of the addresses: P2PKH, P2WPKH, P2WPKHInP2SH or P2TR.
+	Type address.AddressType
+
+	// GapLimit is the number of unused addresses given out or derived ahead after the last used
+	// one, DefaultGapLimit by default.
+	GapLimit int
+
+	// Label of the extended public key of the account, attached by LabelStore.ApplyAccount.
+	Label string
+
+	network address.NetworkInfo
+	node    *hdwallet.HdWallet
+
+	mu         sync.Mutex
+	chains     [2]*accountChain
+	scripts    map[string]*AccountAddress
+	publicKeys map[string]*AccountAddress
+
+	// labels of the addresses and public keys, given to the addresses when derived
+	labels map[string]string
+}
+
+// NewAccount derives the account at path (for example m/84'/0'/0') from the master wallet,
+// with addresses of the given type.
+func NewAccount(master *hdwallet.HdWallet, path string, addressType address.AddressType, network address.NetworkInfo) (*Account, error) {
+	node, err := hdwallet.DrivePath(master, path)
+	if err != nil {
+		return nil, err
+	}
+	account, err := newAccount(node, path, addressType, network)
+	if err != nil {
+		return nil, err
+	}
+	account.Fingerprint = hex.EncodeToString(digest.Hash160(master.GetPublic().ToCompressedBytes())[:4])
+	return account, nil
+}
+
+func newAccount(node *hdwallet.HdWallet, path string, addressType address.AddressType, network address.NetworkInfo) (*Account, error) {
+	switch addressType {
+	case address.P2PKH, address.P2WPKH, address.P2WPKHInP2SH, address.P2TR:
+	default:
+		return nil, fmt.Errorf("unsupported account address type %d", addressType)
+	}
+	account := &Account{
+		Path:       path,
+		Type:       addressType,
+		GapLimit:   DefaultGapLimit,
+		network:    network,
+		node:       node,
+		scripts:    map[string]*AccountAddress{},
+		publicKeys: map[string]*AccountAddress{},
+	}
+	for _, chain := range []Chain{ReceiveChain, ChangeChain} {
+		chainNode, err := hdwallet.DrivePath(node, strconv.Itoa(int(chain)))
+		if err != nil {
+			return nil, err
+		}
+		account.chains[chain] = &accountChain{node: chainNode}
+		if err := account.lookahead(chain); err != nil {
+			return nil, err
+		}
+	}
+	return account, nil
+}
+
+// XPublicKey returns the extended public key of the account, to watch it without the private keys.
+// Taproot accounts use the xpub version, there is no version dedicated to them.
+func (a *Account) XPublicKey() string {
+	if a.Type == address.P2TR {
+		return a.node.ToXPublicKey(address.P2PKH, a.network)
+	}
+	return a.node.ToXPublicKey(a.Type, a.network)
+}
+
+// NextReceiveAddress gives out a fresh receive address. When the gap limit of unused addresses
+// given out is reached, the first unused one is given out again: a wallet restored from the seed
+// would not find the payments to the addresses beyond the gap.
+func (a *Account) NextReceiveAddress() (AccountAddress, error) {
+	return a.next(ReceiveChain)
+}
+
+// ChangeAddress gives out a fresh change address, so the change of each transaction goes to its
+// own address, with the gap limit of NextReceiveAddress.
+func (a *Account) ChangeAddress() (AccountAddress, error) {
+	return a.next(ChangeChain)
+}
+
+// next gives out the next address of the chain, or the first unused one at the gap limit
+func (a *Account) next(chain Chain) (AccountAddress, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	c := a.chains[chain]
+	lastUsed := c.lastUsed()
+	if c.issued-lastUsed-1 >= a.gapLimit() {
+		return *c.addresses[lastUsed+1], nil
+	}
+	index := c.issued
+	c.issued++
+	if err := a.lookahead(chain); err != nil {
+		return AccountAddress{}, err
+	}
+	return *c.addresses[index], nil
+}
+
+// Lookup returns the address of the account paid by the script (ScriptPubKey in hexadecimal).
+func (a *Account) Lookup(scriptPubKey string) (AccountAddress, bool) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	addr, ok := a.scripts[scriptPubKey]
+	if !ok {
+		return AccountAddress{}, false
+	}
+	return *addr, true
+}
+
+// MarkUsed records that the address paid by the script received funds. The addresses after it
+// are derived up to the gap limit. It returns false when the script is not an address of the
+// account.
+func (a *Account) MarkUsed(scriptPubKey string) (AccountAddress, bool, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	addr, ok := a.scripts[scriptPubKey]
+	if !ok {
+		return AccountAddress{}, false, nil
+	}
+	addr.Used = true
+	c := a.chains[addr.Chain]
+	if addr.Index >= c.issued {
+		c.issued = addr.Index + 1
+	}
+	return *addr, true, a.lookahead(addr.Chain)
+}
+
+// Addresses returns the addresses of the chain given out, or used, so far.
+func (a *Account) Addresses(chain Chain) []AccountAddress {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	c := a.chains[chain]
+	addresses := make([]AccountAddress, c.issued)
+	for i := range addresses {
+		addresses[i] = *c.addresses[i]
+	}
+	return addresses
+}
+
+// Gap returns the number of unused addresses of the chain given out after the last used one.
+func (a *Account) Gap(chain Chain) int {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	c := a.chains[chain]
+	return c.issued - c.lastUsed() - 1
+}
+
+// Owners returns the owner details of every derived address, the ones derived ahead included,
+// to track them in a UtxoStore.
+func (a *Account) Owners() []provider.UtxoOwnerDetails {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	owners := []provider.UtxoOwnerDetails{}
+	for _, c := range a.chains {
+		for _, addr := range c.addresses {
+			owners = append(owners, addr.Owner())
+		}
+	}
+	return owners
+}
+
+// PrivateKey returns the private key of the address at index of the chain. It fails for an
+// account created from an extended public key.
+func (a *Account) PrivateKey(chain Chain, index int) (*keypair.ECPrivate, error) {
+	node, err := hdwallet.DrivePath(a.chains[chain].node, strconv.Itoa(index))
+	if err != nil {
+		return nil, err
+	}
+	return node.GetPrivate()
+}
+
+// Signer returns the signer callback of provider.BitcoinTransactionBuilder: the private key of
+// each input is derived from the path of its owner's public key.
+func (a *Account) Signer() provider.BitcoinSignerCallBack {
+	return func(trDigest []byte, utxo provider.UtxoWithOwner, multiSigPublicKey string) (string, error) {
+		a.mu.Lock()
+		addr, ok := a.publicKeys[utxo.OwnerDetails.PublicKey]
+		a.mu.Unlock()
+		if !ok {
+			return "", fmt.Errorf("public key %s is not a key of the account", utxo.OwnerDetails.PublicKey)
+		}
+		key, err := a.PrivateKey(addr.Chain, addr.Index)
+		if err != nil {
+			return "", err
+		}
+		if utxo.Utxo.IsP2tr() {
+			return key.SignTaprootTransaction(trDigest, constant.TAPROOT_SIGHASH_ALL, []interface{}{}, true), nil
+		}
+		return key.SingInput(trDigest, constant.SIGHASH_ALL), nil
+	}
+}
+
+// Discover restores the used addresses of the account from the history of its addresses: both
+// chains are scanned until the gap limit of consecutive addresses without transaction.
+func (a *Account) Discover(ctx context.Context, chainProvider provider.ChainProvider) error {
+	for _, chain := range []Chain{ReceiveChain, ChangeChain} {
+		for index, unused := 0, 0; unused < a.gapLimit(); index++ {
+			a.mu.Lock()
+			err := a.derive(chain, index)
+			addr := a.chains[chain].addresses[index]
+			a.mu.Unlock()
+			if err != nil {
+				return err
+			}
+			page, err := chainProvider.GetAccountTransactions(ctx, addr.Address, "")
+			if err != nil {
+				return err
+			}
+			if len(page.Transactions) == 0 {
+				unused++
+				continue
+			}
+			unused = 0
+			if _, _, err := a.MarkUsed(addr.Address.ToScriptPubKey().ToHex()); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (a *Account) gapLimit() int {
+	if a.GapLimit <= 0 {
+		return DefaultGapLimit
+	}
+	return a.GapLimit
+}
+
+// lookahead derives the addresses of the chain up to the gap limit after the last used or given
+// out address
+func (a *Account) lookahead(chain Chain) error {
+	c := a.chains[chain]
+	last := c.lastUsed()
+	if c.issued-1 > last {
+		last = c.issued - 1
+	}
+	return a.derive(chain, last+a.gapLimit())
+}
+
+// derive derives the addresses of the chain up to index
+func (a *Account) derive(chain Chain, index int) error {
+	c := a.chains[chain]
+	for i := len(c.addresses); i <= index; i++ {
+		node, err := hdwallet.DrivePath(c.node, strconv.Itoa(i))
+		if err != nil {
+			return err
+		}
+		public := node.GetPublic()
+		var addr address.BitcoinAddress
+		switch a.Type {
+		case address.P2PKH:
+			addr = public.ToAddress()
+		case address.P2WPKH:
+			addr = public.ToSegwitAddress()
+		case address.P2WPKHInP2SH:
+			addr = public.ToP2WPKHInP2SH()
+		default:
+			addr = public.ToTaprootAddress()
+		}
+		accountAddress := &AccountAddress{
+			Chain:     chain,
+			Index:     i,
+			Path:      fmt.Sprintf("%s/%d/%d", a.Path, chain, i),
+			PublicKey: public,
+			Address:   addr,
+			Label:     a.addressLabel(addr.Show(a.network), public.ToHex()),
+		}
+		c.addresses = append(c.addresses, accountAddress)
+		a.scripts[addr.ToScriptPubKey().ToHex()] = accountAddress
+		a.publicKeys[public.ToHex()] = accountAddress
+	}
+	return nil
+}
+
+// setLabels replaces the labels of the addresses and public keys and attaches them to the
+// addresses derived
+func (a *Account) setLabels(labels map[string]string) int {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.labels = labels
+	labeled := 0
+	for _, chain := range a.chains {
+		for _, addr := range chain.addresses {
+			addr.Label = a.addressLabel(addr.Address.Show(a.network), addr.PublicKey.ToHex())
+			if addr.Label != "" {
+				labeled++
+			}
+		}
+	}
+	return labeled
+}
+
+// addressLabel returns the label of the address, or else of its public key
+func (a *Account) addressLabel(addr string, publicKey string) string {
+	if label, ok := a.labels[addr]; ok {
+		return label
+	}
+	return a.labels[publicKey]
+}
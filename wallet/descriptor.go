@@ -0,0 +1,150 @@
+package wallet
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/mrtnetwork/bitcoin/address"
+	hdwallet "github.com/mrtnetwork/bitcoin/hd_wallet"
+)
+
+// character sets of the output descriptor checksums (BIP380)
+const (
+	descriptorInputCharset    = "0123456789()[],'/*abcdefgh@:$%{}IJKLMNOPQRSTUVWXYZ&+-.;<=>?!^_|~ijklmnopqrstuvwxyzABCDEFGH`#\"\\ "
+	descriptorChecksumCharset = "qpzry9x8gf2tvdw0s3jn54khce6mua7l"
+)
+
+// descriptor templates of the account address types, the key replaces %s
+var descriptorTemplates = map[address.AddressType]string{
+	address.P2PKH:        "pkh(%s)",
+	address.P2WPKH:       "wpkh(%s)",
+	address.P2WPKHInP2SH: "sh(wpkh(%s))",
+	address.P2TR:         "tr(%s)",
+}
+
+// NewAccountFromXPublicKey creates a watch-only account from the extended public key of the
+// account derived at path, for example m/84'/0'/0'. The private keys are never available, the
+// transactions are signed with SigningRequest.
+func NewAccountFromXPublicKey(xPublicKey string, path string, addressType address.AddressType, network address.NetworkInfo) (account *Account, err error) {
+	// the extended key decoding panics on invalid keys
+	defer func() {
+		if r := recover(); r != nil {
+			account, err = nil, fmt.Errorf("invalid extended public key: %v", r)
+		}
+	}()
+	node, err := hdwallet.FromXPublicKey(xPublicKey, false, network)
+	if err != nil {
+		return nil, err
+	}
+	return newAccount(node, path, addressType, network)
+}
+
+// NewAccountFromDescriptor creates a watch-only account from an output descriptor of a single
+// key account: pkh, wpkh, sh(wpkh) or tr of an extended public key followed by /<0;1>/*, with an
+// optional key origin, for example wpkh([d34db33f/84'/0'/0']xpub.../<0;1>/*)#checksum. The
+// checksum is verified when present. The descriptors of a single chain, /0/* or /1/*, are refused:
+// the account derives both the receive and the change addresses.
+func NewAccountFromDescriptor(descriptor string, network address.NetworkInfo) (*Account, error) {
+	if index := strings.IndexByte(descriptor, '#'); index >= 0 {
+		checksum, err := descriptorChecksum(descriptor[:index])
+		if err != nil {
+			return nil, err
+		}
+		if checksum != descriptor[index+1:] {
+			return nil, fmt.Errorf("invalid descriptor checksum %s, expected %s", descriptor[index+1:], checksum)
+		}
+		descriptor = descriptor[:index]
+	}
+	addressType, key := address.AddressType(-1), ""
+	for templateType, template := range descriptorTemplates {
+		prefix, suffix, _ := strings.Cut(template, "%s")
+		if strings.HasPrefix(descriptor, prefix) && strings.HasSuffix(descriptor, suffix) && len(descriptor) > len(prefix)+len(suffix) {
+			inner := descriptor[len(prefix) : len(descriptor)-len(suffix)]
+			// sh(wpkh(...)) also starts like sh(...), keep the key without parenthesis
+			if !strings.ContainsAny(inner, "()") {
+				addressType, key = templateType, inner
+			}
+		}
+	}
+	if key == "" {
+		return nil, fmt.Errorf("unsupported descriptor %s", descriptor)
+	}
+
+	path, fingerprint := "m", ""
+	if strings.HasPrefix(key, "[") {
+		end := strings.IndexByte(key, ']')
+		if end < 0 {
+			return nil, fmt.Errorf("invalid key origin in descriptor %s", descriptor)
+		}
+		origin := strings.Split(strings.ReplaceAll(key[1:end], "h", "'"), "/")
+		fingerprint, key = strings.ToLower(origin[0]), key[end+1:]
+		if len(fingerprint) != 8 {
+			return nil, fmt.Errorf("invalid key fingerprint %s", fingerprint)
+		}
+		path = strings.Join(append([]string{"m"}, origin[1:]...), "/")
+		if path != "m" && !hdwallet.IsValidPath(path) {
+			return nil, fmt.Errorf("invalid key origin path %s", path)
+		}
+	}
+	xPublicKey, chains, _ := strings.Cut(key, "/")
+	if chains != "<0;1>/*" {
+		return nil, fmt.Errorf("unsupported derivation /%s, expected the receive and change chains /<0;1>/*", chains)
+	}
+	account, err := NewAccountFromXPublicKey(xPublicKey, path, addressType, network)
+	if err != nil {
+		return nil, err
+	}
+	account.Fingerprint = fingerprint
+	return account, nil
+}
+
+// Descriptor returns the output descriptor of the account with its checksum, the receive and
+// change chains written /<0;1>/*. It is imported by NewAccountFromDescriptor and by Bitcoin Core.
+func (a *Account) Descriptor() string {
+	key := a.node.ToXPublicKey(address.P2PKH, a.network) + "/<0;1>/*"
+	if a.Fingerprint != "" {
+		key = "[" + a.Fingerprint + strings.TrimPrefix(a.Path, "m") + "]" + key
+	}
+	descriptor := fmt.Sprintf(descriptorTemplates[a.Type], key)
+	checksum, _ := descriptorChecksum(descriptor)
+	return descriptor + "#" + checksum
+}
+
+// descriptorChecksum computes the checksum of a descriptor as defined by BIP380
+func descriptorChecksum(descriptor string) (string, error) {
+	polymod := func(c uint64, value uint64) uint64 {
+		c0 := c >> 35
+		c = ((c & 0x7ffffffff) << 5) ^ value
+		for i, generator := range []uint64{0xf5dee51989, 0xa9fdca3312, 0x1bab10e32d, 0x3706b1677a, 0x644d626ffd} {
+			if c0>>i&1 != 0 {
+				c ^= generator
+			}
+		}
+		return c
+	}
+	c, class, classCount := uint64(1), uint64(0), 0
+	for _, char := range descriptor {
+		position := strings.IndexRune(descriptorInputCharset, char)
+		if position < 0 {
+			return "", fmt.Errorf("invalid descriptor character %q", char)
+		}
+		c = polymod(c, uint64(position&31))
+		class = class*3 + uint64(position>>5)
+		if classCount++; classCount == 3 {
+			c = polymod(c, class)
+			class, classCount = 0, 0
+		}
+	}
+	if classCount > 0 {
+		c = polymod(c, class)
+	}
+	for i := 0; i < 8; i++ {
+		c = polymod(c, 0)
+	}
+	c ^= 1
+	checksum := make([]byte, 8)
+	for i := range checksum {
+		checksum[i] = descriptorChecksumCharset[(c>>(5*(7-i)))&31]
+	}
+	return string(checksum), nil
+}
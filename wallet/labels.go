@@ -0,0 +1,459 @@
+package wallet
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/mrtnetwork/bitcoin/address"
+)
+
+// labelPrefix is the key prefix of the labels in the storage
+const labelPrefix = "label/"
+
+// LabelType is the type of a BIP329 label record, the kind of its reference.
+type LabelType string
+
+const (
+	// LabelTx labels a transaction, the reference is its id.
+	LabelTx LabelType = "tx"
+
+	// LabelAddress labels an address, the reference is the address.
+	LabelAddress LabelType = "addr"
+
+	// LabelPublicKey labels a public key, the reference is the key in hexadecimal.
+	LabelPublicKey LabelType = "pubkey"
+
+	// LabelInput labels a transaction input, the reference is txid:index of the spending
+	// transaction.
+	LabelInput LabelType = "input"
+
+	// LabelOutput labels a transaction output, the reference is its outpoint txid:vout.
+	LabelOutput LabelType = "output"
+
+	// LabelXPublicKey labels an extended public key, the reference is the key.
+	LabelXPublicKey LabelType = "xpub"
+)
+
+// Label is a BIP329 label record. The fields not defined by this type, reserved by the BIP or
+// written by other wallets, are kept in Extra and exported unchanged, as the empty label and
+// origin of the records read.
+type Label struct {
+	Type  LabelType
+	Ref   string
+	Label string
+
+	// Origin is the descriptor of the wallet of the reference, optional. It is kept with the
+	// record, it is not the origin of the coin control metadata.
+	Origin string
+
+	// Spendable of an output record, nil when the record does not tell. An output not spendable
+	// is frozen in the UtxoStore.
+	Spendable *bool
+
+	// Extra are the other fields of the record, as read, and the fields of the record set to null.
+	Extra map[string]json.RawMessage
+
+	// hasLabel and hasOrigin record the fields present in the record read, written even when empty
+	hasLabel, hasOrigin bool
+}
+
+// labelFields are the fields of Label, in the order of the records exported
+var labelFields = []string{"type", "ref", "label", "origin", "spendable"}
+
+// MarshalJSON writes the record on a single line, type and ref first. The empty label and origin
+// are omitted, unless they were present in the record read.
+func (label Label) MarshalJSON() ([]byte, error) {
+	fields := []string{}
+	values := map[string]interface{}{"type": label.Type, "ref": label.Ref}
+	if label.Label != "" || label.hasLabel {
+		values["label"] = label.Label
+	}
+	if label.Origin != "" || label.hasOrigin {
+		values["origin"] = label.Origin
+	}
+	if label.Spendable != nil {
+		values["spendable"] = *label.Spendable
+	}
+	for _, field := range labelFields {
+		if _, ok := values[field]; ok {
+			fields = append(fields, field)
+		}
+	}
+	extra := []string{}
+	for field := range label.Extra {
+		if _, ok := values[field]; !ok {
+			extra = append(extra, field)
+		}
+	}
+	sort.Strings(extra)
+	fields = append(fields, extra...)
+
+	var buffer bytes.Buffer
+	buffer.WriteByte('{')
+	for i, field := range fields {
+		if i > 0 {
+			buffer.WriteByte(',')
+		}
+		if err := writeJSON(&buffer, field); err != nil {
+			return nil, err
+		}
+		buffer.WriteByte(':')
+		if value, ok := values[field]; ok {
+			if err := writeJSON(&buffer, value); err != nil {
+				return nil, err
+			}
+		} else if err := json.Compact(&buffer, label.Extra[field]); err != nil {
+			return nil, fmt.Errorf("invalid value of label field %s: %v", field, err)
+		}
+	}
+	buffer.WriteByte('}')
+	return buffer.Bytes(), nil
+}
+
+// UnmarshalJSON reads a record, type and ref are required.
+func (label *Label) UnmarshalJSON(data []byte) error {
+	fields := map[string]json.RawMessage{}
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return err
+	}
+	record := Label{}
+	targets := map[string]interface{}{
+		"type":      &record.Type,
+		"ref":       &record.Ref,
+		"label":     &record.Label,
+		"origin":    &record.Origin,
+		"spendable": &record.Spendable,
+	}
+	for field, value := range fields {
+		target, ok := targets[field]
+		// a null is not a value of the fields, it is kept as read
+		if !ok || (field != "type" && field != "ref" && string(bytes.TrimSpace(value)) == "null") {
+			if record.Extra == nil {
+				record.Extra = map[string]json.RawMessage{}
+			}
+			record.Extra[field] = value
+			continue
+		}
+		if err := json.Unmarshal(value, target); err != nil {
+			return fmt.Errorf("invalid label field %s: %v", field, err)
+		}
+	}
+	if record.Type == "" || record.Ref == "" {
+		return fmt.Errorf("label record without type or ref")
+	}
+	record.hasLabel = fields["label"] != nil && record.Extra["label"] == nil
+	record.hasOrigin = fields["origin"] != nil && record.Extra["origin"] == nil
+	*label = record
+	return nil
+}
+
+// writeJSON writes the value without escaping the HTML characters, the labels are written as
+// entered
+func writeJSON(buffer *bytes.Buffer, value interface{}) error {
+	encoder := json.NewEncoder(buffer)
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(value); err != nil {
+		return err
+	}
+	// the encoder ends the value with a new line
+	buffer.Truncate(buffer.Len() - 1)
+	return nil
+}
+
+// LabelStore keeps the BIP329 labels of the wallet, persisted in a Storage, and shares them with
+// other wallets through the JSON Lines export format. The labels of the outputs and of the
+// transactions are attached to the UtxoStore by Apply and collected from it by Collect, the
+// labels of the addresses, public keys and extended public keys to an Account by ApplyAccount.
+// Records of other types than the ones of the BIP are kept and exported as well.
+type LabelStore struct {
+	storage Storage
+
+	mu     sync.Mutex
+	labels map[string]Label
+}
+
+// NewLabelStore opens the labels persisted in storage.
+func NewLabelStore(storage Storage) (*LabelStore, error) {
+	store := &LabelStore{storage: storage, labels: map[string]Label{}}
+	labels, err := storage.Load(labelPrefix)
+	if err != nil {
+		return nil, err
+	}
+	for key, data := range labels {
+		var label Label
+		if err := json.Unmarshal(data, &label); err != nil {
+			return nil, fmt.Errorf("invalid label %s: %v", key, err)
+		}
+		store.labels[labelKey(label.Type, label.Ref)] = label
+	}
+	return store, nil
+}
+
+// Get returns the record of the reference.
+func (s *LabelStore) Get(labelType LabelType, ref string) (Label, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	label, ok := s.labels[labelKey(labelType, ref)]
+	return label, ok
+}
+
+// Set adds or replaces the record of its reference.
+func (s *LabelStore) Set(label Label) error {
+	if label.Type == "" || label.Ref == "" {
+		return fmt.Errorf("label record without type or ref")
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.write([]Label{label}, nil)
+}
+
+// Delete removes the record of the reference.
+func (s *LabelStore) Delete(labelType LabelType, ref string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.write(nil, []string{labelKey(labelType, ref)})
+}
+
+// Labels returns the records sorted by type and reference.
+func (s *LabelStore) Labels() []Label {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	labels := make([]Label, 0, len(s.labels))
+	for _, label := range s.labels {
+		labels = append(labels, label)
+	}
+	sort.Slice(labels, func(i, j int) bool {
+		if labels[i].Type != labels[j].Type {
+			return labels[i].Type < labels[j].Type
+		}
+		return labels[i].Ref < labels[j].Ref
+	})
+	return labels
+}
+
+// Import reads the records of a BIP329 export, one JSON object per line, and returns their
+// count. A record replaces the one of the same reference. Nothing is imported when a line is
+// invalid.
+func (s *LabelStore) Import(r io.Reader) (int, error) {
+	labels := []Label{}
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		data := bytes.TrimSpace(scanner.Bytes())
+		if len(data) == 0 {
+			continue
+		}
+		var label Label
+		if err := json.Unmarshal(data, &label); err != nil {
+			return 0, fmt.Errorf("invalid label record at line %d: %v", line, err)
+		}
+		labels = append(labels, label)
+	}
+	if err := scanner.Err(); err != nil {
+		return 0, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.write(labels, nil); err != nil {
+		return 0, err
+	}
+	return len(labels), nil
+}
+
+// Export writes the records in the BIP329 format, one JSON object per line.
+func (s *LabelStore) Export(w io.Writer) error {
+	for _, label := range s.Labels() {
+		data, err := label.MarshalJSON()
+		if err != nil {
+			return err
+		}
+		if _, err := w.Write(append(data, '\n')); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Apply attaches the records to the UTXO store. An output record replaces the labels of its coin
+// with the labels of the record, separated by commas, a record not spendable freezes the coin and
+// a spendable one unfreezes it. A transaction record labels its transaction of the wallet. It
+// returns the number of outputs and transactions updated.
+func (s *LabelStore) Apply(store *UtxoStore) (int, error) {
+	updated := 0
+	for _, label := range s.Labels() {
+		switch label.Type {
+		case LabelTx:
+			if label.Label == "" || !store.hasTransaction(label.Ref) || store.TransactionLabel(label.Ref) == label.Label {
+				continue
+			}
+			if err := store.SetTransactionLabel(label.Ref, label.Label); err != nil {
+				return updated, err
+			}
+			updated++
+		case LabelOutput:
+			outpoint, err := parseOutpoint(label.Ref)
+			if err != nil {
+				continue
+			}
+			utxo, ok := store.Utxo(outpoint)
+			if !ok {
+				continue
+			}
+			metadata := utxo.Metadata
+			if label.Label != "" {
+				metadata.Labels = splitLabels(label.Label)
+			}
+			if label.Spendable != nil {
+				metadata.Frozen = !*label.Spendable
+			}
+			if equalLabels(metadata.Labels, utxo.Metadata.Labels) && metadata.Frozen == utxo.Metadata.Frozen {
+				continue
+			}
+			if err := store.SetMetadata(outpoint, metadata); err != nil {
+				return updated, err
+			}
+			updated++
+		}
+	}
+	return updated, nil
+}
+
+// Collect records the labels of the UTXO store as records, to be exported: the labels of a coin
+// joined by commas and whether it is frozen, and the labels of the transactions. The label of a
+// record is kept while it holds the same labels, and the other fields of the records are kept.
+func (s *LabelStore) Collect(store *UtxoStore) error {
+	transactions := store.transactionLabels()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	labels := []Label{}
+	for txId, text := range transactions {
+		label, ok := s.labels[labelKey(LabelTx, txId)]
+		if ok && label.Label == text {
+			continue
+		}
+		if !ok {
+			label = Label{Type: LabelTx, Ref: txId}
+		}
+		label.Label = text
+		labels = append(labels, label)
+	}
+	for _, utxo := range store.Utxos() {
+		metadata := utxo.Metadata
+		ref := utxo.Outpoint.String()
+		label, ok := s.labels[labelKey(LabelOutput, ref)]
+		if !ok {
+			if len(metadata.Labels) == 0 && !metadata.Frozen {
+				continue
+			}
+			label = Label{Type: LabelOutput, Ref: ref}
+		}
+		before, _ := label.MarshalJSON()
+		if len(metadata.Labels) > 0 && !equalLabels(splitLabels(label.Label), metadata.Labels) {
+			label.Label = strings.Join(metadata.Labels, ", ")
+		}
+		if metadata.Frozen || label.Spendable != nil {
+			spendable := !metadata.Frozen
+			label.Spendable = &spendable
+		}
+		if after, _ := label.MarshalJSON(); !bytes.Equal(before, after) || !ok {
+			labels = append(labels, label)
+		}
+	}
+	return s.write(labels, nil)
+}
+
+// ApplyAccount attaches the records to the account: the labels of the addr and pubkey records to
+// the addresses of the account, derived now or later, the label of an address before the one of
+// its public key, and the label of the xpub record of the account key to Account.Label. The
+// previous labels of the account are replaced. It returns the number of addresses labeled.
+func (s *LabelStore) ApplyAccount(account *Account) int {
+	// the records of other wallets may use the xpub version of the key
+	keys := map[string]bool{account.XPublicKey(): true, account.node.ToXPublicKey(address.P2PKH, account.network): true}
+	labels, accountLabel := map[string]string{}, ""
+	for _, label := range s.Labels() {
+		switch {
+		case label.Label == "":
+		case label.Type == LabelAddress || label.Type == LabelPublicKey:
+			if _, ok := labels[label.Ref]; !ok || label.Type == LabelAddress {
+				labels[label.Ref] = label.Label
+			}
+		case label.Type == LabelXPublicKey && keys[label.Ref]:
+			accountLabel = label.Label
+		}
+	}
+	account.Label = accountLabel
+	return account.setLabels(labels)
+}
+
+// write stores the labels and deletes the keys
+func (s *LabelStore) write(labels []Label, deleted []string) error {
+	if len(labels) == 0 && len(deleted) == 0 {
+		return nil
+	}
+	batch := map[string][]byte{}
+	for _, key := range deleted {
+		batch[key] = nil
+	}
+	for _, label := range labels {
+		data, err := label.MarshalJSON()
+		if err != nil {
+			return err
+		}
+		batch[labelKey(label.Type, label.Ref)] = data
+	}
+	if err := s.storage.Write(batch); err != nil {
+		return err
+	}
+	for _, key := range deleted {
+		delete(s.labels, key)
+	}
+	for _, label := range labels {
+		s.labels[labelKey(label.Type, label.Ref)] = label
+	}
+	return nil
+}
+
+func labelKey(labelType LabelType, ref string) string {
+	return labelPrefix + string(labelType) + "/" + ref
+}
+
+// parseOutpoint parses the txid:vout reference of an output
+func parseOutpoint(ref string) (Outpoint, error) {
+	txId, vout, ok := strings.Cut(ref, ":")
+	index, err := strconv.Atoi(vout)
+	if !ok || len(txId) != 64 || err != nil || index < 0 {
+		return Outpoint{}, fmt.Errorf("invalid outpoint %s", ref)
+	}
+	return Outpoint{TxId: txId, Vout: index}, nil
+}
+
+// splitLabels returns the labels of a BIP329 label separated by commas
+func splitLabels(label string) []string {
+	labels := []string{}
+	for _, element := range strings.Split(label, ",") {
+		if element = strings.TrimSpace(element); element != "" {
+			labels = append(labels, element)
+		}
+	}
+	return labels
+}
+
+// equalLabels reports whether the labels are the same, in the same order
+func equalLabels(first []string, second []string) bool {
+	if len(first) != len(second) {
+		return false
+	}
+	for i := range first {
+		if first[i] != second[i] {
+			return false
+		}
+	}
+	return true
+}
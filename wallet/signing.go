@@ -0,0 +1,243 @@
+package wallet
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+
+	"github.com/mrtnetwork/bitcoin/address"
+	"github.com/mrtnetwork/bitcoin/formating"
+	"github.com/mrtnetwork/bitcoin/provider"
+	"github.com/mrtnetwork/bitcoin/scripts"
+)
+
+// ErrTemplateMismatch is returned when a signed transaction does not spend the inputs or pay the
+// outputs of its signing request.
+var ErrTemplateMismatch = errors.New("signed transaction does not match the signing request")
+
+// SigningInput is an input of a SigningRequest with the derivation of the key signing it.
+type SigningInput struct {
+	TxId string `json:"txid"`
+	Vout int    `json:"vout"`
+
+	// Value and ScriptPubKey (hexadecimal) of the spent output, required by the segwit digests.
+	Value        *big.Int            `json:"value"`
+	ScriptPubKey string              `json:"script"`
+	ScriptType   address.AddressType `json:"script_type"`
+
+	// PublicKey in hexadecimal, Fingerprint of the master key and derivation Path of the key.
+	PublicKey   string `json:"public_key"`
+	Fingerprint string `json:"fingerprint,omitempty"`
+	Path        string `json:"path"`
+}
+
+// SigningOutput is an output of a SigningRequest.
+type SigningOutput struct {
+	// Address of the output, empty for a script without address.
+	Address      string   `json:"address,omitempty"`
+	ScriptPubKey string   `json:"script"`
+	Value        *big.Int `json:"value"`
+
+	// Path of the key of a change output, empty for the payments. The signer can check the change
+	// comes back to the account.
+	Path string `json:"path,omitempty"`
+}
+
+// SigningRequest is an unsigned transaction handed to an offline signer, with the values,
+// scripts and derivation paths of its inputs. It is serialized with encoding/json.
+type SigningRequest struct {
+	// UnsignedTx is the transaction without scriptSig nor witness in hexadecimal.
+	UnsignedTx string          `json:"unsigned_tx"`
+	Inputs     []SigningInput  `json:"inputs"`
+	Outputs    []SigningOutput `json:"outputs"`
+	Fee        *big.Int        `json:"fee"`
+	EnableRBF  bool            `json:"rbf"`
+}
+
+// newSigningRequest describes the transaction built from the UTXOs of the account
+func newSigningRequest(account *Account, builder *provider.BitcoinTransactionBuilder, change string) (*SigningRequest, error) {
+	tx, err := builder.BuildTransaction(placeholderSigner)
+	if err != nil {
+		return nil, err
+	}
+	request := &SigningRequest{UnsignedTx: unsignedTemplate(tx).Serialize(), Fee: new(big.Int).Set(builder.FEE), EnableRBF: builder.EnableRBF}
+	for _, utxo := range builder.Utxos {
+		addr, ok := account.Lookup(utxo.OwnerDetails.Address.ToScriptPubKey().ToHex())
+		if !ok {
+			return nil, fmt.Errorf("utxo %s:%d is not paid to the account", utxo.Utxo.TxHash, utxo.Utxo.Vout)
+		}
+		request.Inputs = append(request.Inputs, SigningInput{
+			TxId:         utxo.Utxo.TxHash,
+			Vout:         utxo.Utxo.Vout,
+			Value:        new(big.Int).Set(utxo.Utxo.Value),
+			ScriptPubKey: addr.Address.ToScriptPubKey().ToHex(),
+			ScriptType:   utxo.Utxo.ScriptType,
+			PublicKey:    addr.PublicKey.ToHex(),
+			Fingerprint:  account.Fingerprint,
+			Path:         addr.Path,
+		})
+	}
+	for _, output := range builder.OutPuts {
+		script := output.Address.ToScriptPubKey().ToHex()
+		signingOutput := SigningOutput{Address: output.Address.Show(account.network), ScriptPubKey: script, Value: new(big.Int).Set(output.Value)}
+		if addr, ok := account.Lookup(script); ok && script == change {
+			signingOutput.Path = addr.Path
+		}
+		request.Outputs = append(request.Outputs, signingOutput)
+	}
+	return request, nil
+}
+
+// Verify checks the signed transaction spends the inputs and pays the outputs of the request,
+// with the same version, lock time and sequences, and that every input is signed by the key of
+// its derivation path. The signatures themselves are verified by the nodes on broadcast.
+func (request *SigningRequest) Verify(tx *scripts.BtcTransaction) error {
+	if unsignedTemplate(tx).Serialize() != request.UnsignedTx {
+		return request.mismatch(tx)
+	}
+	for i, input := range request.Inputs {
+		var witness []string
+		if tx.HasSegwit && i < len(tx.Witnesses) {
+			witness = tx.Witnesses[i].Stack
+		}
+		var scriptSig []interface{}
+		if tx.Inputs[i].ScriptSig != nil {
+			scriptSig = tx.Inputs[i].ScriptSig.Script
+		}
+		signed := false
+		switch input.ScriptType {
+		case address.P2TR:
+			signed = len(witness) == 1 && len(witness[0]) >= 128
+		case address.P2WPKH, address.P2WPKHInP2SH:
+			signed = len(witness) == 2 && witness[1] == input.PublicKey
+		case address.P2PKH:
+			signed = len(scriptSig) == 2 && scriptSig[1] == input.PublicKey
+		}
+		if !signed {
+			return fmt.Errorf("input %d is not signed by the key at %s", i, input.Path)
+		}
+	}
+	return nil
+}
+
+// mismatch describes the first difference between the signed transaction and the request
+func (request *SigningRequest) mismatch(tx *scripts.BtcTransaction) error {
+	if len(tx.Inputs) != len(request.Inputs) || len(tx.Outputs) != len(request.Outputs) {
+		return fmt.Errorf("%w: %d inputs and %d outputs instead of %d and %d", ErrTemplateMismatch, len(tx.Inputs), len(tx.Outputs), len(request.Inputs), len(request.Outputs))
+	}
+	for i, input := range tx.Inputs {
+		if input.TxID != request.Inputs[i].TxId || input.TxIndex != request.Inputs[i].Vout {
+			return fmt.Errorf("%w: input %d spends %s:%d instead of %s:%d", ErrTemplateMismatch, i, input.TxID, input.TxIndex, request.Inputs[i].TxId, request.Inputs[i].Vout)
+		}
+	}
+	for i, output := range tx.Outputs {
+		expected := request.Outputs[i]
+		if output.ScriptPubKey.ToHex() != expected.ScriptPubKey || output.Amount.Cmp(expected.Value) != 0 {
+			return fmt.Errorf("%w: output %d pays %v to %s instead of %v to %s", ErrTemplateMismatch, i, output.Amount, output.ScriptPubKey.ToHex(), expected.Value, expected.ScriptPubKey)
+		}
+	}
+	return fmt.Errorf("%w: version, lock time or sequences differ", ErrTemplateMismatch)
+}
+
+// Sign signs the request with the private keys of the account, on the offline machine. The keys
+// are derived from the paths of the inputs, which must belong to the account, and the signed
+// transaction is checked against the unsigned template.
+func (a *Account) Sign(request *SigningRequest) (*scripts.BtcTransaction, error) {
+	utxos := provider.UtxoWithOwnerList{}
+	for i, input := range request.Inputs {
+		addr, err := a.addressAt(input.Path)
+		if err != nil {
+			return nil, fmt.Errorf("input %d: %v", i, err)
+		}
+		if addr.PublicKey.ToHex() != input.PublicKey || addr.Address.ToScriptPubKey().ToHex() != input.ScriptPubKey {
+			return nil, fmt.Errorf("input %d is not paid to the key at %s", i, input.Path)
+		}
+		utxos = append(utxos, provider.UtxoWithOwner{
+			Utxo:         provider.BitcoinUtxo{TxHash: input.TxId, Vout: input.Vout, Value: input.Value, ScriptType: a.Type},
+			OwnerDetails: addr.Owner(),
+		})
+	}
+	outputs := []provider.BitcoinOutputDetails{}
+	for i, output := range request.Outputs {
+		script, err := scripts.ScriptFromRaw(formating.HexToBytes(output.ScriptPubKey), false)
+		if err != nil {
+			return nil, fmt.Errorf("output %d: %v", i, err)
+		}
+		if output.Path != "" {
+			addr, err := a.addressAt(output.Path)
+			if err != nil || addr.Address.ToScriptPubKey().ToHex() != output.ScriptPubKey {
+				return nil, fmt.Errorf("change output %d is not paid to the key at %s", i, output.Path)
+			}
+		}
+		outputs = append(outputs, provider.BitcoinOutputDetails{Address: scriptAddress{script: script}, Value: output.Value})
+	}
+	builder := provider.NewBitcoinTransactionBuilder(utxos, outputs, request.Fee, a.network, "", request.EnableRBF)
+	tx, err := builder.BuildTransaction(a.Signer())
+	if err != nil {
+		return nil, err
+	}
+	if err := request.Verify(tx); err != nil {
+		return nil, err
+	}
+	return tx, nil
+}
+
+// addressAt returns the address at the derivation path, a path of the account
+func (a *Account) addressAt(path string) (*AccountAddress, error) {
+	relative := strings.TrimPrefix(path, a.Path+"/")
+	parts := strings.Split(relative, "/")
+	if relative == path || len(parts) != 2 {
+		return nil, fmt.Errorf("path %s is not a path of the account %s", path, a.Path)
+	}
+	chain, err := strconv.Atoi(parts[0])
+	if err != nil || (Chain(chain) != ReceiveChain && Chain(chain) != ChangeChain) {
+		return nil, fmt.Errorf("invalid chain in path %s", path)
+	}
+	index, err := strconv.Atoi(parts[1])
+	if err != nil || index < 0 {
+		return nil, fmt.Errorf("invalid index in path %s", path)
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if err := a.derive(Chain(chain), index); err != nil {
+		return nil, err
+	}
+	return a.chains[chain].addresses[index], nil
+}
+
+// unsignedTemplate returns the transaction without scriptSig nor witness
+func unsignedTemplate(tx *scripts.BtcTransaction) *scripts.BtcTransaction {
+	inputs := make([]*scripts.TxInput, len(tx.Inputs))
+	for i, input := range tx.Inputs {
+		inputs[i] = scripts.NewTxInput(input.TxID, input.TxIndex, input.Sequence)
+	}
+	return scripts.NewBtcTransaction(inputs, tx.Outputs, false, tx.Locktime, tx.Version)
+}
+
+// placeholderSigner returns signatures of the largest size, the built transaction has the size
+// of the signed one
+func placeholderSigner(trDigest []byte, utxo provider.UtxoWithOwner, multiSigPublicKey string) (string, error) {
+	if utxo.Utxo.IsP2tr() {
+		return strings.Repeat("00", 64), nil
+	}
+	return "30" + strings.Repeat("00", 71), nil
+}
+
+// scriptAddress is the output script of a request, paid by the builder like an address
+type scriptAddress struct {
+	script *scripts.Script
+}
+
+func (addr scriptAddress) ToScriptPubKey() *scripts.Script {
+	return addr.script
+}
+
+func (addr scriptAddress) Show(network ...interface{}) string {
+	return addr.script.ToHex()
+}
+
+func (addr scriptAddress) GetType() address.AddressType {
+	return address.AddressType(-1)
+}
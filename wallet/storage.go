@@ -0,0 +1,137 @@
+package wallet
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// Storage persists the state of the wallet as key/value pairs. Implementations must be safe for
+// concurrent use.
+type Storage interface {
+	// Load returns the values of the keys starting with prefix.
+	Load(prefix string) (map[string][]byte, error)
+
+	// Write stores the values of batch atomically, a nil value deletes its key.
+	Write(batch map[string][]byte) error
+}
+
+// MemoryStorage is a Storage keeping the values in memory, for tests and short-lived wallets.
+type MemoryStorage struct {
+	mu     sync.Mutex
+	values map[string][]byte
+}
+
+// NewMemoryStorage returns an empty MemoryStorage.
+func NewMemoryStorage() *MemoryStorage {
+	return &MemoryStorage{values: map[string][]byte{}}
+}
+
+// Load returns the values of the keys starting with prefix.
+func (s *MemoryStorage) Load(prefix string) (map[string][]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return load(s.values, prefix), nil
+}
+
+// Write stores the values of batch, a nil value deletes its key.
+func (s *MemoryStorage) Write(batch map[string][]byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	apply(s.values, batch)
+	return nil
+}
+
+// FileStorage is a Storage keeping the values in a JSON file. The file is rewritten on every
+// write through a temporary file renamed over it, so a crash never leaves a partial state.
+type FileStorage struct {
+	path string
+
+	mu     sync.Mutex
+	values map[string][]byte
+}
+
+// OpenFileStorage opens the storage of the file at path, the file is created by the first write.
+func OpenFileStorage(path string) (*FileStorage, error) {
+	storage := &FileStorage{path: path, values: map[string][]byte{}}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return storage, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &storage.values); err != nil {
+		return nil, err
+	}
+	if storage.values == nil {
+		storage.values = map[string][]byte{}
+	}
+	return storage, nil
+}
+
+// Load returns the values of the keys starting with prefix.
+func (s *FileStorage) Load(prefix string) (map[string][]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return load(s.values, prefix), nil
+}
+
+// Write stores the values of batch and rewrites the file, a nil value deletes its key.
+func (s *FileStorage) Write(batch map[string][]byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	values := make(map[string][]byte, len(s.values)+len(batch))
+	apply(values, s.values)
+	apply(values, batch)
+	data, err := json.Marshal(values)
+	if err != nil {
+		return err
+	}
+	file, err := os.CreateTemp(filepath.Dir(s.path), filepath.Base(s.path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(file.Name())
+	if _, err := file.Write(data); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Sync(); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(file.Name(), s.path); err != nil {
+		return err
+	}
+	s.values = values
+	return nil
+}
+
+// load copies the values of the keys starting with prefix
+func load(values map[string][]byte, prefix string) map[string][]byte {
+	result := map[string][]byte{}
+	for key, value := range values {
+		if strings.HasPrefix(key, prefix) {
+			result[key] = append([]byte{}, value...)
+		}
+	}
+	return result
+}
+
+// apply writes batch to values, a nil value deletes its key
+func apply(values map[string][]byte, batch map[string][]byte) {
+	for key, value := range batch {
+		if value == nil {
+			delete(values, key)
+		} else {
+			values[key] = append([]byte{}, value...)
+		}
+	}
+}
@@ -0,0 +1,647 @@
+// Wallet bookkeeping on top of the providers: the addresses of BIP32 accounts, the unspent
+// outputs of the wallet and their state, persisted in a pluggable Storage.
+package wallet
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/mrtnetwork/bitcoin/provider"
+	"github.com/mrtnetwork/bitcoin/scripts"
+)
+
+// keys of the storage
+const (
+	utxoPrefix  = "utxo/"
+	txPrefix    = "tx/"
+	blockPrefix = "block/"
+)
+
+// Outpoint identifies a transaction output.
+type Outpoint struct {
+	TxId string `json:"txid"`
+	Vout int    `json:"vout"`
+}
+
+func (o Outpoint) String() string {
+	return o.TxId + ":" + strconv.Itoa(o.Vout)
+}
+
+// UtxoState is the state of an output of the wallet.
+type UtxoState int
+
+const (
+	// UtxoUnconfirmed is an unspent output of a transaction of the mempool.
+	UtxoUnconfirmed UtxoState = iota
+
+	// UtxoConfirmed is an unspent output of a transaction included in a block.
+	UtxoConfirmed
+
+	// UtxoSpent is an output spent by a transaction, confirmed or not.
+	UtxoSpent
+)
+
+func (state UtxoState) String() string {
+	switch state {
+	case UtxoUnconfirmed:
+		return "unconfirmed"
+	case UtxoConfirmed:
+		return "confirmed"
+	default:
+		return "spent"
+	}
+}
+
+// Utxo is an output paying a script tracked by the wallet.
+type Utxo struct {
+	Outpoint
+
+	// Value of the output in satoshis.
+	Value *big.Int `json:"value"`
+
+	// ScriptPubKey of the output in hexadecimal.
+	ScriptPubKey string `json:"script"`
+
+	// BlockHeight and BlockHash of the block including the transaction, 0 and empty when
+	// unconfirmed. The hash is unknown for the imported outputs.
+	BlockHeight int    `json:"height,omitempty"`
+	BlockHash   string `json:"hash,omitempty"`
+
+	// SpentBy is the id of the transaction spending the output, empty when unspent.
+	SpentBy string `json:"spent_by,omitempty"`
+
+	// SpentHeight is the height of the block including SpentBy, 0 while it is unconfirmed.
+	SpentHeight int `json:"spent_height,omitempty"`
+
+	// Metadata is the coin control state of the output, returned with it by Spendable.
+	Metadata provider.CoinMetadata `json:"metadata"`
+}
+
+// State returns the state of the output.
+func (utxo *Utxo) State() UtxoState {
+	if utxo.SpentBy != "" {
+		return UtxoSpent
+	}
+	if utxo.BlockHeight > 0 {
+		return UtxoConfirmed
+	}
+	return UtxoUnconfirmed
+}
+
+// Conflict reports an unconfirmed transaction of the wallet double spent by another transaction.
+// The transaction is forgotten with its outputs and the transactions spending them.
+type Conflict struct {
+	// TxId of the transaction double spent.
+	TxId string
+
+	// ReplacedBy is the id of the transaction spending the same outputs.
+	ReplacedBy string
+
+	// Confirmed reports whether ReplacedBy is included in a block, otherwise it replaced TxId in
+	// the mempool.
+	Confirmed bool
+}
+
+// walletTx is a transaction spending or paying the wallet, its inputs are kept to detect the
+// double spends
+type walletTx struct {
+	Inputs    []Outpoint `json:"inputs"`
+	Height    int        `json:"height,omitempty"`
+	BlockHash string     `json:"hash,omitempty"`
+	Label     string     `json:"label,omitempty"`
+}
+
+// UtxoStore keeps the outputs of the scripts tracked by the wallet and follows their state: the
+// transactions of the wallet are added when broadcast, the ones seen in the mempool and the
+// connected blocks update the store. Spends of a broadcast transaction are marked immediately,
+// the transactions double spent are reported as conflicts and the blocks disconnected by a
+// reorganization are rolled back. Every change is written to the storage before returning, an
+// operation whose write fails has no effect.
+type UtxoStore struct {
+	// DustThreshold is the value up to which a new output paying a script that already received
+	// an output is quarantined as a suspected dust attack, provider.DustAttackThreshold by default.
+	// The outputs of a transaction spending outputs of the wallet are its own and never
+	// quarantined. Nil disables the quarantine.
+	DustThreshold *big.Int
+
+	storage Storage
+
+	mu           sync.Mutex
+	owners       map[string]provider.UtxoOwnerDetails
+	utxos        map[Outpoint]*Utxo
+	transactions map[string]*walletTx
+	blocks       map[int]string
+	tip          int
+
+	// spenders maps the outputs spent by the transactions to their id
+	spenders map[Outpoint]string
+
+	// changes are the keys written by the current operation
+	changes map[string][]byte
+}
+
+// NewUtxoStore opens the store persisted in storage.
+func NewUtxoStore(storage Storage) (*UtxoStore, error) {
+	store := &UtxoStore{
+		DustThreshold: big.NewInt(provider.DustAttackThreshold),
+		storage:       storage,
+		owners:        map[string]provider.UtxoOwnerDetails{},
+	}
+	if err := store.load(); err != nil {
+		return nil, err
+	}
+	return store, nil
+}
+
+// load reads the outputs, the transactions and the blocks from the storage, the state of the
+// store is only replaced once everything is read
+func (s *UtxoStore) load() error {
+	utxos := map[Outpoint]*Utxo{}
+	transactions := map[string]*walletTx{}
+	blocks := map[int]string{}
+	spenders := map[Outpoint]string{}
+	tip := 0
+	stored, err := s.storage.Load(utxoPrefix)
+	if err != nil {
+		return err
+	}
+	for key, data := range stored {
+		utxo := &Utxo{}
+		if err := json.Unmarshal(data, utxo); err != nil {
+			return fmt.Errorf("invalid output %s: %v", key, err)
+		}
+		utxos[utxo.Outpoint] = utxo
+	}
+	if stored, err = s.storage.Load(txPrefix); err != nil {
+		return err
+	}
+	for key, data := range stored {
+		transaction := &walletTx{}
+		if err := json.Unmarshal(data, transaction); err != nil {
+			return fmt.Errorf("invalid transaction %s: %v", key, err)
+		}
+		txId := strings.TrimPrefix(key, txPrefix)
+		transactions[txId] = transaction
+		for _, input := range transaction.Inputs {
+			spenders[input] = txId
+		}
+	}
+	if stored, err = s.storage.Load(blockPrefix); err != nil {
+		return err
+	}
+	for key, hash := range stored {
+		height, err := strconv.Atoi(strings.TrimPrefix(key, blockPrefix))
+		if err != nil {
+			return fmt.Errorf("invalid block %s", key)
+		}
+		blocks[height] = string(hash)
+		if height > tip {
+			tip = height
+		}
+	}
+	s.utxos, s.transactions, s.blocks, s.spenders, s.tip = utxos, transactions, blocks, spenders, tip
+	return nil
+}
+
+// Track adds the script of the owner's address to the wallet, Spendable returns its outputs
+// with the owner details. The owners are not persisted, they must be tracked again after opening
+// the store.
+func (s *UtxoStore) Track(owner provider.UtxoOwnerDetails) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.owners[owner.Address.ToScriptPubKey().ToHex()] = owner
+}
+
+// Import adds outputs fetched from a provider, for example to initialize the store with the
+// result of GetAccountUtxo. Their owners are tracked.
+func (s *UtxoStore) Import(utxos provider.UtxoWithOwnerList) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.begin()
+	added := []*Utxo{}
+	for _, utxo := range utxos {
+		script := utxo.OwnerDetails.Address.ToScriptPubKey().ToHex()
+		s.owners[script] = utxo.OwnerDetails
+		outpoint := Outpoint{TxId: utxo.Utxo.TxHash, Vout: utxo.Utxo.Vout}
+		stored, ok := s.utxos[outpoint]
+		if !ok {
+			stored = &Utxo{Outpoint: outpoint, Value: new(big.Int).Set(utxo.Utxo.Value), ScriptPubKey: script, Metadata: utxo.Metadata}
+			s.utxos[outpoint] = stored
+			added = append(added, stored)
+		}
+		if utxo.Utxo.BlockHeight > 0 && stored.BlockHeight == 0 {
+			stored.BlockHeight = utxo.Utxo.BlockHeight
+		}
+		s.putUtxo(stored)
+	}
+	for _, utxo := range added {
+		s.quarantine(utxo)
+		s.putUtxo(utxo)
+	}
+	return s.commit()
+}
+
+// AddTransaction records an unconfirmed transaction, one broadcast by the wallet or seen in the
+// mempool: the outputs it spends are marked spent and its outputs paying the wallet are added.
+// The unconfirmed transactions of the wallet spending the same outputs are replaced by it and
+// returned as conflicts. A transaction spending outputs already spent in a block is ignored.
+func (s *UtxoStore) AddTransaction(tx *scripts.BtcTransaction) ([]Conflict, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.begin()
+	conflicts := s.add(tx.TxId(), tx, 0, "")
+	return conflicts, s.commit()
+}
+
+// ConnectBlock records the transactions of the block connected at height. A block replacing the
+// one known at its height, or below, rolls the store back to the previous height first. A block
+// not extending the known block at the previous height returns an error: Rollback to the height
+// of the fork, then connect the blocks of the new chain.
+func (s *UtxoStore) ConnectBlock(height int, block *provider.Block) ([]Conflict, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if hash, ok := s.blocks[height]; ok && hash == block.Header.Hash {
+		return nil, nil
+	}
+	if previous, ok := s.blocks[height-1]; ok && block.Header.PrevBlock != "" && previous != block.Header.PrevBlock {
+		return nil, fmt.Errorf("block %s does not extend block %s at height %d", block.Header.Hash, previous, height-1)
+	}
+	s.begin()
+	if height <= s.tip {
+		s.rollback(height - 1)
+	}
+	conflicts := []Conflict{}
+	for i, tx := range block.Transactions {
+		txId := tx.TxId()
+		if i < len(block.TxIds) {
+			txId = block.TxIds[i]
+		}
+		conflicts = append(conflicts, s.add(txId, tx, height, block.Header.Hash)...)
+	}
+	s.blocks[height] = block.Header.Hash
+	s.changes[blockKey(height)] = []byte(block.Header.Hash)
+	s.tip = height
+	return conflicts, s.commit()
+}
+
+// Rollback disconnects the blocks above height: their transactions are unconfirmed again and the
+// outputs they spent are spent by unconfirmed transactions.
+func (s *UtxoStore) Rollback(height int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.begin()
+	s.rollback(height)
+	return s.commit()
+}
+
+// SetMetadata replaces the coin control state of the output at outpoint: freeze it, reserve it,
+// label it or release it from the dust quarantine.
+func (s *UtxoStore) SetMetadata(outpoint Outpoint, metadata provider.CoinMetadata) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	utxo, ok := s.utxos[outpoint]
+	if !ok {
+		return fmt.Errorf("unknown output %s", outpoint)
+	}
+	s.begin()
+	utxo.Metadata = metadata
+	s.putUtxo(utxo)
+	return s.commit()
+}
+
+// SetTransactionLabel labels a transaction of the wallet, an empty label removes the label.
+func (s *UtxoStore) SetTransactionLabel(txId string, label string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	transaction, ok := s.transactions[txId]
+	if !ok {
+		return fmt.Errorf("unknown transaction %s", txId)
+	}
+	s.begin()
+	transaction.Label = label
+	s.putTransaction(txId)
+	return s.commit()
+}
+
+// TransactionLabel returns the label of a transaction of the wallet, empty when it has none.
+func (s *UtxoStore) TransactionLabel(txId string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if transaction, ok := s.transactions[txId]; ok {
+		return transaction.Label
+	}
+	return ""
+}
+
+// hasTransaction reports whether the transaction is a transaction of the wallet
+func (s *UtxoStore) hasTransaction(txId string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, ok := s.transactions[txId]
+	return ok
+}
+
+// transactionLabels returns the labels of the transactions of the wallet by id
+func (s *UtxoStore) transactionLabels() map[string]string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	labels := map[string]string{}
+	for txId, transaction := range s.transactions {
+		if transaction.Label != "" {
+			labels[txId] = transaction.Label
+		}
+	}
+	return labels
+}
+
+// Tip returns the height and the hash of the last block connected.
+func (s *UtxoStore) Tip() (int, string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.tip, s.blocks[s.tip]
+}
+
+// Utxo returns the output at outpoint.
+func (s *UtxoStore) Utxo(outpoint Outpoint) (Utxo, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	utxo, ok := s.utxos[outpoint]
+	if !ok {
+		return Utxo{}, false
+	}
+	return *utxo, true
+}
+
+// Utxos returns every output of the wallet, spent ones included, by outpoint.
+func (s *UtxoStore) Utxos() []Utxo {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.list(func(utxo *Utxo) bool { return true })
+}
+
+// Unspent returns the unspent outputs with at least minConf confirmations, 0 includes the
+// unconfirmed ones.
+func (s *UtxoStore) Unspent(minConf int) []Utxo {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.list(func(utxo *Utxo) bool { return utxo.SpentBy == "" && s.confirmations(utxo) >= minConf })
+}
+
+// Spendable returns the unspent outputs of the tracked owners with at least minConf
+// confirmations and their coin control state, ready to be given to
+// provider.NewBitcoinTransactionBuilder which skips the frozen, reserved and quarantined ones.
+func (s *UtxoStore) Spendable(minConf int) provider.UtxoWithOwnerList {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	spendable := provider.UtxoWithOwnerList{}
+	for _, utxo := range s.list(func(utxo *Utxo) bool { return utxo.SpentBy == "" && s.confirmations(utxo) >= minConf }) {
+		owner, ok := s.owners[utxo.ScriptPubKey]
+		if !ok {
+			continue
+		}
+		spendable = append(spendable, provider.UtxoWithOwner{
+			Utxo: provider.BitcoinUtxo{
+				TxHash:      utxo.TxId,
+				Value:       new(big.Int).Set(utxo.Value),
+				Vout:        utxo.Vout,
+				ScriptType:  owner.Address.GetType(),
+				BlockHeight: utxo.BlockHeight,
+			},
+			OwnerDetails: owner,
+			Metadata:     utxo.Metadata,
+		})
+	}
+	return spendable
+}
+
+// Balance returns the values of the unspent outputs, confirmed and unconfirmed.
+func (s *UtxoStore) Balance() (confirmed *big.Int, unconfirmed *big.Int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	confirmed, unconfirmed = big.NewInt(0), big.NewInt(0)
+	for _, utxo := range s.utxos {
+		switch utxo.State() {
+		case UtxoConfirmed:
+			confirmed.Add(confirmed, utxo.Value)
+		case UtxoUnconfirmed:
+			unconfirmed.Add(unconfirmed, utxo.Value)
+		}
+	}
+	return confirmed, unconfirmed
+}
+
+// confirmations returns the number of confirmations of the output, 0 when unconfirmed
+func (s *UtxoStore) confirmations(utxo *Utxo) int {
+	if utxo.BlockHeight == 0 {
+		return 0
+	}
+	if s.tip < utxo.BlockHeight {
+		return 1
+	}
+	return s.tip - utxo.BlockHeight + 1
+}
+
+// list returns copies of the outputs matching filter, by outpoint
+func (s *UtxoStore) list(filter func(utxo *Utxo) bool) []Utxo {
+	result := []Utxo{}
+	for _, utxo := range s.utxos {
+		if filter(utxo) {
+			result = append(result, *utxo)
+		}
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].TxId != result[j].TxId {
+			return result[i].TxId < result[j].TxId
+		}
+		return result[i].Vout < result[j].Vout
+	})
+	return result
+}
+
+// add records a transaction confirmed at height, or unconfirmed with a height of 0
+func (s *UtxoStore) add(txId string, tx *scripts.BtcTransaction, height int, hash string) []Conflict {
+	inputs := make([]Outpoint, len(tx.Inputs))
+	relevant := s.transactions[txId] != nil
+	// a transaction spending outputs of the wallet is its own, its small outputs are not dust
+	own := false
+	for i, input := range tx.Inputs {
+		inputs[i] = Outpoint{TxId: input.TxID, Vout: input.TxIndex}
+		if _, ok := s.utxos[inputs[i]]; ok {
+			relevant, own = true, true
+		}
+		if spender, ok := s.spenders[inputs[i]]; ok && spender != txId {
+			relevant = true
+			// a confirmed spend is only undone by a rollback
+			if height == 0 && s.transactions[spender].Height > 0 {
+				return nil
+			}
+		}
+	}
+	outputs := []int{}
+	for vout, output := range tx.Outputs {
+		if _, ok := s.owners[output.ScriptPubKey.ToHex()]; ok {
+			outputs = append(outputs, vout)
+		}
+	}
+	if !relevant && len(outputs) == 0 {
+		return nil
+	}
+
+	conflicts := []Conflict{}
+	for _, input := range inputs {
+		if spender, ok := s.spenders[input]; ok && spender != txId {
+			conflicts = append(conflicts, s.remove(spender, txId, height > 0)...)
+		}
+	}
+	transaction := &walletTx{Inputs: inputs, Height: height, BlockHash: hash}
+	if previous, ok := s.transactions[txId]; ok {
+		transaction.Label = previous.Label
+	}
+	s.transactions[txId] = transaction
+	s.putTransaction(txId)
+	for _, input := range inputs {
+		s.spenders[input] = txId
+		if utxo, ok := s.utxos[input]; ok {
+			utxo.SpentBy, utxo.SpentHeight = txId, height
+			s.putUtxo(utxo)
+		}
+	}
+	for _, vout := range outputs {
+		outpoint := Outpoint{TxId: txId, Vout: vout}
+		utxo, ok := s.utxos[outpoint]
+		if !ok {
+			utxo = &Utxo{Outpoint: outpoint, Value: new(big.Int).Set(tx.Outputs[vout].Amount), ScriptPubKey: tx.Outputs[vout].ScriptPubKey.ToHex()}
+			s.utxos[outpoint] = utxo
+			if !own {
+				s.quarantine(utxo)
+			}
+		}
+		utxo.BlockHeight, utxo.BlockHash = height, hash
+		s.putUtxo(utxo)
+	}
+	return conflicts
+}
+
+// remove forgets an unconfirmed transaction double spent by another one, with its outputs and
+// the transactions spending them
+func (s *UtxoStore) remove(txId string, replacedBy string, confirmed bool) []Conflict {
+	transaction, ok := s.transactions[txId]
+	if !ok || transaction.Height > 0 {
+		return nil
+	}
+	delete(s.transactions, txId)
+	s.changes[txPrefix+txId] = nil
+	conflicts := []Conflict{{TxId: txId, ReplacedBy: replacedBy, Confirmed: confirmed}}
+	for outpoint, utxo := range s.utxos {
+		if outpoint.TxId != txId {
+			continue
+		}
+		if utxo.SpentBy != "" {
+			conflicts = append(conflicts, s.remove(utxo.SpentBy, replacedBy, confirmed)...)
+		}
+		delete(s.utxos, outpoint)
+		s.changes[utxoKey(outpoint)] = nil
+	}
+	for _, input := range transaction.Inputs {
+		if s.spenders[input] == txId {
+			delete(s.spenders, input)
+		}
+		if utxo, ok := s.utxos[input]; ok && utxo.SpentBy == txId {
+			utxo.SpentBy, utxo.SpentHeight = "", 0
+			s.putUtxo(utxo)
+		}
+	}
+	return conflicts
+}
+
+// quarantine marks a new output as a suspected dust attack when it is a tiny value paying a script
+// that received another output
+func (s *UtxoStore) quarantine(utxo *Utxo) {
+	if s.DustThreshold == nil || utxo.Value.Cmp(s.DustThreshold) > 0 {
+		return
+	}
+	for outpoint, other := range s.utxos {
+		if outpoint != utxo.Outpoint && other.ScriptPubKey == utxo.ScriptPubKey {
+			utxo.Metadata.Quarantined = true
+			return
+		}
+	}
+}
+
+// rollback disconnects the blocks above height
+func (s *UtxoStore) rollback(height int) {
+	for blockHeight := range s.blocks {
+		if blockHeight > height {
+			delete(s.blocks, blockHeight)
+			s.changes[blockKey(blockHeight)] = nil
+		}
+	}
+	for txId, transaction := range s.transactions {
+		if transaction.Height > height {
+			transaction.Height, transaction.BlockHash = 0, ""
+			s.putTransaction(txId)
+		}
+	}
+	for _, utxo := range s.utxos {
+		changed := false
+		if utxo.BlockHeight > height {
+			utxo.BlockHeight, utxo.BlockHash = 0, ""
+			changed = true
+		}
+		if utxo.SpentHeight > height {
+			utxo.SpentHeight = 0
+			changed = true
+		}
+		if changed {
+			s.putUtxo(utxo)
+		}
+	}
+	if s.tip > height {
+		s.tip = height
+	}
+}
+
+func (s *UtxoStore) begin() {
+	s.changes = map[string][]byte{}
+}
+
+// commit writes the changes of the operation to the storage. The operation already changed the
+// state of the store, it is read again from the storage when the write fails.
+func (s *UtxoStore) commit() error {
+	changes := s.changes
+	s.changes = nil
+	if len(changes) == 0 {
+		return nil
+	}
+	if err := s.storage.Write(changes); err != nil {
+		if loadErr := s.load(); loadErr != nil {
+			return fmt.Errorf("%v, reloading the store: %v", err, loadErr)
+		}
+		return err
+	}
+	return nil
+}
+
+func (s *UtxoStore) putUtxo(utxo *Utxo) {
+	data, _ := json.Marshal(utxo)
+	s.changes[utxoKey(utxo.Outpoint)] = data
+}
+
+func (s *UtxoStore) putTransaction(txId string) {
+	data, _ := json.Marshal(s.transactions[txId])
+	s.changes[txPrefix+txId] = data
+}
+
+func utxoKey(outpoint Outpoint) string {
+	return utxoPrefix + outpoint.String()
+}
+
+// blockKey pads the height, the keys of the blocks sort by height
+func blockKey(height int) string {
+	return fmt.Sprintf("%s%010d", blockPrefix, height)
+}
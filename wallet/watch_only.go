@@ -0,0 +1,167 @@
+package wallet
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"sort"
+
+	"github.com/mrtnetwork/bitcoin/provider"
+	"github.com/mrtnetwork/bitcoin/scripts"
+)
+
+// changeDustLimit is the smallest change output created, a smaller change is left to the fee
+const changeDustLimit = 546
+
+// WatchOnlyWallet follows an account without its private keys, created from an extended public
+// key or a descriptor: it tracks the balance and the UTXOs of the account, builds the signing
+// requests handed to the offline signer, verifies the signed transactions against them and
+// broadcasts them.
+type WatchOnlyWallet struct {
+	Account  *Account
+	Store    *UtxoStore
+	Provider provider.ChainProvider
+
+	// MinConf is the number of confirmations of the UTXOs spent, 1 by default.
+	MinConf int
+
+	// EnableRBF signals the replaceability of the transactions built, true by default.
+	EnableRBF bool
+}
+
+// NewWatchOnlyWallet follows the account, its UTXOs are kept in store.
+func NewWatchOnlyWallet(account *Account, store *UtxoStore, chainProvider provider.ChainProvider) *WatchOnlyWallet {
+	w := &WatchOnlyWallet{Account: account, Store: store, Provider: chainProvider, MinConf: 1, EnableRBF: true}
+	w.track()
+	return w
+}
+
+// Sync restores the used addresses of the account from the history and imports their UTXOs in
+// the store.
+func (w *WatchOnlyWallet) Sync(ctx context.Context) error {
+	if err := w.Account.Discover(ctx, w.Provider); err != nil {
+		return err
+	}
+	w.track()
+	for _, chain := range []Chain{ReceiveChain, ChangeChain} {
+		for _, addr := range w.Account.Addresses(chain) {
+			if !addr.Used {
+				continue
+			}
+			utxos, err := w.Provider.GetAccountUtxo(ctx, addr.Owner())
+			if err != nil {
+				return err
+			}
+			if err := w.Store.Import(utxos); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Balance returns the confirmed and unconfirmed balance of the account.
+func (w *WatchOnlyWallet) Balance() (confirmed *big.Int, unconfirmed *big.Int) {
+	return w.Store.Balance()
+}
+
+// Utxos returns the spendable UTXOs of the account with at least MinConf confirmations.
+func (w *WatchOnlyWallet) Utxos() provider.UtxoWithOwnerList {
+	return w.Store.Spendable(w.MinConf)
+}
+
+// CreateTransaction selects the UTXOs allowed by coin control, largest first, to pay the outputs
+// at the fee rate, and returns the signing request of the transaction. The change goes to a
+// fresh change address of the account.
+func (w *WatchOnlyWallet) CreateTransaction(outputs []provider.BitcoinOutputDetails, feeRate provider.FeeRate, control provider.CoinControl) (*SigningRequest, error) {
+	amount := big.NewInt(0)
+	for _, output := range outputs {
+		amount.Add(amount, output.Value)
+	}
+	change, err := w.Account.ChangeAddress()
+	if err != nil {
+		return nil, err
+	}
+	candidates := w.Utxos().Select(control)
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return candidates[i].Utxo.Value.Cmp(candidates[j].Utxo.Value) > 0
+	})
+	withChange := append(append([]provider.BitcoinOutputDetails{}, outputs...), provider.BitcoinOutputDetails{Address: change.Address, Value: big.NewInt(0)})
+	for count := 1; count <= len(candidates); count++ {
+		selected := candidates[:count]
+		total := selected.SumOfUtxosValue()
+		fee, err := w.fee(selected, withChange, feeRate, control)
+		if err != nil {
+			return nil, err
+		}
+		remaining := new(big.Int).Sub(total, amount)
+		if rest := new(big.Int).Sub(remaining, fee); rest.Cmp(big.NewInt(changeDustLimit)) >= 0 {
+			withChange[len(withChange)-1].Value = rest
+			return newSigningRequest(w.Account, w.builder(selected, withChange, fee, control), change.Address.ToScriptPubKey().ToHex())
+		}
+		fee, err = w.fee(selected, outputs, feeRate, control)
+		if err != nil {
+			return nil, err
+		}
+		if remaining.Cmp(fee) >= 0 {
+			// the change would be dust, it is left to the miners
+			return newSigningRequest(w.Account, w.builder(selected, outputs, remaining, control), "")
+		}
+	}
+	return nil, fmt.Errorf("insufficient funds: %d spendable utxos for %v satoshis and the fee", len(candidates), amount)
+}
+
+// Broadcast verifies the transaction signed offline against its request, broadcasts it and
+// records it in the store. signed is the serialized transaction in hexadecimal.
+func (w *WatchOnlyWallet) Broadcast(ctx context.Context, request *SigningRequest, signed string) (string, error) {
+	tx, err := scripts.BtcTransactionFromRaw(signed)
+	if err != nil {
+		return "", err
+	}
+	if err := request.Verify(tx); err != nil {
+		return "", err
+	}
+	txId, err := w.Provider.SendRawTransaction(ctx, tx.Serialize())
+	if err != nil {
+		return "", err
+	}
+	for _, output := range tx.Outputs {
+		if _, _, err := w.Account.MarkUsed(output.ScriptPubKey.ToHex()); err != nil {
+			return txId, err
+		}
+	}
+	w.track()
+	if _, err := w.Store.AddTransaction(tx); err != nil {
+		return txId, err
+	}
+	return txId, nil
+}
+
+// track tracks the derived addresses of the account in the store
+func (w *WatchOnlyWallet) track() {
+	for _, owner := range w.Account.Owners() {
+		w.Store.Track(owner)
+	}
+}
+
+func (w *WatchOnlyWallet) builder(utxos provider.UtxoWithOwnerList, outputs []provider.BitcoinOutputDetails, fee *big.Int, control provider.CoinControl) *provider.BitcoinTransactionBuilder {
+	builder := provider.NewBitcoinTransactionBuilder(utxos, outputs, fee, w.Account.network, "", w.EnableRBF)
+	builder.CoinControl = control
+	return builder
+}
+
+// fee returns the fee of the transaction at the fee rate, from the size of the transaction
+// signed with placeholder signatures
+func (w *WatchOnlyWallet) fee(utxos provider.UtxoWithOwnerList, outputs []provider.BitcoinOutputDetails, feeRate provider.FeeRate, control provider.CoinControl) (*big.Int, error) {
+	builder := w.builder(utxos, outputs, big.NewInt(0), control)
+	spent := big.NewInt(0)
+	for _, output := range outputs {
+		spent.Add(spent, output.Value)
+	}
+	builder.FEE = new(big.Int).Sub(utxos.SumOfUtxosValue(), spent)
+	tx, err := builder.BuildTransaction(placeholderSigner)
+	if err != nil {
+		return nil, err
+	}
+	return feeRate.Fee(tx.GetVSize()), nil
+}